@@ -26,6 +26,27 @@ type Config struct {
 	S3AccessKey              string        `yaml:"s3AccessKey"`
 	S3SecretAccessKey        string        `yaml:"s3SecretAccessKey"`
 	S3OpsRetries             int           `yaml:"s3OpsRetries"`
+	ExportsReconcileSchedule string        `yaml:"exportsReconcileSchedule"`
+	ExportsReconcileAutoFix  bool          `yaml:"exportsReconcileAutoFix"`
+	DeviceTrashRetention     time.Duration `yaml:"deviceTrashRetention"`
+	ManagementAddressTag     string        `yaml:"managementAddressTag"`
+	DiscoveryRanges          []string      `yaml:"discoveryRanges"`
+	DiscoverySchedule        string        `yaml:"discoverySchedule"`
+	DiscoveryNeighbors       bool          `yaml:"discoveryNeighbors"`
+	DiscoveryCredentials     []string      `yaml:"discoveryCredentials"`
+	DiscoveryTimeout         time.Duration `yaml:"discoveryTimeout"`
+	DiscoveryConcurrency     int           `yaml:"discoveryConcurrency"`
+	VaultAddress             string        `yaml:"vaultAddress"`
+	VaultToken               string        `yaml:"vaultToken"`
+	VaultNamespace           string        `yaml:"vaultNamespace"`
+	SecretEnvPrefix          string        `yaml:"secretEnvPrefix"`
+	SecretFilesDir           string        `yaml:"secretFilesDir"`
+	UpgradeRebootTimeout     time.Duration `yaml:"upgradeRebootTimeout"`
+	WirelessClients          bool          `yaml:"wirelessClients"`
+	WirelessClientsRetention time.Duration `yaml:"wirelessClientsRetention"`
+	ApiIdleTimeout           time.Duration `yaml:"apiIdleTimeout"`
+	ApiTimeout               time.Duration `yaml:"apiTimeout"`
+	SshTimeout               time.Duration `yaml:"sshTimeout"`
 }
 
 func configProcessError(err error) {
@@ -44,6 +65,39 @@ func (cfg *Config) setDefaults() {
 	if cfg.deviceExportCronSchedule == "" {
 		cfg.deviceExportCronSchedule = "0 * * * *"
 	}
+	if cfg.ExportsReconcileSchedule == "" {
+		cfg.ExportsReconcileSchedule = "30 3 * * *"
+	}
+	if cfg.DeviceTrashRetention == 0 {
+		cfg.DeviceTrashRetention = time.Hour * 24 * 30
+	}
+	if cfg.ManagementAddressTag == "" {
+		cfg.ManagementAddressTag = "MGMT"
+	}
+	if cfg.DiscoveryTimeout == 0 {
+		cfg.DiscoveryTimeout = time.Second
+	}
+	if cfg.DiscoveryConcurrency == 0 {
+		cfg.DiscoveryConcurrency = 64
+	}
+	if cfg.UpgradeRebootTimeout == 0 {
+		cfg.UpgradeRebootTimeout = 10 * time.Minute
+	}
+	if cfg.WirelessClientsRetention == 0 {
+		cfg.WirelessClientsRetention = 7 * 24 * time.Hour
+	}
+	if cfg.ApiIdleTimeout == 0 {
+		cfg.ApiIdleTimeout = time.Minute
+	}
+	if cfg.SecretEnvPrefix == "" {
+		cfg.SecretEnvPrefix = "MIKROMANAGER_SECRET_"
+	}
+	if cfg.ApiTimeout == 0 {
+		cfg.ApiTimeout = 30 * time.Second
+	}
+	if cfg.SshTimeout == 0 {
+		cfg.SshTimeout = 5 * time.Minute
+	}
 	if cfg.DbPath == "" {
 		cfg.DbPath = "database/mikromanager.db"
 	}
@@ -75,6 +129,15 @@ func (cfg *Config) setDefaults() {
 	if envSecretAccessKey != "" {
 		cfg.S3SecretAccessKey = envSecretAccessKey
 	}
+	// check if VAULT_ADDR and VAULT_TOKEN are set
+	envVaultAddress := os.Getenv("VAULT_ADDR")
+	if envVaultAddress != "" {
+		cfg.VaultAddress = envVaultAddress
+	}
+	envVaultToken := os.Getenv("VAULT_TOKEN")
+	if envVaultToken != "" {
+		cfg.VaultToken = envVaultToken
+	}
 }
 
 func readConfigFile(path string) *Config {
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CollectorSetting overrides the default settings of a poller collector for the devices of a
+// group.
+type CollectorSetting struct {
+	Base
+	GroupId   string `gorm:"index"`
+	Collector string
+	Enabled   bool
+	// Interval is the minimum time between two runs of the collector, it runs on every poll if
+	// zero
+	Interval time.Duration
+	// Timeout limits the time of every device request of the collector, the requests are not
+	// limited if zero
+	Timeout time.Duration
+}
+
+// GetByGroupId retrieves the collector settings of the group with the given ID ordered by
+// collector name. It returns an error if the retrieval fails.
+func (s *CollectorSetting) GetByGroupId(db *DB, groupId string) ([]*CollectorSetting, error) {
+	var list []*CollectorSetting
+	return list, db.DB.Order("collector").Find(&list, "group_id = ?", groupId).Error
+}
+
+// GetAll retrieves the collector settings of all the groups. It returns an error if the
+// retrieval fails.
+func (s *CollectorSetting) GetAll(db *DB) ([]*CollectorSetting, error) {
+	var list []*CollectorSetting
+	return list, db.DB.Find(&list).Error
+}
+
+// SetCollectorSettings replaces the collector settings of the group with the given ID in a
+// single transaction. It returns an error if any of the database operations fail.
+func SetCollectorSettings(db *DB, groupId string, settings []*CollectorSetting) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("group_id = ?", groupId).Delete(&CollectorSetting{}).Error
+		if err != nil {
+			return err
+		}
+		for _, s := range settings {
+			s.Id = ""
+			s.GroupId = groupId
+		}
+		if len(settings) == 0 {
+			return nil
+		}
+		return tx.Create(&settings).Error
+	})
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetCollectorSettings(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setting := &CollectorSetting{}
+	err = SetCollectorSettings(db, "group-1", []*CollectorSetting{
+		{Collector: "routes", Enabled: false},
+		{Collector: "interfaces", Enabled: true, Interval: time.Hour, Timeout: 5 * time.Second},
+	})
+	assert.NoError(t, err)
+	err = SetCollectorSettings(db, "group-2", []*CollectorSetting{{Collector: "arp", Enabled: true}})
+	assert.NoError(t, err)
+
+	list, err := setting.GetByGroupId(db, "group-1")
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "interfaces", list[0].Collector)
+	assert.Equal(t, time.Hour, list[0].Interval)
+	assert.Equal(t, 5*time.Second, list[0].Timeout)
+	assert.False(t, list[1].Enabled)
+
+	all, err := setting.GetAll(db)
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	err = SetCollectorSettings(db, "group-1", nil)
+	assert.NoError(t, err)
+	list, err = setting.GetByGroupId(db, "group-1")
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
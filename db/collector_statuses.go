@@ -0,0 +1,44 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CollectorStatus holds the outcome of the last run of a poller collector on a device.
+type CollectorStatus struct {
+	Base
+	DeviceId  string `gorm:"index"`
+	Collector string
+	RanAt     time.Time
+	Duration  time.Duration
+	Succeeded bool
+	Error     string
+}
+
+// GetByDeviceId retrieves the collector statuses of the device with the given ID ordered by
+// collector name. It returns an error if the retrieval fails.
+func (s *CollectorStatus) GetByDeviceId(db *DB, deviceId string) ([]*CollectorStatus, error) {
+	var list []*CollectorStatus
+	return list, db.DB.Order("collector").Find(&list, "device_id = ?", deviceId).Error
+}
+
+// Save will replace the status of the same device and collector with the current object's
+// values in a single transaction. It returns an error if any of the database operations fail.
+func (s *CollectorStatus) Save(db *DB) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("device_id = ? AND collector = ?", s.DeviceId, s.Collector).Delete(&CollectorStatus{}).Error
+		if err != nil {
+			return err
+		}
+		s.Id = ""
+		return tx.Create(&s).Error
+	})
+}
+
+// DeleteByDeviceId deletes all the collector statuses of the device with the given ID. It
+// returns an error if the deletion fails.
+func (s *CollectorStatus) DeleteByDeviceId(db *DB, deviceId string) error {
+	return db.DB.Where("device_id = ?", deviceId).Delete(&CollectorStatus{}).Error
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectorStatusSave(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := &CollectorStatus{}
+	now := time.Now()
+	for _, s := range []*CollectorStatus{
+		{DeviceId: "device-1", Collector: "routes", RanAt: now.Add(-time.Minute), Error: "timeout"},
+		{DeviceId: "device-1", Collector: "arp", RanAt: now, Succeeded: true},
+		{DeviceId: "device-1", Collector: "routes", RanAt: now, Succeeded: true, Duration: time.Second},
+		{DeviceId: "device-2", Collector: "routes", RanAt: now},
+	} {
+		err = s.Save(db)
+		assert.NoError(t, err)
+	}
+
+	// the status of the same collector is replaced
+	list, err := status.GetByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "arp", list[0].Collector)
+	assert.Equal(t, "routes", list[1].Collector)
+	assert.True(t, list[1].Succeeded)
+	assert.Empty(t, list[1].Error)
+	assert.Equal(t, time.Second, list[1].Duration)
+
+	err = status.DeleteByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	list, err = status.GetByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+	list, err = status.GetByDeviceId(db, "device-2")
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+}
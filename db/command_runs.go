@@ -0,0 +1,115 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	CommandTransportSsh = "ssh"
+	CommandTransportApi = "api"
+
+	CommandRunning   = "running"
+	CommandFinished  = "finished"
+	CommandSucceeded = "succeeded"
+	CommandFailed    = "failed"
+)
+
+// CommandRun is an ad-hoc command run on a number of devices, the runs are kept for audit.
+type CommandRun struct {
+	Base
+	// UserId and Username identify the user who ran the command, the username is kept in case
+	// the user is deleted
+	UserId    string `gorm:"index"`
+	Username  string
+	Transport string
+	Command   string
+	// Target describes the selected devices, e.g. the group name
+	Target string
+	// TemplateId references the configuration template applied by the run, if any
+	TemplateId string
+	Status     string
+	FinishedAt *time.Time
+	Results    []*CommandResult
+}
+
+// CommandResult is the outcome of a command run on a single device.
+type CommandResult struct {
+	Base
+	CommandRunId string `gorm:"index"`
+	DeviceId     string `gorm:"index"`
+	Device       *Device
+	// DeviceAddress is kept in case the device is deleted
+	DeviceAddress string
+	// Script is the command run on the device when it differs from the command of the run,
+	// e.g. a configuration template rendered for the device
+	Script     string
+	Status     string
+	Output     string
+	Error      string
+	FinishedAt *time.Time
+}
+
+// Finished returns true if the command finished on all the devices.
+func (r *CommandRun) Finished() bool {
+	return r.Status == CommandFinished
+}
+
+// Count returns the number of devices with the given command result status.
+func (r *CommandRun) Count(status string) int {
+	var count int
+	for _, result := range r.Results {
+		if result.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Create will create a new command run entry in the database along with its results. It returns
+// an error if the creation fails.
+func (r *CommandRun) Create(db *DB) error {
+	return db.DB.Omit("Results.Device").Create(&r).Error
+}
+
+// Save will update the command run entry in the database with the current object's values, the
+// results are not updated. It returns an error if the update fails.
+func (r *CommandRun) Save(db *DB) error {
+	return db.DB.Omit("Results").Save(&r).Error
+}
+
+// GetById fetches a command run entry from the database using the current object's ID, including
+// its results and their devices. It returns an error if the fetch fails.
+func (r *CommandRun) GetById(db *DB) error {
+	return db.DB.Preload("Results", func(tx *gorm.DB) *gorm.DB { return tx.Order("device_address") }).
+		Preload("Results.Device").
+		First(&r, "id = ?", r.Id).Error
+}
+
+// GetLatest retrieves up to limit latest command runs, including their results without the
+// output and scripts. It returns an error if the retrieval fails.
+func (r *CommandRun) GetLatest(db *DB, limit int) ([]*CommandRun, error) {
+	var list []*CommandRun
+	return list, db.DB.Preload("Results", func(tx *gorm.DB) *gorm.DB { return tx.Omit("output", "script") }).
+		Order("created_at desc").Limit(limit).Find(&list).Error
+}
+
+// FailUnfinished marks the command runs and results that were interrupted, e.g. by a restart,
+// as finished and failed. It returns an error if the update fails.
+func (r *CommandRun) FailUnfinished(db *DB) error {
+	now := time.Now()
+	err := db.DB.Model(&CommandResult{}).Where("status = ?", CommandRunning).
+		Updates(map[string]any{"status": CommandFailed, "error": "interrupted", "finished_at": &now}).Error
+	if err != nil {
+		return err
+	}
+	return db.DB.Model(&CommandRun{}).Where("status = ?", CommandRunning).
+		Updates(map[string]any{"status": CommandFinished, "finished_at": &now}).Error
+}
+
+// Save will update the command result entry in the database with the current object's values.
+// It returns an error if the update fails.
+func (r *CommandResult) Save(db *DB) error {
+	return db.DB.Omit("Device").Save(&r).Error
+}
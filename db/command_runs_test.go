@@ -0,0 +1,73 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandRuns(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device := &Device{Address: "10.0.0.1"}
+	err = device.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := &CommandRun{
+		Username:  "admin",
+		Transport: CommandTransportSsh,
+		Command:   "/ip address print",
+		Status:    CommandRunning,
+		Results: []*CommandResult{
+			{DeviceId: device.Id, DeviceAddress: device.Address, Status: CommandRunning},
+			{DeviceId: "gone", DeviceAddress: "10.0.0.2", Status: CommandRunning},
+		},
+	}
+	err = run.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEmpty(t, run.Results[0].Id)
+
+	run.Results[0].Status = CommandSucceeded
+	run.Results[0].Output = "output"
+	err = run.Results[0].Save(db)
+	assert.NoError(t, err)
+
+	// the runs interrupted by a restart are finished
+	err = run.FailUnfinished(db)
+	assert.NoError(t, err)
+
+	fetched := &CommandRun{}
+	fetched.Id = run.Id
+	err = fetched.GetById(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, fetched.Finished())
+	assert.NotNil(t, fetched.FinishedAt)
+	assert.Len(t, fetched.Results, 2)
+	assert.Equal(t, device.Address, fetched.Results[0].Device.Address)
+	assert.Equal(t, "output", fetched.Results[0].Output)
+	assert.Nil(t, fetched.Results[1].Device)
+	assert.Equal(t, "interrupted", fetched.Results[1].Error)
+	assert.Equal(t, 1, fetched.Count(CommandSucceeded))
+	assert.Equal(t, 1, fetched.Count(CommandFailed))
+
+	latest, err := run.GetLatest(db, 10)
+	assert.NoError(t, err)
+	assert.Len(t, latest, 1)
+	assert.Len(t, latest[0].Results, 2)
+	// the output is not loaded for the history
+	assert.Empty(t, latest[0].Results[0].Output)
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// ComplianceRuleContains requires the export, or its section, to match the pattern
+	ComplianceRuleContains = "contains"
+	// ComplianceRuleNotContains requires the export, or its section, not to match the pattern
+	ComplianceRuleNotContains = "not-contains"
+	// ComplianceRuleSection requires the section to be present in the export
+	ComplianceRuleSection = "section"
+)
+
+var ComplianceRuleKinds = []string{ComplianceRuleContains, ComplianceRuleNotContains, ComplianceRuleSection}
+
+type CompliancePolicy struct {
+	Base
+	Name        string `gorm:"unique"`
+	Description string
+	// GroupId limits the policy to the members of the group, the policy applies to all the
+	// devices if empty
+	GroupId string `gorm:"index"`
+	Group   *DeviceGroup
+	Rules   []*ComplianceRule `gorm:"foreignKey:PolicyId"`
+}
+
+type ComplianceRule struct {
+	Base
+	PolicyId string `gorm:"index"`
+	Kind     string
+	// Section limits the rule to a section of the export, e.g. "/ip service"
+	Section string
+	// Pattern is a regular expression matched in the multi-line mode
+	Pattern string
+}
+
+type ComplianceResult struct {
+	Base
+	DeviceId string `gorm:"index"`
+	Device   *Device
+	PolicyId string `gorm:"index"`
+	Policy   *CompliancePolicy
+	// ExportId references the export the policy was evaluated against
+	ExportId string
+	Passed   bool
+	// Violations holds the descriptions of the failed rules, one per line
+	Violations string
+}
+
+// ViolationList returns the descriptions of the failed rules.
+func (r *ComplianceResult) ViolationList() []string {
+	if r.Violations == "" {
+		return nil
+	}
+	return strings.Split(r.Violations, "\n")
+}
+
+// Create will create a new compliance policy entry in the database along with its rules. It
+// returns an error if the creation fails.
+func (p *CompliancePolicy) Create(db *DB) error {
+	return db.DB.Omit("Group").Create(&p).Error
+}
+
+// Update will update the compliance policy entry in the database with the current object's
+// values, the rules of the policy are replaced. It returns an error if the update fails.
+func (p *CompliancePolicy) Update(db *DB) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("policy_id = ?", p.Id).Delete(&ComplianceRule{}).Error
+		if err != nil {
+			return err
+		}
+		for _, rule := range p.Rules {
+			rule.Id = ""
+			rule.PolicyId = p.Id
+		}
+		return tx.Omit("Group").Save(&p).Error
+	})
+}
+
+// Delete will delete the compliance policy entry from the database that matches the current
+// object's ID along with its rules and results. It returns an error if the deletion fails.
+func (p *CompliancePolicy) Delete(db *DB) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("policy_id = ?", p.Id).Delete(&ComplianceRule{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("policy_id = ?", p.Id).Delete(&ComplianceResult{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&p).Error
+	})
+}
+
+// GetById fetches a compliance policy entry from the database using the current object's ID,
+// including its group and rules. It returns an error if the fetch fails.
+func (p *CompliancePolicy) GetById(db *DB) error {
+	return db.DB.Preload("Group").Preload("Rules").First(&p, "id = ?", p.Id).Error
+}
+
+// GetAll retrieves all compliance policy entries ordered by name, including their groups and
+// rules. It returns an error if the retrieval fails.
+func (p *CompliancePolicy) GetAll(db *DB) ([]*CompliancePolicy, error) {
+	var list []*CompliancePolicy
+	return list, db.DB.Preload("Group").Preload("Rules").Order("name").Find(&list).Error
+}
+
+// GetByDeviceId retrieves the compliance results of the device with the given ID, including
+// their policies. It returns an error if the retrieval fails.
+func (r *ComplianceResult) GetByDeviceId(db *DB, deviceId string) ([]*ComplianceResult, error) {
+	var list []*ComplianceResult
+	return list, db.DB.Preload("Policy").Where("device_id = ?", deviceId).Find(&list).Error
+}
+
+// GetAll retrieves the compliance results of all the devices, including the devices and the
+// policies. It returns an error if the retrieval fails.
+func (r *ComplianceResult) GetAll(db *DB) ([]*ComplianceResult, error) {
+	var list []*ComplianceResult
+	return list, db.DB.Preload("Device").Preload("Policy").Find(&list).Error
+}
+
+// DeleteByDeviceId deletes all the compliance results of the device with the given ID. It
+// returns an error if the deletion fails.
+func (r *ComplianceResult) DeleteByDeviceId(db *DB, deviceId string) error {
+	return db.DB.Where("device_id = ?", deviceId).Delete(&r).Error
+}
+
+// ReplaceComplianceResults replaces the compliance results of the device with the given ID in a
+// single transaction. It returns an error if any of the database operations fail.
+func ReplaceComplianceResults(db *DB, deviceId string, results []*ComplianceResult) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("device_id = ?", deviceId).Delete(&ComplianceResult{}).Error
+		if err != nil {
+			return err
+		}
+		for _, r := range results {
+			r.Id = ""
+			r.DeviceId = deviceId
+		}
+		if len(results) == 0 {
+			return nil
+		}
+		return tx.Omit("Device", "Policy").Create(&results).Error
+	})
+}
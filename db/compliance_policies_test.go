@@ -0,0 +1,80 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompliancePolicies(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device := &Device{Address: "10.0.0.1"}
+	err = device.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &CompliancePolicy{
+		Name: "services",
+		Rules: []*ComplianceRule{
+			{Kind: ComplianceRuleSection, Section: "/ip service"},
+			{Kind: ComplianceRuleContains, Section: "/ip service", Pattern: "set telnet disabled=yes"},
+		},
+	}
+	err = policy.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the rules are replaced on update
+	policy.Rules = []*ComplianceRule{{Kind: ComplianceRuleNotContains, Pattern: "set ftp disabled=no"}}
+	err = policy.Update(db)
+	assert.NoError(t, err)
+
+	fetched := &CompliancePolicy{}
+	fetched.Id = policy.Id
+	err = fetched.GetById(db)
+	assert.NoError(t, err)
+	assert.Len(t, fetched.Rules, 1)
+	assert.Equal(t, ComplianceRuleNotContains, fetched.Rules[0].Kind)
+
+	err = ReplaceComplianceResults(db, device.Id, []*ComplianceResult{
+		{PolicyId: policy.Id, Passed: false, Violations: "a\nb"},
+	})
+	assert.NoError(t, err)
+	err = ReplaceComplianceResults(db, device.Id, []*ComplianceResult{
+		{PolicyId: policy.Id, Passed: false, Violations: "must not contain"},
+	})
+	assert.NoError(t, err)
+
+	result := &ComplianceResult{}
+	results, err := result.GetByDeviceId(db, device.Id)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "services", results[0].Policy.Name)
+	assert.Equal(t, []string{"must not contain"}, results[0].ViolationList())
+
+	all, err := result.GetAll(db)
+	assert.NoError(t, err)
+	assert.Len(t, all, 1)
+	assert.Equal(t, device.Address, all[0].Device.Address)
+
+	// the results and the rules are deleted along with the policy
+	err = policy.Delete(db)
+	assert.NoError(t, err)
+	all, err = result.GetAll(db)
+	assert.NoError(t, err)
+	assert.Empty(t, all)
+	var rules int64
+	db.DB.Model(&ComplianceRule{}).Count(&rules)
+	assert.Zero(t, rules)
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
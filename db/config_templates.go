@@ -0,0 +1,40 @@
+package db
+
+type ConfigTemplate struct {
+	Base
+	Name        string `gorm:"unique"`
+	Description string
+	// Body is a Go template of the RouterOS script, rendered for every device
+	Body string
+}
+
+// Create will create a new configuration template entry in the database with the current
+// object's values. It returns an error if the creation fails.
+func (t *ConfigTemplate) Create(db *DB) error {
+	return db.DB.Create(&t).Error
+}
+
+// Save will update the configuration template entry in the database with the current object's
+// values. It returns an error if the update fails.
+func (t *ConfigTemplate) Save(db *DB) error {
+	return db.DB.Save(&t).Error
+}
+
+// Delete will delete the configuration template entry from the database that matches the
+// current object's ID. It returns an error if the deletion fails.
+func (t *ConfigTemplate) Delete(db *DB) error {
+	return db.DB.Delete(&t).Error
+}
+
+// GetById fetches a configuration template entry from the database using the current object's
+// ID. It returns an error if the fetch fails.
+func (t *ConfigTemplate) GetById(db *DB) error {
+	return db.DB.First(&t, "id = ?", t.Id).Error
+}
+
+// GetAll retrieves all configuration template entries ordered by name. It returns an error if
+// the retrieval fails.
+func (t *ConfigTemplate) GetAll(db *DB) ([]*ConfigTemplate, error) {
+	var list []*ConfigTemplate
+	return list, db.DB.Order("name").Find(&list).Error
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigTemplates(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"ntp", "dns"} {
+		tmpl := &ConfigTemplate{Name: name, Body: "/system ntp client set enabled=yes"}
+		err = tmpl.Create(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the names are unique
+	err = (&ConfigTemplate{Name: "ntp", Body: "/"}).Create(db)
+	assert.Error(t, err)
+
+	tmpl := &ConfigTemplate{}
+	list, err := tmpl.GetAll(db)
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "dns", list[0].Name)
+
+	list[1].Description = "NTP client"
+	err = list[1].Save(db)
+	assert.NoError(t, err)
+
+	tmpl.Id = list[1].Id
+	err = tmpl.GetById(db)
+	assert.NoError(t, err)
+	assert.Equal(t, "NTP client", tmpl.Description)
+
+	err = tmpl.Delete(db)
+	assert.NoError(t, err)
+	list, err = tmpl.GetAll(db)
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
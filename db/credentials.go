@@ -1,10 +1,33 @@
 package db
 
+const (
+	// SecretSourceDB is the default source, the password is encrypted and stored in the database
+	SecretSourceDB = ""
+	// SecretSourceEnv reads the password from the environment variable named by SecretRef
+	SecretSourceEnv = "env"
+	// SecretSourceFile reads the password from the file at SecretRef, e.g. a Kubernetes secret mount
+	SecretSourceFile = "file"
+	// SecretSourceVault reads the password from the HashiCorp Vault KV path at SecretRef
+	SecretSourceVault = "vault"
+)
+
+// SecretSources lists the supported password sources in the order shown in the UI
+var SecretSources = []string{SecretSourceDB, SecretSourceEnv, SecretSourceFile, SecretSourceVault}
+
 type Credentials struct {
 	Base
 	Alias             string `gorm:"unique"`
 	Username          string
 	EncryptedPassword string
+	// SecretSource and SecretRef point to an external secret holding the password, the
+	// EncryptedPassword is not used for those
+	SecretSource string
+	SecretRef    string
+}
+
+// IsExternal returns true if the password is not stored in the database.
+func (c *Credentials) IsExternal() bool {
+	return c.SecretSource != SecretSourceDB
 }
 
 // Create will create a new credentials entry in the database with the current
@@ -14,9 +37,19 @@ func (c *Credentials) Create(db *DB) error {
 }
 
 // Update will update an existing credentials entry in the database with the
-// current object's values. It returns an error if the update fails.
+// current object's values, empty values included so switching the password source
+// clears the unused fields. It returns an error if the update fails.
 func (c *Credentials) Update(db *DB) error {
-	return db.DB.Model(&c).Where("id = ?", c.Id).Updates(&c).Error
+	return db.DB.Model(&c).Where("id = ?", c.Id).
+		Select("alias", "username", "encrypted_password", "secret_source", "secret_ref").
+		Updates(&c).Error
+}
+
+// UpdatePassword replaces the encrypted password of the credentials in a single update. It returns
+// an error if the update fails.
+func (c *Credentials) UpdatePassword(db *DB, encryptedPassword string) error {
+	c.EncryptedPassword = encryptedPassword
+	return db.DB.Model(&c).Update("encrypted_password", encryptedPassword).Error
 }
 
 // Delete will delete an existing credentials entry from the database that
@@ -38,6 +71,12 @@ func (c *Credentials) GetById(db *DB) error {
 	return db.DB.First(&c, "id = ?", c.Id).Error
 }
 
+// GetByAlias fetches a credentials entry from the database using the current object's alias
+// and populates the current object with its values. It returns an error if the fetch fails.
+func (c *Credentials) GetByAlias(db *DB) error {
+	return db.DB.First(&c, "alias = ?", c.Alias).Error
+}
+
 // GetAll retrieves all credentials entries from the database and returns them
 // as a slice of Credentials pointers. It returns an error if the retrieval fails.
 func (c *Credentials) GetAll(db *DB) ([]*Credentials, error) {
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"gorm.io/gorm"
+)
+
+// CredentialsCandidate is an entry of the ordered list of fallback credentials of a device
+// or a device group, OwnerId is the ID of either of those.
+type CredentialsCandidate struct {
+	Base
+	OwnerId       string `gorm:"index"`
+	CredentialsId string
+	Credentials   *Credentials
+	Position      int
+}
+
+// GetCredentialsCandidates retrieves the fallback credentials of the device or device group
+// with the given ID, in order. It returns an error if the retrieval fails.
+func GetCredentialsCandidates(db *DB, ownerId string) ([]*Credentials, error) {
+	var (
+		candidates []*CredentialsCandidate
+		creds      []*Credentials
+	)
+
+	err := db.DB.Preload("Credentials").Order("position").Find(&candidates, "owner_id = ?", ownerId).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range candidates {
+		// the credentials might have been deleted since
+		if c.Credentials != nil {
+			creds = append(creds, c.Credentials)
+		}
+	}
+
+	return creds, nil
+}
+
+// SetCredentialsCandidates replaces the fallback credentials of the device or device group with
+// the given ID with the credentials IDs in the given order, empty and repeated IDs are skipped.
+// It returns an error if any of the database operations fail.
+func SetCredentialsCandidates(db *DB, ownerId string, credentialsIds []string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var (
+			position int
+			seen     = map[string]bool{}
+		)
+
+		err := tx.Where("owner_id = ?", ownerId).Delete(&CredentialsCandidate{}).Error
+		if err != nil {
+			return err
+		}
+
+		for _, id := range credentialsIds {
+			if id == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			position++
+			err = tx.Create(&CredentialsCandidate{OwnerId: ownerId, CredentialsId: id, Position: position}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestCredentialsSet(t *testing.T, db *DB, aliases ...string) map[string]*Credentials {
+	creds := map[string]*Credentials{}
+	for _, alias := range aliases {
+		c := &Credentials{Alias: alias, Username: alias}
+		err := c.Create(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		creds[alias] = c
+	}
+	return creds
+}
+
+func TestSetCredentialsCandidates(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds := createTestCredentialsSet(t, db, "first", "second")
+
+	err = SetCredentialsCandidates(db, "owner", []string{creds["second"].Id, "", creds["first"].Id, creds["second"].Id})
+	assert.NoError(t, err)
+
+	candidates, err := GetCredentialsCandidates(db, "owner")
+	assert.NoError(t, err)
+	assert.Len(t, candidates, 2)
+	assert.Equal(t, "second", candidates[0].Alias)
+	assert.Equal(t, "first", candidates[1].Alias)
+
+	// deleted credentials are skipped
+	err = creds["second"].Delete(db)
+	assert.NoError(t, err)
+	candidates, err = GetCredentialsCandidates(db, "owner")
+	assert.NoError(t, err)
+	assert.Len(t, candidates, 1)
+
+	err = SetCredentialsCandidates(db, "owner", nil)
+	assert.NoError(t, err)
+	candidates, err = GetCredentialsCandidates(db, "owner")
+	assert.NoError(t, err)
+	assert.Empty(t, candidates)
+}
@@ -105,6 +105,23 @@ func TestCredentialsUpdate(t *testing.T) {
 	assert.Equal(t, "updated-username", creds.Username)
 	assert.Equal(t, "updated-password", creds.EncryptedPassword)
 
+	// switching to an external secret clears the stored password
+	creds.EncryptedPassword = ""
+	creds.SecretSource = SecretSourceEnv
+	creds.SecretRef = "ROUTER_PASSWORD"
+	err = creds.Update(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetched := &Credentials{}
+	fetched.Id = creds.Id
+	err = fetched.GetById(db)
+	assert.NoError(t, err)
+	assert.Equal(t, "", fetched.EncryptedPassword)
+	assert.Equal(t, "ROUTER_PASSWORD", fetched.SecretRef)
+	assert.True(t, fetched.IsExternal())
+
 	err = db.Close()
 	if err != nil {
 		t.Fatal(err)
@@ -211,3 +228,64 @@ func TestCredentialsGetAll(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestCredentialsGetByAlias(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds := &Credentials{
+		Alias:             "test-alias",
+		Username:          "test-username",
+		EncryptedPassword: "test-password",
+	}
+
+	err = creds.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetchedCreds := &Credentials{Alias: "test-alias"}
+	err = fetchedCreds.GetByAlias(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, creds.Id, fetchedCreds.Id)
+	assert.Equal(t, "test-username", fetchedCreds.Username)
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCredentialsUpdatePassword(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds := &Credentials{
+		Alias:             "test-alias",
+		Username:          "test-username",
+		EncryptedPassword: "old-password",
+	}
+	err = creds.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = creds.UpdatePassword(db, "new-password")
+	assert.NoError(t, err)
+
+	fetchedCreds := &Credentials{}
+	fetchedCreds.Id = creds.Id
+	err = fetchedCreds.GetById(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "new-password", fetchedCreds.EncryptedPassword)
+	assert.Equal(t, "test-username", fetchedCreds.Username)
+}
@@ -3,19 +3,44 @@ package db
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/pbkdf2"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
+)
+
+const (
+	// cipherV2Prefix marks the AES-GCM ciphertexts with a PBKDF2 derived key, the ciphertexts
+	// without a prefix are the legacy AES-CTR ones keyed with a single SHA-256 of the key
+	cipherV2Prefix = "v2:"
+	kdfSaltSize    = 16
+	kdfIterations  = 600000
+)
+
+var (
+	// derivedKeys caches the PBKDF2 derived keys by key and salt, the derivation is slow on purpose
+	derivedKeys = map[string][]byte{}
+	// encryptionSalts holds the salt used for new ciphertexts per key, a new one is generated on start
+	encryptionSalts = map[string][]byte{}
+	kdfMutex        sync.Mutex
 )
 
 // DecryptString takes a string that is encrypted with the given key and returns
 // the decrypted string. The encrypted string is expected to be the output of
 // EncryptString and the key is expected to be the same as the one used for
-// encryption. If the key is incorrect or the encrypted string is tampered with,
-// an error is returned.
+// encryption. Legacy AES-CTR ciphertexts are still supported, for the current
+// AES-GCM ones an error is returned if the key is incorrect or the encrypted
+// string is tampered with.
 func DecryptString(cryptoText string, keyString string) (plainTextString string, err error) {
+	if data, ok := strings.CutPrefix(cryptoText, cipherV2Prefix); ok {
+		return decryptV2(data, keyString)
+	}
+
 	encrypted, err := base64.URLEncoding.DecodeString(cryptoText)
 	if err != nil {
 		return "", err
@@ -32,10 +57,13 @@ func DecryptString(cryptoText string, keyString string) (plainTextString string,
 	return string(decrypted), nil
 }
 
-// encryptAES encrypts the given data using the given key with AES encryption
-// in cipher feedback mode. A random initialization vector (IV) is generated
-// and prepended to the encrypted data. The function returns the IV combined
-// with the encrypted data or an error if the encryption fails.// decryptAES decrypts the given data using the given key with AES encryption
+// IsLegacyCipherText returns true if the string was encrypted with the legacy AES-CTR scheme
+// and should be re-encrypted.
+func IsLegacyCipherText(cryptoText string) bool {
+	return !strings.HasPrefix(cryptoText, cipherV2Prefix)
+}
+
+// decryptAES decrypts the given data using the given key with AES encryption
 // using a counter mode of operation. The first 16 bytes of the data
 // are expected to be the initialization vector. The function returns an error
 // if the decryption fails.
@@ -54,53 +82,115 @@ func decryptAES(key, data []byte) ([]byte, error) {
 }
 
 // hashTo32Bytes takes a string, hashes it with SHA-256 and returns the first
-// 32 bytes of the hash. This is used to generate a key for AES encryption
-// from a given string.
+// 32 bytes of the hash. This is used to generate a key for the legacy AES-CTR
+// encryption from a given string.
 func hashTo32Bytes(input string) []byte {
 	data := sha256.Sum256([]byte(input))
 	return data[0:]
 
 }
 
-// EncryptString encrypts the given plaintext string using the given keyString
-// with AES encryption and returns the encrypted data as a URL-safe base64
-// encoded string. The key is first hashed with SHA-256 and the first 32 bytes
-// of the hash are used as the key for AES encryption. The function returns an
-// error if the encryption fails.
-func EncryptString(plainText string, keyString string) (cipherTextString string, err error) {
-	key := hashTo32Bytes(keyString)
-	encrypted, err := encryptAES(key, []byte(plainText))
+// deriveKey returns the 32 bytes AES key derived from the given key and salt with PBKDF2-SHA256,
+// the derived keys are cached for the lifetime of the process.
+func deriveKey(keyString string, salt []byte) ([]byte, error) {
+	kdfMutex.Lock()
+	defer kdfMutex.Unlock()
+
+	cacheKey := keyString + "\x00" + string(salt)
+	if key, ok := derivedKeys[cacheKey]; ok {
+		return key, nil
+	}
+	key, err := pbkdf2.Key(sha256.New, keyString, salt, kdfIterations, 32)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	derivedKeys[cacheKey] = key
+	return key, nil
+}
+
+// encryptionSalt returns the salt used for new ciphertexts encrypted with the given key, it's
+// generated once per process so that the key is only derived once.
+func encryptionSalt(keyString string) ([]byte, error) {
+	kdfMutex.Lock()
+	defer kdfMutex.Unlock()
 
-	return base64.URLEncoding.EncodeToString(encrypted), nil
+	if salt, ok := encryptionSalts[keyString]; ok {
+		return salt, nil
+	}
+	salt := make([]byte, kdfSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	encryptionSalts[keyString] = salt
+	return salt, nil
 }
 
-// encryptAES encrypts the given plaintext data using the given key with AES
-// encryption and returns the encrypted data as a slice of bytes. The key is
-// first used to create a new AES cipher, which is then used to create a new CTR
-// stream. The IV for the CTR stream is populated with random data from the
-// crypto/rand package. The function returns an error if the encryption fails.
-func encryptAES(key, data []byte) ([]byte, error) {
+// newGCM returns an AES-GCM cipher for the given key.
+func newGCM(key []byte) (cipher.AEAD, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
+	return cipher.NewGCM(block)
+}
 
-	// create two 'windows' in to the output slice.
-	output := make([]byte, aes.BlockSize+len(data))
-	iv := output[:aes.BlockSize]
-	encrypted := output[aes.BlockSize:]
+// decryptV2 decrypts the base64 encoded salt, nonce and AES-GCM sealed data.
+func decryptV2(data string, keyString string) (string, error) {
+	encrypted, err := base64.URLEncoding.DecodeString(data)
+	if err != nil {
+		return "", err
+	}
+	if len(encrypted) < kdfSaltSize {
+		return "", errors.New("cipherText too short")
+	}
 
-	// populate the IV slice with random data.
-	if _, err = io.ReadFull(rand.Reader, iv); err != nil {
-		return nil, err
+	key, err := deriveKey(keyString, encrypted[:kdfSaltSize])
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
 	}
 
-	stream := cipher.NewCTR(block, iv)
+	encrypted = encrypted[kdfSaltSize:]
+	if len(encrypted) < gcm.NonceSize() {
+		return "", errors.New("cipherText too short")
+	}
+	decrypted, err := gcm.Open(nil, encrypted[:gcm.NonceSize()], encrypted[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(decrypted), nil
+}
+
+// EncryptString encrypts the given plaintext string using the given keyString
+// with AES-GCM and returns the encrypted data as a versioned URL-safe base64
+// encoded string. The AES key is derived from the keyString with PBKDF2-SHA256
+// and a random salt, the salt and the random nonce are stored along with the
+// encrypted data. The function returns an error if the encryption fails.
+func EncryptString(plainText string, keyString string) (cipherTextString string, err error) {
+	salt, err := encryptionSalt(keyString)
+	if err != nil {
+		return "", err
+	}
+	key, err := deriveKey(keyString, salt)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	output := make([]byte, kdfSaltSize+gcm.NonceSize(), kdfSaltSize+gcm.NonceSize()+len(plainText)+gcm.Overhead())
+	copy(output, salt)
+	nonce := output[kdfSaltSize:]
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	output = gcm.Seal(output, nonce, []byte(plainText), nil)
 
-	// note that encrypted is still a window in to the output slice
-	stream.XORKeyStream(encrypted, data)
-	return output, nil
+	return cipherV2Prefix + base64.URLEncoding.EncodeToString(output), nil
 }
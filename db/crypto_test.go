@@ -0,0 +1,61 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encryptLegacy produces the AES-CTR ciphertexts stored by the previous versions.
+func encryptLegacy(t *testing.T, plainText string, keyString string) string {
+	block, err := aes.NewCipher(hashTo32Bytes(keyString))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := make([]byte, aes.BlockSize+len(plainText))
+	copy(output, "0123456789abcdef")
+	cipher.NewCTR(block, output[:aes.BlockSize]).XORKeyStream(output[aes.BlockSize:], []byte(plainText))
+	return base64.URLEncoding.EncodeToString(output)
+}
+
+func TestEncryptDecryptString(t *testing.T) {
+	encrypted, err := EncryptString("secret", "key")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, cipherV2Prefix))
+	assert.False(t, IsLegacyCipherText(encrypted))
+
+	// the nonce is random
+	other, err := EncryptString("secret", "key")
+	assert.NoError(t, err)
+	assert.NotEqual(t, encrypted, other)
+
+	decrypted, err := DecryptString(encrypted, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", decrypted)
+
+	_, err = DecryptString(encrypted, "wrong-key")
+	assert.Error(t, err)
+
+	// tampered ciphertexts are refused
+	raw, err := base64.URLEncoding.DecodeString(strings.TrimPrefix(encrypted, cipherV2Prefix))
+	assert.NoError(t, err)
+	raw[len(raw)-1] ^= 0xff
+	_, err = DecryptString(cipherV2Prefix+base64.URLEncoding.EncodeToString(raw), "key")
+	assert.Error(t, err)
+
+	_, err = DecryptString(cipherV2Prefix+"AAAA", "key")
+	assert.Error(t, err)
+}
+
+func TestDecryptLegacyString(t *testing.T) {
+	legacy := encryptLegacy(t, "secret", "key")
+	assert.True(t, IsLegacyCipherText(legacy))
+
+	decrypted, err := DecryptString(legacy, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", decrypted)
+}
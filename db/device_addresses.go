@@ -0,0 +1,49 @@
+package db
+
+import (
+	"gorm.io/gorm"
+)
+
+type DeviceAddress struct {
+	Base
+	DeviceId  string `gorm:"index"`
+	Address   string `gorm:"index"`
+	Network   string
+	Interface string
+	Comment   string
+	// Management is set for the address chosen as the device management address
+	Management bool
+}
+
+// GetByDeviceId retrieves the known addresses of the device with the given ID ordered by
+// address. It returns an error if the retrieval fails.
+func (a *DeviceAddress) GetByDeviceId(db *DB, deviceId string) ([]*DeviceAddress, error) {
+	var list []*DeviceAddress
+	return list, db.DB.Order("address").Find(&list, "device_id = ?", deviceId).Error
+}
+
+// GetAll retrieves the known addresses of all the devices. It returns an error if the
+// retrieval fails.
+func (a *DeviceAddress) GetAll(db *DB) ([]*DeviceAddress, error) {
+	var list []*DeviceAddress
+	return list, db.DB.Find(&list).Error
+}
+
+// ReplaceDeviceAddresses replaces the known addresses of the device with the given ID in a single
+// transaction. It returns an error if any of the database operations fail.
+func ReplaceDeviceAddresses(db *DB, deviceId string, addresses []*DeviceAddress) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("device_id = ?", deviceId).Delete(&DeviceAddress{}).Error
+		if err != nil {
+			return err
+		}
+		for _, a := range addresses {
+			a.Id = ""
+			a.DeviceId = deviceId
+		}
+		if len(addresses) == 0 {
+			return nil
+		}
+		return tx.Create(&addresses).Error
+	})
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceDeviceAddresses(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := &DeviceAddress{}
+	err = ReplaceDeviceAddresses(db, "device-1", []*DeviceAddress{
+		{Address: "10.0.0.2", Interface: "ether2"},
+		{Address: "10.0.0.1", Interface: "ether1", Management: true},
+	})
+	assert.NoError(t, err)
+	err = ReplaceDeviceAddresses(db, "device-2", []*DeviceAddress{{Address: "10.0.1.1"}})
+	assert.NoError(t, err)
+
+	list, err := address.GetByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "10.0.0.1", list[0].Address)
+	assert.True(t, list[0].Management)
+
+	// replacing the addresses of one device doesn't affect the others
+	err = ReplaceDeviceAddresses(db, "device-1", []*DeviceAddress{{Address: "10.0.0.3"}})
+	assert.NoError(t, err)
+	list, err = address.GetByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.Equal(t, "10.0.0.3", list[0].Address)
+
+	all, err := address.GetAll(db)
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	err = ReplaceDeviceAddresses(db, "device-1", nil)
+	assert.NoError(t, err)
+	list, err = address.GetByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"gorm.io/gorm"
+)
+
+type DeviceArpEntry struct {
+	Base
+	DeviceId   string `gorm:"index"`
+	Address    string `gorm:"index"`
+	MacAddress string `gorm:"index"`
+	Interface  string
+	Comment    string
+	Dynamic    bool
+	Complete   bool
+}
+
+// GetByDeviceId retrieves the ARP entries of the device with the given ID ordered by address.
+// It returns an error if the retrieval fails.
+func (a *DeviceArpEntry) GetByDeviceId(db *DB, deviceId string) ([]*DeviceArpEntry, error) {
+	var list []*DeviceArpEntry
+	return list, db.DB.Order("address").Find(&list, "device_id = ?", deviceId).Error
+}
+
+// GetAll retrieves the ARP entries of all the devices. It returns an error if the retrieval
+// fails.
+func (a *DeviceArpEntry) GetAll(db *DB) ([]*DeviceArpEntry, error) {
+	var list []*DeviceArpEntry
+	return list, db.DB.Find(&list).Error
+}
+
+// ReplaceDeviceArpEntries replaces the ARP entries of the device with the given ID in a single
+// transaction. It returns an error if any of the database operations fail.
+func ReplaceDeviceArpEntries(db *DB, deviceId string, entries []*DeviceArpEntry) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("device_id = ?", deviceId).Delete(&DeviceArpEntry{}).Error
+		if err != nil {
+			return err
+		}
+		for _, a := range entries {
+			a.Id = ""
+			a.DeviceId = deviceId
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.Create(&entries).Error
+	})
+}
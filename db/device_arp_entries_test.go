@@ -0,0 +1,39 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceDeviceArpEntries(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := &DeviceArpEntry{}
+	err = ReplaceDeviceArpEntries(db, "device-1", []*DeviceArpEntry{
+		{Address: "10.0.0.2", MacAddress: "AA:BB:CC:DD:EE:02", Interface: "bridge", Dynamic: true, Complete: true},
+		{Address: "10.0.0.1", MacAddress: "AA:BB:CC:DD:EE:01", Interface: "bridge"},
+	})
+	assert.NoError(t, err)
+	err = ReplaceDeviceArpEntries(db, "device-2", []*DeviceArpEntry{{Address: "10.0.1.1"}})
+	assert.NoError(t, err)
+
+	list, err := entry.GetByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "10.0.0.1", list[0].Address)
+	assert.True(t, list[1].Complete)
+
+	all, err := entry.GetAll(db)
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	err = ReplaceDeviceArpEntries(db, "device-1", nil)
+	assert.NoError(t, err)
+	list, err = entry.GetByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
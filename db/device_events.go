@@ -0,0 +1,58 @@
+package db
+
+const (
+	DeviceEventAddressChanged  = "address-changed"
+	DeviceEventAddressConflict = "address-conflict"
+	// DeviceEventAddressResolved is recorded when the management address conflict is gone
+	DeviceEventAddressResolved = "address-conflict-resolved"
+	DeviceEventSerialChanged   = "serial-changed"
+	DeviceEventDuplicateSerial = "duplicate-serial"
+	DeviceEventCredsFallback   = "credentials-fallback"
+	DeviceEventInterfaceDown   = "interface-down"
+	DeviceEventInterfaceUp     = "interface-up"
+)
+
+type DeviceEvent struct {
+	Base
+	DeviceId string `gorm:"index"`
+	Device   *Device
+	Type     string
+	Message  string
+}
+
+// Create will create a new device event entry in the database with the current object's values.
+// It returns an error if the creation fails.
+func (e *DeviceEvent) Create(db *DB) error {
+	return db.DB.Create(&e).Error
+}
+
+// GetByDeviceId retrieves up to limit latest events of the device with the given ID, all of
+// them if limit is not positive. It returns an error if the retrieval fails.
+func (e *DeviceEvent) GetByDeviceId(db *DB, deviceId string, limit int) ([]*DeviceEvent, error) {
+	var list []*DeviceEvent
+	query := db.DB.Order("created_at desc").Where("device_id = ?", deviceId)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	return list, query.Find(&list).Error
+}
+
+// GetLastOfTypes fetches the latest event of the device with any of the given types into the
+// current object. It returns an error if the fetch fails, gorm.ErrRecordNotFound if there is no
+// such event.
+func (e *DeviceEvent) GetLastOfTypes(db *DB, deviceId string, types ...string) error {
+	return db.DB.Where("device_id = ? AND type IN ?", deviceId, types).Order("created_at desc").Take(&e).Error
+}
+
+// GetLatest retrieves up to limit latest events of all the devices, including the devices
+// themselves. It returns an error if the retrieval fails.
+func (e *DeviceEvent) GetLatest(db *DB, limit int) ([]*DeviceEvent, error) {
+	var list []*DeviceEvent
+	return list, db.DB.Preload("Device").Order("created_at desc").Limit(limit).Find(&list).Error
+}
+
+// DeleteByDeviceId deletes all the events of the device with the given ID. It returns an error
+// if the deletion fails.
+func (e *DeviceEvent) DeleteByDeviceId(db *DB, deviceId string) error {
+	return db.DB.Where("device_id = ?", deviceId).Delete(&e).Error
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestDeviceEvents(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device := &Device{Address: "10.0.0.1"}
+	err = device.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, eventType := range []string{DeviceEventAddressChanged, DeviceEventSerialChanged, DeviceEventDuplicateSerial} {
+		event := &DeviceEvent{DeviceId: device.Id, Type: eventType, Message: eventType}
+		err = event.Create(db)
+		assert.NoError(t, err)
+	}
+
+	event := &DeviceEvent{}
+	list, err := event.GetByDeviceId(db, device.Id, 2)
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	latest, err := event.GetLatest(db, 10)
+	assert.NoError(t, err)
+	assert.Len(t, latest, 3)
+	assert.Equal(t, device.Address, latest[0].Device.Address)
+
+	err = event.DeleteByDeviceId(db, device.Id)
+	assert.NoError(t, err)
+	list, err = event.GetByDeviceId(db, device.Id, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestDeviceEventsGetLastOfTypes(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := &DeviceEvent{}
+	err = event.GetLastOfTypes(db, "device", DeviceEventAddressConflict)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	for _, eventType := range []string{DeviceEventAddressConflict, DeviceEventInterfaceDown} {
+		err = (&DeviceEvent{DeviceId: "device", Type: eventType}).Create(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	event = &DeviceEvent{}
+	err = event.GetLastOfTypes(db, "device", DeviceEventAddressChanged, DeviceEventAddressConflict)
+	assert.NoError(t, err)
+	assert.Equal(t, DeviceEventAddressConflict, event.Type)
+}
+
+func TestDeviceEventsOrder(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the fractions of the stored timestamps have different lengths, some are within the same
+	// millisecond
+	base := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		message string
+		nanos   int
+	}{
+		{"second", 510000000},
+		{"first", 500000000},
+		{"third", 917600000},
+		{"fourth", 917630000},
+	} {
+		event := &DeviceEvent{DeviceId: "device", Type: DeviceEventInterfaceDown, Message: tc.message}
+		event.CreatedAt = base.Add(time.Duration(tc.nanos))
+		err = event.Create(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := (&DeviceEvent{}).GetByDeviceId(db, "device", 0)
+	assert.NoError(t, err)
+	var messages []string
+	for _, event := range list {
+		messages = append(messages, event.Message)
+	}
+	assert.Equal(t, []string{"fourth", "third", "second", "first"}, messages)
+
+	latest, err := (&DeviceEvent{}).GetLatest(db, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "fourth", latest[0].Message)
+
+	last := &DeviceEvent{}
+	assert.NoError(t, last.GetLastOfTypes(db, "device", DeviceEventInterfaceDown))
+	assert.Equal(t, "fourth", last.Message)
+}
@@ -4,6 +4,12 @@ type DeviceGroup struct {
 	Base
 	Name    string    `gorm:"unique"`
 	Devices []*Device `gorm:"many2many:device_groups_devices;"`
+	// MinimumVersion is the lowest RouterOS version the group devices are expected to run,
+	// no version is enforced if empty
+	MinimumVersion string
+	// Variables holds the configuration templates variables of the group devices, one
+	// "name=value" pair per line
+	Variables string
 }
 
 // Create will create a new device group entry in the database with the current object's values.
@@ -44,18 +50,24 @@ func (g *DeviceGroup) GetAllPlain(db *DB) ([]*DeviceGroup, error) {
 }
 
 // GetAllPreload retrieves all device group entries from the database and returns them
-// as a slice of *DeviceGroup instances. It preloads the associated devices for each
-// device group. The function returns an error if the retrieval fails.
+// as a slice of *DeviceGroup instances. It preloads the associated devices, except the
+// trashed ones, for each device group. The function returns an error if the retrieval fails.
 func (g *DeviceGroup) GetAllPreload(db *DB) ([]*DeviceGroup, error) {
 	var groups []*DeviceGroup
-	return groups, db.DB.Model(&g).Preload("Devices").Find(&groups).Error
+	return groups, db.DB.Model(&g).Preload("Devices", notTrashed).Find(&groups).Error
 }
 
 // GetById fetches a device group entry from the database using the current object's ID
-// and populates the current object with its values, including its associated devices.
-// It returns an error if the fetch fails.
+// and populates the current object with its values, including its associated devices
+// that are not in the trash. It returns an error if the fetch fails.
 func (g *DeviceGroup) GetById(db *DB) error {
-	return db.DB.Model(g).Preload("Devices").First(&g, "id = ?", g.Id).Error
+	return db.DB.Model(g).Preload("Devices", notTrashed).First(&g, "id = ?", g.Id).Error
+}
+
+// GetByName fetches a device group entry from the database using the current object's name
+// and populates the current object with its values. It returns an error if the fetch fails.
+func (g *DeviceGroup) GetByName(db *DB) error {
+	return db.DB.First(&g, "name = ?", g.Name).Error
 }
 
 // Append will append the given devices to the current device group in the database.
@@ -196,3 +196,28 @@ func TestDeviceGroupGetById(t *testing.T) {
 	assert.NotEmpty(t, fetchedGroup.CreatedAt)
 	assert.NotEmpty(t, fetchedGroup.UpdatedAt)
 }
+
+func TestDeviceGroupGetByName(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group, err := createTestDeviceGroup(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetchedGroup := &DeviceGroup{Name: group.Name}
+	err = fetchedGroup.GetByName(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, group.Id, fetchedGroup.Id)
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type DeviceInterface struct {
+	Base
+	DeviceId   string `gorm:"index"`
+	Name       string
+	Type       string
+	MacAddress string
+	Comment    string
+	Running    bool
+	Disabled   bool
+	RxBytes    int64
+	TxBytes    int64
+	RxErrors   int64
+	TxErrors   int64
+	// RxRate and TxRate are the bits per second computed between the last two polls
+	RxRate float64
+	TxRate float64
+	// Expected is set for the interfaces expected to be running, a down event is recorded when
+	// such an interface stops running
+	Expected bool
+	PolledAt time.Time
+}
+
+// GetByDeviceId retrieves the interfaces of the device with the given ID ordered by name. It
+// returns an error if the retrieval fails.
+func (i *DeviceInterface) GetByDeviceId(db *DB, deviceId string) ([]*DeviceInterface, error) {
+	var list []*DeviceInterface
+	return list, db.DB.Order("name").Find(&list, "device_id = ?", deviceId).Error
+}
+
+// GetAll retrieves the interfaces of all the devices. It returns an error if the retrieval fails.
+func (i *DeviceInterface) GetAll(db *DB) ([]*DeviceInterface, error) {
+	var list []*DeviceInterface
+	return list, db.DB.Find(&list).Error
+}
+
+// SetExpected sets whether the interface with the given name of the device is expected to be
+// running. It returns an error if the update fails or the device has no such interface.
+func (i *DeviceInterface) SetExpected(db *DB, deviceId string, name string, expected bool) error {
+	result := db.DB.Model(&DeviceInterface{}).
+		Where("device_id = ? AND name = ?", deviceId, name).
+		Update("expected", expected)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ReplaceDeviceInterfaces replaces the interfaces of the device with the given ID in a single
+// transaction. It returns an error if any of the database operations fail.
+func ReplaceDeviceInterfaces(db *DB, deviceId string, interfaces []*DeviceInterface) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("device_id = ?", deviceId).Delete(&DeviceInterface{}).Error
+		if err != nil {
+			return err
+		}
+		for _, i := range interfaces {
+			i.Id = ""
+			i.DeviceId = deviceId
+		}
+		if len(interfaces) == 0 {
+			return nil
+		}
+		return tx.Create(&interfaces).Error
+	})
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestReplaceDeviceInterfaces(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iface := &DeviceInterface{}
+	err = ReplaceDeviceInterfaces(db, "device-1", []*DeviceInterface{
+		{Name: "ether2", Type: "ether"},
+		{Name: "ether1", Type: "ether", Running: true, RxBytes: 1024},
+	})
+	assert.NoError(t, err)
+	err = ReplaceDeviceInterfaces(db, "device-2", []*DeviceInterface{{Name: "ether1"}})
+	assert.NoError(t, err)
+
+	list, err := iface.GetByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "ether1", list[0].Name)
+	assert.True(t, list[0].Running)
+	assert.Equal(t, int64(1024), list[0].RxBytes)
+
+	// replacing the interfaces of one device doesn't affect the others
+	err = ReplaceDeviceInterfaces(db, "device-1", []*DeviceInterface{{Name: "bridge"}})
+	assert.NoError(t, err)
+	list, err = iface.GetByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	list, err = iface.GetByDeviceId(db, "device-2")
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	all, err := iface.GetAll(db)
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	err = ReplaceDeviceInterfaces(db, "device-1", nil)
+	assert.NoError(t, err)
+	list, err = iface.GetByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestDeviceInterfaceSetExpected(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iface := &DeviceInterface{}
+	err = ReplaceDeviceInterfaces(db, "device-1", []*DeviceInterface{{Name: "ether1", Expected: true}})
+	assert.NoError(t, err)
+
+	err = iface.SetExpected(db, "device-1", "ether1", false)
+	assert.NoError(t, err)
+	list, err := iface.GetByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	assert.False(t, list[0].Expected)
+
+	err = iface.SetExpected(db, "device-1", "ether9", true)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"gorm.io/gorm"
+)
+
+type DeviceLease struct {
+	Base
+	DeviceId   string `gorm:"index"`
+	Address    string `gorm:"index"`
+	MacAddress string `gorm:"index"`
+	HostName   string
+	Server     string
+	Status     string
+	Comment    string
+	Dynamic    bool
+}
+
+// GetByDeviceId retrieves the DHCP leases of the device with the given ID ordered by address.
+// It returns an error if the retrieval fails.
+func (l *DeviceLease) GetByDeviceId(db *DB, deviceId string) ([]*DeviceLease, error) {
+	var list []*DeviceLease
+	return list, db.DB.Order("address").Find(&list, "device_id = ?", deviceId).Error
+}
+
+// GetAll retrieves the DHCP leases of all the devices. It returns an error if the retrieval
+// fails.
+func (l *DeviceLease) GetAll(db *DB) ([]*DeviceLease, error) {
+	var list []*DeviceLease
+	return list, db.DB.Find(&list).Error
+}
+
+// ReplaceDeviceLeases replaces the DHCP leases of the device with the given ID in a single
+// transaction. It returns an error if any of the database operations fail.
+func ReplaceDeviceLeases(db *DB, deviceId string, leases []*DeviceLease) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("device_id = ?", deviceId).Delete(&DeviceLease{}).Error
+		if err != nil {
+			return err
+		}
+		for _, l := range leases {
+			l.Id = ""
+			l.DeviceId = deviceId
+		}
+		if len(leases) == 0 {
+			return nil
+		}
+		return tx.Create(&leases).Error
+	})
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceDeviceLeases(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lease := &DeviceLease{}
+	err = ReplaceDeviceLeases(db, "device-1", []*DeviceLease{
+		{Address: "10.0.0.20", MacAddress: "AA:BB:CC:DD:EE:02", Dynamic: true},
+		{Address: "10.0.0.10", MacAddress: "AA:BB:CC:DD:EE:01", HostName: "printer"},
+	})
+	assert.NoError(t, err)
+	err = ReplaceDeviceLeases(db, "device-2", []*DeviceLease{{Address: "10.0.1.10"}})
+	assert.NoError(t, err)
+
+	list, err := lease.GetByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "10.0.0.10", list[0].Address)
+	assert.Equal(t, "printer", list[0].HostName)
+
+	all, err := lease.GetAll(db)
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	err = ReplaceDeviceLeases(db, "device-1", []*DeviceLease{{Address: "10.0.0.30"}})
+	assert.NoError(t, err)
+	list, err = lease.GetByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.Equal(t, "10.0.0.30", list[0].Address)
+}
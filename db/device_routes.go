@@ -0,0 +1,51 @@
+package db
+
+import (
+	"gorm.io/gorm"
+)
+
+type DeviceRoute struct {
+	Base
+	DeviceId     string `gorm:"index"`
+	DstAddress   string
+	Gateway      string
+	Distance     string
+	RoutingTable string
+	Comment      string
+	// Connected is set for the routes of the networks connected to the device, the others are
+	// static ones
+	Connected bool
+	Active    bool
+}
+
+// GetByDeviceId retrieves the routes of the device with the given ID ordered by destination.
+// It returns an error if the retrieval fails.
+func (r *DeviceRoute) GetByDeviceId(db *DB, deviceId string) ([]*DeviceRoute, error) {
+	var list []*DeviceRoute
+	return list, db.DB.Order("routing_table, dst_address").Find(&list, "device_id = ?", deviceId).Error
+}
+
+// GetAll retrieves the routes of all the devices. It returns an error if the retrieval fails.
+func (r *DeviceRoute) GetAll(db *DB) ([]*DeviceRoute, error) {
+	var list []*DeviceRoute
+	return list, db.DB.Find(&list).Error
+}
+
+// ReplaceDeviceRoutes replaces the routes of the device with the given ID in a single
+// transaction. It returns an error if any of the database operations fail.
+func ReplaceDeviceRoutes(db *DB, deviceId string, routes []*DeviceRoute) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("device_id = ?", deviceId).Delete(&DeviceRoute{}).Error
+		if err != nil {
+			return err
+		}
+		for _, r := range routes {
+			r.Id = ""
+			r.DeviceId = deviceId
+		}
+		if len(routes) == 0 {
+			return nil
+		}
+		return tx.Create(&routes).Error
+	})
+}
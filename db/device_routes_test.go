@@ -0,0 +1,42 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceDeviceRoutes(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	route := &DeviceRoute{}
+	err = ReplaceDeviceRoutes(db, "device-1", []*DeviceRoute{
+		{DstAddress: "10.0.0.0/24", Connected: true, RoutingTable: "main"},
+		{DstAddress: "0.0.0.0/0", Gateway: "10.0.0.254", RoutingTable: "main", Active: true},
+	})
+	assert.NoError(t, err)
+	err = ReplaceDeviceRoutes(db, "device-2", []*DeviceRoute{{DstAddress: "0.0.0.0/0"}})
+	assert.NoError(t, err)
+
+	list, err := route.GetByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "0.0.0.0/0", list[0].DstAddress)
+	assert.True(t, list[0].Active)
+
+	all, err := route.GetAll(db)
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	err = ReplaceDeviceRoutes(db, "device-1", nil)
+	assert.NoError(t, err)
+	list, err = route.GetByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+	all, err = route.GetAll(db)
+	assert.NoError(t, err)
+	assert.Len(t, all, 1)
+}
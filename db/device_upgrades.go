@@ -0,0 +1,88 @@
+package db
+
+import "time"
+
+const (
+	UpgradePending    = "pending"
+	UpgradeExporting  = "exporting"
+	UpgradeInstalling = "installing"
+	UpgradeRebooting  = "rebooting"
+	UpgradeVerifying  = "verifying"
+	UpgradeFirmware   = "upgrading-firmware"
+	UpgradeSucceeded  = "succeeded"
+	UpgradeFailed     = "failed"
+)
+
+type DeviceUpgrade struct {
+	Base
+	DeviceId string `gorm:"index"`
+	Device   *Device
+	Status   string
+	// Firmware enables the RouterBOARD firmware upgrade after the packages are upgraded
+	Firmware     bool
+	FromVersion  string
+	ToVersion    string
+	FromFirmware string
+	ToFirmware   string
+	// ExportId references the export created before the upgrade
+	ExportId   string
+	Error      string
+	FinishedAt *time.Time
+}
+
+// Finished returns true if the upgrade has either succeeded or failed.
+func (u *DeviceUpgrade) Finished() bool {
+	return u.Status == UpgradeSucceeded || u.Status == UpgradeFailed
+}
+
+// Create will create a new device upgrade entry in the database with the current object's values.
+// It returns an error if the creation fails.
+func (u *DeviceUpgrade) Create(db *DB) error {
+	return db.DB.Create(&u).Error
+}
+
+// Save will update the device upgrade entry in the database with the current object's values.
+// It returns an error if the update fails.
+func (u *DeviceUpgrade) Save(db *DB) error {
+	return db.DB.Omit("Device").Save(&u).Error
+}
+
+// GetById fetches a device upgrade entry from the database using the current object's ID, including
+// its device. It returns an error if the fetch fails.
+func (u *DeviceUpgrade) GetById(db *DB) error {
+	return db.DB.Preload("Device").First(&u, "id = ?", u.Id).Error
+}
+
+// GetByDeviceId retrieves up to limit latest upgrades of the device with the given ID, all of
+// them if limit is not positive. It returns an error if the retrieval fails.
+func (u *DeviceUpgrade) GetByDeviceId(db *DB, deviceId string, limit int) ([]*DeviceUpgrade, error) {
+	var list []*DeviceUpgrade
+	query := db.DB.Order("created_at desc").Where("device_id = ?", deviceId)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	return list, query.Find(&list).Error
+}
+
+// GetLatest retrieves up to limit latest upgrades of all the devices, including the devices
+// themselves. It returns an error if the retrieval fails.
+func (u *DeviceUpgrade) GetLatest(db *DB, limit int) ([]*DeviceUpgrade, error) {
+	var list []*DeviceUpgrade
+	return list, db.DB.Preload("Device").Order("created_at desc").Limit(limit).Find(&list).Error
+}
+
+// FailUnfinished marks the upgrades that were interrupted, e.g. by a restart, as failed. It
+// returns the number of upgrades updated and an error if the update fails.
+func (u *DeviceUpgrade) FailUnfinished(db *DB) (int64, error) {
+	now := time.Now()
+	result := db.DB.Model(&DeviceUpgrade{}).
+		Where("status NOT IN ?", []string{UpgradeSucceeded, UpgradeFailed}).
+		Updates(map[string]any{"status": UpgradeFailed, "error": "interrupted", "finished_at": &now})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteByDeviceId deletes all the upgrades of the device with the given ID. It returns an error
+// if the deletion fails.
+func (u *DeviceUpgrade) DeleteByDeviceId(db *DB, deviceId string) error {
+	return db.DB.Where("device_id = ?", deviceId).Delete(&u).Error
+}
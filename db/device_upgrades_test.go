@@ -0,0 +1,67 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceUpgrades(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device := &Device{Address: "10.0.0.1"}
+	err = device.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	finished := &DeviceUpgrade{DeviceId: device.Id, Status: UpgradePending, FromVersion: "7.14", ToVersion: "7.15"}
+	err = finished.Create(db)
+	assert.NoError(t, err)
+	finished.Status = UpgradeSucceeded
+	err = finished.Save(db)
+	assert.NoError(t, err)
+	assert.True(t, finished.Finished())
+
+	running := &DeviceUpgrade{DeviceId: device.Id, Status: UpgradeRebooting}
+	err = running.Create(db)
+	assert.NoError(t, err)
+	assert.False(t, running.Finished())
+
+	upgrade := &DeviceUpgrade{}
+	list, err := upgrade.GetByDeviceId(db, device.Id, 0)
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	latest, err := upgrade.GetLatest(db, 10)
+	assert.NoError(t, err)
+	assert.Len(t, latest, 2)
+	assert.Equal(t, device.Address, latest[0].Device.Address)
+
+	// only the unfinished upgrades are marked as failed
+	count, err := upgrade.FailUnfinished(db)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	fetched := &DeviceUpgrade{}
+	fetched.Id = running.Id
+	err = fetched.GetById(db)
+	assert.NoError(t, err)
+	assert.Equal(t, UpgradeFailed, fetched.Status)
+	assert.NotNil(t, fetched.FinishedAt)
+
+	fetched.Id = finished.Id
+	err = fetched.GetById(db)
+	assert.NoError(t, err)
+	assert.Equal(t, UpgradeSucceeded, fetched.Status)
+	assert.Equal(t, "7.15", fetched.ToVersion)
+
+	err = upgrade.DeleteByDeviceId(db, device.Id)
+	assert.NoError(t, err)
+	list, err = upgrade.GetByDeviceId(db, device.Id, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
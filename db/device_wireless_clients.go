@@ -0,0 +1,56 @@
+package db
+
+import (
+	"gorm.io/gorm"
+)
+
+type DeviceWirelessClient struct {
+	Base
+	DeviceId string `gorm:"index"`
+	Device   *Device
+	// Menu is the registration table the client was found in, e.g. "/interface/wifi"
+	Menu       string
+	Interface  string
+	MacAddress string `gorm:"index"`
+	Ssid       string
+	// Signal is the signal strength in dBm
+	Signal  int
+	TxRate  string
+	RxRate  string
+	Uptime  string
+	LastIp  string
+	Comment string
+}
+
+// GetByDeviceId retrieves the wireless clients connected to the device with the given ID ordered
+// by interface and MAC address. It returns an error if the retrieval fails.
+func (c *DeviceWirelessClient) GetByDeviceId(db *DB, deviceId string) ([]*DeviceWirelessClient, error) {
+	var list []*DeviceWirelessClient
+	return list, db.DB.Order("interface, mac_address").Find(&list, "device_id = ?", deviceId).Error
+}
+
+// GetAll retrieves the wireless clients of all the devices, including the devices themselves.
+// It returns an error if the retrieval fails.
+func (c *DeviceWirelessClient) GetAll(db *DB) ([]*DeviceWirelessClient, error) {
+	var list []*DeviceWirelessClient
+	return list, db.DB.Preload("Device").Order("mac_address").Find(&list).Error
+}
+
+// ReplaceDeviceWirelessClients replaces the wireless clients of the device with the given ID in a
+// single transaction. It returns an error if any of the database operations fail.
+func ReplaceDeviceWirelessClients(db *DB, deviceId string, clients []*DeviceWirelessClient) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("device_id = ?", deviceId).Delete(&DeviceWirelessClient{}).Error
+		if err != nil {
+			return err
+		}
+		for _, c := range clients {
+			c.Id = ""
+			c.DeviceId = deviceId
+		}
+		if len(clients) == 0 {
+			return nil
+		}
+		return tx.Omit("Device").Create(&clients).Error
+	})
+}
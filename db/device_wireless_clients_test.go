@@ -0,0 +1,47 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceDeviceWirelessClients(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device, err := createTestDevice(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &DeviceWirelessClient{}
+	err = ReplaceDeviceWirelessClients(db, device.Id, []*DeviceWirelessClient{
+		{Interface: "wifi2", MacAddress: "AA:BB:CC:DD:EE:02", Signal: -70},
+		{Interface: "wifi1", MacAddress: "AA:BB:CC:DD:EE:01", Ssid: "office", Signal: -55},
+	})
+	assert.NoError(t, err)
+	err = ReplaceDeviceWirelessClients(db, "device-2", []*DeviceWirelessClient{{MacAddress: "AA:BB:CC:DD:EE:00"}})
+	assert.NoError(t, err)
+
+	list, err := client.GetByDeviceId(db, device.Id)
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "wifi1", list[0].Interface)
+	assert.Equal(t, -55, list[0].Signal)
+
+	all, err := client.GetAll(db)
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+	assert.Equal(t, "AA:BB:CC:DD:EE:00", all[0].MacAddress)
+	assert.Nil(t, all[0].Device)
+	assert.Equal(t, device.Address, all[1].Device.Address)
+
+	err = ReplaceDeviceWirelessClients(db, device.Id, nil)
+	assert.NoError(t, err)
+	list, err = client.GetByDeviceId(db, device.Id)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
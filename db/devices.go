@@ -1,8 +1,10 @@
 package db
 
 import (
+	"errors"
 	"time"
 
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
@@ -45,21 +47,36 @@ type Device struct {
 	InstalledVersion     string         `json:"installed-version"`
 	LatestVersion        string         `json:"latest-version"`
 	Status               string         `json:"status"`
+	ArchiveExports       bool
+	// WorkingCredentialsID references the credentials the device accepted the last time it was
+	// contacted, those are tried first
+	WorkingCredentialsID string
+	WorkingCredentials   *Credentials `gorm:"foreignKey:WorkingCredentialsID"`
 }
 
-// GetAllPlain retrieves all device entries from the database and returns them
-// as a slice of *Device instances. It returns an error if the retrieval fails.
+// notTrashed is the query condition used to filter out devices that were moved to the trash.
+const notTrashed = "deleted_at IS NULL"
+
+// GetAllPlain retrieves all device entries that are not in the trash from the database
+// and returns them as a slice of *Device instances. It returns an error if the retrieval fails.
 func (d *Device) GetAllPlain(db *DB) ([]*Device, error) {
 	var deviceList []*Device
-	return deviceList, db.DB.Find(&deviceList).Error
+	return deviceList, db.DB.Where(notTrashed).Find(&deviceList).Error
 }
 
-// GetAllPreload retrieves all device entries from the database and returns them
-// as a slice of *Device instances, including their associated groups. It returns
-// an error if the retrieval fails.
+// GetAllPreload retrieves all device entries that are not in the trash from the database
+// and returns them as a slice of *Device instances, including their associated groups.
+// It returns an error if the retrieval fails.
 func (d *Device) GetAllPreload(db *DB) ([]*Device, error) {
 	var deviceList []*Device
-	return deviceList, db.DB.Model(&d).Preload("Groups").Find(&deviceList).Error
+	return deviceList, db.DB.Model(&d).Preload("Groups").Where(notTrashed).Find(&deviceList).Error
+}
+
+// GetAllTrashed retrieves all device entries that were moved to the trash, oldest first.
+// It returns an error if the retrieval fails.
+func (d *Device) GetAllTrashed(db *DB) ([]*Device, error) {
+	var deviceList []*Device
+	return deviceList, db.DB.Where("deleted_at IS NOT NULL").Order("deleted_at").Find(&deviceList).Error
 }
 
 // GetCredentials returns the credentials object associated with the device,
@@ -73,6 +90,103 @@ func (d *Device) GetCredentials(db *DB) (*Credentials, error) {
 	return d.Credentials, nil
 }
 
+// GetCredentialsChain returns the ordered list of credentials to try when logging in to the
+// device: the device credentials (or the default set if unset), the device fallback credentials,
+// the fallback credentials of its groups ordered by group name and finally the default set.
+// Each set appears only once. It returns an error if any of the retrievals fail.
+func (d *Device) GetCredentialsChain(db *DB) ([]*Credentials, error) {
+	var (
+		chain  []*Credentials
+		seen   = map[string]bool{}
+		groups []*DeviceGroup
+	)
+
+	add := func(creds ...*Credentials) {
+		for _, c := range creds {
+			if !seen[c.Id] {
+				seen[c.Id] = true
+				chain = append(chain, c)
+			}
+		}
+	}
+
+	getDefault := func() error {
+		defaults := &Credentials{}
+		err := defaults.GetDefault(db)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		} else if err == nil {
+			add(defaults)
+		}
+		return err
+	}
+
+	// fall back to the default set if the device credentials are unset or were deleted
+	primary := &Credentials{}
+	primary.Id = d.CredentialsID
+	err := primary.GetById(db)
+	if err == nil {
+		add(primary)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	} else if err = getDefault(); err != nil {
+		return nil, err
+	}
+
+	fallback, err := GetCredentialsCandidates(db, d.Id)
+	if err != nil {
+		return nil, err
+	}
+	add(fallback...)
+
+	err = db.DB.Model(d).Order("name").Association("Groups").Find(&groups)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		fallback, err = GetCredentialsCandidates(db, group.Id)
+		if err != nil {
+			return nil, err
+		}
+		add(fallback...)
+	}
+
+	if err = getDefault(); err != nil {
+		return nil, err
+	}
+
+	return chain, nil
+}
+
+// polledColumns lists the device columns written by the pollers
+var polledColumns = []string{
+	"architecture_name", "bad_blocks", "board_name", "build_time", "cpu", "cpu_count", "cpu_frequency",
+	"cpu_load", "factory_software", "free_hdd_space", "free_memory", "identity", "platform", "polled_at",
+	"polling_succeeded", "total_hdd_space", "total_memory", "uptime", "version", "write_sect_since_reboot",
+	"write_sect_total", "model", "serial_number", "firmware_type", "factory_firmware", "current_firmware",
+	"upgrade_firmware", "update_channel", "installed_version", "latest_version", "status", "updated_at",
+}
+
+// SetWorkingCredentials remembers the credentials the device accepted. It returns an error if
+// the update fails.
+func (d *Device) SetWorkingCredentials(db *DB, credentialsId string) error {
+	d.WorkingCredentialsID = credentialsId
+	return db.DB.Model(&d).Update("working_credentials_id", credentialsId).Error
+}
+
+// SetAddress switches the management address of the device. It returns an error if the update
+// fails.
+func (d *Device) SetAddress(db *DB, address string) error {
+	d.Address = address
+	return db.DB.Model(&d).Update("address", address).Error
+}
+
+// SaveUpdateInfo stores the update channel and the installed and latest RouterOS versions of the
+// device. It returns an error if the update fails.
+func (d *Device) SaveUpdateInfo(db *DB) error {
+	return db.DB.Model(&d).Select("update_channel", "installed_version", "latest_version").Updates(d).Error
+}
+
 // Create will create a new device entry in the database with the current object's values.
 // The function automatically sets the PollingSucceeded field to -1 to indicate that the
 // device has not been polled yet.
@@ -89,6 +203,13 @@ func (d *Device) Save(db *DB) error {
 	return db.DB.Save(&d).Error
 }
 
+// SavePolled stores the state of the device collected by the pollers, the other columns, e.g. the
+// trash state or the ones edited while the device was polled, are kept. It returns an error if
+// the update fails.
+func (d *Device) SavePolled(db *DB) error {
+	return db.DB.Model(&d).Select(polledColumns).Updates(d).Error
+}
+
 // Update will update an existing device entry in the database with the current
 // object's values, including its associated groups. If the update fails, it
 // returns an error.
@@ -107,7 +228,47 @@ func (d *Device) GetById(db *DB) error {
 	return db.DB.Model(d).Preload(clause.Associations).First(&d, "id = ?", d.Id).Error
 }
 
-// Delete will delete an existing device entry from the database that matches the
+// GetByAddress fetches a device entry, including a trashed one, from the database using the
+// current object's address and populates the current object with its values, including its
+// associated groups. It returns an error if the fetch fails.
+func (d *Device) GetByAddress(db *DB) error {
+	return db.DB.Model(d).Preload("Groups").First(&d, "address = ?", d.Address).Error
+}
+
+// GetDuplicates retrieves the devices, excluding the trashed ones, that report the same
+// serial number as the current object. It returns an error if the retrieval fails.
+func (d *Device) GetDuplicates(db *DB) ([]*Device, error) {
+	var deviceList []*Device
+	if d.SerialNumber == "" {
+		return deviceList, nil
+	}
+	return deviceList, db.DB.Where(notTrashed).Where("serial_number = ? AND id != ?", d.SerialNumber, d.Id).Find(&deviceList).Error
+}
+
+// Trashed returns true if the device was moved to the trash.
+func (d *Device) Trashed() bool {
+	return d.DeletedAt != nil
+}
+
+// Trash moves the device to the trash, the device is no longer polled or exported but
+// it can be restored until it's purged. The archive flag defines whether the device
+// exports should be archived rather than deleted when the device is purged. It returns
+// an error if the update fails.
+func (d *Device) Trash(db *DB, archive bool) error {
+	now := time.Now()
+	d.DeletedAt = &now
+	d.ArchiveExports = archive
+	return db.DB.Model(&d).Updates(map[string]any{"deleted_at": d.DeletedAt, "archive_exports": archive}).Error
+}
+
+// Restore takes the device out of the trash. It returns an error if the update fails.
+func (d *Device) Restore(db *DB) error {
+	d.DeletedAt = nil
+	d.ArchiveExports = false
+	return db.DB.Model(&d).Updates(map[string]any{"deleted_at": nil, "archive_exports": false}).Error
+}
+
+// Delete will permanently delete an existing device entry from the database that matches the
 // current object's ID. It returns an error if the deletion fails.
 func (d *Device) Delete(db *DB) error {
 	return db.DB.Delete(&d).Error
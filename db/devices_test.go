@@ -223,6 +223,48 @@ func TestDevicesUpdate(t *testing.T) {
 	}
 }
 
+func TestDevicesSaveUpdateInfo(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dev := &Device{
+		Address:       "10.0.0.1",
+		Identity:      "router",
+		UpdateChannel: "stable",
+	}
+	err = dev.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	update := &Device{
+		UpdateChannel:    "long-term",
+		InstalledVersion: "7.15.3",
+		LatestVersion:    "7.16.2",
+	}
+	update.Id = dev.Id
+	err = update.SaveUpdateInfo(db)
+	assert.NoError(t, err)
+
+	fetched := &Device{}
+	fetched.Id = dev.Id
+	err = fetched.GetById(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "long-term", fetched.UpdateChannel)
+	assert.Equal(t, "7.16.2", fetched.LatestVersion)
+	// the other fields are left intact
+	assert.Equal(t, "router", fetched.Identity)
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestDevicesGetById(t *testing.T) {
 	db, err := openTestDb(t.TempDir())
 	if err != nil {
@@ -281,3 +323,184 @@ func TestDevicesDelete(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestDevicesTrashRestore(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dev := &Device{
+		Address: "10.0.0.1",
+	}
+
+	err = dev.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dev.Trash(db, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devices, err := dev.GetAllPlain(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, devices, 0)
+
+	trashed, err := dev.GetAllTrashed(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, trashed, 1)
+	assert.True(t, trashed[0].Trashed())
+	assert.True(t, trashed[0].ArchiveExports)
+
+	err = dev.Restore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devices, err = dev.GetAllPreload(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, devices, 1)
+	assert.False(t, devices[0].Trashed())
+	assert.False(t, devices[0].ArchiveExports)
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDevicesGetByAddress(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dev, err := createTestDevice(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetchedDev := &Device{Address: dev.Address}
+	err = fetchedDev.GetByAddress(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, dev.Id, fetchedDev.Id)
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDevicesGetCredentialsChain(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds := createTestCredentialsSet(t, db, "Default", "primary", "device-fallback", "group-fallback")
+
+	device := &Device{Address: "10.0.0.1", CredentialsID: creds["primary"].Id}
+	err = device.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := &DeviceGroup{Name: "group", Devices: []*Device{device}}
+	err = group.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = SetCredentialsCandidates(db, device.Id, []string{creds["device-fallback"].Id})
+	assert.NoError(t, err)
+	err = SetCredentialsCandidates(db, group.Id, []string{creds["group-fallback"].Id, creds["primary"].Id})
+	assert.NoError(t, err)
+
+	chain, err := device.GetCredentialsChain(db)
+	assert.NoError(t, err)
+	var aliases []string
+	for _, c := range chain {
+		aliases = append(aliases, c.Alias)
+	}
+	assert.Equal(t, []string{"primary", "device-fallback", "group-fallback", "Default"}, aliases)
+
+	// the default set is the primary one if the device credentials are unset
+	device.CredentialsID = ""
+	chain, err = device.GetCredentialsChain(db)
+	assert.NoError(t, err)
+	assert.Equal(t, "Default", chain[0].Alias)
+	assert.Len(t, chain, 4)
+}
+
+func TestDevicesSavePolled(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device, err := createTestDevice(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the device is trashed and edited while being polled
+	polled := &Device{}
+	polled.Id = device.Id
+	err = polled.GetById(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = device.Trash(db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.DB.Model(device).Unscoped().Update("ssh_port", "2222").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	polled.Identity = "router"
+	polled.PollingSucceeded = 1
+	err = polled.SavePolled(db)
+	assert.NoError(t, err)
+
+	fetched := &Device{}
+	err = db.DB.Unscoped().First(fetched, "id = ?", device.Id).Error
+	assert.NoError(t, err)
+	assert.True(t, fetched.Trashed())
+	assert.Equal(t, "2222", fetched.SshPort)
+	assert.Equal(t, "router", fetched.Identity)
+	assert.Equal(t, int64(1), fetched.PollingSucceeded)
+}
+
+func TestDevicesSetAddress(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device, err := createTestDevice(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = device.SetAddress(db, "10.0.9.1")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.9.1", device.Address)
+
+	fetched := &Device{}
+	fetched.Id = device.Id
+	err = fetched.GetById(db)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.9.1", fetched.Address)
+}
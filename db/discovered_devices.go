@@ -0,0 +1,102 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type DiscoveredDevice struct {
+	Base
+	Address       string `gorm:"unique"`
+	ApiOpen       bool
+	SshOpen       bool
+	CredentialsID string
+	Credentials   *Credentials
+	Identity      string
+	BoardName     string
+	Version       string
+	MacAddress    string
+	// Source is either "scan" or "neighbor"
+	Source    string
+	SeenFrom  string
+	LastSeen  time.Time
+	Dismissed bool
+	Groups    []*DeviceGroup `gorm:"many2many:discovered_devices_groups;"`
+}
+
+// Upsert creates a new discovered device entry or updates the existing one with the same address,
+// the dismissed flag of an existing entry is preserved. The suggested groups are replaced with the
+// current object's groups. It returns an error if any of the database operations fail.
+func (dd *DiscoveredDevice) Upsert(db *DB) error {
+	existing := &DiscoveredDevice{Address: dd.Address}
+	err := existing.GetByAddress(db)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return db.DB.Create(&dd).Error
+	} else if err != nil {
+		return err
+	}
+
+	dd.Id = existing.Id
+	dd.CreatedAt = existing.CreatedAt
+	dd.Dismissed = existing.Dismissed
+	err = db.DB.Model(&dd).Association("Groups").Replace(dd.Groups)
+	if err != nil {
+		return err
+	}
+	return db.DB.Save(&dd).Error
+}
+
+// GetByAddress fetches a discovered device entry from the database using the current object's
+// address and populates the current object with its values. It returns an error if the fetch fails.
+func (dd *DiscoveredDevice) GetByAddress(db *DB) error {
+	return db.DB.First(&dd, "address = ?", dd.Address).Error
+}
+
+// GetById fetches a discovered device entry from the database using the current object's ID
+// and populates the current object with its values, including its credentials and suggested
+// groups. It returns an error if the fetch fails.
+func (dd *DiscoveredDevice) GetById(db *DB) error {
+	return db.DB.Model(dd).Preload("Groups").Preload("Credentials").First(&dd, "id = ?", dd.Id).Error
+}
+
+// GetAll retrieves the discovered device entries that were not dismissed, including their
+// credentials and suggested groups, most recently seen first. It returns an error if the
+// retrieval fails.
+func (dd *DiscoveredDevice) GetAll(db *DB) ([]*DiscoveredDevice, error) {
+	var list []*DiscoveredDevice
+	return list, db.DB.Preload("Groups").Preload("Credentials").Where("dismissed = ?", false).Order("last_seen desc").Find(&list).Error
+}
+
+// Dismiss hides the discovered device from the proposals, it will not be proposed again even
+// if it's discovered later. It returns an error if the update fails.
+func (dd *DiscoveredDevice) Dismiss(db *DB) error {
+	dd.Dismissed = true
+	return db.DB.Model(&dd).Update("dismissed", true).Error
+}
+
+// Delete will delete an existing discovered device entry from the database that matches the
+// current object's ID. It returns an error if the deletion fails.
+func (dd *DiscoveredDevice) Delete(db *DB) error {
+	return db.DB.Select("Groups").Delete(&dd).Error
+}
+
+// Adopt creates a managed device out of the discovered one, the new device uses the discovered
+// credentials and the suggested groups. The discovered device entry is deleted afterwards.
+// It returns the new device and an error if any of the database operations fail.
+func (dd *DiscoveredDevice) Adopt(db *DB) (*Device, error) {
+	device := &Device{
+		Address:       dd.Address,
+		CredentialsID: dd.CredentialsID,
+		Identity:      dd.Identity,
+		Groups:        dd.Groups,
+	}
+
+	err := device.Create(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return device, dd.Delete(db)
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoveredDevicesUpsert(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group, err := createTestDeviceGroup(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dd := &DiscoveredDevice{Address: "10.0.0.10", ApiOpen: true, Source: "scan", LastSeen: time.Now()}
+	err = dd.Upsert(db)
+	assert.NoError(t, err)
+
+	err = dd.Dismiss(db)
+	assert.NoError(t, err)
+
+	// rediscovering the same address updates the entry but keeps it dismissed
+	again := &DiscoveredDevice{Address: "10.0.0.10", ApiOpen: true, Identity: "router", Source: "scan", LastSeen: time.Now(), Groups: []*DeviceGroup{group}}
+	err = again.Upsert(db)
+	assert.NoError(t, err)
+	assert.Equal(t, dd.Id, again.Id)
+
+	fetched := &DiscoveredDevice{Address: "10.0.0.10"}
+	err = fetched.GetByAddress(db)
+	assert.NoError(t, err)
+	assert.Equal(t, "router", fetched.Identity)
+	assert.True(t, fetched.Dismissed)
+
+	list, err := fetched.GetAll(db)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestDiscoveredDevicesAdopt(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group, err := createTestDeviceGroup(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dd := &DiscoveredDevice{Address: "10.0.0.11", Identity: "switch", LastSeen: time.Now(), Groups: []*DeviceGroup{group}}
+	err = dd.Upsert(db)
+	assert.NoError(t, err)
+
+	list, err := dd.GetAll(db)
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.Len(t, list[0].Groups, 1)
+
+	device, err := list[0].Adopt(db)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.11", device.Address)
+	assert.Equal(t, "switch", device.Identity)
+
+	fetched := &Device{}
+	fetched.Id = device.Id
+	err = fetched.GetById(db)
+	assert.NoError(t, err)
+	assert.Len(t, fetched.Groups, 1)
+
+	list, err = dd.GetAll(db)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
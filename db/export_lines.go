@@ -0,0 +1,107 @@
+package db
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// exportLinesTable is the SQLite FTS5 index of the redacted export lines, the trigram tokenizer
+// allows searching for any part of the lines, e.g. an IP address
+const exportLinesTable = "export_redacted_lines"
+
+// legacyExportLinesTable is the index of the older versions holding the plain export lines, it is
+// dropped to not keep the device secrets unencrypted
+const legacyExportLinesTable = "export_lines"
+
+// exportLinesBatchSize limits the number of lines inserted at once
+const exportLinesBatchSize = 500
+
+// ExportLine is a single line of an indexed export.
+type ExportLine struct {
+	ExportId   string
+	DeviceId   string
+	LineNumber int
+	Content    string
+}
+
+// createExportLinesIndex creates the export lines index unless it exists already and drops the
+// legacy one. It returns an error if the creation fails.
+func createExportLinesIndex(db *DB) error {
+	err := db.DB.Exec("DROP TABLE IF EXISTS " + legacyExportLinesTable).Error
+	if err != nil {
+		return err
+	}
+	return db.DB.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS " + exportLinesTable +
+		" USING fts5(export_id UNINDEXED, device_id UNINDEXED, line_number UNINDEXED, content, tokenize = 'trigram')").Error
+}
+
+// IndexExport replaces the indexed lines of the export with the lines of the body, the line
+// numbers start with 1. The index is not encrypted, the body should have the secrets redacted.
+// It returns an error if any of the database operations fail.
+func IndexExport(db *DB, export *Export, body []byte) error {
+	var lines []*ExportLine
+
+	for i, line := range strings.Split(strings.ReplaceAll(string(body), "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines = append(lines, &ExportLine{ExportId: export.Id, DeviceId: export.DeviceId, LineNumber: i + 1, Content: line})
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(exportLinesTable).Where("export_id = ?", export.Id).Delete(&ExportLine{}).Error
+		if err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			return nil
+		}
+		return tx.Table(exportLinesTable).CreateInBatches(lines, exportLinesBatchSize).Error
+	})
+}
+
+// DeleteExportLines deletes the indexed lines of the exports with the given IDs. It returns an
+// error if the deletion fails.
+func DeleteExportLines(db *DB, exportIds []string) error {
+	if len(exportIds) == 0 {
+		return nil
+	}
+	return db.DB.Table(exportLinesTable).Where("export_id IN ?", exportIds).Delete(&ExportLine{}).Error
+}
+
+// IndexedExportIds returns the IDs of the indexed exports. It returns an error if the retrieval
+// fails.
+func IndexedExportIds(db *DB) (map[string]bool, error) {
+	var (
+		ids     []string
+		indexed = map[string]bool{}
+	)
+
+	err := db.DB.Table(exportLinesTable).Distinct("export_id").Pluck("export_id", &ids).Error
+	for _, id := range ids {
+		indexed[id] = true
+	}
+	return indexed, err
+}
+
+// SearchExportLines retrieves up to limit lines of the exports with the given IDs containing the
+// text, the text should be at least 3 characters long to match. The lines are ordered by the
+// export and the line number. It returns an error if the search fails.
+func SearchExportLines(db *DB, text string, exportIds []string, limit int) ([]*ExportLine, error) {
+	var list []*ExportLine
+
+	// the text is searched as a phrase, the quotes are escaped by doubling them
+	phrase := `"` + strings.ReplaceAll(text, `"`, `""`) + `"`
+	return list, db.DB.Table(exportLinesTable).
+		Where("content MATCH ? AND export_id IN ?", phrase, exportIds).
+		Order("export_id, line_number").Limit(limit).Find(&list).Error
+}
+
+// GetExportLines retrieves the indexed lines of the exports with the given IDs ordered by the
+// export and the line number. It returns an error if the retrieval fails.
+func GetExportLines(db *DB, exportIds []string) ([]*ExportLine, error) {
+	var list []*ExportLine
+	return list, db.DB.Table(exportLinesTable).Where("export_id IN ?", exportIds).
+		Order("export_id, line_number").Find(&list).Error
+}
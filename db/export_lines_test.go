@@ -0,0 +1,96 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportLines(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device, err := createTestDevice(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := &Export{S3Key: "first", DeviceId: device.Id}
+	second := &Export{S3Key: "second", DeviceId: device.Id}
+	for _, export := range []*Export{first, second} {
+		err = export.Save(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	body := "# RouterOS 7.15\r\n/ip address\r\n\r\nadd address=10.0.0.1/24 interface=ether1\r\n/ip firewall filter\r\nadd chain=input comment=\"Allow SSH\"\r\n"
+	err = IndexExport(db, first, []byte(body))
+	assert.NoError(t, err)
+	// indexing again replaces the lines
+	err = IndexExport(db, first, []byte(body))
+	assert.NoError(t, err)
+	err = IndexExport(db, second, []byte("/ip address\nadd address=10.0.1.1/24 interface=ether1\n"))
+	assert.NoError(t, err)
+
+	indexed, err := IndexedExportIds(db)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{first.Id: true, second.Id: true}, indexed)
+
+	lines, err := SearchExportLines(db, "10.0.0.1", []string{first.Id, second.Id}, 10)
+	assert.NoError(t, err)
+	assert.Len(t, lines, 1)
+	assert.Equal(t, 4, lines[0].LineNumber)
+	assert.Equal(t, device.Id, lines[0].DeviceId)
+	assert.Equal(t, "add address=10.0.0.1/24 interface=ether1", lines[0].Content)
+
+	// the search is limited to the given exports
+	lines, err = SearchExportLines(db, "interface=ether1", []string{second.Id}, 10)
+	assert.NoError(t, err)
+	assert.Len(t, lines, 1)
+	assert.Equal(t, second.Id, lines[0].ExportId)
+
+	lines, err = SearchExportLines(db, `comment="Allow`, []string{first.Id, second.Id}, 10)
+	assert.NoError(t, err)
+	assert.Len(t, lines, 1)
+
+	lines, err = GetExportLines(db, []string{first.Id})
+	assert.NoError(t, err)
+	assert.Len(t, lines, 5)
+
+	// the lines are deleted along with the exports
+	err = first.Delete(db)
+	assert.NoError(t, err)
+	lines, err = GetExportLines(db, []string{first.Id})
+	assert.NoError(t, err)
+	assert.Empty(t, lines)
+
+	err = second.DeleteByDeviceId(db, device.Id)
+	assert.NoError(t, err)
+	indexed, err = IndexedExportIds(db)
+	assert.NoError(t, err)
+	assert.Empty(t, indexed)
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateExportLinesIndexDropsLegacy(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.DB.Exec("CREATE VIRTUAL TABLE " + legacyExportLinesTable + " USING fts5(content)").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = createExportLinesIndex(db)
+	assert.NoError(t, err)
+	assert.False(t, db.DB.Migrator().HasTable(legacyExportLinesTable))
+	assert.True(t, db.DB.Migrator().HasTable(exportLinesTable))
+}
@@ -1,8 +1,10 @@
 package db
 
 import (
+	"errors"
 	"time"
 
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
@@ -14,13 +16,48 @@ type Export struct {
 	Size         *int64
 	DeviceId     string
 	Device       *Device
+	// Missing is set when the export object could not be found in the S3 bucket
+	Missing bool
 }
 
 func (e *Export) Save(db *DB) error {
 	return db.DB.Save(&e).Error
 }
 
+// CreateUnlessExists creates the export entry unless an entry with the same S3 key exists already,
+// the existing entry is fetched into the current object in that case. The check and the creation
+// run in a single transaction, so the same object stored concurrently is indexed only once. It
+// returns true if the entry was created and an error if any of the database operations fail.
+func (e *Export) CreateUnlessExists(db *DB) (bool, error) {
+	var created bool
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		existing := &Export{}
+		err := tx.First(existing, "s3_key = ?", e.S3Key).Error
+		if err == nil {
+			*e = *existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		created = true
+		return tx.Create(&e).Error
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return created, nil
+}
+
+// Delete will delete the export entry from the database along with its indexed lines. It
+// returns an error if the deletion fails.
 func (e *Export) Delete(db *DB) error {
+	err := DeleteExportLines(db, []string{e.Id})
+	if err != nil {
+		return err
+	}
 	return db.DB.Delete(&e).Error
 }
 
@@ -38,6 +75,19 @@ func (e *Export) GetByDeviceId(db *DB, deviceId string) ([]*Export, error) {
 	return exportList, db.DB.Order("last_modified desc").Preload(clause.Associations).Find(&exportList, "device_id = ?", deviceId).Error
 }
 
+// DeleteByDeviceId will delete all the export entries of the device with the given ID along with
+// their indexed lines. It returns an error if the deletion fails.
 func (e *Export) DeleteByDeviceId(db *DB, deviceId string) error {
+	err := db.DB.Table(exportLinesTable).Where("device_id = ?", deviceId).Delete(&ExportLine{}).Error
+	if err != nil {
+		return err
+	}
 	return db.DB.Where("device_id = ?", deviceId).Delete(&e).Error
 }
+
+// SetMissing flags the export as having (or not having) its S3 object missing and persists
+// the flag. It returns an error if the update fails.
+func (e *Export) SetMissing(db *DB, missing bool) error {
+	e.Missing = missing
+	return db.DB.Model(&e).Update("missing", missing).Error
+}
@@ -162,3 +162,64 @@ func TestExportGetAll(t *testing.T) {
 	assert.NotEmpty(t, export.CreatedAt)
 	assert.NotEmpty(t, export.UpdatedAt)
 }
+
+func TestExportSetMissing(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device, err := createTestDevice(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	export := testExport
+	export.Device = device
+	err = export.Save(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = export.SetMissing(db, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetchedExport := &Export{}
+	fetchedExport.Id = export.Id
+	err = fetchedExport.GetById(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, fetchedExport.Missing)
+}
+
+func TestExportCreateUnlessExists(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device, err := createTestDevice(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := &Export{S3Key: "exports/same.rsc", DeviceId: device.Id}
+	created, err := first.CreateUnlessExists(db)
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	// the same object stored again gets the existing entry
+	second := &Export{S3Key: "exports/same.rsc", DeviceId: device.Id}
+	created, err = second.CreateUnlessExists(db)
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, first.Id, second.Id)
+
+	exports, err := second.GetByDeviceId(db, device.Id)
+	assert.NoError(t, err)
+	assert.Len(t, exports, 1)
+}
@@ -69,12 +69,42 @@ func (db *DB) Open(path string) error {
 		&Session{},
 		&DeviceGroup{},
 		&Export{},
+		&DiscoveredDevice{},
+		&DeviceAddress{},
+		&DeviceEvent{},
+		&CredentialsCandidate{},
+		&DeviceUpgrade{},
+		&Rollout{},
+		&RolloutDevice{},
+		&CommandRun{},
+		&CommandResult{},
+		&ConfigTemplate{},
+		&CompliancePolicy{},
+		&ComplianceRule{},
+		&ComplianceResult{},
+		&DeviceInterface{},
+		&DeviceRoute{},
+		&DeviceLease{},
+		&DeviceArpEntry{},
+		&DeviceWirelessClient{},
+		&WirelessClientCount{},
+		&CollectorSetting{},
+		&CollectorStatus{},
 	)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return createExportLinesIndex(db)
+}
+
+// Transaction runs fn with a DB bound to a single database transaction, the transaction is
+// committed if fn returns nil and rolled back otherwise. It returns the error returned by fn or
+// an error if the commit fails.
+func (db *DB) Transaction(fn func(tx *DB) error) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		return fn(&DB{DB: tx, LogLevel: db.LogLevel})
+	})
 }
 
 // Close the underlying database connection.
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// reencrypt decrypts the secret with the old key and encrypts it with the new one.
+func reencrypt(secret string, oldKey string, newKey string) (string, error) {
+	plain, err := DecryptString(secret, oldKey)
+	if err != nil {
+		return "", err
+	}
+	// legacy ciphertexts are not authenticated, a wrong key produces garbage rather than an error
+	if IsLegacyCipherText(secret) && !utf8.ValidString(plain) {
+		return "", errors.New("decryption produced invalid data, the old key is likely wrong")
+	}
+	return EncryptString(plain, newKey)
+}
+
+// Rekey re-encrypts the passwords of all the credentials and users stored in the database, encrypted with the old key,
+// with the new key in a single transaction, legacy ciphertexts are upgraded to the current
+// scheme on the way. The new key can be the same as the old one to only upgrade the ciphertexts.
+// It returns the number of secrets re-encrypted and an error if any of them can not be decrypted
+// or any of the database operations fail, nothing is changed in that case.
+func Rekey(db *DB, oldKey string, newKey string) (int, error) {
+	var count int
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var (
+			creds []*Credentials
+			users []*User
+		)
+
+		err := tx.Find(&creds).Error
+		if err != nil {
+			return err
+		}
+		for _, c := range creds {
+			// external secrets are not stored in the database
+			if c.IsExternal() || c.EncryptedPassword == "" {
+				continue
+			}
+			encrypted, err := reencrypt(c.EncryptedPassword, oldKey, newKey)
+			if err != nil {
+				return fmt.Errorf("credentials %s: %w", c.Alias, err)
+			}
+			err = tx.Model(c).Update("encrypted_password", encrypted).Error
+			if err != nil {
+				return err
+			}
+			count++
+		}
+
+		err = tx.Find(&users).Error
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			encrypted, err := reencrypt(u.EncryptedPassword, oldKey, newKey)
+			if err != nil {
+				return fmt.Errorf("user %s: %w", u.Username, err)
+			}
+			err = tx.Model(u).Update("encrypted_password", encrypted).Error
+			if err != nil {
+				return err
+			}
+			count++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
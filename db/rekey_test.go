@@ -0,0 +1,51 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRekey(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := &Credentials{Alias: "legacy", EncryptedPassword: encryptLegacy(t, "legacy-password", "old-key")}
+	current, err := EncryptString("current-password", "old-key")
+	assert.NoError(t, err)
+	creds := &Credentials{Alias: "current", EncryptedPassword: current}
+	user := &User{Username: "admin", EncryptedPassword: encryptLegacy(t, "admin", "old-key")}
+	external := &Credentials{Alias: "external", SecretSource: SecretSourceEnv, SecretRef: "ROUTER_PASSWORD"}
+	for _, model := range []interface{ Create(*DB) error }{legacy, creds, user, external} {
+		err = model.Create(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a wrong old key is detected and nothing is changed
+	_, err = Rekey(db, "wrong-key", "new-key")
+	assert.Error(t, err)
+
+	count, err := Rekey(db, "old-key", "new-key")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	fetched := &Credentials{Alias: "legacy"}
+	err = fetched.GetByAlias(db)
+	assert.NoError(t, err)
+	assert.False(t, IsLegacyCipherText(fetched.EncryptedPassword))
+	password, err := DecryptString(fetched.EncryptedPassword, "new-key")
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy-password", password)
+
+	fetchedUser := &User{}
+	fetchedUser.Id = user.Id
+	err = fetchedUser.GetById(db)
+	assert.NoError(t, err)
+	password, err = DecryptString(fetchedUser.EncryptedPassword, "new-key")
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", password)
+}
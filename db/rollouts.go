@@ -0,0 +1,184 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RolloutScheduled = "scheduled"
+	RolloutRunning   = "running"
+	RolloutHalted    = "halted"
+	RolloutCompleted = "completed"
+	RolloutCancelled = "cancelled"
+
+	// RolloutDevicePending marks the devices of the batches that were not started yet, the
+	// devices of the started batches take the status of their upgrades
+	RolloutDevicePending = "pending"
+	// RolloutDeviceSkipped marks the devices that were already up to date when their batch started
+	RolloutDeviceSkipped = "skipped"
+)
+
+// ErrRolloutChanged is returned when the rollout status was changed since the rollout was fetched,
+// e.g. the rollout was cancelled while being advanced
+var ErrRolloutChanged = errors.New("the rollout was changed concurrently")
+
+type Rollout struct {
+	Base
+	GroupId string `gorm:"index"`
+	Group   *DeviceGroup
+	Status  string
+	// Firmware enables the RouterBOARD firmware upgrade of the devices
+	Firmware bool
+	// CanaryCount is the size of the first batch, BatchSize is used for the first batch if zero
+	CanaryCount int
+	BatchSize   int
+	// BatchPause is the time to wait after a batch is finished before starting the next one
+	BatchPause time.Duration
+	// WindowStart and WindowEnd limit the start of the batches to a daily maintenance window,
+	// formatted as "15:04" in the server time zone, batches can start any time if empty
+	WindowStart string
+	WindowEnd   string
+	StartAt     time.Time
+	// Batch is the index of the current batch, the canary batch is 0
+	Batch           int
+	BatchFinishedAt *time.Time
+	Error           string
+	FinishedAt      *time.Time
+	Devices         []*RolloutDevice
+	// storedStatus is the status the rollout had when fetched or last saved
+	storedStatus string
+}
+
+type RolloutDevice struct {
+	Base
+	RolloutId string `gorm:"index"`
+	DeviceId  string `gorm:"index"`
+	Device    *Device
+	Batch     int
+	UpgradeId string
+	Upgrade   *DeviceUpgrade
+	Status    string
+	Error     string
+}
+
+// Active returns true if the rollout is either waiting for its start or running.
+func (r *Rollout) Active() bool {
+	return r.Status == RolloutScheduled || r.Status == RolloutRunning
+}
+
+// Batches returns the number of batches of the rollout.
+func (r *Rollout) Batches() int {
+	var count int
+	for _, d := range r.Devices {
+		if d.Batch+1 > count {
+			count = d.Batch + 1
+		}
+	}
+	return count
+}
+
+// BatchDevices returns the devices of the rollout batch with the given index.
+func (r *Rollout) BatchDevices(batch int) []*RolloutDevice {
+	var devices []*RolloutDevice
+	for _, d := range r.Devices {
+		if d.Batch == batch {
+			devices = append(devices, d)
+		}
+	}
+	return devices
+}
+
+// rolloutPreload loads the group of the rollout and its devices along with their upgrades.
+func rolloutPreload(db *DB) *gorm.DB {
+	return db.DB.Preload("Group").
+		Preload("Devices", func(tx *gorm.DB) *gorm.DB { return tx.Order("batch") }).
+		Preload("Devices.Device").
+		Preload("Devices.Upgrade")
+}
+
+// AfterFind remembers the stored status of the fetched rollout.
+func (r *Rollout) AfterFind(tx *gorm.DB) error {
+	r.storedStatus = r.Status
+	return nil
+}
+
+// AfterCreate remembers the stored status of the created rollout.
+func (r *Rollout) AfterCreate(tx *gorm.DB) error {
+	r.storedStatus = r.Status
+	return nil
+}
+
+// Create will create a new rollout entry in the database along with its devices. It returns
+// an error if the creation fails.
+func (r *Rollout) Create(db *DB) error {
+	return db.DB.Omit("Group", "Devices.Device", "Devices.Upgrade").Create(&r).Error
+}
+
+// Save will update the rollout entry in the database with the current object's values, the
+// devices are updated as well, all in a single transaction. The rollout is only updated if its
+// stored status is still the one it was fetched with, so a concurrent change, e.g. a cancellation,
+// is not overwritten, neither the rollout nor its devices are written in that case. It returns
+// ErrRolloutChanged in that case and an error if the update fails.
+func (r *Rollout) Save(db *DB) error {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&r).Where("status = ?", r.storedStatus).Select("*").Omit("Group", "Devices", "CreatedAt").Updates(r)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrRolloutChanged
+		}
+
+		for _, d := range r.Devices {
+			err := tx.Omit("Device", "Upgrade").Save(d).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.storedStatus = r.Status
+	return nil
+}
+
+// Changed returns true if the stored status of the rollout was changed since it was fetched. It
+// returns an error if the check fails.
+func (r *Rollout) Changed(db *DB) (bool, error) {
+	var count int64
+	err := db.DB.Model(&Rollout{}).Where("id = ? AND status = ?", r.Id, r.storedStatus).Count(&count).Error
+	return count == 0, err
+}
+
+// GetById fetches a rollout entry from the database using the current object's ID, including
+// its group and devices. It returns an error if the fetch fails.
+func (r *Rollout) GetById(db *DB) error {
+	return rolloutPreload(db).First(&r, "id = ?", r.Id).Error
+}
+
+// GetAll retrieves all rollout entries, the latest first, including their groups. It returns
+// an error if the retrieval fails.
+func (r *Rollout) GetAll(db *DB) ([]*Rollout, error) {
+	var list []*Rollout
+	return list, db.DB.Preload("Group").Preload("Devices").Order("created_at desc").Find(&list).Error
+}
+
+// GetActive retrieves the scheduled and running rollouts, including their groups and devices.
+// It returns an error if the retrieval fails.
+func (r *Rollout) GetActive(db *DB) ([]*Rollout, error) {
+	var list []*Rollout
+	return list, rolloutPreload(db).Where("status IN ?", []string{RolloutScheduled, RolloutRunning}).
+		Order("created_at").Find(&list).Error
+}
+
+// DeleteByDeviceId deletes the rollout entries of the device with the given ID. It returns an
+// error if the deletion fails.
+func (d *RolloutDevice) DeleteByDeviceId(db *DB, deviceId string) error {
+	return db.DB.Where("device_id = ?", deviceId).Delete(&d).Error
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollouts(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group := &DeviceGroup{Name: "core"}
+	err = group.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rollout := &Rollout{GroupId: group.Id, Group: group, Status: RolloutScheduled, BatchSize: 1, StartAt: time.Now()}
+	for i, address := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		device := &Device{Address: address}
+		err = device.Create(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rollout.Devices = append(rollout.Devices, &RolloutDevice{DeviceId: device.Id, Device: device, Batch: 2 - i, Status: RolloutDevicePending})
+	}
+	err = rollout.Create(db)
+	assert.NoError(t, err)
+
+	fetched := &Rollout{}
+	fetched.Id = rollout.Id
+	err = fetched.GetById(db)
+	assert.NoError(t, err)
+	assert.Equal(t, "core", fetched.Group.Name)
+	assert.Len(t, fetched.Devices, 3)
+	assert.Equal(t, 3, fetched.Batches())
+	// the devices are ordered by batch
+	assert.Equal(t, "10.0.0.3", fetched.Devices[0].Device.Address)
+	assert.Len(t, fetched.BatchDevices(1), 1)
+	assert.True(t, fetched.Active())
+
+	active, err := rollout.GetActive(db)
+	assert.NoError(t, err)
+	assert.Len(t, active, 1)
+
+	// the devices are saved along with the rollout
+	fetched.Status = RolloutRunning
+	fetched.Devices[0].Status = UpgradeSucceeded
+	err = fetched.Save(db)
+	assert.NoError(t, err)
+	err = fetched.GetById(db)
+	assert.NoError(t, err)
+	assert.Equal(t, RolloutRunning, fetched.Status)
+	assert.Equal(t, UpgradeSucceeded, fetched.Devices[0].Status)
+
+	// a stale copy does not overwrite the status changed meanwhile
+	stale := &Rollout{}
+	stale.Id = rollout.Id
+	err = stale.GetById(db)
+	assert.NoError(t, err)
+	fetched.Status = RolloutCancelled
+	err = fetched.Save(db)
+	assert.NoError(t, err)
+	changed, err := stale.Changed(db)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	stale.Batch = 1
+	stale.Devices[0].Status = UpgradeFailed
+	err = stale.Save(db)
+	assert.ErrorIs(t, err, ErrRolloutChanged)
+	err = fetched.GetById(db)
+	assert.NoError(t, err)
+	assert.Equal(t, RolloutCancelled, fetched.Status)
+	assert.Equal(t, 0, fetched.Batch)
+	// the devices of the stale copy are not written either
+	assert.Equal(t, UpgradeSucceeded, fetched.Devices[0].Status)
+
+	fetched.Status = RolloutCompleted
+	err = fetched.Save(db)
+	assert.NoError(t, err)
+	active, err = rollout.GetActive(db)
+	assert.NoError(t, err)
+	assert.Empty(t, active)
+
+	all, err := rollout.GetAll(db)
+	assert.NoError(t, err)
+	assert.Len(t, all, 1)
+
+	item := &RolloutDevice{}
+	err = item.DeleteByDeviceId(db, fetched.Devices[0].DeviceId)
+	assert.NoError(t, err)
+	err = fetched.GetById(db)
+	assert.NoError(t, err)
+	assert.Len(t, fetched.Devices, 2)
+}
@@ -1,9 +1,36 @@
 package db
 
+const (
+	// UserRoleAdmin users have full access
+	UserRoleAdmin = "admin"
+	// UserRoleOperator users can only run the read-only commands on the devices and can not
+	// manage the users
+	UserRoleOperator = "operator"
+)
+
+// UserRoles lists the roles that can be assigned to the users.
+var UserRoles = []string{UserRoleAdmin, UserRoleOperator}
+
 type User struct {
 	Base
 	Username          string `gorm:"unique"`
 	EncryptedPassword string
+	// Role is one of the UserRoles, the users created before the roles were introduced have
+	// no role and are admins
+	Role string
+	// ViewSecrets allows the user to see the passwords, secrets and keys of the exports, the
+	// admins can always see them
+	ViewSecrets bool
+}
+
+// IsAdmin returns true if the user has the admin role.
+func (u *User) IsAdmin() bool {
+	return u.Role == "" || u.Role == UserRoleAdmin
+}
+
+// CanViewSecrets returns true if the user is allowed to see the exports unredacted.
+func (u *User) CanViewSecrets() bool {
+	return u.IsAdmin() || u.ViewSecrets
 }
 
 // Create will create a new user entry in the database with the current
@@ -35,7 +62,12 @@ func (u *User) GetByUsername(db *DB) error {
 // Update will update an existing user entry in the database with the current
 // object's values. It returns an error if the update fails.
 func (u *User) Update(db *DB) error {
-	return db.DB.Model(&u).Where("id = ?", u.Id).Updates(u).Error
+	err := db.DB.Model(&u).Where("id = ?", u.Id).Updates(u).Error
+	if err != nil {
+		return err
+	}
+	// Updates skips the zero values, the permission can be revoked as well
+	return db.DB.Model(&u).Where("id = ?", u.Id).Update("view_secrets", u.ViewSecrets).Error
 }
 
 // GetAll retrieves all user entries from the database and returns them
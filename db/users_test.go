@@ -165,3 +165,39 @@ func TestUserUpdate(t *testing.T) {
 	assert.NotEmpty(t, testUser.CreatedAt)
 	assert.NotEmpty(t, testUser.UpdatedAt)
 }
+
+func TestUserIsAdmin(t *testing.T) {
+	assert.True(t, (&User{}).IsAdmin())
+	assert.True(t, (&User{Role: UserRoleAdmin}).IsAdmin())
+	assert.False(t, (&User{Role: UserRoleOperator}).IsAdmin())
+}
+
+func TestUserCanViewSecrets(t *testing.T) {
+	assert.True(t, (&User{Role: UserRoleAdmin}).CanViewSecrets())
+	assert.False(t, (&User{Role: UserRoleOperator}).CanViewSecrets())
+	assert.True(t, (&User{Role: UserRoleOperator, ViewSecrets: true}).CanViewSecrets())
+}
+
+func TestUserUpdateViewSecrets(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &User{Username: "operator", Role: UserRoleOperator, ViewSecrets: true}
+	err = user.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the permission is revoked even though it is the zero value
+	user.ViewSecrets = false
+	err = user.Update(db)
+	assert.NoError(t, err)
+
+	fetched := &User{}
+	fetched.Id = user.Id
+	err = fetched.GetById(db)
+	assert.NoError(t, err)
+	assert.False(t, fetched.ViewSecrets)
+}
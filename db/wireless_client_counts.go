@@ -0,0 +1,45 @@
+package db
+
+import (
+	"time"
+)
+
+type WirelessClientCount struct {
+	Base
+	DeviceId  string `gorm:"index"`
+	Clients   int
+	SampledAt time.Time `gorm:"index"`
+}
+
+// Create will create a new wireless client count entry in the database with the current object's
+// values. It returns an error if the creation fails.
+func (c *WirelessClientCount) Create(db *DB) error {
+	return db.DB.Create(&c).Error
+}
+
+// GetByDeviceId retrieves the client counts of the device with the given ID sampled since the
+// given time, oldest first. It returns an error if the retrieval fails.
+func (c *WirelessClientCount) GetByDeviceId(db *DB, deviceId string, since time.Time) ([]*WirelessClientCount, error) {
+	var list []*WirelessClientCount
+	return list, db.DB.Order("sampled_at").Find(&list, "device_id = ? AND sampled_at >= ?", deviceId, since).Error
+}
+
+// GetSince retrieves the client counts of all the devices sampled since the given time, oldest
+// first. It returns an error if the retrieval fails.
+func (c *WirelessClientCount) GetSince(db *DB, since time.Time) ([]*WirelessClientCount, error) {
+	var list []*WirelessClientCount
+	return list, db.DB.Order("sampled_at").Find(&list, "sampled_at >= ?", since).Error
+}
+
+// DeleteBefore deletes the client counts sampled before the given time. It returns the number of
+// the deleted counts and an error if the deletion fails.
+func (c *WirelessClientCount) DeleteBefore(db *DB, before time.Time) (int64, error) {
+	result := db.DB.Where("sampled_at < ?", before).Delete(&WirelessClientCount{})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteByDeviceId deletes all the client counts of the device with the given ID. It returns an
+// error if the deletion fails.
+func (c *WirelessClientCount) DeleteByDeviceId(db *DB, deviceId string) error {
+	return db.DB.Where("device_id = ?", deviceId).Delete(&WirelessClientCount{}).Error
+}
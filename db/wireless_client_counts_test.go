@@ -0,0 +1,47 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWirelessClientCounts(t *testing.T) {
+	db, err := openTestDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := &WirelessClientCount{}
+	now := time.Now()
+	for i, sample := range []*WirelessClientCount{
+		{DeviceId: "device-1", Clients: 3, SampledAt: now.Add(-2 * time.Hour)},
+		{DeviceId: "device-1", Clients: 5, SampledAt: now.Add(-time.Hour)},
+		{DeviceId: "device-1", Clients: 4, SampledAt: now},
+		{DeviceId: "device-2", Clients: 1, SampledAt: now},
+	} {
+		err = sample.Create(db)
+		assert.NoError(t, err, i)
+	}
+
+	list, err := count.GetByDeviceId(db, "device-1", now.Add(-90*time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, 5, list[0].Clients)
+
+	list, err = count.GetSince(db, now.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	deleted, err := count.DeleteBefore(db, now.Add(-90*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	err = count.DeleteByDeviceId(db, "device-1")
+	assert.NoError(t, err)
+	list, err = count.GetSince(db, now.Add(-24*time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.Equal(t, "device-2", list[0].DeviceId)
+}
@@ -0,0 +1,122 @@
+package http
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/mazay/mikromanager/internal"
+)
+
+type collectorSettingRow struct {
+	Name        string
+	Description string
+	Defaults    internal.CollectorSettings
+	// Override is set when the group replaces the collector defaults with the values below
+	Override bool
+	Enabled  bool
+	Interval string
+	Timeout  string
+}
+
+type collectorSettingsField struct {
+	Rows []*collectorSettingRow
+}
+
+// formatDuration returns the duration as written in the forms, empty for zero.
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// parseDuration parses the duration written in the forms, empty is zero.
+func parseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err == nil && d < 0 {
+		err = fmt.Errorf("negative duration %s", value)
+	}
+	return d, err
+}
+
+// newCollectorSettingsField prepares a row for every collector, the rows of the collectors
+// without the group settings show the defaults.
+func newCollectorSettingsField(collectors []internal.Collector, settings []*db.CollectorSetting) *collectorSettingsField {
+	field := &collectorSettingsField{}
+	for _, collector := range collectors {
+		s := internal.ResolveCollectorSettings(collector, settings)
+		field.Rows = append(field.Rows, &collectorSettingRow{
+			Name:        collector.Name(),
+			Description: collector.Description(),
+			Defaults:    collector.Defaults(),
+			Override:    hasCollectorSetting(settings, collector.Name()),
+			Enabled:     s.Enabled,
+			Interval:    formatDuration(s.Interval),
+			Timeout:     formatDuration(s.Timeout),
+		})
+	}
+	return field
+}
+
+// hasCollectorSetting returns true if any of the settings is of the named collector.
+func hasCollectorSetting(settings []*db.CollectorSetting, name string) bool {
+	for _, s := range settings {
+		if s.Collector == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCollectorSettingsField reads the collector settings rows from the submitted form.
+func parseCollectorSettingsField(collectors []internal.Collector, form url.Values) *collectorSettingsField {
+	field := &collectorSettingsField{}
+	for _, collector := range collectors {
+		name := collector.Name()
+		field.Rows = append(field.Rows, &collectorSettingRow{
+			Name:        name,
+			Description: collector.Description(),
+			Defaults:    collector.Defaults(),
+			Override:    form.Get("collectorOverride-"+name) == "on",
+			Enabled:     form.Get("collectorEnabled-"+name) == "on",
+			Interval:    form.Get("collectorInterval-" + name),
+			Timeout:     form.Get("collectorTimeout-" + name),
+		})
+	}
+	return field
+}
+
+// settings returns the group settings of the overridden collectors. It returns an error if any
+// of the durations is malformed.
+func (f *collectorSettingsField) settings() ([]*db.CollectorSetting, error) {
+	var settings []*db.CollectorSetting
+
+	for _, row := range f.Rows {
+		if !row.Override {
+			continue
+		}
+		interval, err := parseDuration(row.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("collector %s interval: %w", row.Name, err)
+		}
+		timeout, err := parseDuration(row.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("collector %s timeout: %w", row.Name, err)
+		}
+		settings = append(settings, &db.CollectorSetting{
+			Collector: row.Name,
+			Enabled:   row.Enabled,
+			Interval:  interval,
+			Timeout:   timeout,
+		})
+	}
+
+	return settings, nil
+}
@@ -0,0 +1,177 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/mazay/mikromanager/internal"
+)
+
+// commandsLimit is the maximum number of command runs displayed in the history
+const commandsLimit = 100
+
+type commandsData struct {
+	User            *db.User
+	Devices         []*db.Device
+	Groups          []*db.DeviceGroup
+	Runs            []*db.CommandRun
+	ReadOnlyVerbs   []string
+	Transport       string
+	Command         string
+	GroupId         string
+	SelectedDevices []string
+	Msg             string
+}
+
+type commandData struct {
+	Run *db.CommandRun
+}
+
+// commandTargets returns the devices of the list that are either selected or members of the
+// selected group along with the description of the selection.
+func (c *HttpConfig) commandTargets(devices []*db.Device, selected []string, groupId string) ([]*db.Device, string, error) {
+	var (
+		targets     []*db.Device
+		description []string
+		members     []string
+	)
+
+	if len(selected) == 1 {
+		description = append(description, "1 device")
+	} else if len(selected) > 1 {
+		description = append(description, fmt.Sprintf("%d devices", len(selected)))
+	}
+
+	if groupId != "" {
+		group := &db.DeviceGroup{}
+		group.Id = groupId
+		err := group.GetById(c.Db)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, device := range group.Devices {
+			members = append(members, device.Id)
+		}
+		description = append(description, "group "+group.Name)
+	}
+
+	for _, device := range devices {
+		if slices.Contains(selected, device.Id) || slices.Contains(members, device.Id) {
+			targets = append(targets, device)
+		}
+	}
+
+	return targets, strings.Join(description, ", "), nil
+}
+
+// getCommands responds to /commands, GET displays the command form along with the history of the
+// command runs, POST starts the command on the selected devices and redirects to its results.
+func (c *HttpConfig) getCommands(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		device    = &db.Device{}
+		group     = &db.DeviceGroup{}
+		run       = &db.CommandRun{}
+		data      = &commandsData{Transport: db.CommandTransportSsh, ReadOnlyVerbs: internal.ReadOnlyVerbs}
+		templates = []string{commandsTmpl, baseTmpl}
+	)
+
+	data.User, err = c.sessionUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	data.Devices, err = device.GetAllPlain(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Groups, err = group.GetAllPlain(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "POST" {
+		err = r.ParseForm()
+		if err != nil {
+			c.Logger.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.Transport = r.PostForm.Get("transport")
+		data.Command = r.PostForm.Get("command")
+		data.GroupId = r.PostForm.Get("group")
+		data.SelectedDevices = r.PostForm["devices"]
+
+		var started *db.CommandRun
+		targets, target, err := c.commandTargets(data.Devices, data.SelectedDevices, data.GroupId)
+		if err == nil {
+			started, err = c.Commands.Start(data.User, data.Transport, data.Command, target, targets)
+		}
+		if err == nil {
+			http.Redirect(w, r, "/command?id="+started.Id, http.StatusFound)
+			return
+		}
+		data.Msg = err.Error()
+	} else {
+		// the device and group pages link here with the target preselected
+		data.GroupId = r.URL.Query().Get("group")
+		data.SelectedDevices = r.URL.Query()["device"]
+	}
+
+	data.Runs, err = run.GetLatest(c.Db, commandsLimit)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c.renderTemplate(w, templates, data)
+}
+
+// getCommand responds to GET /command?id=<id> and displays the output of the command run on
+// every device.
+func (c *HttpConfig) getCommand(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		data      = &commandData{Run: &db.CommandRun{}}
+		id        = r.URL.Query().Get("id")
+		templates = []string{commandTmpl, baseTmpl}
+	)
+
+	user, err := c.sessionUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	if id == "" {
+		http.Error(w, "Something went wrong, no command ID provided", http.StatusInternalServerError)
+		return
+	}
+
+	data.Run.Id = id
+	err = data.Run.GetById(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the output of the export commands holds the device secrets
+	if !user.CanViewSecrets() {
+		for _, result := range data.Run.Results {
+			result.Output = internal.RedactExport(result.Output)
+			result.Script = internal.RedactExport(result.Script)
+		}
+	}
+
+	c.renderTemplate(w, templates, data)
+}
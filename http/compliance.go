@@ -0,0 +1,116 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/mazay/mikromanager/internal"
+)
+
+type complianceData struct {
+	Report   *internal.VersionCompliance
+	Devices  []*db.Device
+	Channels []string
+}
+
+type updateChannelResult struct {
+	DeviceId      string `json:"deviceId"`
+	Address       string `json:"address"`
+	Channel       string `json:"channel,omitempty"`
+	LatestVersion string `json:"latestVersion,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+type updateChannelResponse struct {
+	Channel string                 `json:"channel"`
+	Devices []*updateChannelResult `json:"devices"`
+}
+
+// getCompliance responds to GET /compliance and displays the devices by RouterOS version and
+// firmware along with the devices running a version below the minimum version of their groups.
+func (c *HttpConfig) getCompliance(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		device    = &db.Device{}
+		data      = &complianceData{Channels: internal.UpdateChannels}
+		templates = []string{complianceTmpl, baseTmpl}
+	)
+
+	_, err = c.checkSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	data.Devices, err = device.GetAllPreload(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Report = internal.GetVersionCompliance(data.Devices)
+
+	c.renderTemplate(w, templates, data)
+}
+
+// apiSetUpdateChannel responds to POST /api/device/channel and switches the devices set with the
+// "id" parameters to the update channel set with the "channel" parameter. The outcome for every
+// device is returned, a failure on one device doesn't stop the others.
+func (c *HttpConfig) apiSetUpdateChannel(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	if !c.requireAdminJSON(w, r) {
+		return
+	}
+
+	if r.Method != "POST" {
+		c.writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		c.writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response := &updateChannelResponse{Channel: r.Form.Get("channel"), Devices: []*updateChannelResult{}}
+	ids := r.Form["id"]
+	if len(ids) == 0 {
+		c.writeJSONError(w, http.StatusBadRequest, errors.New("no device ID provided"))
+		return
+	}
+	if !slices.Contains(internal.UpdateChannels, response.Channel) {
+		c.writeJSONError(w, http.StatusBadRequest, fmt.Errorf("unknown update channel %q", response.Channel))
+		return
+	}
+
+	for _, id := range ids {
+		result := &updateChannelResult{DeviceId: id}
+		response.Devices = append(response.Devices, result)
+
+		d := &db.Device{}
+		d.Id = id
+		err = d.GetById(c.Db)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		result.Address = d.Address
+
+		ctx, cancel := internal.WithTimeout(r.Context(), c.Timeouts.Api)
+		err = internal.SetUpdateChannel(ctx, c.Db, c.Secrets, d, response.Channel)
+		cancel()
+		if err != nil {
+			c.Logger.Error(err.Error())
+			result.Error = err.Error()
+			continue
+		}
+		result.Channel = d.UpdateChannel
+		result.LatestVersion = d.LatestVersion
+	}
+
+	c.writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,214 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/mazay/mikromanager/internal"
+)
+
+// policyFormBlankRules is the number of the empty rule rows added to the policy form
+const policyFormBlankRules = 3
+
+type policiesData struct {
+	Summary *internal.ComplianceSummary
+	Msg     string
+}
+
+type policyForm struct {
+	Id          string
+	Name        string
+	Description string
+	GroupId     string
+	Groups      []*db.DeviceGroup
+	Rules       []*db.ComplianceRule
+	Kinds       []string
+	Msg         string
+}
+
+// formFillIn fills in the form with the policy values, the empty rule rows are appended for
+// the new rules.
+func (pf *policyForm) formFillIn(policy *db.CompliancePolicy) {
+	pf.Id = policy.Id
+	pf.Name = policy.Name
+	pf.Description = policy.Description
+	pf.GroupId = policy.GroupId
+	pf.Rules = policy.Rules
+	for range policyFormBlankRules {
+		pf.Rules = append(pf.Rules, &db.ComplianceRule{})
+	}
+}
+
+// getPolicies responds to GET /policies and displays the compliance policies along with the
+// devices violating them.
+func (c *HttpConfig) getPolicies(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		policy    = &db.CompliancePolicy{}
+		result    = &db.ComplianceResult{}
+		data      = &policiesData{}
+		templates = []string{policiesTmpl, baseTmpl}
+	)
+
+	_, err = c.checkSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	policies, err := policy.GetAll(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	results, err := result.GetAll(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Summary = internal.SummarizeCompliance(policies, results)
+
+	if r.URL.Query().Get("checking") != "" {
+		data.Msg = "The latest exports are being checked, refresh the page in a few moments to see the results."
+	}
+
+	c.renderTemplate(w, templates, data)
+}
+
+// editPolicy responds to /policy/edit, GET displays the form for the policy set with the "id"
+// parameter or a new one, POST validates and stores the policy along with its rules.
+func (c *HttpConfig) editPolicy(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		group     = &db.DeviceGroup{}
+		policy    = &db.CompliancePolicy{}
+		data      = &policyForm{Kinds: db.ComplianceRuleKinds}
+		templates = []string{policyFormTmpl, baseTmpl}
+	)
+
+	if !c.requireAdmin(w, r) {
+		return
+	}
+
+	data.Groups, err = group.GetAllPlain(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "POST" {
+		err = r.ParseForm()
+		if err != nil {
+			c.Logger.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		policy.Id = r.PostForm.Get("id")
+		policy.Name = strings.TrimSpace(r.PostForm.Get("name"))
+		policy.Description = r.PostForm.Get("description")
+		policy.GroupId = r.PostForm.Get("group")
+
+		kinds := r.PostForm["kind"]
+		sections := r.PostForm["section"]
+		patterns := r.PostForm["pattern"]
+		for i := range kinds {
+			if i >= len(sections) || i >= len(patterns) {
+				break
+			}
+			rule := &db.ComplianceRule{
+				Kind:    kinds[i],
+				Section: internal.NormalizeSection(sections[i]),
+				Pattern: patterns[i],
+			}
+			// the blank rows are skipped
+			if rule.Section == "" && rule.Pattern == "" {
+				continue
+			}
+			if err == nil {
+				err = internal.ValidateRule(rule)
+			}
+			policy.Rules = append(policy.Rules, rule)
+		}
+
+		if err == nil && policy.Name == "" {
+			err = errors.New("the policy name is required")
+		}
+		if err == nil && policy.Id == "" {
+			err = policy.Create(c.Db)
+		} else if err == nil {
+			err = policy.Update(c.Db)
+		}
+		if err != nil {
+			data.formFillIn(policy)
+			data.Msg = err.Error()
+			c.renderTemplate(w, templates, data)
+			return
+		}
+
+		http.Redirect(w, r, "/policies", http.StatusFound)
+		return
+	}
+
+	policy.Id = r.URL.Query().Get("id")
+	if policy.Id != "" {
+		err = policy.GetById(c.Db)
+		if err != nil {
+			data.Msg = err.Error()
+		}
+	}
+	data.formFillIn(policy)
+
+	c.renderTemplate(w, templates, data)
+}
+
+// deletePolicy responds to /policy/delete and deletes the policy with the given ID along with
+// its results.
+func (c *HttpConfig) deletePolicy(w http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		policy = &db.CompliancePolicy{}
+	)
+
+	if !c.requireAdmin(w, r) {
+		return
+	}
+
+	policy.Id = r.URL.Query().Get("id")
+	if policy.Id == "" {
+		http.Error(w, "Something went wrong, no policy ID provided", http.StatusInternalServerError)
+		return
+	}
+
+	err = policy.Delete(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/policies", http.StatusFound)
+}
+
+// checkPolicies responds to /policies/check and evaluates the policies against the latest
+// export of every device in the background.
+func (c *HttpConfig) checkPolicies(w http.ResponseWriter, r *http.Request) {
+	_, err := c.checkSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	go func() {
+		_, err := internal.CheckLatestExports(c.Db, c.S3)
+		if err != nil {
+			c.Logger.Error(err.Error())
+		}
+	}()
+
+	http.Redirect(w, r, "/policies?checking=true", http.StatusFound)
+}
@@ -0,0 +1,227 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/mazay/mikromanager/internal"
+)
+
+type configTemplatesData struct {
+	Templates []*db.ConfigTemplate
+}
+
+type configTemplateForm struct {
+	Id          string
+	Name        string
+	Description string
+	Body        string
+	Msg         string
+}
+
+type configTemplateApply struct {
+	Template        *db.ConfigTemplate
+	Devices         []*db.Device
+	Groups          []*db.DeviceGroup
+	GroupId         string
+	SelectedDevices []string
+	Previews        []*internal.RenderedTemplate
+	// Failed is set when the template can not be rendered for some of the devices
+	Failed bool
+	Msg    string
+}
+
+// getConfigTemplates responds to GET /templates and displays all the configuration templates.
+func (c *HttpConfig) getConfigTemplates(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		tmpl      = &db.ConfigTemplate{}
+		data      = &configTemplatesData{}
+		templates = []string{configTemplatesTmpl, baseTmpl}
+	)
+
+	_, err = c.checkSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	data.Templates, err = tmpl.GetAll(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c.renderTemplate(w, templates, data)
+}
+
+// editConfigTemplate responds to /template/edit, GET displays the form for the template set
+// with the "id" parameter or a new one, POST validates and stores the template.
+func (c *HttpConfig) editConfigTemplate(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		tmpl      = &db.ConfigTemplate{}
+		data      = &configTemplateForm{}
+		templates = []string{configTemplateFormTmpl, baseTmpl}
+	)
+
+	if !c.requireAdmin(w, r) {
+		return
+	}
+
+	if r.Method == "POST" {
+		err = r.ParseForm()
+		if err != nil {
+			c.Logger.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.Id = r.PostForm.Get("id")
+		data.Name = strings.TrimSpace(r.PostForm.Get("name"))
+		data.Description = r.PostForm.Get("description")
+		data.Body = r.PostForm.Get("body")
+
+		tmpl.Id = data.Id
+		tmpl.Name = data.Name
+		tmpl.Description = data.Description
+		tmpl.Body = data.Body
+
+		_, err = internal.ParseConfigTemplate(tmpl)
+		if err == nil && tmpl.Id == "" {
+			err = tmpl.Create(c.Db)
+		} else if err == nil {
+			err = tmpl.Save(c.Db)
+		}
+		if err != nil {
+			data.Msg = err.Error()
+			c.renderTemplate(w, templates, data)
+			return
+		}
+
+		http.Redirect(w, r, "/templates", http.StatusFound)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id != "" {
+		tmpl.Id = id
+		err = tmpl.GetById(c.Db)
+		if err != nil {
+			data.Msg = err.Error()
+		}
+		data.Id = tmpl.Id
+		data.Name = tmpl.Name
+		data.Description = tmpl.Description
+		data.Body = tmpl.Body
+	}
+
+	c.renderTemplate(w, templates, data)
+}
+
+// deleteConfigTemplate responds to /template/delete and deletes the template with the given ID.
+func (c *HttpConfig) deleteConfigTemplate(w http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		tmpl = &db.ConfigTemplate{}
+	)
+
+	if !c.requireAdmin(w, r) {
+		return
+	}
+
+	tmpl.Id = r.URL.Query().Get("id")
+	if tmpl.Id == "" {
+		http.Error(w, "Something went wrong, no template ID provided", http.StatusInternalServerError)
+		return
+	}
+
+	err = tmpl.Delete(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/templates", http.StatusFound)
+}
+
+// applyConfigTemplate responds to /template/apply?id=<id>, GET displays the devices selection,
+// POST renders the template for the selected devices for a preview or, if the "apply" parameter
+// is set, applies the rendered scripts and redirects to the results.
+func (c *HttpConfig) applyConfigTemplate(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		device    = &db.Device{}
+		group     = &db.DeviceGroup{}
+		data      = &configTemplateApply{Template: &db.ConfigTemplate{}}
+		templates = []string{configTemplateApplyTmpl, baseTmpl}
+	)
+
+	user, err := c.sessionUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	data.Template.Id = r.URL.Query().Get("id")
+	if data.Template.Id == "" {
+		http.Error(w, "Something went wrong, no template ID provided", http.StatusInternalServerError)
+		return
+	}
+	err = data.Template.GetById(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the devices are rendered with their group variables
+	data.Devices, err = device.GetAllPreload(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Groups, err = group.GetAllPlain(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "POST" {
+		err = r.ParseForm()
+		if err != nil {
+			c.Logger.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.GroupId = r.PostForm.Get("group")
+		data.SelectedDevices = r.PostForm["devices"]
+
+		targets, target, err := c.commandTargets(data.Devices, data.SelectedDevices, data.GroupId)
+		if err != nil {
+			data.Msg = err.Error()
+		} else if len(targets) == 0 {
+			data.Msg = "No devices selected"
+		} else if r.PostForm.Get("apply") != "" {
+			run, err := c.Commands.StartTemplate(user, data.Template, target, targets)
+			if err == nil {
+				http.Redirect(w, r, "/command?id="+run.Id, http.StatusFound)
+				return
+			}
+			data.Msg = err.Error()
+		}
+
+		data.Previews = internal.PreviewConfigTemplate(data.Template, targets)
+		for _, preview := range data.Previews {
+			if preview.Error != "" {
+				data.Failed = true
+			}
+		}
+	}
+
+	c.renderTemplate(w, templates, data)
+}
@@ -1,16 +1,25 @@
 package http
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 
 	"github.com/mazay/mikromanager/db"
+	"github.com/mazay/mikromanager/internal"
 )
 
 type credentialsForm struct {
-	Id       string
-	Alias    string
-	Username string
-	Msg      string
+	Id           string
+	Alias        string
+	Username     string
+	SecretSource string
+	SecretRef    string
+	Sources      []string
+	Msg          string
 }
 
 type credentialsData struct {
@@ -24,6 +33,36 @@ func (cf *credentialsForm) formFillIn(creds *db.Credentials) {
 	cf.Id = creds.Id
 	cf.Alias = creds.Alias
 	cf.Username = creds.Username
+	cf.SecretSource = creds.SecretSource
+	cf.SecretRef = creds.SecretRef
+}
+
+// secretFromValues sets the password source of the credentials from the submitted form, the
+// password is encrypted and stored only for the database source. It returns an error if the
+// source is unknown, the password or reference is missing or the reference is not allowed.
+func secretFromValues(creds *db.Credentials, values url.Values, secrets *internal.Secrets, encryptionKey string) error {
+	var err error
+
+	creds.SecretSource = values.Get("secretSource")
+	if !slices.Contains(db.SecretSources, creds.SecretSource) {
+		return fmt.Errorf("unknown password source %q", creds.SecretSource)
+	}
+
+	if creds.IsExternal() {
+		creds.SecretRef = strings.TrimSpace(values.Get("secretRef"))
+		creds.EncryptedPassword = ""
+		if creds.SecretRef == "" {
+			return errors.New("the secret reference is required for external passwords")
+		}
+		return secrets.CheckRef(creds.SecretSource, creds.SecretRef)
+	}
+
+	creds.SecretRef = ""
+	if values.Get("password") == "" {
+		return errors.New("the password is required")
+	}
+	creds.EncryptedPassword, err = db.EncryptString(values.Get("password"), encryptionKey)
+	return err
 }
 
 func (c *HttpConfig) getCredentials(w http.ResponseWriter, r *http.Request) {
@@ -32,7 +71,7 @@ func (c *HttpConfig) getCredentials(w http.ResponseWriter, r *http.Request) {
 		creds      = &db.Credentials{}
 		data       = &credentialsData{}
 		pagination = &Pagination{}
-		templates  = []string{credsTmpl, paginationTmpl, baseTmpl}
+		templates  = []string{credsTmpl, secretSourceTmpl, paginationTmpl, baseTmpl}
 	)
 
 	_, err = c.checkSession(r)
@@ -77,13 +116,11 @@ func (c *HttpConfig) editCredentials(w http.ResponseWriter, r *http.Request) {
 	var (
 		err       error
 		credsErr  error
-		data      = &credentialsForm{}
-		templates = []string{credsFormTmpl, baseTmpl}
+		data      = &credentialsForm{Sources: db.SecretSources}
+		templates = []string{credsFormTmpl, secretSourceTmpl, baseTmpl}
 	)
 
-	_, err = c.checkSession(r)
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
+	if !c.requireAdmin(w, r) {
 		return
 	}
 
@@ -98,23 +135,18 @@ func (c *HttpConfig) editCredentials(w http.ResponseWriter, r *http.Request) {
 		id := r.PostForm.Get("idInput")
 		alias := r.PostForm.Get("alias")
 		username := r.PostForm.Get("username")
-		encryptedPw, err := db.EncryptString(r.PostForm.Get("password"), c.EncryptionKey)
-
-		if err != nil {
-			c.Logger.Error(err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
 
 		creds := &db.Credentials{
-			Alias:             alias,
-			Username:          username,
-			EncryptedPassword: encryptedPw,
+			Alias:    alias,
+			Username: username,
 		}
 
 		if id == "" {
 			// "id" is unset - create new credentials
-			credsErr = creds.Create(c.Db)
+			credsErr = secretFromValues(creds, r.PostForm, c.Secrets, c.EncryptionKey)
+			if credsErr == nil {
+				credsErr = creds.Create(c.Db)
+			}
 		} else {
 			// "id" is set - update existing credentials
 			creds.Id = id
@@ -126,8 +158,10 @@ func (c *HttpConfig) editCredentials(w http.ResponseWriter, r *http.Request) {
 			}
 			creds.Alias = alias
 			creds.Username = username
-			creds.EncryptedPassword = encryptedPw
-			credsErr = creds.Update(c.Db)
+			credsErr = secretFromValues(creds, r.PostForm, c.Secrets, c.EncryptionKey)
+			if credsErr == nil {
+				credsErr = creds.Update(c.Db)
+			}
 		}
 
 		if credsErr != nil {
@@ -162,9 +196,7 @@ func (c *HttpConfig) deleteCredentials(w http.ResponseWriter, r *http.Request) {
 		creds = &db.Credentials{}
 	)
 
-	_, err = c.checkSession(r)
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
+	if !c.requireAdmin(w, r) {
 		return
 	}
 
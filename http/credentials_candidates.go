@@ -0,0 +1,27 @@
+package http
+
+import (
+	"github.com/mazay/mikromanager/db"
+)
+
+// minFallbackSlots is the minimum number of fallback credentials selects displayed in the forms
+const minFallbackSlots = 3
+
+type fallbackCredentialsField struct {
+	Credentials []*db.Credentials
+	// Slots holds the selected credentials ID of every select, empty for the unset ones
+	Slots []string
+}
+
+// newFallbackCredentialsField prepares the fallback credentials selects, there is always
+// at least one empty select left unless all the credentials are already selected.
+func newFallbackCredentialsField(credentials []*db.Credentials, selected []*db.Credentials) *fallbackCredentialsField {
+	field := &fallbackCredentialsField{Credentials: credentials}
+	for _, c := range selected {
+		field.Slots = append(field.Slots, c.Id)
+	}
+	for len(field.Slots) < len(credentials) && (len(field.Slots) < minFallbackSlots || len(field.Slots) == len(selected)) {
+		field.Slots = append(field.Slots, "")
+	}
+	return field
+}
@@ -2,20 +2,29 @@ package http
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/mazay/mikromanager/db"
+	"github.com/mazay/mikromanager/internal"
 )
 
 type deviceGroupForm struct {
 	Id              string
 	Name            string
+	MinimumVersion  string
+	Variables       string
 	Msg             string
 	Devices         []*db.Device
 	SelectedDevices []string
+	Fallback        *fallbackCredentialsField
+	Collectors      *collectorSettingsField
 }
 
 type deviceGroupDetails struct {
 	Group *db.DeviceGroup
+	// BelowMinimum holds the IDs of the members running a version below the group minimum
+	BelowMinimum []string
+	Collectors   *collectorSettingsField
 }
 
 type deviceGroupsData struct {
@@ -28,6 +37,8 @@ type deviceGroupsData struct {
 func (df *deviceGroupForm) formFillIn(group *db.DeviceGroup, devices []*db.Device) {
 	df.Id = group.Id
 	df.Name = group.Name
+	df.MinimumVersion = group.MinimumVersion
+	df.Variables = group.Variables
 	df.Devices = devices
 	for _, dev := range group.Devices {
 		df.SelectedDevices = append(df.SelectedDevices, dev.Id)
@@ -40,12 +51,12 @@ func (c *HttpConfig) editDeviceGroup(w http.ResponseWriter, r *http.Request) {
 		groupErr  error
 		data      = &deviceGroupForm{}
 		device    = &db.Device{}
-		templates = []string{deviceGroupFormTmpl, baseTmpl}
+		creds     = &db.Credentials{}
+		setting   = &db.CollectorSetting{}
+		templates = []string{deviceGroupFormTmpl, fallbackCredsTmpl, collectorSettingsTmpl, baseTmpl}
 	)
 
-	_, err = c.checkSession(r)
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
+	if !c.requireAdmin(w, r) {
 		return
 	}
 
@@ -57,6 +68,15 @@ func (c *HttpConfig) editDeviceGroup(w http.ResponseWriter, r *http.Request) {
 	}
 	data.Devices = devsAll
 
+	credsAll, err := creds.GetAll(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Fallback = newFallbackCredentialsField(credsAll, nil)
+	data.Collectors = newCollectorSettingsField(c.Collectors, nil)
+
 	if r.Method == "POST" {
 		// parse the form
 		err = r.ParseForm()
@@ -67,7 +87,11 @@ func (c *HttpConfig) editDeviceGroup(w http.ResponseWriter, r *http.Request) {
 		}
 		id := r.PostForm.Get("idInput")
 		name := r.PostForm.Get("nameInput")
+		minimumVersion := strings.TrimSpace(r.PostForm.Get("minimumVersion"))
+		variables := strings.TrimSpace(r.PostForm.Get("variables"))
 		devIds := r.PostForm["devicesInput"]
+		fallbackIds := r.PostForm["fallbackCredentials"]
+		data.Collectors = parseCollectorSettingsField(c.Collectors, r.PostForm)
 
 		devList := []*db.Device{}
 		for _, devId := range devIds {
@@ -77,15 +101,25 @@ func (c *HttpConfig) editDeviceGroup(w http.ResponseWriter, r *http.Request) {
 		}
 
 		group := &db.DeviceGroup{
-			Name:    name,
-			Devices: devList,
+			Name:           name,
+			Devices:        devList,
+			MinimumVersion: minimumVersion,
+			Variables:      variables,
 		}
 		group.Id = id
 
-		if id == "" {
+		groupErr = internal.ValidateVersion(minimumVersion)
+		if groupErr == nil {
+			_, groupErr = internal.ParseVariables(variables)
+		}
+		collectorSettings, err := data.Collectors.settings()
+		if groupErr == nil {
+			groupErr = err
+		}
+		if groupErr == nil && id == "" {
 			// "id" is unset - create new group
 			groupErr = group.Create(c.Db)
-		} else {
+		} else if groupErr == nil {
 			// "id" is set - update existing group
 			err := group.Update(c.Db)
 			if err != nil {
@@ -93,6 +127,13 @@ func (c *HttpConfig) editDeviceGroup(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
+		if groupErr == nil {
+			groupErr = db.SetCredentialsCandidates(c.Db, group.Id, fallbackIds)
+		}
+		if groupErr == nil {
+			groupErr = db.SetCollectorSettings(c.Db, group.Id, collectorSettings)
+		}
+
 		if groupErr != nil {
 			// return data with errors if validation failed
 			data.Id = id
@@ -114,6 +155,16 @@ func (c *HttpConfig) editDeviceGroup(w http.ResponseWriter, r *http.Request) {
 			} else {
 				data.formFillIn(g, devsAll)
 			}
+			fallback, err := db.GetCredentialsCandidates(c.Db, id)
+			if err != nil {
+				data.Msg = err.Error()
+			}
+			data.Fallback = newFallbackCredentialsField(credsAll, fallback)
+			settings, err := setting.GetByGroupId(c.Db, id)
+			if err != nil {
+				data.Msg = err.Error()
+			}
+			data.Collectors = newCollectorSettingsField(c.Collectors, settings)
 		}
 	}
 
@@ -170,6 +221,7 @@ func (c *HttpConfig) getDeviceGroup(w http.ResponseWriter, r *http.Request) {
 	var (
 		err       error
 		group     = &db.DeviceGroup{}
+		setting   = &db.CollectorSetting{}
 		data      = &deviceGroupDetails{}
 		id        = r.URL.Query().Get("id")
 		templates = []string{deviceGroupTmpl, baseTmpl}
@@ -194,6 +246,22 @@ func (c *HttpConfig) getDeviceGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	data.Group = group
+	if group.MinimumVersion != "" {
+		for _, d := range group.Devices {
+			cmp, err := internal.CompareVersions(d.InstalledVersion, group.MinimumVersion)
+			if err == nil && cmp < 0 {
+				data.BelowMinimum = append(data.BelowMinimum, d.Id)
+			}
+		}
+	}
+
+	settings, err := setting.GetByGroupId(c.Db, group.Id)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Collectors = newCollectorSettingsField(c.Collectors, settings)
 	c.renderTemplate(w, templates, data)
 }
 
@@ -204,9 +272,7 @@ func (c *HttpConfig) deleteDeviceGroup(w http.ResponseWriter, r *http.Request) {
 		id  = r.URL.Query().Get("id")
 	)
 
-	_, err = c.checkSession(r)
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
+	if !c.requireAdmin(w, r) {
 		return
 	}
 
@@ -225,5 +291,12 @@ func (c *HttpConfig) deleteDeviceGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = db.SetCollectorSettings(c.Db, id, nil)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	http.Redirect(w, r, "/device/groups", http.StatusFound)
 }
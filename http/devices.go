@@ -1,7 +1,10 @@
 package http
 
 import (
+	"errors"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/mazay/mikromanager/db"
 	"github.com/mazay/mikromanager/internal"
@@ -15,14 +18,34 @@ type deviceForm struct {
 	CredentialsId string
 	Msg           string
 	Credentials   []*db.Credentials
+	Fallback      *fallbackCredentialsField
 }
 
 type deviceDetails struct {
-	Device       *db.Device
-	Exports      []*db.Export
-	Health       *internal.Health
-	CpuResources map[string]*internal.CpuResource
-	Errors       []string
+	Device    *db.Device
+	Exports   []*db.Export
+	Addresses []*db.DeviceAddress
+	// Interfaces holds the interfaces collected by the last poll
+	Interfaces []*db.DeviceInterface
+	Routes     []*db.DeviceRoute
+	Leases     []*db.DeviceLease
+	ArpEntries []*db.DeviceArpEntry
+	// WirelessClients holds the clients of the device registration tables, ClientHistory their
+	// hourly counts
+	WirelessClients []*db.DeviceWirelessClient
+	ClientHistory   []*clientHistoryBar
+	// Collectors holds the outcome of the last run of every poller collector
+	Collectors []*db.CollectorStatus
+	Events     []*db.DeviceEvent
+	// Compliance holds the results of the compliance policies evaluated against the latest export
+	Compliance []*db.ComplianceResult
+	// Upgrade is the latest upgrade of the device
+	Upgrade *db.DeviceUpgrade
+	// CredsFallback is set when the device only accepts fallback credentials
+	CredsFallback bool
+	Health        *internal.Health
+	CpuResources  map[string]*internal.CpuResource
+	Errors        []string
 }
 
 type devicesData struct {
@@ -46,12 +69,10 @@ func (c *HttpConfig) editDevice(w http.ResponseWriter, r *http.Request) {
 		deviceErr error
 		data      = &deviceForm{}
 		creds     = &db.Credentials{}
-		templates = []string{deviceFormTmpl, baseTmpl}
+		templates = []string{deviceFormTmpl, fallbackCredsTmpl, baseTmpl}
 	)
 
-	_, err = c.checkSession(r)
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
+	if !c.requireAdmin(w, r) {
 		return
 	}
 
@@ -62,6 +83,7 @@ func (c *HttpConfig) editDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	data.Credentials = credsAll
+	data.Fallback = newFallbackCredentialsField(credsAll, nil)
 
 	if r.Method == "POST" {
 		// parse the form
@@ -76,6 +98,7 @@ func (c *HttpConfig) editDevice(w http.ResponseWriter, r *http.Request) {
 		apiPort := r.PostForm.Get("apiPort")
 		sshPort := r.PostForm.Get("sshPort")
 		credentialsId := r.PostForm.Get("credentialsId")
+		fallbackIds := r.PostForm["fallbackCredentials"]
 
 		device := &db.Device{
 			Address: address,
@@ -102,6 +125,10 @@ func (c *HttpConfig) editDevice(w http.ResponseWriter, r *http.Request) {
 			deviceErr = device.Update(c.Db)
 		}
 
+		if deviceErr == nil {
+			deviceErr = db.SetCredentialsCandidates(c.Db, device.Id, fallbackIds)
+		}
+
 		if deviceErr != nil {
 			// return data with errors if validation failed
 			data.Id = id
@@ -123,6 +150,11 @@ func (c *HttpConfig) editDevice(w http.ResponseWriter, r *http.Request) {
 			} else {
 				data.formFillIn(d)
 			}
+			fallback, err := db.GetCredentialsCandidates(c.Db, id)
+			if err != nil {
+				data.Msg = err.Error()
+			}
+			data.Fallback = newFallbackCredentialsField(credsAll, fallback)
 		}
 	}
 
@@ -180,9 +212,20 @@ func (c *HttpConfig) getDevice(w http.ResponseWriter, r *http.Request) {
 		err       error
 		device    = &db.Device{}
 		export    = &db.Export{}
+		address   = &db.DeviceAddress{}
+		iface     = &db.DeviceInterface{}
+		route     = &db.DeviceRoute{}
+		lease     = &db.DeviceLease{}
+		arp       = &db.DeviceArpEntry{}
+		client    = &db.DeviceWirelessClient{}
+		count     = &db.WirelessClientCount{}
+		status    = &db.CollectorStatus{}
+		event     = &db.DeviceEvent{}
+		upgrade   = &db.DeviceUpgrade{}
+		result    = &db.ComplianceResult{}
 		data      = &deviceDetails{}
 		id        = r.URL.Query().Get("id")
-		templates = []string{deviceDetailsTmpl, baseTmpl, updateModalTmpl}
+		templates = []string{deviceDetailsTmpl, baseTmpl, updateModalTmpl, upgradeStatusTmpl}
 	)
 
 	_, err = c.checkSession(r)
@@ -214,70 +257,142 @@ func (c *HttpConfig) getDevice(w http.ResponseWriter, r *http.Request) {
 	}
 	data.Exports = exports
 
-	health, err := internal.GetDeviceHealth(device, c.Db, c.EncryptionKey)
+	chain, err := device.GetCredentialsChain(c.Db)
 	if err != nil {
 		c.Logger.Error(err.Error())
 		data.Errors = append(data.Errors, err.Error())
-	} else {
-		data.Health = health
+	} else if len(chain) > 0 && device.WorkingCredentials != nil {
+		data.CredsFallback = chain[0].Id != device.WorkingCredentialsID
 	}
 
-	cpuRes, err := internal.GetCpuResources(device, c.Db, c.EncryptionKey)
+	data.Addresses, err = address.GetByDeviceId(c.Db, device.Id)
 	if err != nil {
 		c.Logger.Error(err.Error())
-		data.Errors = append(data.Errors, err.Error())
-	} else {
-		data.CpuResources = cpuRes
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	c.renderTemplate(w, templates, data)
-}
+	data.Interfaces, err = iface.GetByDeviceId(c.Db, device.Id)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-func (c *HttpConfig) deleteDevice(w http.ResponseWriter, r *http.Request) {
-	var (
-		err error
-		d   = &db.Device{}
-		e   = &db.Export{}
-		id  = r.URL.Query().Get("id")
-	)
+	data.Routes, err = route.GetByDeviceId(c.Db, device.Id)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	_, err = c.checkSession(r)
+	data.Leases, err = lease.GetByDeviceId(c.Db, device.Id)
 	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if id == "" {
-		http.Error(w, "Something went wrong, no device ID provided", http.StatusInternalServerError)
+	data.ArpEntries, err = arp.GetByDeviceId(c.Db, device.Id)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	d.Id = id
+	data.WirelessClients, err = client.GetByDeviceId(c.Db, device.Id)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	// delete exports from S3
-	exports, err := c.S3.GetExports(d.Id)
+	counts, err := count.GetByDeviceId(c.Db, device.Id, time.Now().Add(-wirelessHistoryPeriod))
 	if err != nil {
 		c.Logger.Error(err.Error())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	err = c.S3.DeleteExports(exports)
+	if len(counts) > 0 {
+		data.ClientHistory = clientHistoryBars(counts, time.Now())
+	}
+
+	data.Collectors, err = status.GetByDeviceId(c.Db, device.Id)
 	if err != nil {
 		c.Logger.Error(err.Error())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// delete exports from DB
-	err = e.DeleteByDeviceId(c.Db, d.Id)
+	data.Events, err = event.GetByDeviceId(c.Db, device.Id, 10)
 	if err != nil {
 		c.Logger.Error(err.Error())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// delete device
-	err = d.Delete(c.Db)
+	data.Compliance, err = result.GetByDeviceId(c.Db, device.Id)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	upgrades, err := upgrade.GetByDeviceId(c.Db, device.Id, 1)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(upgrades) > 0 {
+		data.Upgrade = upgrades[0]
+	}
+
+	// the device requests stop once the page is closed
+	ctx, cancel := internal.WithTimeout(r.Context(), c.Timeouts.Api)
+	health, err := internal.GetDeviceHealth(ctx, device, c.Db, c.Secrets, c.ApiPool)
+	cancel()
+	if err != nil {
+		c.Logger.Error(err.Error())
+		data.Errors = append(data.Errors, err.Error())
+	} else {
+		data.Health = health
+	}
+
+	ctx, cancel = internal.WithTimeout(r.Context(), c.Timeouts.Api)
+	cpuRes, err := internal.GetCpuResources(ctx, device, c.Db, c.Secrets, c.ApiPool)
+	cancel()
+	if err != nil {
+		c.Logger.Error(err.Error())
+		data.Errors = append(data.Errors, err.Error())
+	} else {
+		data.CpuResources = cpuRes
+	}
+
+	c.renderTemplate(w, templates, data)
+}
+
+// deleteDevice responds to /delete?id=<id> and moves the device to the trash, the exports are
+// archived rather than deleted when the device is purged if the "archive" parameter is set.
+func (c *HttpConfig) deleteDevice(w http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		d       = &db.Device{}
+		id      = r.URL.Query().Get("id")
+		archive = r.URL.Query().Get("archive") != ""
+	)
+
+	if !c.requireAdmin(w, r) {
+		return
+	}
+
+	if id == "" {
+		http.Error(w, "Something went wrong, no device ID provided", http.StatusInternalServerError)
+		return
+	}
+
+	d.Id = id
+	err = d.Trash(c.Db, archive)
 	if err != nil {
 		c.Logger.Error(err.Error())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -294,9 +409,7 @@ func (c *HttpConfig) updateDevice(w http.ResponseWriter, r *http.Request) {
 		id  = r.URL.Query().Get("id")
 	)
 
-	_, err = c.checkSession(r)
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
+	if !c.requireAdminJSON(w, r) {
 		return
 	}
 
@@ -313,7 +426,46 @@ func (c *HttpConfig) updateDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// trigger an update without blocking
-	go internal.UpdateDevice(d, c.Db, c.EncryptionKey, c.Logger)
-	w.WriteHeader(http.StatusOK)
+	// the upgrade runs in the background, its progress is displayed on the upgrades page
+	upgrade, err := c.Upgrader.Start(d, r.URL.Query().Get("firmware") == "true")
+	if errors.Is(err, internal.ErrUpgradeRunning) {
+		c.writeJSONError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		c.Logger.Error(err.Error())
+		c.writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	c.writeJSON(w, http.StatusAccepted, upgrade)
+}
+
+// setInterfaceExpected responds to /device/interface/expected?id=<id>&name=<name>&expected=<bool>
+// and sets whether the interface of the device is expected to be running, the down events are
+// only recorded for the expected interfaces.
+func (c *HttpConfig) setInterfaceExpected(w http.ResponseWriter, r *http.Request) {
+	var (
+		iface    = &db.DeviceInterface{}
+		id       = r.URL.Query().Get("id")
+		name     = r.URL.Query().Get("name")
+		expected = r.URL.Query().Get("expected") == "true"
+	)
+
+	if !c.requireAdmin(w, r) {
+		return
+	}
+
+	if id == "" || name == "" {
+		http.Error(w, "Something went wrong, no device ID or interface name provided", http.StatusInternalServerError)
+		return
+	}
+
+	err := iface.SetExpected(c.Db, id, name, expected)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/details?id="+url.QueryEscape(id)+"#interfaces", http.StatusFound)
 }
@@ -0,0 +1,154 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/mazay/mikromanager/internal"
+)
+
+type devicesImportForm struct {
+	Format string
+	Data   string
+	Msg    string
+	Plan   *internal.DeviceImportPlan
+}
+
+// readImportData returns the import data and format from the request, the data is taken from the
+// uploaded "file" if present and from the "data" field otherwise.
+func readImportData(r *http.Request) (string, string, error) {
+	format := r.PostForm.Get("format")
+
+	file, header, err := r.FormFile("file")
+	if err == http.ErrMissingFile {
+		return r.PostForm.Get("data"), format, nil
+	}
+	if err != nil {
+		return "", format, err
+	}
+	// We don't need to check the error here
+	//nolint:errcheck
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", format, err
+	}
+	switch strings.ToLower(filepath.Ext(header.Filename)) {
+	case ".csv":
+		format = "csv"
+	case ".yaml", ".yml":
+		format = "yaml"
+	}
+	return string(data), format, nil
+}
+
+// importDevices responds to /devices/import, POST requests without the "confirm" field show
+// a preview of the devices that are going to be created or updated, confirmed requests apply it.
+func (c *HttpConfig) importDevices(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		data      = &devicesImportForm{Format: "csv"}
+		templates = []string{devicesImportTmpl, baseTmpl}
+	)
+
+	if !c.requireAdmin(w, r) {
+		return
+	}
+
+	if r.Method == "POST" {
+		// parse the form, up to 10 MB of the uploaded file is kept in memory
+		err = r.ParseMultipartForm(10 << 20)
+		if err != nil && err != http.ErrNotMultipart {
+			c.Logger.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data.Data, data.Format, err = readImportData(r)
+		if err != nil {
+			c.Logger.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		records, err := internal.ParseDevices(strings.NewReader(data.Data), data.Format)
+		if err != nil {
+			data.Msg = err.Error()
+			c.renderTemplate(w, templates, data)
+			return
+		}
+
+		data.Plan, err = internal.PlanDevicesImport(c.Db, records)
+		if err != nil {
+			c.Logger.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if r.PostForm.Get("confirm") != "" {
+			_, err := internal.ApplyDevicesImport(c.Db, data.Plan)
+			if err != nil {
+				c.Logger.Error(err.Error())
+				data.Msg = fmt.Sprintf("nothing was imported: %s", err.Error())
+				data.Plan = nil
+				c.renderTemplate(w, templates, data)
+				return
+			}
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+	}
+
+	c.renderTemplate(w, templates, data)
+}
+
+// exportDevices responds to GET /devices/export?format=<csv|yaml> and downloads the devices
+// inventory in a format suitable for the bulk import.
+func (c *HttpConfig) exportDevices(w http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		d      = &db.Device{}
+		creds  = &db.Credentials{}
+		format = r.URL.Query().Get("format")
+	)
+
+	_, err = c.checkSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "yaml" {
+		http.Error(w, fmt.Sprintf("unsupported format: %s", format), http.StatusBadRequest)
+		return
+	}
+
+	devices, err := d.GetAllPreload(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	credsAll, err := creds.GetAll(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=devices.%s", format))
+	w.Header().Set("Content-Type", "text/plain")
+	err = internal.WriteDevices(w, internal.DevicesToRecords(devices, credsAll), format)
+	if err != nil {
+		c.Logger.Error(err.Error())
+	}
+}
@@ -0,0 +1,131 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/mazay/mikromanager/internal"
+)
+
+type discoveryData struct {
+	Count     int
+	Devices   []*db.DiscoveredDevice
+	Ranges    []string
+	Neighbors bool
+	Running   bool
+}
+
+// getDiscovery responds to GET /discovery and displays the devices found by the network
+// discovery that can be adopted.
+func (c *HttpConfig) getDiscovery(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		dd        = &db.DiscoveredDevice{}
+		data      = &discoveryData{Ranges: c.Discovery.Ranges, Neighbors: c.Discovery.Neighbors}
+		templates = []string{discoveryTmpl, baseTmpl}
+	)
+
+	_, err = c.checkSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	data.Devices, err = dd.GetAll(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Count = len(data.Devices)
+	data.Running = internal.DiscoveryRunning()
+
+	c.renderTemplate(w, templates, data)
+}
+
+// runDiscovery responds to /discovery/run and starts the network discovery in the background.
+func (c *HttpConfig) runDiscovery(w http.ResponseWriter, r *http.Request) {
+	if !c.requireAdmin(w, r) {
+		return
+	}
+
+	if internal.DiscoveryRunning() {
+		http.Error(w, internal.ErrDiscoveryRunning.Error(), http.StatusConflict)
+		return
+	}
+
+	go func() {
+		err := internal.Discover(c.Db, c.Discovery)
+		if err != nil && !errors.Is(err, internal.ErrDiscoveryRunning) {
+			c.Logger.Error(err.Error())
+		}
+	}()
+
+	http.Redirect(w, r, "/discovery", http.StatusFound)
+}
+
+// adoptDevice responds to /discovery/adopt?id=<id> and creates a managed device out of the
+// discovered one, the user is redirected to the new device details.
+func (c *HttpConfig) adoptDevice(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		dd  = &db.DiscoveredDevice{}
+		id  = r.URL.Query().Get("id")
+	)
+
+	if !c.requireAdmin(w, r) {
+		return
+	}
+
+	if id == "" {
+		http.Error(w, "Something went wrong, no device ID provided", http.StatusInternalServerError)
+		return
+	}
+
+	dd.Id = id
+	err = dd.GetById(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	device, err := dd.Adopt(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/details?id="+device.Id, http.StatusFound)
+}
+
+// dismissDevice responds to /discovery/dismiss?id=<id> and hides the discovered device from
+// the proposals.
+func (c *HttpConfig) dismissDevice(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		dd  = &db.DiscoveredDevice{}
+		id  = r.URL.Query().Get("id")
+	)
+
+	if !c.requireAdmin(w, r) {
+		return
+	}
+
+	if id == "" {
+		http.Error(w, "Something went wrong, no device ID provided", http.StatusInternalServerError)
+		return
+	}
+
+	dd.Id = id
+	err = dd.Dismiss(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/discovery", http.StatusFound)
+}
@@ -0,0 +1,57 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/mazay/mikromanager/db"
+)
+
+// eventsLimit is the maximum number of events displayed on the events page
+const eventsLimit = 500
+
+type eventsData struct {
+	Device *db.Device
+	Events []*db.DeviceEvent
+}
+
+// getEvents responds to GET /events and displays the latest device events, the events of
+// a single device are displayed if the "id" parameter is set.
+func (c *HttpConfig) getEvents(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		event     = &db.DeviceEvent{}
+		data      = &eventsData{}
+		id        = r.URL.Query().Get("id")
+		templates = []string{eventsTmpl, baseTmpl}
+	)
+
+	_, err = c.checkSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	if id != "" {
+		data.Device = &db.Device{}
+		data.Device.Id = id
+		err = data.Device.GetById(c.Db)
+		if err != nil {
+			c.Logger.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.Events, err = event.GetByDeviceId(c.Db, id, eventsLimit)
+		for _, e := range data.Events {
+			e.Device = data.Device
+		}
+	} else {
+		data.Events, err = event.GetLatest(c.Db, eventsLimit)
+	}
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c.renderTemplate(w, templates, data)
+}
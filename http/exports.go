@@ -3,10 +3,16 @@ package http
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/mazay/mikromanager/db"
+	"github.com/mazay/mikromanager/internal"
 )
 
+// exportContextLines is the number of the lines displayed before and after the requested line
+const exportContextLines = 5
+
 type exportsData struct {
 	Count       int
 	DeviceId    string
@@ -18,6 +24,21 @@ type exportsData struct {
 type exportData struct {
 	Export     *db.Export
 	ExportData string
+	// Line is the export line requested with the "line" parameter, e.g. a search match, Context
+	// holds the lines around it
+	Line    int
+	Context []*exportLine
+	// Redacted is set when the secrets of the export are masked for the user
+	Redacted bool
+}
+
+type exportLine struct {
+	Number  int
+	Content string
+}
+
+type exportsReconcileData struct {
+	Report *internal.ReconcileReport
 }
 
 // getExports handles the GET request for /exports and displays a paginated list of exports
@@ -78,7 +99,9 @@ func (c *HttpConfig) getExports(w http.ResponseWriter, r *http.Request) {
 	c.renderTemplate(w, templates, data)
 }
 
-// getExport responds to GET /exports?id=<id> and displays the export by <id>
+// getExport responds to GET /exports?id=<id> and displays the export by <id>, the lines around
+// the optional "line" parameter are displayed separately. The secrets are masked for the users
+// not allowed to see them
 func (c *HttpConfig) getExport(w http.ResponseWriter, r *http.Request) {
 	var (
 		err       error
@@ -88,7 +111,7 @@ func (c *HttpConfig) getExport(w http.ResponseWriter, r *http.Request) {
 		templates = []string{exportTmpl, baseTmpl}
 	)
 
-	_, err = c.checkSession(r)
+	user, err := c.sessionUser(r)
 	if err != nil {
 		http.Redirect(w, r, "/login", http.StatusFound)
 		return
@@ -113,11 +136,32 @@ func (c *HttpConfig) getExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	data.ExportData = string(exportBody)
+	if !user.CanViewSecrets() {
+		data.ExportData = internal.RedactExport(data.ExportData)
+		data.Redacted = true
+	}
+
+	data.Line, _ = strconv.Atoi(r.URL.Query().Get("line"))
+	if data.Line > 0 {
+		data.Context = exportContext(data.ExportData, data.Line)
+	}
 
 	c.renderTemplate(w, templates, data)
 }
 
-// downloadExport responds to GET /exports/download?id=<id> and downloads the export by <id>
+// exportContext returns the export lines around the line with the given number.
+func exportContext(export string, line int) []*exportLine {
+	var context []*exportLine
+
+	lines := strings.Split(strings.ReplaceAll(export, "\r\n", "\n"), "\n")
+	for i := max(line-exportContextLines, 1); i <= min(line+exportContextLines, len(lines)); i++ {
+		context = append(context, &exportLine{Number: i, Content: lines[i-1]})
+	}
+	return context
+}
+
+// downloadExport responds to GET /exports/download?id=<id> and downloads the export by <id>, the
+// secrets are masked for the users not allowed to see them
 func (c *HttpConfig) downloadExport(w http.ResponseWriter, r *http.Request) {
 	var (
 		err    error
@@ -125,7 +169,7 @@ func (c *HttpConfig) downloadExport(w http.ResponseWriter, r *http.Request) {
 		id     = r.URL.Query().Get("id")
 	)
 
-	_, err = c.checkSession(r)
+	user, err := c.sessionUser(r)
 	if err != nil {
 		http.Redirect(w, r, "/login", http.StatusFound)
 		return
@@ -150,6 +194,10 @@ func (c *HttpConfig) downloadExport(w http.ResponseWriter, r *http.Request) {
 	}
 
 	filename := fmt.Sprintf("%s %s.rsc", export.Device.Identity, export.LastModified.Format("2006-01-02 15:04:05"))
+	if !user.CanViewSecrets() {
+		exportBody = []byte(internal.RedactExport(string(exportBody)))
+		filename = fmt.Sprintf("%s %s redacted.rsc", export.Device.Identity, export.LastModified.Format("2006-01-02 15:04:05"))
+	}
 
 	// stream the export file
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
@@ -159,3 +207,40 @@ func (c *HttpConfig) downloadExport(w http.ResponseWriter, r *http.Request) {
 		c.Logger.Error(err.Error())
 	}
 }
+
+// reconcileExports responds to /exports/reconcile and compares the exports stored in the DB with the
+// S3 bucket contents. GET requests only report the differences, POST requests by admins fix them.
+func (c *HttpConfig) reconcileExports(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		mode      = internal.ReconcileModeReport
+		data      = &exportsReconcileData{}
+		templates = []string{exportsReconcileTmpl, baseTmpl}
+	)
+
+	switch r.Method {
+	case "GET":
+		_, err = c.checkSession(r)
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+	case "POST":
+		if !c.requireAdmin(w, r) {
+			return
+		}
+		mode = internal.ReconcileModeFix
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data.Report, err = internal.ReconcileExports(c.Db, c.S3, mode)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c.renderTemplate(w, templates, data)
+}
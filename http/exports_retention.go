@@ -1,19 +1,57 @@
 package http
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/mazay/mikromanager/db"
+	"github.com/mazay/mikromanager/internal"
 )
 
 type exportRetentionPolicyForm struct {
-	Id     string
-	Name   string
-	Hourly int64
-	Daily  int64
-	Weekly int64
-	Msg    string
+	Id      string
+	Name    string
+	Hourly  int64
+	Daily   int64
+	Weekly  int64
+	Msg     string
+	Preview *retentionPreview
+}
+
+type retentionPreview struct {
+	Hourly      int64
+	Daily       int64
+	Weekly      int64
+	KeepCount   int
+	RemoveCount int
+	Plans       []*internal.RetentionPlan
+}
+
+type retentionPreviewExport struct {
+	Id           string     `json:"id"`
+	S3Key        string     `json:"s3Key"`
+	LastModified *time.Time `json:"lastModified"`
+}
+
+type retentionPreviewDevice struct {
+	DeviceId string                    `json:"deviceId"`
+	Identity string                    `json:"identity"`
+	Address  string                    `json:"address"`
+	Keep     []*retentionPreviewExport `json:"keep"`
+	Remove   []*retentionPreviewExport `json:"remove"`
+}
+
+type retentionPreviewResponse struct {
+	Hourly      int64                     `json:"hourly"`
+	Daily       int64                     `json:"daily"`
+	Weekly      int64                     `json:"weekly"`
+	KeepCount   int                       `json:"keepCount"`
+	RemoveCount int                       `json:"removeCount"`
+	Devices     []*retentionPreviewDevice `json:"devices"`
 }
 
 func (erp *exportRetentionPolicyForm) formFillIn(policy *db.ExportsRetentionPolicy) {
@@ -24,12 +62,77 @@ func (erp *exportRetentionPolicyForm) formFillIn(policy *db.ExportsRetentionPoli
 	erp.Weekly = policy.Weekly
 }
 
+// policyFromValues overrides the policy retention numbers with the "hourly", "daily" and
+// "weekly" values, the missing ones are kept unless required is set. It returns an error if any
+// of the values is missing while required, empty, not a number or negative.
+func policyFromValues(policy *db.ExportsRetentionPolicy, values url.Values, required bool) error {
+	for _, item := range []struct {
+		key   string
+		field *int64
+	}{
+		{"hourly", &policy.Hourly},
+		{"daily", &policy.Daily},
+		{"weekly", &policy.Weekly},
+	} {
+		if !values.Has(item.key) {
+			if required {
+				return fmt.Errorf("the %s value is required", item.key)
+			}
+			continue
+		}
+		value := strings.TrimSpace(values.Get(item.key))
+		if value == "" {
+			return fmt.Errorf("the %s value is empty", item.key)
+		}
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("the %s value %q is not a number", item.key, value)
+		}
+		if number < 0 {
+			return fmt.Errorf("the %s value should not be negative", item.key)
+		}
+		*item.field = number
+	}
+	return nil
+}
+
+// getRetentionPreview runs the retention logic for the given policy against all the devices
+// exports without deleting anything.
+func (c *HttpConfig) getRetentionPreview(policy *db.ExportsRetentionPolicy) (*retentionPreview, error) {
+	preview := &retentionPreview{
+		Hourly: policy.Hourly,
+		Daily:  policy.Daily,
+		Weekly: policy.Weekly,
+	}
+
+	plans, err := internal.PlanDevicesRetention(c.Db, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, plan := range plans {
+		preview.KeepCount += len(plan.Keep)
+		preview.RemoveCount += len(plan.Remove)
+	}
+	preview.Plans = plans
+
+	return preview, nil
+}
+
+func toRetentionPreviewExports(exports []*db.Export) []*retentionPreviewExport {
+	var items = []*retentionPreviewExport{}
+	for _, e := range exports {
+		items = append(items, &retentionPreviewExport{Id: e.Id, S3Key: e.S3Key, LastModified: e.LastModified})
+	}
+	return items
+}
+
 func (c *HttpConfig) editExportRetentionPolicy(w http.ResponseWriter, r *http.Request) {
 	var (
 		err       error
 		data      = &exportRetentionPolicyForm{}
 		erp       = &db.ExportsRetentionPolicy{Name: "Default"}
-		templates = []string{erpTmpl, baseTmpl}
+		templates = []string{erpTmpl, erpPreviewTmpl, baseTmpl}
 	)
 
 	_, err = c.checkSession(r)
@@ -54,29 +157,27 @@ func (c *HttpConfig) editExportRetentionPolicy(w http.ResponseWriter, r *http.Re
 			return
 		}
 
-		hourly, err := strconv.ParseInt(r.PostForm.Get("hourly"), 10, 64)
+		stored := *erp
+		err = policyFromValues(erp, r.PostForm, true)
 		if err != nil {
-			c.Logger.Error(err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			data.Msg = err.Error()
+			data.formFillIn(&stored)
+			c.renderTemplate(w, templates, data)
 			return
 		}
-		erp.Hourly = hourly
 
-		daily, err := strconv.ParseInt(r.PostForm.Get("daily"), 10, 64)
-		if err != nil {
-			c.Logger.Error(err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		erp.Daily = daily
-
-		weekly, err := strconv.ParseInt(r.PostForm.Get("weekly"), 10, 64)
-		if err != nil {
-			c.Logger.Error(err.Error())
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		// show the impact of the new policy and ask for confirmation before saving
+		if r.PostForm.Get("confirm") == "" {
+			data.Preview, err = c.getRetentionPreview(erp)
+			if err != nil {
+				c.Logger.Error(err.Error())
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			data.formFillIn(erp)
+			c.renderTemplate(w, templates, data)
 			return
 		}
-		erp.Weekly = weekly
 
 		err = erp.Update(c.Db)
 		if err != nil {
@@ -89,3 +190,101 @@ func (c *HttpConfig) editExportRetentionPolicy(w http.ResponseWriter, r *http.Re
 	data.formFillIn(erp)
 	c.renderTemplate(w, templates, data)
 }
+
+// previewExportRetentionPolicy responds to GET /erp/preview and shows the policy form along with
+// the exports that would be kept or removed per device, the current policy can be overridden with
+// "hourly", "daily" and "weekly" query parameters.
+func (c *HttpConfig) previewExportRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		data      = &exportRetentionPolicyForm{}
+		erp       = &db.ExportsRetentionPolicy{Name: "Default"}
+		templates = []string{erpTmpl, erpPreviewTmpl, baseTmpl}
+	)
+
+	_, err = c.checkSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	err = erp.GetDefault(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = policyFromValues(erp, r.URL.Query(), false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data.Preview, err = c.getRetentionPreview(erp)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data.formFillIn(erp)
+	c.renderTemplate(w, templates, data)
+}
+
+// apiPreviewExportRetentionPolicy responds to GET /api/erp/preview with the JSON version of the
+// retention preview, it accepts the same query parameters as the HTML preview.
+func (c *HttpConfig) apiPreviewExportRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	var (
+		err      error
+		erp      = &db.ExportsRetentionPolicy{Name: "Default"}
+		response = &retentionPreviewResponse{Devices: []*retentionPreviewDevice{}}
+	)
+
+	_, err = c.checkSession(r)
+	if err != nil {
+		c.writeJSONError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	err = erp.GetDefault(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		c.writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = policyFromValues(erp, r.URL.Query(), false)
+	if err != nil {
+		c.writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	preview, err := c.getRetentionPreview(erp)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		c.writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.Hourly = preview.Hourly
+	response.Daily = preview.Daily
+	response.Weekly = preview.Weekly
+	response.KeepCount = preview.KeepCount
+	response.RemoveCount = preview.RemoveCount
+	for _, plan := range preview.Plans {
+		device := &retentionPreviewDevice{
+			DeviceId: plan.DeviceId,
+			Keep:     toRetentionPreviewExports(plan.Keep),
+			Remove:   toRetentionPreviewExports(plan.Remove),
+		}
+		// the exports with no device attached have no device details
+		if plan.Device != nil {
+			device.Identity = plan.Device.Identity
+			device.Address = plan.Device.Address
+		}
+		response.Devices = append(response.Devices, device)
+	}
+
+	c.writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/mazay/mikromanager/internal"
+)
+
+// exportsSearchLimit is the maximum number of the displayed search matches
+const exportsSearchLimit = 500
+
+type exportsSearchData struct {
+	Search  *internal.ExportSearch
+	Matches []*internal.ExportMatch
+	// Truncated is set when the number of the matches reached the limit
+	Truncated bool
+	Msg       string
+}
+
+// searchExports responds to GET /exports/search and finds the export lines containing the "q"
+// parameter, the "regex" parameter makes it a regular expression and the "all" parameter
+// searches all the retained exports rather than the latest ones.
+func (c *HttpConfig) searchExports(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		query     = r.URL.Query()
+		data      = &exportsSearchData{}
+		templates = []string{exportsSearchTmpl, baseTmpl}
+	)
+
+	user, err := c.sessionUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	data.Search = &internal.ExportSearch{
+		Query:  query.Get("q"),
+		Regex:  query.Get("regex") != "",
+		All:    query.Get("all") != "",
+		Redact: !user.CanViewSecrets(),
+		Limit:  exportsSearchLimit,
+	}
+	if query.Get("indexing") != "" {
+		data.Msg = "The exports missing from the search index are being indexed, repeat the search in a few moments."
+	}
+
+	if data.Search.Query != "" {
+		data.Matches, err = internal.SearchExports(c.Db, data.Search)
+		if err != nil {
+			data.Msg = err.Error()
+		}
+		data.Truncated = len(data.Matches) >= exportsSearchLimit
+	}
+
+	c.renderTemplate(w, templates, data)
+}
+
+// indexExports responds to /exports/index and indexes the exports missing from the search index
+// in the background.
+func (c *HttpConfig) indexExports(w http.ResponseWriter, r *http.Request) {
+	_, err := c.checkSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	go func() {
+		_, err := internal.IndexExports(c.Db, c.S3)
+		if err != nil {
+			c.Logger.Error(err.Error())
+		}
+	}()
+
+	http.Redirect(w, r, "/exports/search?indexing=true", http.StatusFound)
+}
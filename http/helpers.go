@@ -1,6 +1,8 @@
 package http
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -11,23 +13,50 @@ import (
 )
 
 var (
-	loginTmpl           = path.Join("templates", "login.html")
-	baseTmpl            = path.Join("templates", "base.html")
-	paginationTmpl      = path.Join("templates", "pagination.html")
-	indexTmpl           = path.Join("templates", "index.html")
-	deviceDetailsTmpl   = path.Join("templates", "device_details.html")
-	deviceFormTmpl      = path.Join("templates", "device_form.html")
-	credsTmpl           = path.Join("templates", "credentials.html")
-	credsFormTmpl       = path.Join("templates", "credentials_form.html")
-	erpTmpl             = path.Join("templates", "erp_form.html")
-	exportsTmpl         = path.Join("templates", "exports.html")
-	exportTmpl          = path.Join("templates", "export.html")
-	userFormTmpl        = path.Join("templates", "user_form.html")
-	usersTmpl           = path.Join("templates", "users.html")
-	deviceGroupFormTmpl = path.Join("templates", "device_group_form.html")
-	deviceGroupsTmpl    = path.Join("templates", "device_groups.html")
-	deviceGroupTmpl     = path.Join("templates", "device_group_details.html")
-	updateModalTmpl     = path.Join("templates", "update_modal.html")
+	loginTmpl               = path.Join("templates", "login.html")
+	baseTmpl                = path.Join("templates", "base.html")
+	paginationTmpl          = path.Join("templates", "pagination.html")
+	indexTmpl               = path.Join("templates", "index.html")
+	deviceDetailsTmpl       = path.Join("templates", "device_details.html")
+	deviceFormTmpl          = path.Join("templates", "device_form.html")
+	credsTmpl               = path.Join("templates", "credentials.html")
+	credsFormTmpl           = path.Join("templates", "credentials_form.html")
+	erpTmpl                 = path.Join("templates", "erp_form.html")
+	exportsTmpl             = path.Join("templates", "exports.html")
+	exportTmpl              = path.Join("templates", "export.html")
+	userFormTmpl            = path.Join("templates", "user_form.html")
+	usersTmpl               = path.Join("templates", "users.html")
+	deviceGroupFormTmpl     = path.Join("templates", "device_group_form.html")
+	deviceGroupsTmpl        = path.Join("templates", "device_groups.html")
+	deviceGroupTmpl         = path.Join("templates", "device_group_details.html")
+	updateModalTmpl         = path.Join("templates", "update_modal.html")
+	erpPreviewTmpl          = path.Join("templates", "erp_preview.html")
+	exportsReconcileTmpl    = path.Join("templates", "exports_reconcile.html")
+	trashTmpl               = path.Join("templates", "trash.html")
+	devicesImportTmpl       = path.Join("templates", "devices_import.html")
+	discoveryTmpl           = path.Join("templates", "discovery.html")
+	eventsTmpl              = path.Join("templates", "events.html")
+	fallbackCredsTmpl       = path.Join("templates", "fallback_credentials.html")
+	collectorSettingsTmpl   = path.Join("templates", "collector_settings.html")
+	passwordRotationTmpl    = path.Join("templates", "password_rotation.html")
+	secretSourceTmpl        = path.Join("templates", "secret_source.html")
+	upgradesTmpl            = path.Join("templates", "upgrades.html")
+	upgradeStatusTmpl       = path.Join("templates", "upgrade_status.html")
+	rolloutsTmpl            = path.Join("templates", "rollouts.html")
+	rolloutTmpl             = path.Join("templates", "rollout.html")
+	rolloutFormTmpl         = path.Join("templates", "rollout_form.html")
+	rolloutStatusTmpl       = path.Join("templates", "rollout_status.html")
+	complianceTmpl          = path.Join("templates", "compliance.html")
+	commandsTmpl            = path.Join("templates", "commands.html")
+	commandTmpl             = path.Join("templates", "command.html")
+	configTemplatesTmpl     = path.Join("templates", "config_templates.html")
+	configTemplateFormTmpl  = path.Join("templates", "config_template_form.html")
+	configTemplateApplyTmpl = path.Join("templates", "config_template_apply.html")
+	policiesTmpl            = path.Join("templates", "policies.html")
+	policyFormTmpl          = path.Join("templates", "policy_form.html")
+	exportsSearchTmpl       = path.Join("templates", "exports_search.html")
+	inventorySearchTmpl     = path.Join("templates", "inventory_search.html")
+	wirelessTmpl            = path.Join("templates", "wireless.html")
 )
 
 func handlerWrapper(fn http.HandlerFunc, logger *zap.Logger) http.HandlerFunc {
@@ -90,3 +119,67 @@ func (c *HttpConfig) checkSession(r *http.Request) (*db.Session, error) {
 
 	return session, err
 }
+
+// sessionUser returns the user of the request session. It returns an error if the session is
+// invalid or the user can not be fetched.
+func (c *HttpConfig) sessionUser(r *http.Request) (*db.User, error) {
+	session, err := c.checkSession(r)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &db.User{}
+	user.Id = session.UserId
+	return user, user.GetById(c.Db)
+}
+
+// requireAdmin responds with 403 unless the session user is an admin. It returns false if the
+// request should not be processed any further.
+func (c *HttpConfig) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	user, err := c.sessionUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return false
+	}
+	if !user.IsAdmin() {
+		http.Error(w, "This action requires the admin role", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// requireAdminJSON is requireAdmin for the JSON endpoints, the errors are written as JSON.
+func (c *HttpConfig) requireAdminJSON(w http.ResponseWriter, r *http.Request) bool {
+	user, err := c.sessionUser(r)
+	if err != nil {
+		c.writeJSONError(w, http.StatusUnauthorized, err)
+		return false
+	}
+	if !user.IsAdmin() {
+		c.writeJSONError(w, http.StatusForbidden, errors.New("this action requires the admin role"))
+		return false
+	}
+	return true
+}
+
+// writeJSON serializes the data as JSON and writes it to the response with the given status code.
+func (c *HttpConfig) writeJSON(w http.ResponseWriter, status int, data any) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(js)
+	if err != nil {
+		c.Logger.Error(err.Error())
+	}
+}
+
+// writeJSONError writes an error message as a JSON object with the given status code.
+func (c *HttpConfig) writeJSONError(w http.ResponseWriter, status int, err error) {
+	c.writeJSON(w, status, map[string]string{"error": err.Error()})
+}
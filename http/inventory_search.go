@@ -0,0 +1,38 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/mazay/mikromanager/internal"
+)
+
+type inventorySearchData struct {
+	Query   string
+	Matches []*internal.InventoryMatch
+	Msg     string
+}
+
+// searchInventory responds to GET /inventory/search and finds the device addresses, routes,
+// DHCP leases, ARP entries and interfaces matching the "q" parameter, e.g. an IP or MAC address.
+func (c *HttpConfig) searchInventory(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		data      = &inventorySearchData{Query: r.URL.Query().Get("q")}
+		templates = []string{inventorySearchTmpl, baseTmpl}
+	)
+
+	_, err = c.checkSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	if data.Query != "" {
+		data.Matches, err = internal.SearchInventory(c.Db, data.Query)
+		if err != nil {
+			data.Msg = err.Error()
+		}
+	}
+
+	c.renderTemplate(w, templates, data)
+}
@@ -2,6 +2,7 @@ package http
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/mazay/mikromanager/db"
 	"github.com/mazay/mikromanager/internal"
@@ -12,9 +13,21 @@ type HttpConfig struct {
 	Port          string
 	Db            *db.DB
 	EncryptionKey string
-	Logger        *zap.Logger
-	BackupPath    string
-	S3            *internal.S3
+	// Secrets resolves the device credentials passwords
+	Secrets    *internal.Secrets
+	Logger     *zap.Logger
+	BackupPath string
+	S3         *internal.S3
+	// TrashRetention is the grace period before trashed devices are purged
+	TrashRetention time.Duration
+	Discovery      *internal.DiscoveryConfig
+	Upgrader       *internal.Upgrader
+	Commands       *internal.CommandRunner
+	// Collectors holds the poller collectors configurable per device group
+	Collectors []internal.Collector
+	// ApiPool keeps the device API connections shared with the pollers
+	ApiPool  *internal.ApiPool
+	Timeouts internal.DeviceTimeouts
 }
 
 func (c *HttpConfig) HttpServer() {
@@ -30,17 +43,54 @@ func (c *HttpConfig) HttpServer() {
 	http.HandleFunc("/details", handlerWrapper(c.getDevice, c.Logger))
 	http.HandleFunc("/edit", handlerWrapper(c.editDevice, c.Logger))
 	http.HandleFunc("/delete", handlerWrapper(c.deleteDevice, c.Logger))
+	http.HandleFunc("/devices/import", handlerWrapper(c.importDevices, c.Logger))
+	http.HandleFunc("/devices/export", handlerWrapper(c.exportDevices, c.Logger))
+	http.HandleFunc("/trash", handlerWrapper(c.getTrash, c.Logger))
+	http.HandleFunc("/trash/restore", handlerWrapper(c.restoreDevice, c.Logger))
+	http.HandleFunc("/trash/purge", handlerWrapper(c.purgeDevice, c.Logger))
+	http.HandleFunc("/events", handlerWrapper(c.getEvents, c.Logger))
+	http.HandleFunc("/upgrades", handlerWrapper(c.getUpgrades, c.Logger))
+	http.HandleFunc("/compliance", handlerWrapper(c.getCompliance, c.Logger))
+	http.HandleFunc("/rollouts", handlerWrapper(c.getRollouts, c.Logger))
+	http.HandleFunc("/rollout", handlerWrapper(c.getRollout, c.Logger))
+	http.HandleFunc("/rollout/edit", handlerWrapper(c.editRollout, c.Logger))
+	http.HandleFunc("/rollout/cancel", handlerWrapper(c.changeRollout, c.Logger))
+	http.HandleFunc("/rollout/resume", handlerWrapper(c.changeRollout, c.Logger))
+	http.HandleFunc("/commands", handlerWrapper(c.getCommands, c.Logger))
+	http.HandleFunc("/command", handlerWrapper(c.getCommand, c.Logger))
+	http.HandleFunc("/templates", handlerWrapper(c.getConfigTemplates, c.Logger))
+	http.HandleFunc("/template/edit", handlerWrapper(c.editConfigTemplate, c.Logger))
+	http.HandleFunc("/template/delete", handlerWrapper(c.deleteConfigTemplate, c.Logger))
+	http.HandleFunc("/template/apply", handlerWrapper(c.applyConfigTemplate, c.Logger))
+	http.HandleFunc("/policies", handlerWrapper(c.getPolicies, c.Logger))
+	http.HandleFunc("/policies/check", handlerWrapper(c.checkPolicies, c.Logger))
+	http.HandleFunc("/policy/edit", handlerWrapper(c.editPolicy, c.Logger))
+	http.HandleFunc("/policy/delete", handlerWrapper(c.deletePolicy, c.Logger))
+	http.HandleFunc("/discovery", handlerWrapper(c.getDiscovery, c.Logger))
+	http.HandleFunc("/discovery/run", handlerWrapper(c.runDiscovery, c.Logger))
+	http.HandleFunc("/discovery/adopt", handlerWrapper(c.adoptDevice, c.Logger))
+	http.HandleFunc("/discovery/dismiss", handlerWrapper(c.dismissDevice, c.Logger))
 	http.HandleFunc("/credentials", handlerWrapper(c.getCredentials, c.Logger))
 	http.HandleFunc("/credentials/edit", handlerWrapper(c.editCredentials, c.Logger))
 	http.HandleFunc("/credentials/delete", handlerWrapper(c.deleteCredentials, c.Logger))
+	http.HandleFunc("/credentials/rotate", handlerWrapper(c.rotatePassword, c.Logger))
 	http.HandleFunc("/erp", handlerWrapper(c.editExportRetentionPolicy, c.Logger))
+	http.HandleFunc("/erp/preview", handlerWrapper(c.previewExportRetentionPolicy, c.Logger))
+	http.HandleFunc("/api/erp/preview", handlerWrapper(c.apiPreviewExportRetentionPolicy, c.Logger))
+	http.HandleFunc("/api/device/channel", handlerWrapper(c.apiSetUpdateChannel, c.Logger))
 	http.HandleFunc("/exports", handlerWrapper(c.getExports, c.Logger))
 	http.HandleFunc("/export", handlerWrapper(c.getExport, c.Logger))
 	http.HandleFunc("/export/download", handlerWrapper(c.downloadExport, c.Logger))
+	http.HandleFunc("/exports/reconcile", handlerWrapper(c.reconcileExports, c.Logger))
+	http.HandleFunc("/exports/search", handlerWrapper(c.searchExports, c.Logger))
+	http.HandleFunc("/exports/index", handlerWrapper(c.indexExports, c.Logger))
 	http.HandleFunc("/device/groups", handlerWrapper(c.getDeviceGroups, c.Logger))
 	http.HandleFunc("/device/group/edit", handlerWrapper(c.editDeviceGroup, c.Logger))
 	http.HandleFunc("/device/group", handlerWrapper(c.getDeviceGroup, c.Logger))
 	http.HandleFunc("/device/group/delete", handlerWrapper(c.deleteDeviceGroup, c.Logger))
+	http.HandleFunc("/inventory/search", handlerWrapper(c.searchInventory, c.Logger))
+	http.HandleFunc("/wireless", handlerWrapper(c.getWireless, c.Logger))
+	http.HandleFunc("/device/interface/expected", handlerWrapper(c.setInterfaceExpected, c.Logger))
 	http.HandleFunc("/device/update", handlerWrapper(c.updateDevice, c.Logger))
 	http.Handle("/static/", http.StripPrefix("/static/", static))
 	c.Logger.Fatal(http.ListenAndServe(":"+c.Port, nil).Error())
@@ -0,0 +1,95 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/mazay/mikromanager/internal"
+)
+
+// defaultPasswordLength is the length of the generated passwords unless another is requested
+const defaultPasswordLength = 24
+
+type passwordRotationData struct {
+	Credentials *db.Credentials
+	Devices     []*db.Device
+	Skipped     []*db.Device
+	Length      int
+	Msg         string
+	Report      *internal.RotationReport
+}
+
+// rotatePassword responds to /credentials/rotate?id=<id>, GET shows the devices the password is
+// going to be rotated on, POST rotates the password and shows the report. The new password is
+// either generated or provided with the "password" and "confirm" form values.
+func (c *HttpConfig) rotatePassword(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		creds     = &db.Credentials{}
+		device    = &db.Device{}
+		data      = &passwordRotationData{Length: defaultPasswordLength}
+		id        = r.URL.Query().Get("id")
+		templates = []string{passwordRotationTmpl, baseTmpl}
+	)
+
+	if !c.requireAdmin(w, r) {
+		return
+	}
+
+	if id == "" {
+		http.Error(w, "Something went wrong, no credentials ID provided", http.StatusInternalServerError)
+		return
+	}
+
+	creds.Id = id
+	err = creds.GetById(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Credentials = creds
+
+	devices, err := device.GetAllPlain(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Devices, data.Skipped = internal.RotationDevices(devices, creds)
+
+	if r.Method == "POST" {
+		err = r.ParseForm()
+		if err != nil {
+			c.Logger.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		password := r.PostForm.Get("password")
+		if password == "" {
+			data.Length, err = strconv.Atoi(r.PostForm.Get("length"))
+			if err == nil {
+				password, err = internal.GeneratePassword(data.Length)
+			}
+		} else if password != r.PostForm.Get("confirm") {
+			data.Msg = "The passwords do not match"
+		}
+		if err != nil {
+			data.Msg = err.Error()
+		}
+
+		if data.Msg == "" {
+			// every device request is limited in time, a rotation cut short by a closed page is
+			// rolled back
+			data.Report, err = internal.RotatePassword(r.Context(), c.Db, creds, password, c.EncryptionKey, c.Timeouts, c.Logger)
+			if err != nil {
+				c.Logger.Error(err.Error())
+				data.Msg = err.Error()
+			}
+		}
+	}
+
+	c.renderTemplate(w, templates, data)
+}
@@ -0,0 +1,238 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/mazay/mikromanager/internal"
+)
+
+// rolloutStartLayout is the format of the datetime-local input
+const rolloutStartLayout = "2006-01-02T15:04"
+
+type rolloutsData struct {
+	Rollouts []*db.Rollout
+}
+
+type rolloutData struct {
+	Rollout *db.Rollout
+	// Batches holds the devices of the rollout by batch
+	Batches [][]*db.RolloutDevice
+	Msg     string
+}
+
+type rolloutForm struct {
+	Groups       []*db.DeviceGroup
+	GroupId      string
+	Firmware     bool
+	Canary       int
+	BatchSize    int
+	PauseMinutes int
+	WindowStart  string
+	WindowEnd    string
+	StartAt      string
+	Msg          string
+}
+
+// rolloutFromValues plans the rollout of the group from the submitted form. It returns an error
+// message if any of the values is invalid or the rollout can not be planned.
+func rolloutFromValues(group *db.DeviceGroup, form *rolloutForm) (*db.Rollout, string) {
+	err := internal.ValidateWindow(form.WindowStart, form.WindowEnd)
+	if err != nil {
+		return nil, err.Error()
+	}
+	if form.PauseMinutes < 0 {
+		return nil, "The pause can not be negative"
+	}
+
+	startAt := time.Now()
+	if form.StartAt != "" {
+		startAt, err = time.ParseInLocation(rolloutStartLayout, form.StartAt, time.Local)
+		if err != nil {
+			return nil, "Invalid start time"
+		}
+	}
+
+	rollout, err := internal.NewRollout(group, form.Firmware, form.Canary, form.BatchSize)
+	if err != nil {
+		return nil, err.Error()
+	}
+	rollout.BatchPause = time.Duration(form.PauseMinutes) * time.Minute
+	rollout.WindowStart = form.WindowStart
+	rollout.WindowEnd = form.WindowEnd
+	rollout.StartAt = startAt
+
+	return rollout, ""
+}
+
+// getRollouts responds to GET /rollouts and displays all the rollouts, the latest first.
+func (c *HttpConfig) getRollouts(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		rollout   = &db.Rollout{}
+		data      = &rolloutsData{}
+		templates = []string{rolloutsTmpl, rolloutStatusTmpl, baseTmpl}
+	)
+
+	_, err = c.checkSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	data.Rollouts, err = rollout.GetAll(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c.renderTemplate(w, templates, data)
+}
+
+// getRollout responds to GET /rollout?id=<id> and displays the rollout batches along with the
+// upgrade status of every device.
+func (c *HttpConfig) getRollout(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		data      = &rolloutData{Rollout: &db.Rollout{}}
+		id        = r.URL.Query().Get("id")
+		templates = []string{rolloutTmpl, rolloutStatusTmpl, upgradeStatusTmpl, baseTmpl}
+	)
+
+	_, err = c.checkSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	if id == "" {
+		http.Error(w, "Something went wrong, no rollout ID provided", http.StatusInternalServerError)
+		return
+	}
+
+	data.Rollout.Id = id
+	err = data.Rollout.GetById(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range data.Rollout.Batches() {
+		data.Batches = append(data.Batches, data.Rollout.BatchDevices(i))
+	}
+	data.Msg = r.URL.Query().Get("msg")
+
+	c.renderTemplate(w, templates, data)
+}
+
+// editRollout responds to /rollout/edit, GET displays the form for scheduling a rollout of the
+// group set with the "group" parameter, POST plans and schedules the rollout.
+func (c *HttpConfig) editRollout(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		group     = &db.DeviceGroup{}
+		data      = &rolloutForm{Canary: 1, BatchSize: 5, PauseMinutes: 30}
+		templates = []string{rolloutFormTmpl, baseTmpl}
+	)
+
+	if !c.requireAdmin(w, r) {
+		return
+	}
+
+	data.Groups, err = group.GetAllPlain(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "POST" {
+		err = r.ParseForm()
+		if err != nil {
+			c.Logger.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data.GroupId = r.PostForm.Get("group")
+		data.Firmware = r.PostForm.Get("firmware") != ""
+		data.WindowStart = r.PostForm.Get("windowStart")
+		data.WindowEnd = r.PostForm.Get("windowEnd")
+		data.StartAt = r.PostForm.Get("startAt")
+		// invalid numbers are caught by the planning
+		data.Canary, _ = strconv.Atoi(r.PostForm.Get("canary"))
+		data.BatchSize, _ = strconv.Atoi(r.PostForm.Get("batchSize"))
+		data.PauseMinutes, _ = strconv.Atoi(r.PostForm.Get("pause"))
+
+		group.Id = data.GroupId
+		err = group.GetById(c.Db)
+		if err != nil {
+			data.Msg = err.Error()
+			c.renderTemplate(w, templates, data)
+			return
+		}
+
+		rollout, msg := rolloutFromValues(group, data)
+		if msg != "" {
+			data.Msg = msg
+			c.renderTemplate(w, templates, data)
+			return
+		}
+
+		err = rollout.Create(c.Db)
+		if err != nil {
+			c.Logger.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/rollout?id="+rollout.Id, http.StatusFound)
+		return
+	}
+
+	data.GroupId = r.URL.Query().Get("group")
+	c.renderTemplate(w, templates, data)
+}
+
+// changeRollout responds to /rollout/cancel and /rollout/resume and applies the action to the
+// rollout with the given ID, the failures are displayed on the rollout page.
+func (c *HttpConfig) changeRollout(w http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		rollout = &db.Rollout{}
+		id      = r.URL.Query().Get("id")
+	)
+
+	if !c.requireAdmin(w, r) {
+		return
+	}
+
+	if id == "" {
+		http.Error(w, "Something went wrong, no rollout ID provided", http.StatusInternalServerError)
+		return
+	}
+
+	rollout.Id = id
+	err = rollout.GetById(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Path == "/rollout/resume" {
+		err = internal.ResumeRollout(c.Db, rollout)
+	} else {
+		err = internal.CancelRollout(c.Db, rollout)
+	}
+	target := "/rollout?id=" + rollout.Id
+	if err != nil {
+		target += "&msg=" + url.QueryEscape(err.Error())
+	}
+
+	http.Redirect(w, r, target, http.StatusFound)
+}
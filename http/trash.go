@@ -0,0 +1,133 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/mazay/mikromanager/internal"
+)
+
+type trashedDevice struct {
+	Device     *db.Device
+	PurgeAfter time.Time
+}
+
+type trashData struct {
+	Count          int
+	Devices        []*trashedDevice
+	TrashRetention time.Duration
+}
+
+// getTrash responds to GET /trash and displays the devices that were moved to the trash
+// along with the time they are going to be purged at.
+func (c *HttpConfig) getTrash(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		d         = &db.Device{}
+		data      = &trashData{TrashRetention: c.TrashRetention}
+		templates = []string{trashTmpl, baseTmpl}
+	)
+
+	_, err = c.checkSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	trashed, err := d.GetAllTrashed(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data.Count = len(trashed)
+	for _, device := range trashed {
+		data.Devices = append(data.Devices, &trashedDevice{
+			Device:     device,
+			PurgeAfter: internal.PurgeAfter(device, c.TrashRetention),
+		})
+	}
+
+	c.renderTemplate(w, templates, data)
+}
+
+// restoreDevice responds to POST /trash/restore?id=<id> and takes the device out of the trash,
+// it requires the admin role.
+func (c *HttpConfig) restoreDevice(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		d   = &db.Device{}
+		id  = r.URL.Query().Get("id")
+	)
+
+	if !c.requireAdmin(w, r) {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if id == "" {
+		http.Error(w, "Something went wrong, no device ID provided", http.StatusInternalServerError)
+		return
+	}
+
+	d.Id = id
+	err = d.Restore(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/trash", http.StatusFound)
+}
+
+// purgeDevice responds to POST /trash/purge?id=<id> and permanently deletes a trashed device
+// without waiting for the grace period, its exports are either archived or deleted. It requires
+// the admin role.
+func (c *HttpConfig) purgeDevice(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+		d   = &db.Device{}
+		id  = r.URL.Query().Get("id")
+	)
+
+	if !c.requireAdmin(w, r) {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if id == "" {
+		http.Error(w, "Something went wrong, no device ID provided", http.StatusInternalServerError)
+		return
+	}
+
+	d.Id = id
+	err = d.GetById(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !d.Trashed() {
+		http.Error(w, "Only devices in the trash can be purged", http.StatusBadRequest)
+		return
+	}
+
+	err = internal.PurgeDevice(c.Db, c.S3, d)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/trash", http.StatusFound)
+}
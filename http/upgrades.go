@@ -0,0 +1,65 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/mazay/mikromanager/db"
+)
+
+// upgradesLimit is the maximum number of upgrades displayed on the upgrades page
+const upgradesLimit = 200
+
+type upgradesData struct {
+	Device   *db.Device
+	Upgrades []*db.DeviceUpgrade
+	// Running is set when any of the displayed upgrades is in progress
+	Running bool
+}
+
+// getUpgrades responds to GET /upgrades and displays the latest device upgrades, the upgrades
+// of a single device are displayed if the "id" parameter is set.
+func (c *HttpConfig) getUpgrades(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		upgrade   = &db.DeviceUpgrade{}
+		data      = &upgradesData{}
+		id        = r.URL.Query().Get("id")
+		templates = []string{upgradesTmpl, upgradeStatusTmpl, baseTmpl}
+	)
+
+	_, err = c.checkSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	if id != "" {
+		data.Device = &db.Device{}
+		data.Device.Id = id
+		err = data.Device.GetById(c.Db)
+		if err != nil {
+			c.Logger.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.Upgrades, err = upgrade.GetByDeviceId(c.Db, id, upgradesLimit)
+		for _, u := range data.Upgrades {
+			u.Device = data.Device
+		}
+	} else {
+		data.Upgrades, err = upgrade.GetLatest(c.Db, upgradesLimit)
+	}
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, u := range data.Upgrades {
+		if !u.Finished() {
+			data.Running = true
+		}
+	}
+
+	c.renderTemplate(w, templates, data)
+}
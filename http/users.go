@@ -2,6 +2,7 @@ package http
 
 import (
 	"net/http"
+	"slices"
 
 	"github.com/mazay/mikromanager/db"
 )
@@ -10,6 +11,9 @@ type userForm struct {
 	Id                string
 	Username          string
 	EncryptedPassword string
+	Role              string
+	ViewSecrets       bool
+	Roles             []string
 	Msg               string
 }
 
@@ -24,20 +28,23 @@ func (uf *userForm) formFillIn(user *db.User) {
 	uf.Id = user.Id
 	uf.Username = user.Username
 	uf.EncryptedPassword = user.EncryptedPassword
+	uf.Role = user.Role
+	uf.ViewSecrets = user.ViewSecrets
+	if uf.Role == "" {
+		uf.Role = db.UserRoleAdmin
+	}
 }
 
 func (c *HttpConfig) editUser(w http.ResponseWriter, r *http.Request) {
 	var (
 		err       error
 		formErr   error
-		data      = &userForm{}
+		data      = &userForm{Role: db.UserRoleOperator, Roles: db.UserRoles}
 		user      = &db.User{}
 		templates = []string{userFormTmpl, baseTmpl}
 	)
 
-	_, err = c.checkSession(r)
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
+	if !c.requireAdmin(w, r) {
 		return
 	}
 
@@ -52,6 +59,12 @@ func (c *HttpConfig) editUser(w http.ResponseWriter, r *http.Request) {
 
 		id := r.PostForm.Get("idInput")
 		username := r.PostForm.Get("username")
+		role := r.PostForm.Get("role")
+		viewSecrets := r.PostForm.Get("viewSecrets") != ""
+		if !slices.Contains(db.UserRoles, role) {
+			http.Error(w, "Unknown role "+role, http.StatusBadRequest)
+			return
+		}
 		encryptedPw, err := db.EncryptString(r.PostForm.Get("password"), c.EncryptionKey)
 		if err != nil {
 			c.Logger.Error(err.Error())
@@ -62,6 +75,8 @@ func (c *HttpConfig) editUser(w http.ResponseWriter, r *http.Request) {
 		user.Id = id
 		user.Username = username
 		user.EncryptedPassword = encryptedPw
+		user.Role = role
+		user.ViewSecrets = viewSecrets
 
 		if id == "" {
 			// "id" is unset - create new user
@@ -77,6 +92,8 @@ func (c *HttpConfig) editUser(w http.ResponseWriter, r *http.Request) {
 			}
 			user.Username = username
 			user.EncryptedPassword = encryptedPw
+			user.Role = role
+			user.ViewSecrets = viewSecrets
 			formErr = user.Update(c.Db)
 			if formErr != nil {
 				data.Msg = formErr.Error()
@@ -161,9 +178,7 @@ func (c *HttpConfig) deleteUser(w http.ResponseWriter, r *http.Request) {
 		id  = r.URL.Query().Get("id")
 	)
 
-	_, err = c.checkSession(r)
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
+	if !c.requireAdmin(w, r) {
 		return
 	}
 
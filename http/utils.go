@@ -16,8 +16,10 @@ var funcMap = template.FuncMap{
 	"memoryUsage":   memoryUsage,
 	"containsInt":   containsInt,
 	"humahizeBytes": humahizeBytes,
+	"humanizeRate":  humanizeRate,
 	"hasPrefix":     strings.HasPrefix,
 	"in":            func(s string, l []string) bool { return slices.Contains(l, s) },
+	"add":           func(a, b int) int { return a + b },
 }
 
 func replace(input, from, to string) string {
@@ -38,6 +40,20 @@ func humahizeBytes(b int64) string {
 		float64(b)/float64(div), "KMGTPE"[exp])
 }
 
+// humanizeRate formats the bits per second rate using the decimal units, e.g. "1.5 Mbps".
+func humanizeRate(bps float64) string {
+	const unit = 1000
+	if bps < unit {
+		return fmt.Sprintf("%.0f bps", bps)
+	}
+	div, exp := float64(unit), 0
+	for n := bps / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cbps", bps/div, "kMGTPE"[exp])
+}
+
 func timeAgo(t time.Time) string {
 	diff := time.Since(t)
 	out := time.Time{}.Add(diff)
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/mazay/mikromanager/internal"
+)
+
+// wirelessHistoryPeriod is the period of the client counts summarized on the wireless and the
+// device details pages
+const wirelessHistoryPeriod = 24 * time.Hour
+
+type wirelessData struct {
+	Query        string
+	AccessPoints []*internal.AccessPointSummary
+	Clients      []*db.DeviceWirelessClient
+	Msg          string
+}
+
+// clientHistoryBar is a bar of the client counts chart, the height is the percentage of the
+// highest count of the chart.
+type clientHistoryBar struct {
+	*internal.ClientCountBucket
+	Height int
+}
+
+// clientHistoryBars groups the client counts of the last wirelessHistoryPeriod hourly and scales
+// the bars to the highest count.
+func clientHistoryBars(counts []*db.WirelessClientCount, now time.Time) []*clientHistoryBar {
+	var (
+		bars []*clientHistoryBar
+		peak int
+	)
+
+	end := now.Truncate(time.Hour).Add(time.Hour)
+	buckets := internal.ClientCountHistory(counts, end.Add(-wirelessHistoryPeriod), end, time.Hour)
+	for _, bucket := range buckets {
+		peak = max(peak, bucket.Clients)
+	}
+	for _, bucket := range buckets {
+		bar := &clientHistoryBar{ClientCountBucket: bucket}
+		if peak > 0 {
+			bar.Height = bucket.Clients * 100 / peak
+		}
+		bars = append(bars, bar)
+	}
+
+	return bars
+}
+
+// getWireless responds to GET /wireless and displays the wireless client counts of the access
+// points, the clients matching the "q" parameter are listed as well.
+func (c *HttpConfig) getWireless(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		device    = &db.Device{}
+		client    = &db.DeviceWirelessClient{}
+		count     = &db.WirelessClientCount{}
+		data      = &wirelessData{Query: r.URL.Query().Get("q")}
+		templates = []string{wirelessTmpl, baseTmpl}
+	)
+
+	_, err = c.checkSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	devices, err := device.GetAllPlain(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	clients, err := client.GetAll(c.Db)
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	counts, err := count.GetSince(c.Db, time.Now().Add(-wirelessHistoryPeriod))
+	if err != nil {
+		c.Logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.AccessPoints = internal.SummarizeAccessPoints(devices, clients, counts)
+
+	if data.Query != "" {
+		data.Clients, err = internal.SearchWirelessClients(c.Db, data.Query)
+		if err != nil {
+			data.Msg = err.Error()
+		}
+	}
+
+	c.renderTemplate(w, templates, data)
+}
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+	"go.uber.org/zap"
+)
+
+// CollectorSettings tells whether and how often a collector runs on the devices.
+type CollectorSettings struct {
+	Enabled bool
+	// Interval is the minimum time between two runs of the collector, it runs on every poll if
+	// zero
+	Interval time.Duration
+	// Timeout limits the time of every device request of the collector, the requests are limited
+	// with the client timeout if zero
+	Timeout time.Duration
+}
+
+// CollectorTarget is the device polled by the collectors.
+type CollectorTarget struct {
+	Client *Api
+	Db     *db.DB
+	Device *db.Device
+	Logger *zap.Logger
+}
+
+// Collector fetches a single kind of data from the device and stores it, the device fields are
+// saved by the poller once all the collectors are done.
+type Collector interface {
+	// Name identifies the collector in the group settings and the device statuses
+	Name() string
+	// Description is the human-readable description of the collected data
+	Description() string
+	// Defaults returns the settings used unless the device groups override them
+	Defaults() CollectorSettings
+	// Collect stops talking to the device once the context is done
+	Collect(ctx context.Context, target *CollectorTarget) error
+}
+
+// PlannedCollector is a collector due to run on the device along with its settings.
+type PlannedCollector struct {
+	Collector Collector
+	Settings  CollectorSettings
+}
+
+// collectorFunc is a collector backed by a function.
+type collectorFunc struct {
+	name        string
+	description string
+	defaults    CollectorSettings
+	collect     func(ctx context.Context, target *CollectorTarget) error
+}
+
+func (c *collectorFunc) Name() string                { return c.name }
+func (c *collectorFunc) Description() string         { return c.description }
+func (c *collectorFunc) Defaults() CollectorSettings { return c.defaults }
+func (c *collectorFunc) Collect(ctx context.Context, target *CollectorTarget) error {
+	return c.collect(ctx, target)
+}
+
+// NewCollector returns a collector calling the given function.
+func NewCollector(name string, description string, defaults CollectorSettings, collect func(ctx context.Context, target *CollectorTarget) error) Collector {
+	return &collectorFunc{name: name, description: description, defaults: defaults, collect: collect}
+}
+
+// DeviceCollectorSettings returns the collector settings of the group members keyed by device
+// ID. The settings of the groups are ordered by group name, the first group setting a collector
+// takes precedence. The groups should have their devices loaded.
+func DeviceCollectorSettings(groups []*db.DeviceGroup, settings []*db.CollectorSetting) map[string][]*db.CollectorSetting {
+	var (
+		devices = map[string][]*db.CollectorSetting{}
+		byGroup = map[string][]*db.CollectorSetting{}
+	)
+
+	for _, s := range settings {
+		byGroup[s.GroupId] = append(byGroup[s.GroupId], s)
+	}
+
+	groups = slices.Clone(groups)
+	slices.SortFunc(groups, func(a, b *db.DeviceGroup) int { return strings.Compare(a.Name, b.Name) })
+	for _, group := range groups {
+		if len(byGroup[group.Id]) == 0 {
+			continue
+		}
+		for _, device := range group.Devices {
+			devices[device.Id] = append(devices[device.Id], byGroup[group.Id]...)
+		}
+	}
+
+	return devices
+}
+
+// ResolveCollectorSettings returns the first of the settings overriding the collector defaults,
+// or the defaults if none does.
+func ResolveCollectorSettings(collector Collector, settings []*db.CollectorSetting) CollectorSettings {
+	for _, s := range settings {
+		if s.Collector == collector.Name() {
+			return CollectorSettings{Enabled: s.Enabled, Interval: s.Interval, Timeout: s.Timeout}
+		}
+	}
+	return collector.Defaults()
+}
+
+// PlanCollectors returns the enabled collectors due to run on the device in the given order,
+// the collectors with an interval are skipped until the interval since their last run is over.
+func PlanCollectors(collectors []Collector, settings []*db.CollectorSetting, statuses []*db.CollectorStatus, now time.Time) []*PlannedCollector {
+	var (
+		planned []*PlannedCollector
+		lastRun = map[string]time.Time{}
+	)
+
+	for _, status := range statuses {
+		lastRun[status.Collector] = status.RanAt
+	}
+
+	for _, collector := range collectors {
+		s := ResolveCollectorSettings(collector, settings)
+		if !s.Enabled {
+			continue
+		}
+		if ranAt, ok := lastRun[collector.Name()]; ok && s.Interval > 0 && now.Sub(ranAt) < s.Interval {
+			continue
+		}
+		planned = append(planned, &PlannedCollector{Collector: collector, Settings: s})
+	}
+
+	return planned
+}
+
+// RunCollector runs the planned collector on the target, the device requests are limited with
+// the collector timeout if set. It returns the status of the run, the error is returned as well.
+func RunCollector(ctx context.Context, target *CollectorTarget, planned *PlannedCollector) (*db.CollectorStatus, error) {
+	var (
+		client = *target.Client
+		scoped = *target
+		start  = time.Now()
+	)
+
+	if planned.Settings.Timeout > 0 {
+		client.Timeout = planned.Settings.Timeout
+	}
+	scoped.Client = &client
+
+	err := planned.Collector.Collect(ctx, &scoped)
+	status := &db.CollectorStatus{
+		DeviceId:  target.Device.Id,
+		Collector: planned.Collector.Name(),
+		RanAt:     start,
+		Duration:  time.Since(start),
+		Succeeded: err == nil,
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	return status, err
+}
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCollectorNames(planned []*PlannedCollector) []string {
+	var names []string
+	for _, p := range planned {
+		names = append(names, p.Collector.Name())
+	}
+	return names
+}
+
+func TestDeviceCollectorSettings(t *testing.T) {
+	device := &db.Device{}
+	device.Id = "device"
+	other := &db.Device{}
+	other.Id = "other"
+
+	core := &db.DeviceGroup{Name: "core", Devices: []*db.Device{device}}
+	core.Id = "core"
+	access := &db.DeviceGroup{Name: "access", Devices: []*db.Device{device, other}}
+	access.Id = "access"
+	empty := &db.DeviceGroup{Name: "empty", Devices: []*db.Device{other}}
+	empty.Id = "empty"
+
+	coreRoutes := &db.CollectorSetting{GroupId: "core", Collector: CollectorRoutes}
+	accessRoutes := &db.CollectorSetting{GroupId: "access", Collector: CollectorRoutes, Enabled: true}
+	accessArp := &db.CollectorSetting{GroupId: "access", Collector: CollectorArp}
+
+	groups := []*db.DeviceGroup{core, access, empty}
+	got := DeviceCollectorSettings(groups, []*db.CollectorSetting{coreRoutes, accessRoutes, accessArp})
+	// the groups are ordered by name, "access" before "core"
+	assert.Equal(t, []*db.CollectorSetting{accessRoutes, accessArp, coreRoutes}, got["device"])
+	assert.Equal(t, []*db.CollectorSetting{accessRoutes, accessArp}, got["other"])
+	assert.Equal(t, core, groups[0], "the given groups are not reordered")
+}
+
+func TestResolveCollectorSettings(t *testing.T) {
+	collector := NewCollector(CollectorRoutes, "", CollectorSettings{Enabled: true}, nil)
+
+	assert.Equal(t, CollectorSettings{Enabled: true}, ResolveCollectorSettings(collector, nil))
+	assert.Equal(t, CollectorSettings{Interval: time.Hour, Timeout: time.Second}, ResolveCollectorSettings(collector, []*db.CollectorSetting{
+		{Collector: CollectorArp, Enabled: true},
+		{Collector: CollectorRoutes, Interval: time.Hour, Timeout: time.Second},
+		{Collector: CollectorRoutes, Enabled: true},
+	}))
+}
+
+func TestPlanCollectors(t *testing.T) {
+	var (
+		now        = time.Now()
+		collectors = DefaultCollectors(&CollectorOptions{})
+	)
+
+	planned := PlanCollectors(collectors, nil, nil, now)
+	assert.Equal(t, []string{
+		CollectorResources, CollectorRouterboard, CollectorIdentity, CollectorUpdates, CollectorAddresses,
+		CollectorInterfaces, CollectorRoutes, CollectorLeases, CollectorArp,
+	}, testCollectorNames(planned))
+
+	settings := []*db.CollectorSetting{
+		{Collector: CollectorUpdates},
+		{Collector: CollectorRoutes, Enabled: true, Interval: time.Hour, Timeout: time.Second},
+		{Collector: CollectorArp, Enabled: true, Interval: time.Hour},
+		{Collector: CollectorWirelessClients, Enabled: true},
+	}
+	statuses := []*db.CollectorStatus{
+		{Collector: CollectorRoutes, RanAt: now.Add(-time.Minute)},
+		{Collector: CollectorArp, RanAt: now.Add(-2 * time.Hour)},
+		{Collector: CollectorIdentity, RanAt: now},
+	}
+	planned = PlanCollectors(collectors, settings, statuses, now)
+	assert.Equal(t, []string{
+		CollectorResources, CollectorRouterboard, CollectorIdentity, CollectorAddresses,
+		CollectorInterfaces, CollectorLeases, CollectorArp, CollectorWirelessClients,
+	}, testCollectorNames(planned))
+	assert.Equal(t, CollectorSettings{Enabled: true, Interval: time.Hour}, planned[6].Settings)
+
+	planned = PlanCollectors(collectors, settings, statuses, now.Add(time.Hour))
+	assert.Contains(t, testCollectorNames(planned), CollectorRoutes)
+}
+
+func TestRunCollector(t *testing.T) {
+	var timeouts []time.Duration
+
+	device := &db.Device{}
+	device.Id = "device"
+	client := &Api{Address: "192.0.2.1"}
+	target := &CollectorTarget{Client: client, Device: device}
+
+	failing := NewCollector("failing", "", CollectorSettings{}, func(ctx context.Context, target *CollectorTarget) error {
+		timeouts = append(timeouts, target.Client.Timeout)
+		return errors.New("no route to host")
+	})
+	status, err := RunCollector(context.Background(), target, &PlannedCollector{Collector: failing, Settings: CollectorSettings{Timeout: time.Second}})
+	assert.EqualError(t, err, "no route to host")
+	assert.Equal(t, "device", status.DeviceId)
+	assert.Equal(t, "failing", status.Collector)
+	assert.False(t, status.Succeeded)
+	assert.Equal(t, "no route to host", status.Error)
+
+	working := NewCollector("working", "", CollectorSettings{}, func(ctx context.Context, target *CollectorTarget) error {
+		timeouts = append(timeouts, target.Client.Timeout)
+		target.Device.Identity = "router"
+		return nil
+	})
+	status, err = RunCollector(context.Background(), target, &PlannedCollector{Collector: working})
+	assert.NoError(t, err)
+	assert.True(t, status.Succeeded)
+	assert.Empty(t, status.Error)
+	assert.Equal(t, "router", device.Identity)
+
+	// the collectors without a timeout keep the client one
+	client.Timeout = time.Minute
+	_, err = RunCollector(context.Background(), target, &PlannedCollector{Collector: working})
+	assert.NoError(t, err)
+
+	// the timeouts are scoped to the collector runs
+	assert.Equal(t, []time.Duration{time.Second, 0, time.Minute}, timeouts)
+	assert.Equal(t, time.Minute, client.Timeout)
+}
@@ -0,0 +1,285 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/mazay/mikromanager/db"
+	"go.uber.org/zap"
+)
+
+const defaultCommandConcurrency = 10
+
+var (
+	ErrCommandNotAllowed = errors.New("only read-only commands are allowed for your role")
+
+	// ReadOnlyVerbs lists the RouterOS commands the non-admin users are allowed to run
+	ReadOnlyVerbs = []string{"print", "export", "getall"}
+	// ReadOnlyFlags lists the CLI arguments allowed between the read-only verb and the where clause
+	ReadOnlyFlags = []string{"brief", "compact", "count-only", "detail", "hide-sensitive", "stats", "terse", "value-list", "verbose", "without-paging"}
+	// ReadOnlyMenus lists the RouterOS menu path words the read-only verbs are allowed under, any
+	// other word before the verb is rejected, e.g. "run" in "/system script run print" runs the
+	// script named "print" and "scan" in "/interface wireless scan wlan1 print" starts a scan
+	ReadOnlyMenus = []string{
+		"aaa", "access-list", "accounting", "active", "address", "address-list", "addresses", "advertisements",
+		"alias", "arp", "bgp", "bonding", "bridge", "cache", "caps-man", "capsman", "certificate", "channels",
+		"client", "clock", "cloud", "configuration", "connection", "connections", "console", "datapath",
+		"dhcp-client", "dhcp-relay", "dhcp-server", "disk", "dns", "eoip", "ethernet", "filter", "firewall",
+		"gre", "health", "history", "hotspot", "identity", "igmp-proxy", "instance", "interface", "interfaces",
+		"ip", "ipsec", "ipv6", "irq", "job", "l2tp-client", "l2tp-server", "lease", "leases", "license",
+		"list", "lists", "lldp", "logging", "lte", "mangle", "manual", "member", "mesh", "mpls", "nat",
+		"nd", "neighbor", "neighbors", "netwatch", "network", "note", "ntp", "ospf", "ospf-v3", "ovpn-client",
+		"ovpn-server", "package", "peer", "peers", "policy", "pool", "port", "ppp", "pppoe-client",
+		"pppoe-server", "prefix", "profile", "profiles", "proposal", "queue", "radius", "raw", "registration-table",
+		"remote-access", "resource", "rip", "romon", "route", "routerboard", "routing", "rule", "scheduler",
+		"script", "secret", "security-profiles", "server", "service", "settings", "simple", "smb", "snmp",
+		"socks", "ssh", "static", "system", "table", "template", "tool", "tree", "upnp", "update", "usb",
+		"user", "users", "vlan", "vrrp", "wifi", "wireguard", "wireless",
+	}
+)
+
+// CommandRunner runs ad-hoc commands on the devices, over SSH as CLI commands or over the API as
+// API sentences, recording the output of every device in the database.
+type CommandRunner struct {
+	Db      *db.DB
+	Secrets *Secrets
+	Logger  *zap.Logger
+	// Concurrency is the number of devices the command runs on at a time
+	Concurrency int
+	// Timeouts limits the command on every device
+	Timeouts DeviceTimeouts
+
+	// run talks to the device, it is replaced in tests
+	run func(device *db.Device, transport string, command string) (string, error)
+}
+
+// NewCommandRunner returns a command runner talking to the devices with their credentials chains.
+func NewCommandRunner(database *db.DB, secrets *Secrets, logger *zap.Logger) *CommandRunner {
+	r := &CommandRunner{
+		Db:          database,
+		Secrets:     secrets,
+		Logger:      logger,
+		Concurrency: defaultCommandConcurrency,
+	}
+	r.run = r.runOnDevice
+	return r
+}
+
+// formatSentences renders the API reply as one line of key=value pairs per sentence.
+func formatSentences(reply []*proto.Sentence) string {
+	var lines []string
+	for _, sentence := range reply {
+		var pairs []string
+		for _, pair := range sentence.List {
+			pairs = append(pairs, pair.Key+"="+pair.Value)
+		}
+		lines = append(lines, strings.Join(pairs, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ReadOnlyCommand returns true if the command only reads the device state: a single print,
+// export or getall command, either as a CLI command of the "/menu... verb [flags] [where ...]"
+// shape, e.g. "/ip address print detail where disabled=no", or an API sentence, e.g.
+// "/ip/address/print ?disabled=false". The menu path words have to be listed in ReadOnlyMenus.
+// Scripting, the verb arguments other than the output flags and writing the output to a file are
+// not considered read-only.
+func ReadOnlyCommand(transport string, command string) bool {
+	if strings.ContainsAny(command, ";[]{}\n\r") || strings.Contains(command, "file=") {
+		return false
+	}
+
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return false
+	}
+
+	var words []string
+	switch transport {
+	case db.CommandTransportApi:
+		// the API sentence starts with the full command path followed by the attributes and queries
+		words = strings.Split(strings.TrimPrefix(fields[0], "/"), "/")
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "=") && !strings.HasPrefix(field, "?") {
+				return false
+			}
+		}
+		return slices.Contains(ReadOnlyVerbs, words[len(words)-1]) && allMenuWords(words[:len(words)-1])
+	case db.CommandTransportSsh:
+		// the menu path may be separated with either slashes or spaces, the flags and the where
+		// clause follow the verb
+		for i, field := range fields {
+			words = append(words, strings.Split(strings.Trim(field, "/"), "/")...)
+			if slices.Contains(ReadOnlyVerbs, words[len(words)-1]) {
+				return allMenuWords(words[:len(words)-1]) && readOnlyArgs(fields[i+1:])
+			}
+		}
+	}
+
+	return false
+}
+
+// allMenuWords returns true if all the words are known menu path words.
+func allMenuWords(words []string) bool {
+	for _, word := range words {
+		if !slices.Contains(ReadOnlyMenus, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// readOnlyArgs returns true if the CLI arguments of the read-only verb are the output flags
+// optionally followed by a non-empty where clause.
+func readOnlyArgs(args []string) bool {
+	for i, arg := range args {
+		if arg == "where" {
+			return i < len(args)-1
+		}
+		if !slices.Contains(ReadOnlyFlags, arg) {
+			return false
+		}
+	}
+	return true
+}
+
+// CommandAllowed returns an error if the command is empty, the transport is unknown or the user
+// is not allowed to run the command.
+func CommandAllowed(user *db.User, transport string, command string) error {
+	if strings.TrimSpace(command) == "" {
+		return errors.New("the command is empty")
+	}
+	if transport != db.CommandTransportSsh && transport != db.CommandTransportApi {
+		return fmt.Errorf("unknown transport %q", transport)
+	}
+	if !user.IsAdmin() && !ReadOnlyCommand(transport, command) {
+		return ErrCommandNotAllowed
+	}
+	return nil
+}
+
+// runOnDevice runs the command on the device and returns its output.
+func (r *CommandRunner) runOnDevice(device *db.Device, transport string, command string) (string, error) {
+	if transport == db.CommandTransportApi {
+		ctx, cancel := WithTimeout(context.Background(), r.Timeouts.Api)
+		defer cancel()
+		reply, err := runWithCredentials(ctx, device, r.Db, r.Secrets, nil, command)
+		return formatSentences(reply), err
+	}
+	ctx, cancel := WithTimeout(context.Background(), r.Timeouts.Ssh)
+	defer cancel()
+	output, err := sshWithCredentials(ctx, device, r.Db, r.Secrets, command)
+	return string(output), err
+}
+
+// runResult runs the command on the device of the result and stores the outcome.
+func (r *CommandRunner) runResult(run *db.CommandRun, device *db.Device, result *db.CommandResult) {
+	command := run.Command
+	if result.Script != "" {
+		command = result.Script
+	}
+	output, err := r.run(device, run.Transport, command)
+
+	now := time.Now()
+	result.Output = output
+	result.FinishedAt = &now
+	if err != nil {
+		r.Logger.Warn("command failed", zap.String("run", run.Id), zap.String("device", device.Address), zap.Error(err))
+		result.Status = db.CommandFailed
+		result.Error = err.Error()
+	} else {
+		result.Status = db.CommandSucceeded
+	}
+
+	err = result.Save(r.Db)
+	if err != nil {
+		r.Logger.Error(err.Error())
+	}
+}
+
+// Run runs the command on the devices of the results concurrently and marks the command run as
+// finished, the failures on individual devices don't stop the others.
+func (r *CommandRunner) Run(run *db.CommandRun, devices map[string]*db.Device) {
+	var (
+		wg          sync.WaitGroup
+		jobs        = make(chan *db.CommandResult)
+		concurrency = max(r.Concurrency, 1)
+	)
+
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for result := range jobs {
+				r.runResult(run, devices[result.DeviceId], result)
+			}
+		}()
+	}
+	for _, result := range run.Results {
+		jobs <- result
+	}
+	close(jobs)
+	wg.Wait()
+
+	now := time.Now()
+	run.Status = db.CommandFinished
+	run.FinishedAt = &now
+	err := run.Save(r.Db)
+	if err != nil {
+		r.Logger.Error(err.Error())
+	}
+}
+
+// Start records the command run of the user on the devices and runs it in the background, the
+// target describes the selected devices in the history. It returns the recorded run and an error
+// if the command is not allowed, no devices are selected or the run can not be recorded.
+func (r *CommandRunner) Start(user *db.User, transport string, command string, target string, devices []*db.Device) (*db.CommandRun, error) {
+	err := CommandAllowed(user, transport, command)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, errors.New("no devices selected")
+	}
+
+	run := &db.CommandRun{
+		UserId:    user.Id,
+		Username:  user.Username,
+		Transport: transport,
+		Command:   strings.TrimSpace(command),
+		Target:    target,
+		Status:    db.CommandRunning,
+	}
+	byId := map[string]*db.Device{}
+	for _, device := range devices {
+		if byId[device.Id] != nil {
+			continue
+		}
+		byId[device.Id] = device
+		run.Results = append(run.Results, &db.CommandResult{
+			DeviceId:      device.Id,
+			DeviceAddress: device.Address,
+			Status:        db.CommandRunning,
+		})
+	}
+
+	err = run.Create(r.Db)
+	if err != nil {
+		return nil, err
+	}
+	r.Logger.Info("running command", zap.String("run", run.Id), zap.String("user", user.Username),
+		zap.String("transport", transport), zap.String("command", run.Command), zap.Int("devices", len(run.Results)))
+
+	// the caller gets a copy as the running command keeps changing
+	started := *run
+	started.Results = nil
+	go r.Run(run, byId)
+
+	return &started, nil
+}
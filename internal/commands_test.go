@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestReadOnlyCommand(t *testing.T) {
+	for _, tc := range []struct {
+		transport string
+		command   string
+		expected  bool
+	}{
+		{db.CommandTransportSsh, "/ip address print", true},
+		{db.CommandTransportSsh, "/ip/address/print detail where disabled=no", true},
+		{db.CommandTransportSsh, "ip route print", true},
+		{db.CommandTransportSsh, "/export terse", true},
+		{db.CommandTransportSsh, "/interface print where mac-address=AA:BB:CC:DD:EE:FF", true},
+		{db.CommandTransportSsh, "/system reboot", false},
+		{db.CommandTransportSsh, "/ip address remove 0", false},
+		{db.CommandTransportSsh, "/ip address print; /system reboot", false},
+		{db.CommandTransportSsh, "/ip address print where [/system reboot]", false},
+		{db.CommandTransportSsh, "/export file=backup", false},
+		{db.CommandTransportSsh, ":put print", false},
+		{db.CommandTransportSsh, "/ip address print count-only where disabled=no", true},
+		{db.CommandTransportSsh, "/system script run print", false},
+		{db.CommandTransportSsh, "/system/script/run print", false},
+		{db.CommandTransportSsh, "/ip address print interval=1", false},
+		{db.CommandTransportSsh, "/ip address print follow", false},
+		{db.CommandTransportSsh, "/ip address print where", false},
+		{db.CommandTransportSsh, "/export show-sensitive", false},
+		{db.CommandTransportSsh, "", false},
+		{db.CommandTransportSsh, "/interface wireless scan wlan1 print", false},
+		{db.CommandTransportSsh, "/certificate sign ca print", false},
+		{db.CommandTransportSsh, "/ip cloud force-update print", false},
+		{db.CommandTransportSsh, "/interface ethernet cable-test ether1 print", false},
+		{db.CommandTransportSsh, "/interface ethernet blink ether1 print", false},
+		{db.CommandTransportSsh, "/ip dns cache flush print", false},
+		{db.CommandTransportSsh, "/ip dns cache print", true},
+		{db.CommandTransportSsh, "/interface ethernet print", true},
+		{db.CommandTransportApi, "/ip/address/print", true},
+		{db.CommandTransportApi, "/system/package/update/getall ?channel=stable =.proplist=channel", true},
+		{db.CommandTransportApi, "/system/reboot", false},
+		{db.CommandTransportApi, "/ip/address/print extra", false},
+		{db.CommandTransportApi, "/system/script/run/print", false},
+		{db.CommandTransportApi, "/interface/wireless/scan/print", false},
+		{db.CommandTransportApi, "/ip/dns/cache/flush/print", false},
+		{"telnet", "/ip address print", false},
+	} {
+		assert.Equal(t, tc.expected, ReadOnlyCommand(tc.transport, tc.command), "%s %q", tc.transport, tc.command)
+	}
+}
+
+func TestCommandAllowed(t *testing.T) {
+	admin := &db.User{Role: db.UserRoleAdmin}
+	operator := &db.User{Role: db.UserRoleOperator}
+
+	assert.NoError(t, CommandAllowed(admin, db.CommandTransportSsh, "/system reboot"))
+	assert.ErrorIs(t, CommandAllowed(operator, db.CommandTransportSsh, "/system reboot"), ErrCommandNotAllowed)
+	assert.NoError(t, CommandAllowed(operator, db.CommandTransportApi, "/ip/address/print"))
+	assert.Error(t, CommandAllowed(admin, db.CommandTransportSsh, "  "))
+	assert.Error(t, CommandAllowed(admin, "telnet", "/ip address print"))
+}
+
+func TestFormatSentences(t *testing.T) {
+	first := proto.NewSentence()
+	first.List = []proto.Pair{{Key: "address", Value: "10.0.0.1/24"}, {Key: "interface", Value: "ether1"}}
+	second := proto.NewSentence()
+	second.List = []proto.Pair{{Key: "address", Value: "10.0.1.1/24"}}
+
+	assert.Equal(t, "address=10.0.0.1/24 interface=ether1\naddress=10.0.1.1/24", formatSentences([]*proto.Sentence{first, second}))
+	assert.Equal(t, "", formatSentences(nil))
+}
+
+func TestCommandRunner(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var devices []*db.Device
+	for _, address := range []string{"10.0.0.1", "10.0.0.2"} {
+		device := &db.Device{Address: address}
+		err = device.Create(database)
+		if err != nil {
+			t.Fatal(err)
+		}
+		devices = append(devices, device)
+	}
+
+	runner := NewCommandRunner(database, nil, zap.NewNop())
+	runner.run = func(device *db.Device, transport string, command string) (string, error) {
+		if device.Address == "10.0.0.2" {
+			return "", errors.New("connection refused")
+		}
+		return transport + " " + command, nil
+	}
+
+	user := &db.User{Username: "operator", Role: db.UserRoleOperator}
+	_, err = runner.Start(user, db.CommandTransportSsh, "/system reboot", "group core", devices)
+	assert.ErrorIs(t, err, ErrCommandNotAllowed)
+	_, err = runner.Start(user, db.CommandTransportSsh, "/ip address print", "group core", nil)
+	assert.Error(t, err)
+
+	// the duplicated devices run the command once
+	started, err := runner.Start(user, db.CommandTransportSsh, " /ip address print ", "group core", append(devices, devices[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := &db.CommandRun{}
+	run.Id = started.Id
+	assert.Eventually(t, func() bool {
+		err = run.GetById(database)
+		return err == nil && run.Finished()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, "operator", run.Username)
+	assert.Equal(t, "/ip address print", run.Command)
+	assert.Len(t, run.Results, 2)
+	assert.Equal(t, db.CommandSucceeded, run.Results[0].Status)
+	assert.Equal(t, "ssh /ip address print", run.Results[0].Output)
+	assert.Equal(t, db.CommandFailed, run.Results[1].Status)
+	assert.Equal(t, "connection refused", run.Results[1].Error)
+}
@@ -0,0 +1,277 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mazay/mikromanager/db"
+)
+
+// PolicySummary holds the compliance results of a single policy across the fleet.
+type PolicySummary struct {
+	Policy *db.CompliancePolicy
+	Passed int
+	// Failures holds the results of the devices violating the policy
+	Failures []*db.ComplianceResult
+}
+
+// ComplianceSummary holds the compliance results of all the policies.
+type ComplianceSummary struct {
+	Policies []*PolicySummary
+	// Devices is the number of the evaluated devices, FailedDevices the number of the devices
+	// violating at least one policy
+	Devices       int
+	FailedDevices int
+}
+
+// NormalizeSection formats the menu path the way the exports do, e.g. "/ip/service" becomes
+// "/ip service".
+func NormalizeSection(section string) string {
+	fields := strings.FieldsFunc(section, func(r rune) bool { return r == '/' || r == ' ' || r == '\t' })
+	if len(fields) == 0 {
+		return ""
+	}
+	return "/" + strings.Join(fields, " ")
+}
+
+// ExportSections splits the export into the commands of its sections keyed by the menu path,
+// see ParseExport. The malformed lines are kept as far as they could be parsed.
+func ExportSections(export string) map[string][]string {
+	var sections = map[string][]string{}
+
+	tree, _ := ParseExport(export)
+	for _, section := range tree.Sections {
+		lines := []string{}
+		for _, command := range section.Commands {
+			lines = append(lines, command.Raw)
+		}
+		sections[section.Menu] = lines
+	}
+
+	return sections
+}
+
+// compileRulePattern compiles the rule pattern in the multi-line mode so "^" and "$" match
+// the export lines.
+func compileRulePattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("(?m)" + pattern)
+}
+
+// ValidateRule checks the rule kind, section and pattern. It returns an error if the rule is
+// invalid.
+func ValidateRule(rule *db.ComplianceRule) error {
+	switch rule.Kind {
+	case db.ComplianceRuleSection:
+		if NormalizeSection(rule.Section) == "" {
+			return errors.New("the section rules require a section")
+		}
+		return nil
+	case db.ComplianceRuleContains, db.ComplianceRuleNotContains:
+		if rule.Pattern == "" {
+			return fmt.Errorf("the %s rules require a pattern", rule.Kind)
+		}
+		_, err := compileRulePattern(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", rule.Pattern, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown rule kind %q", rule.Kind)
+	}
+}
+
+// describeRule returns the human-readable description of the rule violation.
+func describeRule(rule *db.ComplianceRule, section string) string {
+	var scope string
+	if section != "" {
+		scope = " in " + section
+	}
+
+	switch rule.Kind {
+	case db.ComplianceRuleSection:
+		return "missing section " + section
+	case db.ComplianceRuleNotContains:
+		return fmt.Sprintf("forbidden %q found%s", rule.Pattern, scope)
+	default:
+		return fmt.Sprintf("missing %q%s", rule.Pattern, scope)
+	}
+}
+
+// EvaluatePolicy checks the export sections against the policy rules and returns the
+// descriptions of the violated rules. The invalid rules are reported as violations.
+func EvaluatePolicy(policy *db.CompliancePolicy, sections map[string][]string) []string {
+	var violations []string
+
+	for _, rule := range policy.Rules {
+		err := ValidateRule(rule)
+		if err != nil {
+			violations = append(violations, err.Error())
+			continue
+		}
+
+		section := NormalizeSection(rule.Section)
+		var (
+			lines   []string
+			present bool
+		)
+		if section == "" {
+			present = true
+			for _, sectionLines := range sections {
+				lines = append(lines, sectionLines...)
+			}
+		} else {
+			lines, present = sections[section]
+		}
+
+		if rule.Kind == db.ComplianceRuleSection {
+			if !present {
+				violations = append(violations, describeRule(rule, section))
+			}
+			continue
+		}
+
+		re, _ := compileRulePattern(rule.Pattern)
+		matched := present && re.MatchString(strings.Join(lines, "\n"))
+		if matched != (rule.Kind == db.ComplianceRuleContains) {
+			violations = append(violations, describeRule(rule, section))
+		}
+	}
+
+	return violations
+}
+
+// PolicyApplies returns true if the policy is not limited to a group or the device is a member
+// of the policy group. The device should have its groups loaded.
+func PolicyApplies(policy *db.CompliancePolicy, device *db.Device) bool {
+	if policy.GroupId == "" {
+		return true
+	}
+	return slices.ContainsFunc(device.Groups, func(g *db.DeviceGroup) bool { return g.Id == policy.GroupId })
+}
+
+// EvaluateCompliance evaluates the policies applying to the device against the export body.
+func EvaluateCompliance(policies []*db.CompliancePolicy, device *db.Device, exportId string, body []byte) []*db.ComplianceResult {
+	var results []*db.ComplianceResult
+
+	sections := ExportSections(string(body))
+	for _, policy := range policies {
+		if !PolicyApplies(policy, device) {
+			continue
+		}
+		violations := EvaluatePolicy(policy, sections)
+		results = append(results, &db.ComplianceResult{
+			DeviceId:   device.Id,
+			PolicyId:   policy.Id,
+			ExportId:   exportId,
+			Passed:     len(violations) == 0,
+			Violations: strings.Join(violations, "\n"),
+		})
+	}
+
+	return results
+}
+
+// CheckExportCompliance evaluates all the policies applying to the device of the export and
+// replaces the stored compliance results of the device. It returns the results and an error
+// if any of the database operations fail.
+func CheckExportCompliance(database *db.DB, export *db.Export, body []byte) ([]*db.ComplianceResult, error) {
+	var (
+		device = &db.Device{}
+		policy = &db.CompliancePolicy{}
+	)
+
+	device.Id = export.DeviceId
+	err := device.GetById(database)
+	if err != nil {
+		return nil, err
+	}
+	policies, err := policy.GetAll(database)
+	if err != nil {
+		return nil, err
+	}
+
+	results := EvaluateCompliance(policies, device, export.Id, body)
+	return results, db.ReplaceComplianceResults(database, device.Id, results)
+}
+
+// CheckLatestExports evaluates the policies against the latest export of every device, e.g.
+// after the policies are changed. It returns the number of the checked devices and an error
+// if any of the exports can not be downloaded or checked.
+func CheckLatestExports(database *db.DB, s3 *S3) (int, error) {
+	var (
+		export  = &db.Export{}
+		checked = map[string]bool{}
+		errs    []error
+	)
+
+	// the exports are ordered by the modification time, the latest first
+	exports, err := export.GetAll(database)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, e := range exports {
+		if e.Device == nil || e.Device.Trashed() || e.Missing || e.Size == nil || checked[e.DeviceId] {
+			continue
+		}
+		checked[e.DeviceId] = true
+
+		body, err := s3.GetFile(e.S3Key, *e.Size)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.S3Key, err))
+			continue
+		}
+		_, err = CheckExportCompliance(database, e, body)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.S3Key, err))
+		}
+	}
+
+	return len(checked), errors.Join(errs...)
+}
+
+// SummarizeCompliance groups the compliance results by policy.
+func SummarizeCompliance(policies []*db.CompliancePolicy, results []*db.ComplianceResult) *ComplianceSummary {
+	var (
+		summary = &ComplianceSummary{}
+		byId    = map[string]*PolicySummary{}
+		devices = map[string]bool{}
+	)
+
+	for _, policy := range policies {
+		s := &PolicySummary{Policy: policy}
+		byId[policy.Id] = s
+		summary.Policies = append(summary.Policies, s)
+	}
+
+	for _, result := range results {
+		s := byId[result.PolicyId]
+		if s == nil || result.Device == nil || result.Device.Trashed() {
+			continue
+		}
+		if _, ok := devices[result.DeviceId]; !ok {
+			devices[result.DeviceId] = false
+		}
+		if result.Passed {
+			s.Passed++
+			continue
+		}
+		s.Failures = append(s.Failures, result)
+		devices[result.DeviceId] = true
+	}
+
+	for _, s := range summary.Policies {
+		slices.SortFunc(s.Failures, func(a, b *db.ComplianceResult) int { return strings.Compare(a.Device.Address, b.Device.Address) })
+	}
+	for _, failed := range devices {
+		summary.Devices++
+		if failed {
+			summary.FailedDevices++
+		}
+	}
+
+	return summary
+}
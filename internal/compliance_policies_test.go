@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+)
+
+const testExport = `# 2024-05-01 10:00:00 by RouterOS 7.15
+# software id = ABCD-1234
+#
+/interface bridge
+add name=bridge comment=\
+    "LAN bridge"
+/ip service
+set telnet disabled=yes
+set ftp disabled=yes
+/system ntp client
+set enabled=yes
+/system ntp client servers
+add address=10.0.0.1
+`
+
+func TestExportSections(t *testing.T) {
+	sections := ExportSections(testExport)
+
+	assert.Len(t, sections, 4)
+	assert.Equal(t, []string{`add name=bridge comment="LAN bridge"`}, sections["/interface bridge"])
+	assert.Equal(t, []string{"set telnet disabled=yes", "set ftp disabled=yes"}, sections["/ip service"])
+	assert.Equal(t, []string{"add address=10.0.0.1"}, sections["/system ntp client servers"])
+
+	assert.Equal(t, "/ip service", NormalizeSection("/ip/service"))
+	assert.Equal(t, "/ip service", NormalizeSection(" /ip  service "))
+	assert.Equal(t, "", NormalizeSection("/"))
+}
+
+func TestValidateRule(t *testing.T) {
+	assert.NoError(t, ValidateRule(&db.ComplianceRule{Kind: db.ComplianceRuleSection, Section: "/ip service"}))
+	assert.Error(t, ValidateRule(&db.ComplianceRule{Kind: db.ComplianceRuleSection}))
+	assert.NoError(t, ValidateRule(&db.ComplianceRule{Kind: db.ComplianceRuleContains, Pattern: "^set telnet disabled=yes$"}))
+	assert.Error(t, ValidateRule(&db.ComplianceRule{Kind: db.ComplianceRuleNotContains}))
+	assert.Error(t, ValidateRule(&db.ComplianceRule{Kind: db.ComplianceRuleContains, Pattern: "set (telnet"}))
+	assert.Error(t, ValidateRule(&db.ComplianceRule{Kind: "matches", Pattern: "x"}))
+}
+
+func TestEvaluatePolicy(t *testing.T) {
+	sections := ExportSections(testExport)
+
+	policy := &db.CompliancePolicy{Rules: []*db.ComplianceRule{
+		{Kind: db.ComplianceRuleSection, Section: "/ip/service"},
+		{Kind: db.ComplianceRuleContains, Section: "/ip service", Pattern: "^set telnet disabled=yes$"},
+		{Kind: db.ComplianceRuleContains, Section: "/system ntp client", Pattern: "enabled=yes"},
+		{Kind: db.ComplianceRuleNotContains, Pattern: "disabled=no"},
+		// the missing sections do not contain the forbidden patterns
+		{Kind: db.ComplianceRuleNotContains, Section: "/snmp community", Pattern: "public"},
+	}}
+	assert.Empty(t, EvaluatePolicy(policy, sections))
+
+	policy.Rules = []*db.ComplianceRule{
+		{Kind: db.ComplianceRuleSection, Section: "/system logging action"},
+		{Kind: db.ComplianceRuleContains, Section: "/ip service", Pattern: "set www disabled=yes"},
+		{Kind: db.ComplianceRuleContains, Section: "/system logging", Pattern: "remote"},
+		{Kind: db.ComplianceRuleNotContains, Section: "/ip service", Pattern: "ftp"},
+		{Kind: db.ComplianceRuleContains, Pattern: "("},
+	}
+	violations := EvaluatePolicy(policy, sections)
+	assert.Len(t, violations, 5)
+	assert.Equal(t, "missing section /system logging action", violations[0])
+	assert.Equal(t, `missing "set www disabled=yes" in /ip service`, violations[1])
+	assert.Equal(t, `forbidden "ftp" found in /ip service`, violations[3])
+}
+
+func TestEvaluateCompliance(t *testing.T) {
+	group := &db.DeviceGroup{Name: "core"}
+	group.Id = "core"
+	device := &db.Device{Groups: []*db.DeviceGroup{group}}
+	device.Id = "device"
+
+	all := &db.CompliancePolicy{Rules: []*db.ComplianceRule{{Kind: db.ComplianceRuleContains, Pattern: "telnet"}}}
+	all.Id = "all"
+	core := &db.CompliancePolicy{GroupId: "core", Rules: []*db.ComplianceRule{{Kind: db.ComplianceRuleSection, Section: "/snmp"}}}
+	core.Id = "core"
+	edge := &db.CompliancePolicy{GroupId: "edge"}
+	edge.Id = "edge"
+
+	results := EvaluateCompliance([]*db.CompliancePolicy{all, core, edge}, device, "export", []byte(testExport))
+	assert.Len(t, results, 2)
+	assert.True(t, results[0].Passed)
+	assert.Equal(t, "export", results[0].ExportId)
+	assert.False(t, results[1].Passed)
+	assert.Equal(t, []string{"missing section /snmp"}, results[1].ViolationList())
+
+	device.Id = "other"
+	results[0].Device = device
+	results[1].Device = device
+	summary := SummarizeCompliance([]*db.CompliancePolicy{all, core, edge}, results)
+	assert.Equal(t, 1, summary.Devices)
+	assert.Equal(t, 1, summary.FailedDevices)
+	assert.Len(t, summary.Policies, 3)
+	assert.Equal(t, 1, summary.Policies[0].Passed)
+	assert.Len(t, summary.Policies[1].Failures, 1)
+	assert.Empty(t, summary.Policies[2].Failures)
+}
+
+func TestCheckExportCompliance(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device := &db.Device{Address: "10.0.0.1"}
+	err = device.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &db.CompliancePolicy{Name: "telnet", Rules: []*db.ComplianceRule{
+		{Kind: db.ComplianceRuleContains, Section: "/ip service", Pattern: "set telnet disabled=yes"},
+	}}
+	err = policy.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	export := &db.Export{DeviceId: device.Id}
+	export.Id = "export"
+	results, err := CheckExportCompliance(database, export, []byte("/ip service\nset telnet disabled=no\n"))
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	// the new export replaces the results
+	_, err = CheckExportCompliance(database, export, []byte(testExport))
+	assert.NoError(t, err)
+
+	result := &db.ComplianceResult{}
+	stored, err := result.GetByDeviceId(database, device.Id)
+	assert.NoError(t, err)
+	assert.Len(t, stored, 1)
+	assert.True(t, stored[0].Passed)
+	assert.Equal(t, "telnet", stored[0].Policy.Name)
+}
@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/mazay/mikromanager/db"
+	"go.uber.org/zap"
+)
+
+// variableNameRe matches the names usable as template fields, e.g. {{ .Vars.ntp_server }}
+var variableNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// TemplateData is the data the configuration templates are rendered with.
+type TemplateData struct {
+	Device *db.Device
+	// Vars holds the variables of the device groups
+	Vars map[string]string
+}
+
+// RenderedTemplate is a configuration template rendered for a single device.
+type RenderedTemplate struct {
+	Device *db.Device
+	Script string
+	Error  string
+}
+
+// ParseVariables parses the "name=value" lines of the group variables, the empty lines and the
+// lines starting with "#" are ignored. It returns an error if any of the lines is invalid.
+func ParseVariables(text string) (map[string]string, error) {
+	var vars = map[string]string{}
+
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, found := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !found || !variableNameRe.MatchString(name) {
+			return nil, fmt.Errorf("line %d: expected name=value, the name made of letters, digits and underscores", i+1)
+		}
+		vars[name] = strings.TrimSpace(value)
+	}
+
+	return vars, nil
+}
+
+// DeviceVariables merges the variables of the device groups, the groups are merged in the order
+// of their names so a variable set by several groups takes the value of the last one. The device
+// should have its groups loaded. It returns an error if the variables of any group are invalid.
+func DeviceVariables(device *db.Device) (map[string]string, error) {
+	var vars = map[string]string{}
+
+	groups := slices.Clone(device.Groups)
+	slices.SortFunc(groups, func(a, b *db.DeviceGroup) int { return strings.Compare(a.Name, b.Name) })
+	for _, group := range groups {
+		groupVars, err := ParseVariables(group.Variables)
+		if err != nil {
+			return nil, fmt.Errorf("group %s variables: %w", group.Name, err)
+		}
+		maps.Copy(vars, groupVars)
+	}
+
+	return vars, nil
+}
+
+// ParseConfigTemplate parses the template body. It returns an error if the body is not a valid
+// Go template.
+func ParseConfigTemplate(tmpl *db.ConfigTemplate) (*template.Template, error) {
+	if strings.TrimSpace(tmpl.Body) == "" {
+		return nil, errors.New("the template is empty")
+	}
+	// a typo in a variable name should fail rather than render an empty value
+	return template.New(tmpl.Name).Option("missingkey=error").Parse(tmpl.Body)
+}
+
+// RenderConfigTemplate renders the template for the device with its fields and group variables.
+// It returns an error if the template or the variables are invalid or a variable is missing.
+func RenderConfigTemplate(tmpl *db.ConfigTemplate, device *db.Device) (string, error) {
+	var buf bytes.Buffer
+
+	parsed, err := ParseConfigTemplate(tmpl)
+	if err != nil {
+		return "", err
+	}
+	vars, err := DeviceVariables(device)
+	if err != nil {
+		return "", err
+	}
+
+	err = parsed.Execute(&buf, &TemplateData{Device: device, Vars: vars})
+	if err != nil {
+		return "", err
+	}
+	script := strings.TrimSpace(buf.String())
+	if script == "" {
+		return "", errors.New("the rendered script is empty")
+	}
+	return script, nil
+}
+
+// PreviewConfigTemplate renders the template for every device, the rendering errors are
+// reported per device.
+func PreviewConfigTemplate(tmpl *db.ConfigTemplate, devices []*db.Device) []*RenderedTemplate {
+	var rendered []*RenderedTemplate
+
+	for _, device := range devices {
+		script, err := RenderConfigTemplate(tmpl, device)
+		result := &RenderedTemplate{Device: device, Script: script}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		rendered = append(rendered, result)
+	}
+
+	return rendered
+}
+
+// StartTemplate renders the configuration template for the devices and runs the scripts over
+// SSH in the background, recording the run in the commands history. Only admins can apply the
+// templates. It returns the recorded run and an error if the user is not allowed to apply the
+// template, no devices are selected, the template can not be rendered for any of the devices
+// or the run can not be recorded.
+func (r *CommandRunner) StartTemplate(user *db.User, tmpl *db.ConfigTemplate, target string, devices []*db.Device) (*db.CommandRun, error) {
+	if !user.IsAdmin() {
+		return nil, ErrCommandNotAllowed
+	}
+	if len(devices) == 0 {
+		return nil, errors.New("no devices selected")
+	}
+
+	run := &db.CommandRun{
+		UserId:     user.Id,
+		Username:   user.Username,
+		Transport:  db.CommandTransportSsh,
+		Command:    "template " + tmpl.Name,
+		Target:     target,
+		TemplateId: tmpl.Id,
+		Status:     db.CommandRunning,
+	}
+	byId := map[string]*db.Device{}
+	for _, device := range devices {
+		if byId[device.Id] != nil {
+			continue
+		}
+		script, err := RenderConfigTemplate(tmpl, device)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", device.Address, err)
+		}
+		byId[device.Id] = device
+		run.Results = append(run.Results, &db.CommandResult{
+			DeviceId:      device.Id,
+			DeviceAddress: device.Address,
+			Script:        script,
+			Status:        db.CommandRunning,
+		})
+	}
+
+	err := run.Create(r.Db)
+	if err != nil {
+		return nil, err
+	}
+	r.Logger.Info("applying configuration template", zap.String("run", run.Id), zap.String("user", user.Username),
+		zap.String("template", tmpl.Name), zap.Int("devices", len(run.Results)))
+
+	started := *run
+	started.Results = nil
+	go r.Run(run, byId)
+
+	return &started, nil
+}
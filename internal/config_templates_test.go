@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestParseVariables(t *testing.T) {
+	vars, err := ParseVariables("# comment\nntp_server = 10.0.0.1\n\ndns=1.1.1.1,8.8.8.8\nempty=")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"ntp_server": "10.0.0.1", "dns": "1.1.1.1,8.8.8.8", "empty": ""}, vars)
+
+	_, err = ParseVariables("ntp_server")
+	assert.Error(t, err)
+	_, err = ParseVariables("ntp-server=10.0.0.1")
+	assert.Error(t, err)
+}
+
+func TestDeviceVariables(t *testing.T) {
+	device := &db.Device{Groups: []*db.DeviceGroup{
+		{Name: "site-b", Variables: "ntp=10.0.1.1"},
+		{Name: "site-a", Variables: "ntp=10.0.0.1\ndns=10.0.0.53"},
+	}}
+
+	vars, err := DeviceVariables(device)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"ntp": "10.0.1.1", "dns": "10.0.0.53"}, vars)
+
+	device.Groups[0].Variables = "invalid"
+	_, err = DeviceVariables(device)
+	assert.ErrorContains(t, err, "site-b")
+}
+
+func TestRenderConfigTemplate(t *testing.T) {
+	device := &db.Device{Identity: "core-1", Groups: []*db.DeviceGroup{{Name: "core", Variables: "ntp=10.0.0.1"}}}
+
+	tmpl := &db.ConfigTemplate{Name: "ntp", Body: "/system identity set name={{ .Device.Identity }}\n/system ntp client servers set {{ .Vars.ntp }}\n"}
+	script, err := RenderConfigTemplate(tmpl, device)
+	assert.NoError(t, err)
+	assert.Equal(t, "/system identity set name=core-1\n/system ntp client servers set 10.0.0.1", script)
+
+	// a missing variable fails the rendering
+	tmpl.Body = "{{ .Vars.dns }}"
+	_, err = RenderConfigTemplate(tmpl, device)
+	assert.Error(t, err)
+
+	tmpl.Body = "{{ .Vars.ntp"
+	_, err = RenderConfigTemplate(tmpl, device)
+	assert.Error(t, err)
+
+	tmpl.Body = " "
+	_, err = RenderConfigTemplate(tmpl, device)
+	assert.Error(t, err)
+
+	tmpl.Body = "{{ .Vars.ntp }}"
+	previews := PreviewConfigTemplate(tmpl, []*db.Device{device, {Address: "10.0.0.2"}})
+	assert.Len(t, previews, 2)
+	assert.Equal(t, "10.0.0.1", previews[0].Script)
+	assert.Empty(t, previews[0].Error)
+	assert.NotEmpty(t, previews[1].Error)
+}
+
+func TestStartTemplate(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var devices []*db.Device
+	for _, identity := range []string{"core-1", "core-2"} {
+		device := &db.Device{Address: "10.0.0." + identity[len(identity)-1:], Identity: identity}
+		err = device.Create(database)
+		if err != nil {
+			t.Fatal(err)
+		}
+		devices = append(devices, device)
+	}
+
+	runner := NewCommandRunner(database, nil, zap.NewNop())
+	runner.run = func(device *db.Device, transport string, command string) (string, error) {
+		return transport + " " + command, nil
+	}
+
+	tmpl := &db.ConfigTemplate{Name: "identity", Body: "/system identity set name={{ .Device.Identity }}"}
+	err = tmpl.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = runner.StartTemplate(&db.User{Role: db.UserRoleOperator}, tmpl, "2 device(s)", devices)
+	assert.ErrorIs(t, err, ErrCommandNotAllowed)
+
+	admin := &db.User{Username: "admin", Role: db.UserRoleAdmin}
+	_, err = runner.StartTemplate(admin, &db.ConfigTemplate{Name: "broken", Body: "{{ .Vars.missing }}"}, "2 device(s)", devices)
+	assert.Error(t, err)
+
+	started, err := runner.StartTemplate(admin, tmpl, "2 device(s)", devices)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := &db.CommandRun{}
+	run.Id = started.Id
+	assert.Eventually(t, func() bool {
+		err = run.GetById(database)
+		return err == nil && run.Finished()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, "template identity", run.Command)
+	assert.Equal(t, tmpl.Id, run.TemplateId)
+	assert.Len(t, run.Results, 2)
+	for i, result := range run.Results {
+		assert.Equal(t, db.CommandSucceeded, result.Status)
+		assert.Equal(t, "/system identity set name="+devices[i].Identity, result.Script)
+		assert.Equal(t, "ssh /system identity set name="+devices[i].Identity, result.Output)
+	}
+}
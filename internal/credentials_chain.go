@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/mazay/mikromanager/db"
+)
+
+// authErrorMarkers are the substrings of the RouterOS API and SSH errors returned on failed logins
+var authErrorMarkers = []string{
+	"invalid user name or password",
+	"unable to authenticate",
+	"cannot log in",
+}
+
+// IsAuthError returns true if the error was caused by the device refusing the credentials.
+func IsAuthError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, marker := range authErrorMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// TryCredentials calls fn with the credentials of the chain in order, starting with the working
+// credentials if those are in the chain, until fn doesn't fail with an authentication error.
+// Any other error stops the iteration as trying other credentials would not help. The passwords
+// are resolved with the secrets, credentials whose password can not be resolved are skipped. It
+// returns the credentials accepted by the device and the error returned by the last fn call.
+func TryCredentials(chain []*db.Credentials, workingId string, secrets *Secrets, fn func(creds *db.Credentials, password string) error) (*db.Credentials, error) {
+	var (
+		err     error
+		ordered []*db.Credentials
+	)
+
+	if len(chain) == 0 {
+		return nil, errors.New("no credentials configured")
+	}
+
+	for _, creds := range chain {
+		if creds.Id == workingId {
+			ordered = append([]*db.Credentials{creds}, ordered...)
+		} else {
+			ordered = append(ordered, creds)
+		}
+	}
+
+	for _, creds := range ordered {
+		password, secretErr := secrets.Password(creds)
+		if secretErr != nil {
+			err = fmt.Errorf("credentials %s: %w", creds.Alias, secretErr)
+			continue
+		}
+
+		err = fn(creds, password)
+		if err == nil {
+			return creds, nil
+		}
+		if !IsAuthError(err) {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+// RememberCredentials stores the credentials accepted by the device so those are tried first
+// the next time. A device event is recorded when the accepted credentials change to any other
+// than the first ones of the chain, meaning the device only accepts fallback credentials. It
+// returns the recorded event, if any, and an error if any of the database operations fail.
+func RememberCredentials(database *db.DB, device *db.Device, chain []*db.Credentials, creds *db.Credentials) (*db.DeviceEvent, error) {
+	if creds == nil || creds.Id == device.WorkingCredentialsID {
+		return nil, nil
+	}
+
+	err := device.SetWorkingCredentials(database, creds.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(chain) == 0 || chain[0].Id == creds.Id {
+		return nil, nil
+	}
+
+	event := &db.DeviceEvent{
+		DeviceId: device.Id,
+		Type:     db.DeviceEventCredsFallback,
+		Message:  fmt.Sprintf("device refused credentials %s, accepted fallback credentials %s", chain[0].Alias, creds.Alias),
+	}
+	return event, event.Create(database)
+}
+
+// runWithCredentials runs the API command on the device trying its credentials chain and stores
+// the accepted credentials, the connection is reused from the pool if any. It returns the reply
+// sentences and an error if the command fails with all the credentials, the context is done or
+// the accepted credentials can not be stored.
+func runWithCredentials(ctx context.Context, device *db.Device, database *db.DB, secrets *Secrets, pool *ApiPool, command string) ([]*proto.Sentence, error) {
+	var reply []*proto.Sentence
+
+	chain, err := device.GetCredentialsChain(database)
+	if err != nil {
+		return nil, err
+	}
+
+	api := &Api{
+		Address: device.Address,
+		Port:    device.ApiPort,
+		Async:   true,
+		Pool:    pool,
+	}
+	creds, err := TryCredentials(chain, device.WorkingCredentialsID, secrets, func(creds *db.Credentials, password string) error {
+		api.Username = creds.Username
+		api.Password = password
+		result, err := api.RunContext(ctx, command)
+		reply = result
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = RememberCredentials(database, device, chain, creds)
+	return reply, err
+}
+
+// sshWithCredentials runs the CLI command on the device over SSH trying its credentials chain
+// and stores the accepted credentials. It returns the command output and an error if the command
+// fails with all the credentials, the context is done or the accepted credentials can not be
+// stored.
+func sshWithCredentials(ctx context.Context, device *db.Device, database *db.DB, secrets *Secrets, command string) ([]byte, error) {
+	var output []byte
+
+	chain, err := device.GetCredentialsChain(database)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &SshClient{Host: device.Address, Port: device.SshPort}
+	creds, err := TryCredentials(chain, device.WorkingCredentialsID, secrets, func(creds *db.Credentials, password string) error {
+		client.User = creds.Username
+		client.Password = password
+		result, err := client.RunContext(ctx, command)
+		output = result
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = RememberCredentials(database, device, chain, creds)
+	return output, err
+}
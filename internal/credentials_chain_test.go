@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+)
+
+const testEncryptionKey = "0123456789abcdef0123456789abcdef"
+
+func testCredentialsChain(t *testing.T, usernames ...string) []*db.Credentials {
+	var chain []*db.Credentials
+	for _, username := range usernames {
+		password, err := db.EncryptString(username+"-password", testEncryptionKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := &db.Credentials{Alias: username, Username: username, EncryptedPassword: password}
+		c.Id = username
+		chain = append(chain, c)
+	}
+	return chain
+}
+
+func TestIsAuthError(t *testing.T) {
+	assert.True(t, IsAuthError(errors.New("from RouterOS device: invalid user name or password (6)")))
+	assert.True(t, IsAuthError(errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password]")))
+	assert.False(t, IsAuthError(errors.New("dial tcp 10.0.0.1:8728: i/o timeout")))
+	assert.False(t, IsAuthError(nil))
+}
+
+func TestTryCredentials(t *testing.T) {
+	chain := testCredentialsChain(t, "admin", "backup", "legacy")
+	authErr := errors.New("invalid user name or password")
+
+	var tried []string
+	login := func(accepted string) func(creds *db.Credentials, password string) error {
+		tried = nil
+		return func(creds *db.Credentials, password string) error {
+			tried = append(tried, creds.Username)
+			assert.Equal(t, creds.Username+"-password", password)
+			if creds.Username != accepted {
+				return authErr
+			}
+			return nil
+		}
+	}
+
+	creds, err := TryCredentials(chain, "", NewSecrets(testEncryptionKey, nil, nil, nil), login("backup"))
+	assert.NoError(t, err)
+	assert.Equal(t, "backup", creds.Username)
+	assert.Equal(t, []string{"admin", "backup"}, tried)
+
+	// the working credentials are tried first
+	creds, err = TryCredentials(chain, "backup", NewSecrets(testEncryptionKey, nil, nil, nil), login("backup"))
+	assert.NoError(t, err)
+	assert.Equal(t, "backup", creds.Username)
+	assert.Equal(t, []string{"backup"}, tried)
+
+	creds, err = TryCredentials(chain, "", NewSecrets(testEncryptionKey, nil, nil, nil), login("nobody"))
+	assert.ErrorIs(t, err, authErr)
+	assert.Nil(t, creds)
+	assert.Len(t, tried, 3)
+
+	// errors other than authentication ones stop the iteration
+	netErr := errors.New("i/o timeout")
+	tried = nil
+	_, err = TryCredentials(chain, "", NewSecrets(testEncryptionKey, nil, nil, nil), func(creds *db.Credentials, password string) error {
+		tried = append(tried, creds.Username)
+		return netErr
+	})
+	assert.ErrorIs(t, err, netErr)
+	assert.Len(t, tried, 1)
+
+	_, err = TryCredentials(nil, "", NewSecrets(testEncryptionKey, nil, nil, nil), login("admin"))
+	assert.Error(t, err)
+}
+
+func TestRememberCredentials(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device := &db.Device{Address: "10.0.0.1"}
+	err = device.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := testCredentialsChain(t, "admin", "backup")
+
+	event, err := RememberCredentials(database, device, chain, chain[0])
+	assert.NoError(t, err)
+	assert.Nil(t, event)
+	assert.Equal(t, "admin", device.WorkingCredentialsID)
+
+	event, err = RememberCredentials(database, device, chain, chain[1])
+	assert.NoError(t, err)
+	assert.Equal(t, db.DeviceEventCredsFallback, event.Type)
+
+	// the same fallback is not reported twice
+	event, err = RememberCredentials(database, device, chain, chain[1])
+	assert.NoError(t, err)
+	assert.Nil(t, event)
+}
@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+	"go.uber.org/zap"
+)
+
+const (
+	CollectorResources       = "resources"
+	CollectorRouterboard     = "routerboard"
+	CollectorIdentity        = "identity"
+	CollectorUpdates         = "updates"
+	CollectorAddresses       = "addresses"
+	CollectorInterfaces      = "interfaces"
+	CollectorRoutes          = "routes"
+	CollectorLeases          = "dhcp-leases"
+	CollectorArp             = "arp"
+	CollectorWirelessClients = "wireless-clients"
+)
+
+// CollectorOptions holds the service-wide options of the built-in collectors.
+type CollectorOptions struct {
+	// MgmtTag is the comment tag of the device management address
+	MgmtTag string
+	// WirelessClients enables the wireless clients collector by default, the client counts are
+	// kept for the WirelessRetention period
+	WirelessClients   bool
+	WirelessRetention time.Duration
+}
+
+// DefaultCollectors returns the built-in collectors in the order the poller runs them, the
+// collectors are enabled on every poll by default.
+func DefaultCollectors(opts *CollectorOptions) []Collector {
+	enabled := CollectorSettings{Enabled: true}
+
+	return []Collector{
+		NewCollector(CollectorResources, "System resources", enabled, collectResources),
+		NewCollector(CollectorRouterboard, "RouterBOARD details and serial number checks", enabled, collectRouterboard),
+		NewCollector(CollectorIdentity, "System identity", enabled, collectIdentity),
+		NewCollector(CollectorUpdates, "Available RouterOS updates", enabled, func(ctx context.Context, target *CollectorTarget) error {
+			return target.Client.CheckForUpdates(ctx, target.Device)
+		}),
+		NewCollector(CollectorAddresses, "IP addresses and the management address", enabled, func(ctx context.Context, target *CollectorTarget) error {
+			return collectAddresses(ctx, target, opts.MgmtTag)
+		}),
+		NewCollector(CollectorInterfaces, "Interfaces and traffic rates", enabled, collectInterfaces),
+		NewCollector(CollectorRoutes, "Static and connected routes", enabled, collectRoutes),
+		NewCollector(CollectorLeases, "DHCP leases", enabled, collectLeases),
+		NewCollector(CollectorArp, "ARP entries", enabled, collectArpEntries),
+		NewCollector(CollectorWirelessClients, "Wireless and CAPsMAN clients", CollectorSettings{Enabled: opts.WirelessClients}, func(ctx context.Context, target *CollectorTarget) error {
+			return collectWirelessClients(ctx, target, opts.WirelessRetention)
+		}),
+	}
+}
+
+// logEvents logs the events recorded by the collector.
+func (target *CollectorTarget) logEvents(events ...*db.DeviceEvent) {
+	if target.Logger == nil {
+		return
+	}
+	for _, event := range events {
+		target.Logger.Warn(event.Message, zap.String("device", target.Device.Id), zap.String("event", event.Type))
+	}
+}
+
+// collectInto runs the command and unmarshals its first sentence into the device.
+func collectInto(ctx context.Context, target *CollectorTarget, command string) error {
+	resource, err := target.Client.RunContext(ctx, command)
+	if err != nil {
+		return err
+	}
+	if len(resource) == 0 {
+		return errors.New("got an empty response to " + command)
+	}
+	inrec, _ := json.Marshal(resource[0].Map)
+	return json.Unmarshal(inrec, target.Device)
+}
+
+func collectResources(ctx context.Context, target *CollectorTarget) error {
+	return collectInto(ctx, target, "/system/resource/print")
+}
+
+// collectRouterboard fetches the RouterBOARD details and records the events of the serial
+// number changes.
+func collectRouterboard(ctx context.Context, target *CollectorTarget) error {
+	previous := target.Device.SerialNumber
+	err := collectInto(ctx, target, "/system/routerboard/print")
+	if err != nil {
+		return err
+	}
+
+	events, err := CheckDeviceSerial(target.Db, target.Device, previous)
+	if err != nil {
+		return err
+	}
+	target.logEvents(events...)
+	return nil
+}
+
+func collectIdentity(ctx context.Context, target *CollectorTarget) error {
+	identity, err := target.Client.RunContext(ctx, "/system/identity/print")
+	if err != nil {
+		return err
+	}
+	if len(identity) == 0 {
+		return errors.New("got an empty identity data")
+	}
+	target.Device.Identity = identity[0].Map["name"]
+	return nil
+}
+
+// collectAddresses stores the device IP addresses and switches the device management address
+// to the one commented with the tag.
+func collectAddresses(ctx context.Context, target *CollectorTarget, mgmtTag string) error {
+	sentences, err := target.Client.RunContext(ctx, "/ip/address/print")
+	if err != nil {
+		return err
+	}
+
+	event, err := UpdateDeviceAddresses(target.Db, target.Device, ParseDeviceAddresses(sentences, mgmtTag))
+	if err != nil {
+		return err
+	}
+	if event != nil {
+		target.logEvents(event)
+	}
+	return nil
+}
+
+// collectInterfaces stores the device interfaces along with their traffic rates and records the
+// events of the expected interfaces going down or up.
+func collectInterfaces(ctx context.Context, target *CollectorTarget) error {
+	sentences, err := target.Client.RunContext(ctx, "/interface/print")
+	if err != nil {
+		return err
+	}
+
+	events, err := UpdateDeviceInterfaces(target.Db, target.Device, ParseDeviceInterfaces(sentences, time.Now()))
+	if err != nil {
+		return err
+	}
+	target.logEvents(events...)
+	return nil
+}
+
+func collectRoutes(ctx context.Context, target *CollectorTarget) error {
+	sentences, err := target.Client.RunContext(ctx, DeviceRoutesCommand)
+	if err != nil {
+		return err
+	}
+	return db.ReplaceDeviceRoutes(target.Db, target.Device.Id, ParseDeviceRoutes(sentences))
+}
+
+func collectLeases(ctx context.Context, target *CollectorTarget) error {
+	sentences, err := target.Client.RunContext(ctx, "/ip/dhcp-server/lease/print")
+	if err != nil {
+		return err
+	}
+	return db.ReplaceDeviceLeases(target.Db, target.Device.Id, ParseDeviceLeases(sentences))
+}
+
+func collectArpEntries(ctx context.Context, target *CollectorTarget) error {
+	sentences, err := target.Client.RunContext(ctx, "/ip/arp/print")
+	if err != nil {
+		return err
+	}
+	return db.ReplaceDeviceArpEntries(target.Db, target.Device.Id, ParseDeviceArpEntries(sentences))
+}
+
+// collectWirelessClients stores the clients of the device wireless registration tables along
+// with their count, the devices without any of the wireless menus are skipped.
+func collectWirelessClients(ctx context.Context, target *CollectorTarget, retention time.Duration) error {
+	var (
+		clients []*db.DeviceWirelessClient
+		found   bool
+	)
+
+	for _, menu := range WirelessMenus {
+		sentences, err := target.Client.RunContext(ctx, menu+"/registration-table/print")
+		if IsUnknownCommand(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		clients = append(clients, ParseWirelessClients(menu, sentences)...)
+	}
+	if !found {
+		return nil
+	}
+
+	return UpdateWirelessClients(target.Db, target.Device, clients, time.Now(), retention)
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -74,25 +75,11 @@ func SentencesToCpuResources(outputs []*proto.Sentence) (map[string]*CpuResource
 
 // GetCpuResources retrieves the CPU resources from a Mikrotik device and saves them to the database.
 // It executes the "/system/resource/cpu/getall" command via the Mikrotik API, parses the response into a map of
-// CpuResource objects, and returns the map. If any step fails, an error is returned.
-func GetCpuResources(device *db.Device, database *db.DB, encryptionKey string) (map[string]*CpuResource, error) {
-	credentials, err := device.GetCredentials(database)
-	if err != nil {
-		return nil, err
-	}
-
-	encryptedPassword, err := db.DecryptString(credentials.EncryptedPassword, encryptionKey)
-	if err != nil {
-		return nil, err
-	}
-
-	api := &Api{
-		Address:  device.Address,
-		Username: credentials.Username,
-		Password: encryptedPassword,
-		Async:    true,
-	}
-	resource, err := api.Run("/system/resource/cpu/getall")
+// CpuResource objects, and returns the map. The credentials chain of the device is tried with the passwords
+// resolved by the secrets, reusing the pool connections. If any step fails or the context is done,
+// an error is returned.
+func GetCpuResources(ctx context.Context, device *db.Device, database *db.DB, secrets *Secrets, pool *ApiPool) (map[string]*CpuResource, error) {
+	resource, err := runWithCredentials(ctx, device, database, secrets, pool, "/system/resource/cpu/getall")
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -220,26 +221,11 @@ func SentencesToHealth(outputs []*proto.Sentence) (*Health, error) {
 // and saves it to the database. It executes the "/system/health/getall"
 // command via the Mikrotik API, parses the response into a Health object,
 // and then saves the health data associated with the given device to the
-// specified database. If any step fails, an error is logged and the
-// process is aborted.
-func GetDeviceHealth(device *db.Device, database *db.DB, encryptionKey string) (*Health, error) {
-	credentials, err := device.GetCredentials(database)
-	if err != nil {
-		return nil, err
-	}
-
-	encryptedPassword, err := db.DecryptString(credentials.EncryptedPassword, encryptionKey)
-	if err != nil {
-		return nil, err
-	}
-
-	api := &Api{
-		Address:  device.Address,
-		Username: credentials.Username,
-		Password: encryptedPassword,
-		Async:    true,
-	}
-	resource, err := api.Run("/system/health/getall")
+// specified database. The credentials chain of the device is tried with
+// the passwords resolved by the secrets, reusing the pool connections. If
+// any step fails or the context is done, an error is returned.
+func GetDeviceHealth(ctx context.Context, device *db.Device, database *db.DB, secrets *Secrets, pool *ApiPool) (*Health, error) {
+	resource, err := runWithCredentials(ctx, device, database, secrets, pool, "/system/health/getall")
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/mazay/mikromanager/db"
+	"gorm.io/gorm"
+)
+
+// ParseDeviceAddresses converts the /ip/address/print sentences to known device addresses, the
+// address with the comment matching the management tag is flagged as the management one.
+func ParseDeviceAddresses(sentences []*proto.Sentence, mgmtTag string) []*db.DeviceAddress {
+	var addresses []*db.DeviceAddress
+
+	for _, sentence := range sentences {
+		s := sentence.Map
+		address, _, _ := strings.Cut(s["address"], "/")
+		if address == "" {
+			continue
+		}
+		addresses = append(addresses, &db.DeviceAddress{
+			Address:    address,
+			Network:    s["network"],
+			Interface:  s["interface"],
+			Comment:    s["comment"],
+			Management: mgmtTag != "" && strings.TrimSpace(s["comment"]) == mgmtTag,
+		})
+	}
+
+	return addresses
+}
+
+// managementAddress returns the first address flagged as the management one, or an empty string.
+func managementAddress(addresses []*db.DeviceAddress) string {
+	for _, a := range addresses {
+		if a.Management {
+			return a.Address
+		}
+	}
+	return ""
+}
+
+// UpdateDeviceAddresses stores the known addresses of the device and switches its management
+// address to the one tagged on the device. The switch is refused if the address already belongs
+// to another device, including a trashed one. Both outcomes are recorded as device events, a
+// conflict only when it appears and once more when it is resolved, the new management address is
+// saved right away. It returns the recorded event, if any, and an error if any of the database
+// operations fail.
+func UpdateDeviceAddresses(database *db.DB, device *db.Device, addresses []*db.DeviceAddress) (*db.DeviceEvent, error) {
+	var (
+		event    *db.DeviceEvent
+		previous = &db.DeviceEvent{}
+	)
+
+	err := previous.GetLastOfTypes(database, device.Id, db.DeviceEventAddressChanged, db.DeviceEventAddressConflict, db.DeviceEventAddressResolved)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		previous = nil
+	} else if err != nil {
+		return nil, err
+	}
+	conflicted := previous != nil && previous.Type == db.DeviceEventAddressConflict
+
+	mgmt := managementAddress(addresses)
+	if mgmt == "" && device.Address != "" {
+		// keep the current address as the management one if it's still assigned on the device
+		for _, a := range addresses {
+			if a.Address == device.Address {
+				a.Management = true
+			}
+		}
+	}
+
+	if mgmt != "" && mgmt != device.Address {
+		owner := &db.Device{Address: mgmt}
+		err := owner.GetByAddress(database)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			event = &db.DeviceEvent{
+				DeviceId: device.Id,
+				Type:     db.DeviceEventAddressChanged,
+				Message:  fmt.Sprintf("management address changed from %s to %s", device.Address, mgmt),
+			}
+			err = device.SetAddress(database, mgmt)
+			if err != nil {
+				return nil, err
+			}
+		case err != nil:
+			return nil, err
+		default:
+			event = &db.DeviceEvent{
+				DeviceId: device.Id,
+				Type:     db.DeviceEventAddressConflict,
+				Message:  fmt.Sprintf("management address %s is already used by device %s, keeping %s", mgmt, owner.Id, device.Address),
+			}
+			for _, a := range addresses {
+				a.Management = a.Address == device.Address
+			}
+			// the same conflict was already recorded by an earlier poll
+			if conflicted && previous.Message == event.Message {
+				event = nil
+			}
+		}
+	} else if conflicted {
+		event = &db.DeviceEvent{
+			DeviceId: device.Id,
+			Type:     db.DeviceEventAddressResolved,
+			Message:  fmt.Sprintf("management address conflict resolved, keeping %s", device.Address),
+		}
+	}
+
+	err = db.ReplaceDeviceAddresses(database, device.Id, addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	if event != nil {
+		err = event.Create(database)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return event, nil
+}
+
+// CheckDeviceSerial records an event when the serial number reported by the device differs
+// from the previously known one, which means the hardware behind the address was replaced,
+// or when another device reports the same serial number. The check only runs when the serial
+// number changes to avoid recording the same event on every poll. It returns the recorded
+// events and an error if any of the database operations fail.
+func CheckDeviceSerial(database *db.DB, device *db.Device, previous string) ([]*db.DeviceEvent, error) {
+	var events []*db.DeviceEvent
+
+	if device.SerialNumber == "" || device.SerialNumber == previous {
+		return nil, nil
+	}
+
+	if previous != "" {
+		events = append(events, &db.DeviceEvent{
+			DeviceId: device.Id,
+			Type:     db.DeviceEventSerialChanged,
+			Message:  fmt.Sprintf("serial number changed from %s to %s", previous, device.SerialNumber),
+		})
+	}
+
+	duplicates, err := device.GetDuplicates(database)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range duplicates {
+		events = append(events, &db.DeviceEvent{
+			DeviceId: device.Id,
+			Type:     db.DeviceEventDuplicateSerial,
+			Message:  fmt.Sprintf("serial number %s is also reported by device %s (%s)", device.SerialNumber, d.Id, d.Address),
+		})
+	}
+
+	for _, e := range events {
+		err = e.Create(database)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDeviceAddresses(t *testing.T) {
+	sentences := []*proto.Sentence{
+		{Map: map[string]string{"address": "10.0.0.1/24", "network": "10.0.0.0", "interface": "ether1"}},
+		{Map: map[string]string{"address": "10.0.1.1/24", "interface": "vlan10", "comment": "MGMT"}},
+		{Map: map[string]string{"interface": "ether3"}},
+	}
+
+	addresses := ParseDeviceAddresses(sentences, "MGMT")
+	assert.Len(t, addresses, 2)
+	assert.Equal(t, "10.0.0.1", addresses[0].Address)
+	assert.False(t, addresses[0].Management)
+	assert.Equal(t, "10.0.1.1", addresses[1].Address)
+	assert.True(t, addresses[1].Management)
+
+	addresses = ParseDeviceAddresses(sentences, "OOB")
+	assert.False(t, addresses[1].Management)
+}
+
+func TestUpdateDeviceAddresses(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device := &db.Device{Address: "10.0.0.1"}
+	other := &db.Device{Address: "10.0.2.1"}
+	for _, d := range []*db.Device{device, other} {
+		err = d.Create(database)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// no tagged address, the current one stays the management address
+	event, err := UpdateDeviceAddresses(database, device, []*db.DeviceAddress{{Address: "10.0.0.1"}})
+	assert.NoError(t, err)
+	assert.Nil(t, event)
+	assert.Equal(t, "10.0.0.1", device.Address)
+
+	// the tagged address is free, the device switches to it
+	event, err = UpdateDeviceAddresses(database, device, []*db.DeviceAddress{
+		{Address: "10.0.0.1"},
+		{Address: "10.0.1.1", Management: true},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, db.DeviceEventAddressChanged, event.Type)
+	assert.Equal(t, "10.0.1.1", device.Address)
+	stored := &db.Device{}
+	stored.Id = device.Id
+	assert.NoError(t, stored.GetById(database))
+	assert.Equal(t, "10.0.1.1", stored.Address)
+
+	// the tagged address belongs to another device, the switch is refused
+	event, err = UpdateDeviceAddresses(database, device, []*db.DeviceAddress{
+		{Address: "10.0.1.1"},
+		{Address: "10.0.2.1", Management: true},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, db.DeviceEventAddressConflict, event.Type)
+	assert.Equal(t, "10.0.1.1", device.Address)
+
+	known, err := (&db.DeviceAddress{}).GetByDeviceId(database, device.Id)
+	assert.NoError(t, err)
+	assert.Len(t, known, 2)
+	assert.True(t, known[0].Management)
+	assert.False(t, known[1].Management)
+
+	events, err := (&db.DeviceEvent{}).GetByDeviceId(database, device.Id, 0)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	// the ongoing conflict is not recorded again on the next poll
+	// the management flags are updated in place, every poll gets its own list
+	conflicting := func() []*db.DeviceAddress {
+		return []*db.DeviceAddress{
+			{Address: "10.0.1.1"},
+			{Address: "10.0.2.1", Management: true},
+		}
+	}
+	event, err = UpdateDeviceAddresses(database, device, conflicting())
+	assert.NoError(t, err)
+	assert.Nil(t, event)
+
+	// the resolution is recorded once
+	resolved := func() []*db.DeviceAddress {
+		return []*db.DeviceAddress{{Address: "10.0.1.1"}}
+	}
+	event, err = UpdateDeviceAddresses(database, device, resolved())
+	assert.NoError(t, err)
+	assert.Equal(t, db.DeviceEventAddressResolved, event.Type)
+	event, err = UpdateDeviceAddresses(database, device, resolved())
+	assert.NoError(t, err)
+	assert.Nil(t, event)
+
+	// a conflict appearing again is recorded
+	event, err = UpdateDeviceAddresses(database, device, conflicting())
+	assert.NoError(t, err)
+	assert.Equal(t, db.DeviceEventAddressConflict, event.Type)
+
+	events, err = (&db.DeviceEvent{}).GetByDeviceId(database, device.Id, 0)
+	assert.NoError(t, err)
+	assert.Len(t, events, 4)
+}
+
+func TestCheckDeviceSerial(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device := &db.Device{Address: "10.0.0.1", SerialNumber: "AAA"}
+	other := &db.Device{Address: "10.0.0.2", SerialNumber: "BBB"}
+	for _, d := range []*db.Device{device, other} {
+		err = d.Create(database)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := CheckDeviceSerial(database, device, "AAA")
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+
+	device.SerialNumber = "BBB"
+	events, err = CheckDeviceSerial(database, device, "AAA")
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, db.DeviceEventSerialChanged, events[0].Type)
+	assert.Equal(t, db.DeviceEventDuplicateSerial, events[1].Type)
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/mazay/mikromanager/db"
+)
+
+// parseCounter converts the interface counter to a number, the missing or malformed counters
+// are zero.
+func parseCounter(value string) int64 {
+	counter, _ := strconv.ParseInt(value, 10, 64)
+	return counter
+}
+
+// ParseDeviceInterfaces converts the /interface/print sentences to the device interfaces polled
+// at the given time.
+func ParseDeviceInterfaces(sentences []*proto.Sentence, polledAt time.Time) []*db.DeviceInterface {
+	var interfaces []*db.DeviceInterface
+
+	for _, sentence := range sentences {
+		s := sentence.Map
+		if s["name"] == "" {
+			continue
+		}
+		interfaces = append(interfaces, &db.DeviceInterface{
+			Name:       s["name"],
+			Type:       s["type"],
+			MacAddress: normalizeMacAddress(s["mac-address"]),
+			Comment:    s["comment"],
+			Running:    s["running"] == "true",
+			Disabled:   s["disabled"] == "true",
+			RxBytes:    parseCounter(s["rx-byte"]),
+			TxBytes:    parseCounter(s["tx-byte"]),
+			RxErrors:   parseCounter(s["rx-error"]),
+			TxErrors:   parseCounter(s["tx-error"]),
+			PolledAt:   polledAt,
+		})
+	}
+
+	return interfaces
+}
+
+// interfaceRate returns the bits per second between the two byte counters, zero if the counter
+// was reset in between, e.g. by a reboot.
+func interfaceRate(current int64, previous int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 || current < previous {
+		return 0
+	}
+	return float64(current-previous) * 8 / elapsed.Seconds()
+}
+
+// UpdateDeviceInterfaces computes the interface rates against the previously polled counters
+// and stores the interfaces of the device. The interfaces seen running for the first time are
+// expected to keep running, the expectation of the known ones is kept. A down event is recorded
+// when an expected interface stops running or disappears, unless it was disabled, and an up event
+// when it runs again. It returns the recorded events and an error if any of the database operations
+// fail.
+func UpdateDeviceInterfaces(database *db.DB, device *db.Device, interfaces []*db.DeviceInterface) ([]*db.DeviceEvent, error) {
+	var (
+		iface    = &db.DeviceInterface{}
+		events   []*db.DeviceEvent
+		previous = map[string]*db.DeviceInterface{}
+	)
+
+	known, err := iface.GetByDeviceId(database, device.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range known {
+		previous[i.Name] = i
+	}
+
+	for _, i := range interfaces {
+		prev, ok := previous[i.Name]
+		if !ok {
+			i.Expected = i.Running && !i.Disabled
+			continue
+		}
+		delete(previous, i.Name)
+
+		elapsed := i.PolledAt.Sub(prev.PolledAt)
+		i.RxRate = interfaceRate(i.RxBytes, prev.RxBytes, elapsed)
+		i.TxRate = interfaceRate(i.TxBytes, prev.TxBytes, elapsed)
+		i.Expected = prev.Expected
+
+		switch {
+		case !i.Expected || i.Disabled:
+		case prev.Running && !i.Running:
+			events = append(events, &db.DeviceEvent{
+				DeviceId: device.Id,
+				Type:     db.DeviceEventInterfaceDown,
+				Message:  fmt.Sprintf("interface %s is down", i.Name),
+			})
+		case !prev.Running && i.Running:
+			events = append(events, &db.DeviceEvent{
+				DeviceId: device.Id,
+				Type:     db.DeviceEventInterfaceUp,
+				Message:  fmt.Sprintf("interface %s is up", i.Name),
+			})
+		}
+	}
+
+	// the expected interfaces missing from the device are down as well
+	for _, prev := range known {
+		if _, missing := previous[prev.Name]; !missing || !prev.Expected || !prev.Running || prev.Disabled {
+			continue
+		}
+		events = append(events, &db.DeviceEvent{
+			DeviceId: device.Id,
+			Type:     db.DeviceEventInterfaceDown,
+			Message:  fmt.Sprintf("interface %s is gone", prev.Name),
+		})
+	}
+
+	err = db.ReplaceDeviceInterfaces(database, device.Id, interfaces)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range events {
+		err = e.Create(database)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDeviceInterfaces(t *testing.T) {
+	now := time.Now()
+	sentences := []*proto.Sentence{
+		{Map: map[string]string{
+			"name": "ether1", "type": "ether", "mac-address": "AA:BB:CC:DD:EE:01", "running": "true",
+			"disabled": "false", "rx-byte": "1000", "tx-byte": "2000", "rx-error": "3", "tx-error": "bogus",
+		}},
+		{Map: map[string]string{"name": "wlan1", "type": "wlan", "running": "false", "disabled": "true"}},
+		{Map: map[string]string{"type": "ether"}},
+	}
+
+	interfaces := ParseDeviceInterfaces(sentences, now)
+	assert.Len(t, interfaces, 2)
+	assert.Equal(t, "ether1", interfaces[0].Name)
+	assert.Equal(t, "AA:BB:CC:DD:EE:01", interfaces[0].MacAddress)
+	assert.True(t, interfaces[0].Running)
+	assert.False(t, interfaces[0].Disabled)
+	assert.Equal(t, int64(1000), interfaces[0].RxBytes)
+	assert.Equal(t, int64(2000), interfaces[0].TxBytes)
+	assert.Equal(t, int64(3), interfaces[0].RxErrors)
+	assert.Equal(t, int64(0), interfaces[0].TxErrors)
+	assert.Equal(t, now, interfaces[0].PolledAt)
+	assert.True(t, interfaces[1].Disabled)
+}
+
+func TestInterfaceRate(t *testing.T) {
+	assert.Equal(t, float64(800), interfaceRate(1100, 1000, time.Second))
+	assert.Equal(t, float64(80), interfaceRate(1100, 1000, 10*time.Second))
+	// the counter was reset
+	assert.Equal(t, float64(0), interfaceRate(100, 1000, time.Second))
+	assert.Equal(t, float64(0), interfaceRate(1100, 1000, 0))
+}
+
+func TestUpdateDeviceInterfaces(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device := &db.Device{Address: "10.0.0.1"}
+	err = device.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iface := &db.DeviceInterface{}
+	start := time.Now()
+
+	// the running interfaces are expected on the first poll
+	events, err := UpdateDeviceInterfaces(database, device, []*db.DeviceInterface{
+		{Name: "ether1", Running: true, RxBytes: 1000, TxBytes: 1000, PolledAt: start},
+		{Name: "ether2", Running: false, PolledAt: start},
+		{Name: "ether3", Running: true, PolledAt: start},
+		{Name: "ether4", Running: true, PolledAt: start},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+	list, err := iface.GetByDeviceId(database, device.Id)
+	assert.NoError(t, err)
+	assert.True(t, list[0].Expected)
+	assert.False(t, list[1].Expected)
+	assert.Zero(t, list[0].RxRate)
+
+	// ether1 goes down, ether3 is disabled and ether4 disappears
+	second := start.Add(10 * time.Second)
+	events, err = UpdateDeviceInterfaces(database, device, []*db.DeviceInterface{
+		{Name: "ether1", Running: false, RxBytes: 2000, TxBytes: 500, PolledAt: second},
+		{Name: "ether2", Running: true, PolledAt: second},
+		{Name: "ether3", Running: false, Disabled: true, PolledAt: second},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, db.DeviceEventInterfaceDown, events[0].Type)
+	assert.Equal(t, "interface ether1 is down", events[0].Message)
+	assert.Equal(t, "interface ether4 is gone", events[1].Message)
+	list, err = iface.GetByDeviceId(database, device.Id)
+	assert.NoError(t, err)
+	assert.Len(t, list, 3)
+	assert.Equal(t, float64(800), list[0].RxRate)
+	assert.Zero(t, list[0].TxRate)
+	assert.True(t, list[0].Expected)
+	assert.False(t, list[1].Expected)
+
+	// ether1 is running again
+	events, err = UpdateDeviceInterfaces(database, device, []*db.DeviceInterface{
+		{Name: "ether1", Running: true, PolledAt: second.Add(time.Minute)},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, db.DeviceEventInterfaceUp, events[0].Type)
+
+	stored, err := (&db.DeviceEvent{}).GetByDeviceId(database, device.Id, 0)
+	assert.NoError(t, err)
+	assert.Len(t, stored, 3)
+}
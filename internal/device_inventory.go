@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/mazay/mikromanager/db"
+)
+
+// DeviceRoutesCommand fetches the static and connected routes, the dynamic routing protocols may
+// add way too many routes to keep them in the inventory
+const DeviceRoutesCommand = "/ip/route/print ?static=true ?connect=true ?#|"
+
+// ParseDeviceRoutes converts the /ip/route/print sentences to the device routes.
+func ParseDeviceRoutes(sentences []*proto.Sentence) []*db.DeviceRoute {
+	var routes []*db.DeviceRoute
+
+	for _, sentence := range sentences {
+		s := sentence.Map
+		if s["dst-address"] == "" {
+			continue
+		}
+		routes = append(routes, &db.DeviceRoute{
+			DstAddress:   s["dst-address"],
+			Gateway:      s["gateway"],
+			Distance:     s["distance"],
+			RoutingTable: s["routing-table"],
+			Comment:      s["comment"],
+			Connected:    s["connect"] == "true",
+			Active:       s["active"] == "true",
+		})
+	}
+
+	return routes
+}
+
+// ParseDeviceLeases converts the /ip/dhcp-server/lease/print sentences to the device DHCP leases.
+func ParseDeviceLeases(sentences []*proto.Sentence) []*db.DeviceLease {
+	var leases []*db.DeviceLease
+
+	for _, sentence := range sentences {
+		s := sentence.Map
+		if s["address"] == "" && s["mac-address"] == "" {
+			continue
+		}
+		leases = append(leases, &db.DeviceLease{
+			Address:    s["address"],
+			MacAddress: normalizeMacAddress(s["mac-address"]),
+			HostName:   s["host-name"],
+			Server:     s["server"],
+			Status:     s["status"],
+			Comment:    s["comment"],
+			Dynamic:    s["dynamic"] == "true",
+		})
+	}
+
+	return leases
+}
+
+// ParseDeviceArpEntries converts the /ip/arp/print sentences to the device ARP entries.
+func ParseDeviceArpEntries(sentences []*proto.Sentence) []*db.DeviceArpEntry {
+	var entries []*db.DeviceArpEntry
+
+	for _, sentence := range sentences {
+		s := sentence.Map
+		if s["address"] == "" {
+			continue
+		}
+		entries = append(entries, &db.DeviceArpEntry{
+			Address:    s["address"],
+			MacAddress: normalizeMacAddress(s["mac-address"]),
+			Interface:  s["interface"],
+			Comment:    s["comment"],
+			Dynamic:    s["dynamic"] == "true",
+			Complete:   s["complete"] == "true",
+		})
+	}
+
+	return entries
+}
@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDeviceRoutes(t *testing.T) {
+	sentences := []*proto.Sentence{
+		{Map: map[string]string{"dst-address": "0.0.0.0/0", "gateway": "10.0.0.254", "distance": "1", "routing-table": "main", "static": "true", "active": "true"}},
+		{Map: map[string]string{"dst-address": "10.0.0.0/24", "gateway": "bridge", "distance": "0", "routing-table": "main", "connect": "true", "active": "true"}},
+		{Map: map[string]string{"gateway": "10.0.0.1"}},
+	}
+
+	routes := ParseDeviceRoutes(sentences)
+	assert.Len(t, routes, 2)
+	assert.Equal(t, "0.0.0.0/0", routes[0].DstAddress)
+	assert.Equal(t, "10.0.0.254", routes[0].Gateway)
+	assert.Equal(t, "1", routes[0].Distance)
+	assert.False(t, routes[0].Connected)
+	assert.True(t, routes[0].Active)
+	assert.True(t, routes[1].Connected)
+}
+
+func TestParseDeviceLeases(t *testing.T) {
+	sentences := []*proto.Sentence{
+		{Map: map[string]string{"address": "10.0.0.10", "mac-address": "aa:bb:cc:dd:ee:01", "host-name": "printer", "server": "dhcp1", "status": "bound", "dynamic": "true"}},
+		{Map: map[string]string{"address": "10.0.0.11", "mac-address": "1:AA:BB:CC:DD:EE:02"}},
+		{Map: map[string]string{"server": "dhcp1"}},
+	}
+
+	leases := ParseDeviceLeases(sentences)
+	assert.Len(t, leases, 2)
+	assert.Equal(t, "10.0.0.10", leases[0].Address)
+	assert.Equal(t, "AA:BB:CC:DD:EE:01", leases[0].MacAddress)
+	assert.Equal(t, "printer", leases[0].HostName)
+	assert.Equal(t, "bound", leases[0].Status)
+	assert.True(t, leases[0].Dynamic)
+	// the values which are not MAC addresses are kept as is
+	assert.Equal(t, "1:AA:BB:CC:DD:EE:02", leases[1].MacAddress)
+}
+
+func TestParseDeviceArpEntries(t *testing.T) {
+	sentences := []*proto.Sentence{
+		{Map: map[string]string{"address": "10.0.0.10", "mac-address": "AA:BB:CC:DD:EE:01", "interface": "bridge", "dynamic": "true", "complete": "true"}},
+		{Map: map[string]string{"address": "10.0.0.11", "interface": "bridge"}},
+		{Map: map[string]string{"interface": "bridge"}},
+	}
+
+	entries := ParseDeviceArpEntries(sentences)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "AA:BB:CC:DD:EE:01", entries[0].MacAddress)
+	assert.Equal(t, "bridge", entries[0].Interface)
+	assert.True(t, entries[0].Dynamic)
+	assert.True(t, entries[0].Complete)
+	assert.False(t, entries[1].Complete)
+}
@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// DeviceJobs tracks the devices with a job in progress, e.g. a poll or an export, so a new job
+// of a device is not scheduled until the previous one is finished.
+type DeviceJobs struct {
+	mu      sync.Mutex
+	running map[string]time.Time
+}
+
+// NewDeviceJobs returns a tracker without any jobs in progress.
+func NewDeviceJobs() *DeviceJobs {
+	return &DeviceJobs{running: map[string]time.Time{}}
+}
+
+// Start marks the job of the device as in progress. It returns false and the start time of the
+// previous job if that one is still in progress.
+func (j *DeviceJobs) Start(deviceId string) (bool, time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if since, ok := j.running[deviceId]; ok {
+		return false, since
+	}
+	j.running[deviceId] = time.Now()
+	return true, time.Time{}
+}
+
+// Finish marks the job of the device as finished.
+func (j *DeviceJobs) Finish(deviceId string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.running, deviceId)
+}
+
+// Running returns the number of the jobs in progress.
+func (j *DeviceJobs) Running() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return len(j.running)
+}
@@ -0,0 +1,28 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceJobs(t *testing.T) {
+	jobs := NewDeviceJobs()
+
+	started, _ := jobs.Start("a")
+	assert.True(t, started)
+	started, since := jobs.Start("a")
+	assert.False(t, started, "the previous job is still running")
+	assert.False(t, since.IsZero())
+	started, _ = jobs.Start("b")
+	assert.True(t, started)
+	assert.Equal(t, 2, jobs.Running())
+
+	jobs.Finish("a")
+	started, _ = jobs.Start("a")
+	assert.True(t, started)
+
+	jobs.Finish("a")
+	jobs.Finish("b")
+	assert.Equal(t, 0, jobs.Running())
+}
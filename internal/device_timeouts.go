@@ -0,0 +1,25 @@
+package internal
+
+import (
+	"context"
+	"time"
+)
+
+// DeviceTimeouts limits the device I/O so an unresponsive device can't block its caller, the
+// operations are not limited if zero.
+type DeviceTimeouts struct {
+	// Api limits every RouterOS API operation including the connection and the login
+	Api time.Duration
+	// Ssh limits every SSH command including the connection and the login
+	Ssh time.Duration
+}
+
+// WithTimeout returns a copy of the context cancelled after the timeout, the context is returned
+// as is if the timeout is not positive. The returned function should be called once the operation
+// is done.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
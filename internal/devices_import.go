@@ -0,0 +1,463 @@
+package internal
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mazay/mikromanager/db"
+	yaml "gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const (
+	DeviceImportCreate    = "create"
+	DeviceImportUpdate    = "update"
+	DeviceImportUnchanged = "unchanged"
+	DeviceImportConflict  = "conflict"
+	DeviceImportInvalid   = "invalid"
+)
+
+var (
+	devicesCSVHeader = []string{"address", "apiPort", "sshPort", "credentials", "groups"}
+	hostnameRegex    = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+)
+
+// DeviceRecord is the portable representation of a device used for bulk import and export.
+// Credentials are referenced by alias and groups by name.
+type DeviceRecord struct {
+	Address     string   `yaml:"address"`
+	ApiPort     string   `yaml:"apiPort,omitempty"`
+	SshPort     string   `yaml:"sshPort,omitempty"`
+	Credentials string   `yaml:"credentials,omitempty"`
+	Groups      []string `yaml:"groups,omitempty"`
+	// fields holds the names of the fields present in the parsed data, nil means all of them
+	fields map[string]bool
+}
+
+// UnmarshalYAML decodes the record and remembers which of its keys are present.
+func (r *DeviceRecord) UnmarshalYAML(node *yaml.Node) error {
+	type plain DeviceRecord
+
+	err := node.Decode((*plain)(r))
+	if err != nil {
+		return err
+	}
+	if node.Kind == yaml.MappingNode {
+		r.fields = map[string]bool{}
+		for i := 0; i < len(node.Content); i += 2 {
+			r.fields[node.Content[i].Value] = true
+		}
+	}
+	return nil
+}
+
+// has reports whether the field was present in the parsed data, fields that are missing are
+// left unchanged on the existing devices.
+func (r *DeviceRecord) has(field string) bool {
+	return r.fields == nil || r.fields[field]
+}
+
+// DeviceImportItem is the planned outcome of importing a single DeviceRecord.
+type DeviceImportItem struct {
+	Line      int
+	Record    *DeviceRecord
+	Action    string
+	Msg       string
+	Changes   []string
+	NewGroups []string
+	device    *db.Device
+	credsId   string
+}
+
+// DeviceImportPlan holds the planned outcome of a bulk import, nothing is written to the
+// database until the plan is applied.
+type DeviceImportPlan struct {
+	Items []*DeviceImportItem
+}
+
+// Count returns the number of items planned with the given action.
+func (p *DeviceImportPlan) Count(action string) int {
+	var count int
+	for _, item := range p.Items {
+		if item.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// ParseDevicesCSV reads device records from CSV data, the first row must be a header with
+// the "address", "apiPort", "sshPort", "credentials" and "groups" columns in any order, only
+// "address" is mandatory. Multiple groups are separated by a semicolon. The columns missing from
+// the header are left unchanged on the existing devices.
+func ParseDevicesCSV(r io.Reader) ([]*DeviceRecord, error) {
+	var records []*DeviceRecord
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("empty CSV data")
+	}
+
+	columns := map[string]int{}
+	fields := map[string]bool{}
+	for i, name := range rows[0] {
+		columns[strings.TrimSpace(name)] = i
+		fields[strings.TrimSpace(name)] = true
+	}
+	if _, ok := columns["address"]; !ok {
+		return nil, errors.New("the CSV header has no \"address\" column")
+	}
+
+	get := func(row []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	for _, row := range rows[1:] {
+		record := &DeviceRecord{
+			Address:     get(row, "address"),
+			ApiPort:     get(row, "apiPort"),
+			SshPort:     get(row, "sshPort"),
+			Credentials: get(row, "credentials"),
+			fields:      fields,
+		}
+		for _, group := range strings.Split(get(row, "groups"), ";") {
+			if group = strings.TrimSpace(group); group != "" {
+				record.Groups = append(record.Groups, group)
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// ParseDevicesYAML reads device records from YAML data, the document must be a list of objects
+// with the "address", "apiPort", "sshPort", "credentials" and "groups" keys. The keys missing from
+// a record are left unchanged on the existing device.
+func ParseDevicesYAML(r io.Reader) ([]*DeviceRecord, error) {
+	var records []*DeviceRecord
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(data, &records)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		record.Address = strings.TrimSpace(record.Address)
+	}
+
+	return records, nil
+}
+
+// ParseDevices reads device records from the data in the given format, "csv" or "yaml".
+func ParseDevices(r io.Reader, format string) ([]*DeviceRecord, error) {
+	switch format {
+	case "csv":
+		return ParseDevicesCSV(r)
+	case "yaml", "yml":
+		return ParseDevicesYAML(r)
+	}
+	return nil, fmt.Errorf("unsupported format: %s", format)
+}
+
+// DevicesToRecords converts devices to records suitable for a bulk export, the devices are
+// expected to have their credentials and groups preloaded.
+func DevicesToRecords(devices []*db.Device, credentials []*db.Credentials) []*DeviceRecord {
+	var (
+		records []*DeviceRecord
+		aliases = map[string]string{}
+	)
+
+	for _, c := range credentials {
+		aliases[c.Id] = c.Alias
+	}
+
+	for _, device := range devices {
+		record := &DeviceRecord{
+			Address:     device.Address,
+			ApiPort:     device.ApiPort,
+			SshPort:     device.SshPort,
+			Credentials: aliases[device.CredentialsID],
+		}
+		for _, group := range device.Groups {
+			record.Groups = append(record.Groups, group.Name)
+		}
+		records = append(records, record)
+	}
+
+	return records
+}
+
+// WriteDevices writes the records in the given format, "csv" or "yaml".
+func WriteDevices(w io.Writer, records []*DeviceRecord, format string) error {
+	switch format {
+	case "csv":
+		writer := csv.NewWriter(w)
+		err := writer.Write(devicesCSVHeader)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			err = writer.Write([]string{r.Address, r.ApiPort, r.SshPort, r.Credentials, strings.Join(r.Groups, ";")})
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "yaml", "yml":
+		encoder := yaml.NewEncoder(w)
+		err := encoder.Encode(records)
+		if err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+	return fmt.Errorf("unsupported format: %s", format)
+}
+
+// validatePort returns an error if the port is set and is not a valid TCP port number.
+func validatePort(port string) error {
+	if port == "" {
+		return nil
+	}
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 1 || number > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// Validate checks the record fields, it returns an error describing the first problem found.
+func (r *DeviceRecord) Validate() error {
+	if r.Address == "" {
+		return errors.New("address is empty")
+	}
+	if net.ParseIP(r.Address) == nil && !hostnameRegex.MatchString(r.Address) {
+		return fmt.Errorf("invalid address %q", r.Address)
+	}
+	if err := validatePort(r.ApiPort); err != nil {
+		return fmt.Errorf("API %w", err)
+	}
+	if err := validatePort(r.SshPort); err != nil {
+		return fmt.Errorf("SSH %w", err)
+	}
+	return nil
+}
+
+// deviceChanges returns the names of the fields that would change when the record is applied
+// to the existing device, the fields missing from the record are not compared.
+func deviceChanges(device *db.Device, record *DeviceRecord, credsId string) []string {
+	var (
+		changes []string
+		groups  []string
+	)
+
+	if record.has("apiPort") && device.ApiPort != record.ApiPort {
+		changes = append(changes, "apiPort")
+	}
+	if record.has("sshPort") && device.SshPort != record.SshPort {
+		changes = append(changes, "sshPort")
+	}
+	if record.has("credentials") && device.CredentialsID != credsId {
+		changes = append(changes, "credentials")
+	}
+	if !record.has("groups") {
+		return changes
+	}
+	for _, group := range device.Groups {
+		groups = append(groups, group.Name)
+	}
+	recordGroups := slices.Clone(record.Groups)
+	slices.Sort(groups)
+	slices.Sort(recordGroups)
+	if !slices.Equal(groups, recordGroups) {
+		changes = append(changes, "groups")
+	}
+
+	return changes
+}
+
+// PlanDevicesImport validates the records and compares them with the devices in the database,
+// devices are matched by address. Records matching a trashed device or repeating an address
+// already seen in the same import are reported as conflicts. Nothing is written to the database.
+func PlanDevicesImport(database *db.DB, records []*DeviceRecord) (*DeviceImportPlan, error) {
+	var (
+		plan      = &DeviceImportPlan{}
+		seen      = map[string]int{}
+		credsIds  = map[string]string{}
+		newGroups = map[string]bool{}
+	)
+
+	for i, record := range records {
+		item := &DeviceImportItem{Line: i + 1, Record: record}
+		plan.Items = append(plan.Items, item)
+
+		if err := record.Validate(); err != nil {
+			item.Action = DeviceImportInvalid
+			item.Msg = err.Error()
+			continue
+		}
+
+		if line, ok := seen[record.Address]; ok {
+			item.Action = DeviceImportConflict
+			item.Msg = fmt.Sprintf("duplicate of record %d", line)
+			continue
+		}
+		seen[record.Address] = item.Line
+
+		if record.Credentials != "" {
+			credsId, ok := credsIds[record.Credentials]
+			if !ok {
+				creds := &db.Credentials{Alias: record.Credentials}
+				err := creds.GetByAlias(database)
+				if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil, err
+				}
+				credsId = creds.Id
+				credsIds[record.Credentials] = credsId
+			}
+			if credsId == "" {
+				item.Action = DeviceImportInvalid
+				item.Msg = fmt.Sprintf("unknown credentials %q", record.Credentials)
+				continue
+			}
+			item.credsId = credsId
+		}
+
+		for _, name := range record.Groups {
+			group := &db.DeviceGroup{Name: name}
+			err := group.GetByName(database)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				if !newGroups[name] {
+					item.NewGroups = append(item.NewGroups, name)
+					newGroups[name] = true
+				}
+			} else if err != nil {
+				return nil, err
+			}
+		}
+
+		device := &db.Device{Address: record.Address}
+		err := device.GetByAddress(database)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			item.Action = DeviceImportCreate
+		case err != nil:
+			return nil, err
+		case device.Trashed():
+			item.Action = DeviceImportConflict
+			item.Msg = "the address belongs to a device in the trash"
+		default:
+			item.device = device
+			item.Changes = deviceChanges(device, record, item.credsId)
+			if len(item.Changes) == 0 {
+				item.Action = DeviceImportUnchanged
+			} else {
+				item.Action = DeviceImportUpdate
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// ApplyDevicesImport creates and updates the devices according to the plan in a single
+// transaction, conflicting, invalid and unchanged records are skipped. Only the fields present
+// in the records are written to the existing devices. Missing device groups are created on the
+// fly. It returns the number of devices written and an error if any of the database operations
+// fail, nothing is written in that case.
+func ApplyDevicesImport(database *db.DB, plan *DeviceImportPlan) (int, error) {
+	var written int
+
+	err := database.Transaction(func(tx *db.DB) error {
+		groups := map[string]*db.DeviceGroup{}
+
+		getGroup := func(name string) (*db.DeviceGroup, error) {
+			if group, ok := groups[name]; ok {
+				return group, nil
+			}
+			group := &db.DeviceGroup{Name: name}
+			err := group.GetByName(tx)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				err = group.Create(tx)
+			}
+			if err != nil {
+				return nil, err
+			}
+			groups[name] = group
+			return group, nil
+		}
+
+		for _, item := range plan.Items {
+			if item.Action != DeviceImportCreate && item.Action != DeviceImportUpdate {
+				continue
+			}
+
+			device := item.device
+			if device == nil {
+				device = &db.Device{}
+			}
+			device.Address = item.Record.Address
+			if item.Record.has("apiPort") {
+				device.ApiPort = item.Record.ApiPort
+			}
+			if item.Record.has("sshPort") {
+				device.SshPort = item.Record.SshPort
+			}
+			if item.Record.has("credentials") {
+				device.CredentialsID = item.credsId
+			}
+			device.Credentials = nil
+			if item.Record.has("groups") {
+				device.Groups = []*db.DeviceGroup{}
+				for _, name := range item.Record.Groups {
+					group, err := getGroup(name)
+					if err != nil {
+						return err
+					}
+					device.Groups = append(device.Groups, group)
+				}
+			}
+
+			var err error
+			if item.Action == DeviceImportCreate {
+				err = device.Create(tx)
+			} else {
+				err = device.Update(tx)
+			}
+			if err != nil {
+				return fmt.Errorf("record %d (%s): %w", item.Line, item.Record.Address, err)
+			}
+			written++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return written, nil
+}
@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestParseDevicesCSV(t *testing.T) {
+	data := "address,groups,apiPort\n10.0.0.1, core;edge ,8729\n10.0.0.2,,\n"
+
+	records, err := ParseDevicesCSV(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := map[string]bool{"address": true, "groups": true, "apiPort": true}
+	assert.Equal(t, []*DeviceRecord{
+		{Address: "10.0.0.1", ApiPort: "8729", Groups: []string{"core", "edge"}, fields: fields},
+		{Address: "10.0.0.2", fields: fields},
+	}, records)
+	assert.False(t, records[0].has("credentials"))
+
+	_, err = ParseDevicesCSV(strings.NewReader("host\n10.0.0.1\n"))
+	assert.Error(t, err)
+}
+
+func TestWriteParseDevicesRoundTrip(t *testing.T) {
+	records := []*DeviceRecord{
+		{Address: "10.0.0.1", ApiPort: "8729", SshPort: "2222", Credentials: "Default", Groups: []string{"core", "edge"}},
+		{Address: "router.example.com"},
+	}
+
+	for _, format := range []string{"csv", "yaml"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WriteDevices(&buf, records, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := ParseDevices(&buf, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// only the values are compared, the present fields depend on the format
+			for _, record := range parsed {
+				record.fields = nil
+			}
+			assert.Equal(t, records, parsed)
+		})
+	}
+}
+
+func TestDeviceRecordValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  *DeviceRecord
+		wantErr bool
+	}{
+		{"IP address", &DeviceRecord{Address: "10.0.0.1"}, false},
+		{"Hostname", &DeviceRecord{Address: "router-1.example.com"}, false},
+		{"Empty address", &DeviceRecord{}, true},
+		{"Invalid address", &DeviceRecord{Address: "not an address"}, true},
+		{"Invalid API port", &DeviceRecord{Address: "10.0.0.1", ApiPort: "api"}, true},
+		{"SSH port out of range", &DeviceRecord{Address: "10.0.0.1", SshPort: "70000"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.record.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlanApplyDevicesImport(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existing := &db.Device{Address: "10.0.0.1"}
+	err = existing.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []*DeviceRecord{
+		{Address: "10.0.0.1", ApiPort: "8729", Groups: []string{"core"}},
+		{Address: "10.0.0.2", Groups: []string{"core"}},
+		{Address: "10.0.0.2"},
+		{Address: "10.0.0.3", Credentials: "unknown"},
+		{Address: ""},
+	}
+
+	plan, err := PlanDevicesImport(database, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actions []string
+	for _, item := range plan.Items {
+		actions = append(actions, item.Action)
+	}
+	assert.Equal(t, []string{DeviceImportUpdate, DeviceImportCreate, DeviceImportConflict, DeviceImportInvalid, DeviceImportInvalid}, actions)
+	assert.Equal(t, []string{"apiPort", "groups"}, plan.Items[0].Changes)
+	assert.Equal(t, []string{"core"}, plan.Items[0].NewGroups)
+
+	written, err := ApplyDevicesImport(database, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, written)
+
+	devices, err := existing.GetAllPreload(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, devices, 2)
+	for _, device := range devices {
+		assert.Len(t, device.Groups, 1)
+	}
+
+	// importing the same records again changes nothing
+	plan, err = PlanDevicesImport(database, records[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, plan.Count(DeviceImportUnchanged))
+}
+
+func TestApplyDevicesImportPartialColumns(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds := &db.Credentials{Alias: "Default", Username: "admin"}
+	err = creds.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := &db.DeviceGroup{Name: "core"}
+	err = group.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := &db.Device{Address: "10.0.0.1", CredentialsID: creds.Id, Groups: []*db.DeviceGroup{group}}
+	err = existing.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the CSV has neither credentials nor groups, they are kept on the existing device
+	records, err := ParseDevicesCSV(strings.NewReader("address,apiPort\n10.0.0.1,8729\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := PlanDevicesImport(database, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"apiPort"}, plan.Items[0].Changes)
+
+	written, err := ApplyDevicesImport(database, plan)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, written)
+
+	stored := &db.Device{}
+	stored.Id = existing.Id
+	assert.NoError(t, stored.GetById(database))
+	assert.Equal(t, "8729", stored.ApiPort)
+	assert.Equal(t, creds.Id, stored.CredentialsID)
+	assert.Len(t, stored.Groups, 1)
+
+	// a YAML record without the groups key keeps the groups as well
+	records, err = ParseDevicesYAML(strings.NewReader("- address: 10.0.0.1\n  apiPort: \"8729\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err = PlanDevicesImport(database, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, plan.Count(DeviceImportUnchanged))
+}
+
+func TestApplyDevicesImportRollback(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []*DeviceRecord{
+		{Address: "10.0.0.1", Groups: []string{"core"}},
+		{Address: "10.0.0.2"},
+	}
+	plan, err := PlanDevicesImport(database, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second address is taken after the plan was made, its create fails
+	err = (&db.Device{Address: "10.0.0.2"}).Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := ApplyDevicesImport(database, plan)
+	assert.Error(t, err)
+	assert.Equal(t, 0, written)
+
+	// nothing of the import is left behind
+	devices, err := (&db.Device{}).GetAllPlain(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, devices, 1)
+	group := &db.DeviceGroup{Name: "core"}
+	assert.ErrorIs(t, group.GetByName(database), gorm.ErrRecordNotFound)
+}
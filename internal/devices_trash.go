@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+)
+
+// PurgeDevice permanently deletes a device along with its exports. If the device was trashed
+// with the ArchiveExports flag set, its S3 exports are moved to the archive path instead of
+// being deleted. The DB records of the exports, inventory, events, upgrades, rollout entries and
+// compliance results are removed in both cases.
+func PurgeDevice(database *db.DB, s3 *S3, device *db.Device) error {
+	var (
+		export  = &db.Export{}
+		event   = &db.DeviceEvent{}
+		upgrade = &db.DeviceUpgrade{}
+		rollout = &db.RolloutDevice{}
+		results = &db.ComplianceResult{}
+		counts  = &db.WirelessClientCount{}
+		status  = &db.CollectorStatus{}
+	)
+
+	if device.ArchiveExports {
+		_, err := s3.ArchiveExports(device.Id)
+		if err != nil {
+			return err
+		}
+	} else {
+		exports, err := s3.GetExports(device.Id)
+		if err != nil {
+			return err
+		}
+		err = s3.DeleteExports(exports)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := export.DeleteByDeviceId(database, device.Id)
+	if err != nil {
+		return err
+	}
+
+	err = db.ReplaceDeviceAddresses(database, device.Id, nil)
+	if err != nil {
+		return err
+	}
+
+	err = db.ReplaceDeviceInterfaces(database, device.Id, nil)
+	if err != nil {
+		return err
+	}
+
+	err = db.ReplaceDeviceRoutes(database, device.Id, nil)
+	if err != nil {
+		return err
+	}
+
+	err = db.ReplaceDeviceLeases(database, device.Id, nil)
+	if err != nil {
+		return err
+	}
+
+	err = db.ReplaceDeviceArpEntries(database, device.Id, nil)
+	if err != nil {
+		return err
+	}
+
+	err = db.ReplaceDeviceWirelessClients(database, device.Id, nil)
+	if err != nil {
+		return err
+	}
+
+	err = counts.DeleteByDeviceId(database, device.Id)
+	if err != nil {
+		return err
+	}
+
+	err = status.DeleteByDeviceId(database, device.Id)
+	if err != nil {
+		return err
+	}
+
+	err = event.DeleteByDeviceId(database, device.Id)
+	if err != nil {
+		return err
+	}
+
+	err = upgrade.DeleteByDeviceId(database, device.Id)
+	if err != nil {
+		return err
+	}
+
+	err = rollout.DeleteByDeviceId(database, device.Id)
+	if err != nil {
+		return err
+	}
+
+	err = results.DeleteByDeviceId(database, device.Id)
+	if err != nil {
+		return err
+	}
+
+	return device.Delete(database)
+}
+
+// PurgeAfter returns the time after which a trashed device is purged for the given grace period.
+func PurgeAfter(device *db.Device, gracePeriod time.Duration) time.Time {
+	if device.DeletedAt == nil {
+		return time.Time{}
+	}
+	return device.DeletedAt.Add(gracePeriod)
+}
+
+// ExpiredTrash returns the trashed devices whose grace period is over.
+func ExpiredTrash(devices []*db.Device, gracePeriod time.Duration, now time.Time) []*db.Device {
+	var expired []*db.Device
+	for _, device := range devices {
+		if device.Trashed() && PurgeAfter(device, gracePeriod).Before(now) {
+			expired = append(expired, device)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,24 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiredTrash(t *testing.T) {
+	now := time.Now()
+	longAgo := now.Add(-time.Hour * 48)
+	recently := now.Add(-time.Hour)
+
+	expired := &db.Device{}
+	expired.DeletedAt = &longAgo
+	fresh := &db.Device{}
+	fresh.DeletedAt = &recently
+	active := &db.Device{}
+
+	got := ExpiredTrash([]*db.Device{expired, fresh, active}, time.Hour*24, now)
+	assert.Equal(t, []*db.Device{expired}, got)
+}
@@ -0,0 +1,397 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/mazay/mikromanager/db"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultApiPort = "8728"
+	defaultSshPort = "22"
+	// maxDiscoveryHosts limits the size of a single scanned range, a /16 network
+	maxDiscoveryHosts = 1 << 16
+)
+
+var (
+	ErrDiscoveryRunning = errors.New("network discovery is already running")
+	discoveryMutex      sync.Mutex
+)
+
+type DiscoveryConfig struct {
+	// Ranges is a list of CIDR ranges to scan for open API and SSH ports
+	Ranges []string
+	// Credentials is a list of credentials aliases to try, the discovered devices are not logged in
+	// to if empty
+	Credentials []string
+	// Neighbors enables reading the /ip/neighbor table of the managed devices
+	Neighbors bool
+	// Timeout limits the port probes, Timeouts the requests to the found devices
+	Timeout     time.Duration
+	Timeouts    DeviceTimeouts
+	Concurrency int
+	Secrets     *Secrets
+	Logger      *zap.Logger
+}
+
+type probeResult struct {
+	address string
+	apiOpen bool
+	sshOpen bool
+}
+
+// expandRange returns all host addresses of the given CIDR range, the network and broadcast
+// addresses of IPv4 ranges larger than /31 are skipped.
+func expandRange(cidr string) ([]string, error) {
+	var hosts []string
+
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, err
+	}
+	prefix = prefix.Masked()
+
+	bits := prefix.Addr().BitLen() - prefix.Bits()
+	if bits > 16 {
+		return nil, fmt.Errorf("range %s is too large, the maximum is %d addresses", cidr, maxDiscoveryHosts)
+	}
+
+	for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+		hosts = append(hosts, addr.String())
+	}
+	if prefix.Addr().Is4() && bits > 1 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+
+	return hosts, nil
+}
+
+// portOpen returns true if a TCP connection to the address and port can be established within the timeout.
+func portOpen(address string, port string, timeout time.Duration) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(address, port), timeout)
+	if err != nil {
+		return false
+	}
+	// We don't need to check the error here
+	//nolint:errcheck
+	conn.Close()
+	return true
+}
+
+// probeHosts checks the default API and SSH ports of the given addresses concurrently and returns
+// the results for the addresses with at least one port open.
+func probeHosts(addresses []string, timeout time.Duration, concurrency int) []*probeResult {
+	var (
+		results []*probeResult
+		mutex   sync.Mutex
+		wg      sync.WaitGroup
+		jobs    = make(chan string)
+	)
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for address := range jobs {
+				result := &probeResult{
+					address: address,
+					apiOpen: portOpen(address, defaultApiPort, timeout),
+					sshOpen: portOpen(address, defaultSshPort, timeout),
+				}
+				if result.apiOpen || result.sshOpen {
+					mutex.Lock()
+					results = append(results, result)
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, address := range addresses {
+		jobs <- address
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// suggestGroups returns the groups shared by the most managed devices within the given range.
+func suggestGroups(devices []*db.Device, cidr string) []*db.DeviceGroup {
+	var (
+		suggested []*db.DeviceGroup
+		counts    = map[string]int{}
+		groups    = map[string]*db.DeviceGroup{}
+		max       int
+	)
+
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil
+	}
+
+	for _, device := range devices {
+		addr, err := netip.ParseAddr(device.Address)
+		if err != nil || !prefix.Contains(addr) {
+			continue
+		}
+		for _, group := range device.Groups {
+			counts[group.Id]++
+			groups[group.Id] = group
+			if counts[group.Id] > max {
+				max = counts[group.Id]
+			}
+		}
+	}
+
+	for id, count := range counts {
+		if count == max {
+			suggested = append(suggested, groups[id])
+		}
+	}
+
+	return suggested
+}
+
+// discoveryCredentials returns the stored credentials that should be tried, in the configured
+// order. No credentials are returned if no aliases are configured, the fleet passwords must not
+// be sent to unknown hosts unless explicitly allowed.
+func discoveryCredentials(database *db.DB, aliases []string) ([]*db.Credentials, error) {
+	var (
+		creds  = &db.Credentials{}
+		result []*db.Credentials
+	)
+
+	if len(aliases) == 0 {
+		return nil, nil
+	}
+
+	all, err := creds.GetAll(database)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, alias := range aliases {
+		for _, c := range all {
+			if c.Alias == alias {
+				result = append(result, c)
+			}
+		}
+	}
+	return result, nil
+}
+
+// identify tries the credentials in order until one of them allows logging in to the device API,
+// the working credentials are stored along with the device identity, board name and version.
+func identify(candidate *db.DiscoveredDevice, credentials []*db.Credentials, cfg *DiscoveryConfig) {
+	for _, creds := range credentials {
+		password, err := cfg.Secrets.Password(creds)
+		if err != nil {
+			cfg.Logger.Error(err.Error())
+			continue
+		}
+
+		api := &Api{
+			Address:  candidate.Address,
+			Username: creds.Username,
+			Password: password,
+			Async:    true,
+			Timeout:  cfg.Timeouts.Api,
+		}
+		identity, err := api.Run("/system/identity/print")
+		if err != nil {
+			cfg.Logger.Debug("discovery login failed", zap.String("address", candidate.Address), zap.String("credentials", creds.Alias), zap.Error(err))
+			continue
+		}
+
+		candidate.CredentialsID = creds.Id
+		if len(identity) > 0 {
+			candidate.Identity = identity[0].Map["name"]
+		}
+		resource, err := api.Run("/system/resource/print")
+		if err == nil && len(resource) > 0 {
+			candidate.BoardName = resource[0].Map["board-name"]
+			candidate.Version = resource[0].Map["version"]
+		}
+		return
+	}
+}
+
+// readNeighbors returns the MikroTik neighbors of a managed device found via MNDP.
+func readNeighbors(database *db.DB, device *db.Device, cfg *DiscoveryConfig) ([]*db.DiscoveredDevice, error) {
+	var neighbors []*db.DiscoveredDevice
+
+	chain, err := device.GetCredentialsChain(database)
+	if err != nil {
+		return nil, err
+	}
+
+	api := &Api{
+		Address: device.Address,
+		Port:    device.ApiPort,
+		Async:   true,
+		Timeout: cfg.Timeouts.Api,
+	}
+	var sentences []*proto.Sentence
+	_, err = TryCredentials(chain, device.WorkingCredentialsID, cfg.Secrets, func(creds *db.Credentials, password string) error {
+		api.Username = creds.Username
+		api.Password = password
+		result, err := api.Run("/ip/neighbor/print")
+		sentences = result
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sentence := range sentences {
+		if sentence.Map["platform"] != "MikroTik" || sentence.Map["address"] == "" {
+			continue
+		}
+		neighbors = append(neighbors, &db.DiscoveredDevice{
+			Address:    sentence.Map["address"],
+			Identity:   sentence.Map["identity"],
+			BoardName:  sentence.Map["board"],
+			Version:    sentence.Map["version"],
+			MacAddress: sentence.Map["mac-address"],
+			Source:     "neighbor",
+			SeenFrom:   device.Address,
+			Groups:     device.Groups,
+		})
+	}
+
+	return neighbors, nil
+}
+
+// DiscoveryRunning returns true if a network discovery is in progress.
+func DiscoveryRunning() bool {
+	if !discoveryMutex.TryLock() {
+		return true
+	}
+	discoveryMutex.Unlock()
+	return false
+}
+
+// Discover scans the configured ranges for open API and SSH ports and optionally reads the
+// neighbor tables of the managed devices. Addresses of already managed (or trashed) devices,
+// including their known non-management addresses, are skipped, the rest are identified with the
+// configured credentials and stored as proposals for adoption. Only one discovery can run at a
+// time.
+func Discover(database *db.DB, cfg *DiscoveryConfig) error {
+	var (
+		device     = &db.Device{}
+		address    = &db.DeviceAddress{}
+		managed    = map[string]bool{}
+		candidates = map[string]*db.DiscoveredDevice{}
+		now        = time.Now()
+	)
+
+	if !discoveryMutex.TryLock() {
+		return ErrDiscoveryRunning
+	}
+	defer discoveryMutex.Unlock()
+
+	devices, err := device.GetAllPreload(database)
+	if err != nil {
+		return err
+	}
+	trashed, err := device.GetAllTrashed(database)
+	if err != nil {
+		return err
+	}
+	for _, d := range append(devices, trashed...) {
+		managed[d.Address] = true
+	}
+	// addresses assigned to managed devices other than their management ones
+	known, err := address.GetAll(database)
+	if err != nil {
+		return err
+	}
+	for _, a := range known {
+		managed[a.Address] = true
+	}
+
+	for _, cidr := range cfg.Ranges {
+		hosts, err := expandRange(cidr)
+		if err != nil {
+			cfg.Logger.Error(err.Error())
+			continue
+		}
+		cfg.Logger.Info("scanning range", zap.String("range", cidr), zap.Int("hosts", len(hosts)))
+
+		var unmanaged []string
+		for _, host := range hosts {
+			if !managed[host] {
+				unmanaged = append(unmanaged, host)
+			}
+		}
+
+		groups := suggestGroups(devices, cidr)
+		for _, result := range probeHosts(unmanaged, cfg.Timeout, cfg.Concurrency) {
+			candidates[result.address] = &db.DiscoveredDevice{
+				Address: result.address,
+				ApiOpen: result.apiOpen,
+				SshOpen: result.sshOpen,
+				Source:  "scan",
+				Groups:  groups,
+			}
+		}
+	}
+
+	if cfg.Neighbors {
+		for _, d := range devices {
+			neighbors, err := readNeighbors(database, d, cfg)
+			if err != nil {
+				cfg.Logger.Error("failed to read neighbors", zap.String("device", d.Address), zap.Error(err))
+				continue
+			}
+			for _, neighbor := range neighbors {
+				if managed[neighbor.Address] {
+					continue
+				}
+				if existing, ok := candidates[neighbor.Address]; ok {
+					// keep the scan results but add the details known by the neighbor
+					existing.MacAddress = neighbor.MacAddress
+					existing.SeenFrom = neighbor.SeenFrom
+					continue
+				}
+				neighbor.ApiOpen = portOpen(neighbor.Address, defaultApiPort, cfg.Timeout)
+				neighbor.SshOpen = portOpen(neighbor.Address, defaultSshPort, cfg.Timeout)
+				candidates[neighbor.Address] = neighbor
+			}
+		}
+	}
+
+	credentials, err := discoveryCredentials(database, cfg.Credentials)
+	if err != nil {
+		return err
+	}
+	if len(credentials) == 0 {
+		cfg.Logger.Info("no discovery credentials configured, the discovered devices are not identified")
+	}
+
+	for _, candidate := range candidates {
+		if candidate.ApiOpen {
+			identify(candidate, credentials, cfg)
+		}
+		candidate.LastSeen = now
+		err = candidate.Upsert(database)
+		if err != nil {
+			cfg.Logger.Error(err.Error())
+		}
+	}
+
+	cfg.Logger.Info("network discovery finished", zap.Int("found", len(candidates)))
+	return nil
+}
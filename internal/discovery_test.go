@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandRange(t *testing.T) {
+	hosts, err := expandRange("10.0.0.0/30")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, hosts)
+
+	hosts, err = expandRange("10.0.0.5/24")
+	assert.NoError(t, err)
+	assert.Len(t, hosts, 254)
+	assert.Equal(t, "10.0.0.1", hosts[0])
+
+	hosts, err = expandRange("10.0.0.1/32")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1"}, hosts)
+
+	_, err = expandRange("10.0.0.0/8")
+	assert.Error(t, err)
+
+	_, err = expandRange("not-a-range")
+	assert.Error(t, err)
+}
+
+func TestSuggestGroups(t *testing.T) {
+	office := &db.DeviceGroup{Name: "office"}
+	office.Id = "office"
+	core := &db.DeviceGroup{Name: "core"}
+	core.Id = "core"
+
+	devices := []*db.Device{
+		{Address: "10.0.0.1", Groups: []*db.DeviceGroup{office, core}},
+		{Address: "10.0.0.2", Groups: []*db.DeviceGroup{office}},
+		{Address: "10.1.0.1", Groups: []*db.DeviceGroup{core}},
+	}
+
+	assert.Equal(t, []*db.DeviceGroup{office}, suggestGroups(devices, "10.0.0.0/24"))
+	assert.Equal(t, []*db.DeviceGroup{core}, suggestGroups(devices, "10.1.0.0/24"))
+	assert.Empty(t, suggestGroups(devices, "192.168.0.0/24"))
+}
+
+func TestDiscoveryCredentials(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, creds := range testCredentialsChain(t, "admin", "backup") {
+		err = creds.Create(database)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// nothing is tried unless the aliases are configured
+	creds, err := discoveryCredentials(database, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, creds)
+
+	creds, err = discoveryCredentials(database, []string{"backup", "missing"})
+	assert.NoError(t, err)
+	assert.Len(t, creds, 1)
+	assert.Equal(t, "backup", creds[0].Username)
+}
@@ -1,10 +1,18 @@
 package internal
 
 import (
+	"errors"
+	"fmt"
 	"path/filepath"
 	"time"
+
+	"github.com/mazay/mikromanager/db"
 )
 
+// ErrExportNotIndexed is returned along with the stored export when its lines could not be indexed,
+// the export itself is usable and the exports reconciliation job indexes it later
+var ErrExportNotIndexed = errors.New("the export was stored but not indexed")
+
 type Export struct {
 	Key          string
 	DeviceId     string
@@ -25,3 +33,44 @@ func (e *Export) GetDeviceId() string {
 func (e *Export) GetBody(s3 *S3) ([]byte, error) {
 	return s3.GetFile(e.Key, *e.Size)
 }
+
+// SaveExport uploads the export of the device to the S3 bucket, stores its DB record and indexes
+// its lines for the search. It returns the stored export and an error if the upload or any of
+// the database operations fail. An indexing failure is only a warning, the stored export is
+// returned along with an error wrapping ErrExportNotIndexed.
+func SaveExport(database *db.DB, s3 *S3, deviceId string, body []byte) (*db.Export, error) {
+	output, err := s3.UploadExport(deviceId, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// the object is already uploaded, the exports reconciliation job with the auto fix enabled
+	// will import and index it later
+	attrs, err := s3.GetExportAttributes(*output.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &db.Export{
+		S3Key:        *output.Key,
+		LastModified: attrs.LastModified,
+		ETag:         *output.ETag,
+		Size:         attrs.Size,
+		DeviceId:     deviceId,
+	}
+	// the reconciliation job might have imported the object already
+	_, err = export.CreateUnlessExists(database)
+	if err != nil {
+		return nil, err
+	}
+	err = indexExport(database, export, body)
+	if err != nil {
+		return export, fmt.Errorf("%w: %w", ErrExportNotIndexed, err)
+	}
+	return export, nil
+}
+
+// indexExport indexes the lines of the export body with the secrets redacted.
+func indexExport(database *db.DB, export *db.Export, body []byte) error {
+	return db.IndexExport(database, export, []byte(RedactExport(string(body))))
+}
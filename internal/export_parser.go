@@ -0,0 +1,299 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// exportActions holds the commands that end the menu path of the export lines, e.g.
+// "/ip service set telnet disabled=yes" of the terse exports
+var exportActions = map[string]bool{
+	"add": true, "set": true, "remove": true, "unset": true, "enable": true, "disable": true,
+	"move": true, "comment": true, "edit": true, "print": true, "export": true, "find": true,
+}
+
+// ExportArg is a key/value argument of an export command, the value is unquoted.
+type ExportArg struct {
+	Key   string
+	Value string
+}
+
+// ExportCommand is a single command of the export, e.g. "set telnet disabled=yes" of the
+// "/ip service" menu.
+type ExportCommand struct {
+	Menu   string
+	Action string
+	// Target holds the positional arguments, e.g. "telnet" of "set telnet disabled=yes" or
+	// "[ find default-name=ether1 ]"
+	Target string
+	Args   []*ExportArg
+	// Raw is the command as written in the export without the menu path, the continued lines
+	// are joined
+	Raw string
+	// Line is the number of the export line the command starts on
+	Line int
+}
+
+// ExportSection holds the commands of a menu path in the order of the export.
+type ExportSection struct {
+	Menu     string
+	Commands []*ExportCommand
+}
+
+// ExportTree is the structured export, the sections are kept in the order of the export.
+type ExportTree struct {
+	// Header holds the comments preceding the first section, e.g. the RouterOS version
+	Header   []string
+	Sections []*ExportSection
+}
+
+// Get returns the value of the argument with the given key and whether it is set.
+func (c *ExportCommand) Get(key string) (string, bool) {
+	for _, arg := range c.Args {
+		if arg.Key == key {
+			return arg.Value, true
+		}
+	}
+	return "", false
+}
+
+// String formats the command the way the exports do, the values are quoted when needed.
+func (c *ExportCommand) String() string {
+	parts := []string{c.Action}
+	if c.Target != "" {
+		parts = append(parts, c.Target)
+	}
+	for _, arg := range c.Args {
+		parts = append(parts, arg.Key+"="+quoteExportValue(arg.Value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Section returns the section with the given menu path, e.g. "/ip service" or "/ip/service",
+// or nil if the export has no such section.
+func (t *ExportTree) Section(menu string) *ExportSection {
+	menu = NormalizeSection(menu)
+	for _, section := range t.Sections {
+		if section.Menu == menu {
+			return section
+		}
+	}
+	return nil
+}
+
+// Lookup returns the values of the argument with the given key set by the commands of the menu
+// path, e.g. the "servers" of "/system ntp client".
+func (t *ExportTree) Lookup(menu string, key string) []string {
+	var values []string
+
+	section := t.Section(menu)
+	if section == nil {
+		return nil
+	}
+	for _, command := range section.Commands {
+		if value, ok := command.Get(key); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// section returns the section with the given normalized menu path, the section is added if the
+// export has no such section yet.
+func (t *ExportTree) section(menu string) *ExportSection {
+	for _, section := range t.Sections {
+		if section.Menu == menu {
+			return section
+		}
+	}
+	section := &ExportSection{Menu: menu}
+	t.Sections = append(t.Sections, section)
+	return section
+}
+
+// quoteExportValue quotes the value if it contains the characters the exports quote.
+func quoteExportValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\"\\;$?[]{}\r\n") {
+		return value
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "?", `\?`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// unquoteExportValue resolves the escape sequences of the quoted value, including the "\XX"
+// hex ones.
+func unquoteExportValue(value string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			sb.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case '_':
+			sb.WriteByte(' ')
+		default:
+			if i+1 < len(value) {
+				if b, err := strconv.ParseUint(value[i:i+2], 16, 8); err == nil && isHexDigit(value[i]) {
+					sb.WriteByte(byte(b))
+					i++
+					continue
+				}
+			}
+			sb.WriteByte(value[i])
+		}
+	}
+
+	return sb.String()
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'A' && c <= 'F')
+}
+
+// tokenizeExportLine splits the line into words keeping the quoted strings and the bracketed
+// expressions together, e.g. `comment="LAN bridge"` or "[ find default=yes ]". It returns the
+// words found and an error if a quote or a bracket is not closed.
+func tokenizeExportLine(line string) ([]string, error) {
+	var (
+		tokens  []string
+		current strings.Builder
+		quoted  bool
+		depth   int
+	)
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(line):
+			current.WriteByte(c)
+			i++
+			current.WriteByte(line[i])
+			continue
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '[':
+			depth++
+		case c == ']' && depth > 0:
+			depth--
+		case (c == ' ' || c == '\t') && depth == 0:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		current.WriteByte(c)
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+
+	if quoted {
+		return tokens, errors.New("unterminated quoted string")
+	}
+	if depth > 0 {
+		return tokens, errors.New("unterminated bracket")
+	}
+	return tokens, nil
+}
+
+// parseExportCommand builds the command out of the words following the menu path.
+func parseExportCommand(menu string, words []string, line int) *ExportCommand {
+	var target []string
+
+	command := &ExportCommand{Menu: menu, Action: words[0], Raw: strings.Join(words, " "), Line: line}
+	for _, word := range words[1:] {
+		key, value, found := strings.Cut(word, "=")
+		if !found || key == "" || strings.HasPrefix(word, "[") {
+			target = append(target, word)
+			continue
+		}
+		if strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) && len(value) > 1 {
+			value = unquoteExportValue(value[1 : len(value)-1])
+		}
+		command.Args = append(command.Args, &ExportArg{Key: key, Value: value})
+	}
+	command.Target = strings.Join(target, " ")
+
+	return command
+}
+
+// ParseExport parses the "/export" output into its sections and commands, both the regular
+// and the terse exports are supported. The continued lines are joined, the comments are kept
+// only for the header. It returns the parsed export along with an error describing the malformed
+// lines, which are parsed as far as possible.
+func ParseExport(export string) (*ExportTree, error) {
+	var (
+		tree    = &ExportTree{}
+		menu    string
+		logical string
+		start   int
+		errs    []error
+	)
+
+	lines := strings.Split(strings.ReplaceAll(export, "\r\n", "\n"), "\n")
+	for i, raw := range lines {
+		if logical == "" {
+			start = i + 1
+		} else {
+			raw = strings.TrimLeft(raw, " \t")
+		}
+		if strings.HasSuffix(raw, "\\") && i+1 < len(lines) {
+			logical += strings.TrimSuffix(raw, "\\")
+			continue
+		}
+		logical += raw
+
+		line := strings.TrimSpace(logical)
+		logical = ""
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if menu == "" {
+				tree.Header = append(tree.Header, line)
+			}
+			continue
+		}
+
+		words, err := tokenizeExportLine(line)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", start, err))
+		}
+
+		if strings.HasPrefix(line, "/") {
+			// the menu path ends with the first action or argument
+			var path []string
+			for len(words) > 0 && !exportActions[words[0]] && !strings.ContainsAny(words[0], "=[") {
+				path = append(path, words[0])
+				words = words[1:]
+			}
+			menu = NormalizeSection(strings.Join(path, " "))
+			tree.section(menu)
+		}
+		if len(words) == 0 {
+			continue
+		}
+		if menu == "" {
+			errs = append(errs, fmt.Errorf("line %d: command outside of any menu", start))
+			continue
+		}
+
+		section := tree.section(menu)
+		section.Commands = append(section.Commands, parseExportCommand(menu, words, start))
+	}
+
+	return tree, errors.Join(errs...)
+}
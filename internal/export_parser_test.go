@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExport(t *testing.T) {
+	export := `# 2024-05-01 10:00:00 by RouterOS 7.15
+# software id = ABCD-1234
+#
+/interface bridge
+add name=bridge comment=\
+    "LAN bridge"
+/interface ethernet
+set [ find default-name=ether1 ] name=wan
+/ip firewall filter
+add action=accept chain=input comment="allow \"established\"\_and \$related" \
+    connection-state=established,related
+add action=drop chain=input in-interface=wan
+/ip service
+set telnet disabled=yes
+set ftp disabled=yes
+/system ntp client servers
+add address=10.0.0.1
+add address=10.0.0.2
+`
+
+	tree, err := ParseExport(export)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"# 2024-05-01 10:00:00 by RouterOS 7.15", "# software id = ABCD-1234", "#"}, tree.Header)
+	assert.Len(t, tree.Sections, 5)
+	assert.Equal(t, "/interface bridge", tree.Sections[0].Menu)
+
+	bridge := tree.Sections[0].Commands[0]
+	assert.Equal(t, "add", bridge.Action)
+	assert.Equal(t, 5, bridge.Line)
+	assert.Equal(t, `add name=bridge comment="LAN bridge"`, bridge.Raw)
+	comment, ok := bridge.Get("comment")
+	assert.True(t, ok)
+	assert.Equal(t, "LAN bridge", comment)
+
+	ether := tree.Section("/interface/ethernet").Commands[0]
+	assert.Equal(t, "set", ether.Action)
+	assert.Equal(t, "[ find default-name=ether1 ]", ether.Target)
+	assert.Len(t, ether.Args, 1)
+
+	filter := tree.Section("/ip firewall filter").Commands[0]
+	comment, _ = filter.Get("comment")
+	assert.Equal(t, `allow "established" and $related`, comment)
+	state, _ := filter.Get("connection-state")
+	assert.Equal(t, "established,related", state)
+	assert.Equal(t, 10, filter.Line)
+
+	telnet := tree.Section("/ip service").Commands[0]
+	assert.Equal(t, "telnet", telnet.Target)
+	disabled, _ := telnet.Get("disabled")
+	assert.Equal(t, "yes", disabled)
+	_, ok = telnet.Get("port")
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, tree.Lookup("/system ntp client servers", "address"))
+	assert.Nil(t, tree.Lookup("/snmp", "enabled"))
+	assert.Nil(t, tree.Section("/snmp"))
+}
+
+func TestParseTerseExport(t *testing.T) {
+	export := "/interface bridge add name=bridge\n/ip service set telnet disabled=yes\n/ip service set ftp disabled=yes\n/system identity set name=core-1\n"
+
+	tree, err := ParseExport(export)
+	assert.NoError(t, err)
+	assert.Len(t, tree.Sections, 3)
+	assert.Len(t, tree.Section("/ip service").Commands, 2)
+	assert.Equal(t, "set ftp disabled=yes", tree.Section("/ip service").Commands[1].Raw)
+	assert.Equal(t, []string{"core-1"}, tree.Lookup("/system identity", "name"))
+}
+
+func TestParseExportErrors(t *testing.T) {
+	tree, err := ParseExport("add name=orphan\n/ip service\nset telnet comment=\"unterminated\nset ftp disabled=[ find\n")
+	assert.ErrorContains(t, err, "line 1: command outside of any menu")
+	assert.ErrorContains(t, err, "line 3: unterminated quoted string")
+	assert.ErrorContains(t, err, "line 4: unterminated bracket")
+	// the malformed lines are parsed as far as possible
+	assert.Len(t, tree.Section("/ip service").Commands, 2)
+}
+
+func TestExportCommandString(t *testing.T) {
+	command := &ExportCommand{Action: "add", Args: []*ExportArg{
+		{Key: "name", Value: "bridge"},
+		{Key: "comment", Value: `LAN "main" $bridge`},
+		{Key: "disabled", Value: ""},
+	}}
+	assert.Equal(t, `add name=bridge comment="LAN \"main\" \$bridge" disabled=""`, command.String())
+
+	// the formatted command is parsed back to the same arguments
+	tree, err := ParseExport("/interface bridge\n" + command.String())
+	assert.NoError(t, err)
+	assert.Equal(t, command.Args, tree.Sections[0].Commands[0].Args)
+
+	command = &ExportCommand{Action: "set", Target: "telnet", Args: []*ExportArg{{Key: "disabled", Value: "yes"}}}
+	assert.Equal(t, "set telnet disabled=yes", command.String())
+}
+
+func TestUnquoteExportValue(t *testing.T) {
+	assert.Equal(t, "a\nb\tc d", unquoteExportValue(`a\nb\tc\_d`))
+	assert.Equal(t, "\u00d0", unquoteExportValue(`\C3\90`))
+	assert.Equal(t, `C:\`, unquoteExportValue(`C:\\`))
+	assert.Equal(t, "?$", unquoteExportValue(`\?\$`))
+}
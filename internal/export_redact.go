@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RedactedValue replaces the sensitive values of the redacted exports
+const RedactedValue = "********"
+
+const (
+	// sensitiveArgs matches the names of the arguments holding the passwords, secrets, pre-shared
+	// and private keys, e.g. "wpa2-pre-shared-key", "tcp-md5-key" or the NTP "key"
+	sensitiveArgs = `(?:[\w-]*-)?(?:password|passphrase|secret|pre-shared-key|preshared-key|private-key|psk|auth-key|` +
+		`authentication-key|encryption-key|protection-key|static-key-\d|md5-key|trap-community)|key`
+	// sensitiveValue matches the argument value, either quoted or not, a quoted value may be
+	// continued on the next line
+	sensitiveValue = `("(?:[^"\\]|\\.)*(?:"|\\$|$)|[^\s"]*)`
+)
+
+var (
+	// sensitiveArgRe matches the sensitive arguments along with their values, e.g.
+	// "wpa2-pre-shared-key=..." or "authentication-password=..."
+	sensitiveArgRe = regexp.MustCompile(`(?i)(?:^|\s)(?:` + sensitiveArgs + `)=` + sensitiveValue)
+	// snmpCommunityArgRe is sensitiveArgRe of the SNMP communities, their names are the secrets
+	snmpCommunityArgRe = regexp.MustCompile(`(?i)(?:^|\s)(?:` + sensitiveArgs + `|name)=` + sensitiveValue)
+)
+
+// isSnmpCommunity returns true if the export line starts with the SNMP community menu path, e.g.
+// "/snmp community" or "/snmp/community add name=...".
+func isSnmpCommunity(line string) bool {
+	fields := strings.Fields(strings.ReplaceAll(strings.TrimSpace(line), "/", " "))
+	return strings.HasPrefix(strings.TrimSpace(line), "/") && len(fields) >= 2 && fields[0] == "snmp" && fields[1] == "community"
+}
+
+// redactState tells whether the sensitive value of the previous line continues on the next one
+type redactState int
+
+const (
+	redactNone redactState = iota
+	// redactQuoted is set when a quoted value continues until the closing quote
+	redactQuoted
+	// redactUnquoted is set when a value without quotes continues until the first space
+	redactUnquoted
+)
+
+// redactLine masks the sensitive values of the export line, the state of the previous line
+// tells whether the line starts with a continued value and community whether the line is of the
+// SNMP community menu. It returns the redacted line and whether the last value continues on the
+// next line.
+func redactLine(line string, state redactState, community bool) (string, redactState) {
+	var prefix string
+
+	if state != redactNone {
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		prefix, line = line[:indent], line[indent:]
+
+		end := -1
+		if state == redactQuoted {
+			for i := 0; i < len(line); i++ {
+				if line[i] == '\\' {
+					i++
+				} else if line[i] == '"' {
+					end = i
+					break
+				}
+			}
+		} else {
+			end = strings.IndexAny(line, " \t")
+		}
+
+		if end < 0 {
+			// the whole line is a part of the value
+			if strings.HasSuffix(line, "\\") {
+				return prefix + "\\", state
+			}
+			if state == redactUnquoted {
+				return prefix + RedactedValue, redactNone
+			}
+			return prefix, redactNone
+		}
+		if state == redactUnquoted {
+			prefix += RedactedValue
+		}
+		line = line[end:]
+	}
+
+	var (
+		sb   strings.Builder
+		last int
+		next = redactNone
+	)
+	re := sensitiveArgRe
+	if community {
+		re = snmpCommunityArgRe
+	}
+
+	sb.WriteString(prefix)
+	for _, match := range re.FindAllStringSubmatchIndex(line, -1) {
+		start, end := match[2], match[3]
+		value := line[start:end]
+		sb.WriteString(line[last:start])
+		last = end
+
+		continued := end == len(line) && strings.HasSuffix(value, "\\")
+		switch {
+		case strings.HasPrefix(value, `"`) && continued:
+			sb.WriteString(`"` + RedactedValue + `\`)
+			next = redactQuoted
+		case strings.HasPrefix(value, `"`) && len(value) > 1 && strings.HasSuffix(value, `"`):
+			sb.WriteString(`"` + RedactedValue + `"`)
+		case strings.HasPrefix(value, `"`):
+			sb.WriteString(`"` + RedactedValue)
+		case continued:
+			sb.WriteString(RedactedValue + `\`)
+			next = redactUnquoted
+		default:
+			sb.WriteString(RedactedValue)
+		}
+	}
+	sb.WriteString(line[last:])
+
+	return sb.String(), next
+}
+
+// RedactExport masks the passwords, secrets, pre-shared and private keys of the export, the
+// lines are kept in place so the line numbers of the export do not change.
+func RedactExport(export string) string {
+	var (
+		state     redactState
+		community bool
+	)
+
+	lines := strings.Split(export, "\n")
+	for i, line := range lines {
+		cr := strings.HasSuffix(line, "\r")
+		// the menu path lines switch the menu of the following lines
+		if state == redactNone && strings.HasPrefix(line, "/") {
+			community = isSnmpCommunity(line)
+		}
+		lines[i], state = redactLine(strings.TrimSuffix(line, "\r"), state, community)
+		if cr {
+			lines[i] += "\r"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RedactExportLine masks the sensitive values of a single export line, the values continued from
+// the previous lines and the menu of the line, unless it starts with the menu path, can not be
+// detected.
+func RedactExportLine(line string) string {
+	redacted, _ := redactLine(line, redactNone, isSnmpCommunity(line))
+	return redacted
+}
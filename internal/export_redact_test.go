@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactExport(t *testing.T) {
+	export := `# 2024-05-01 10:00:00 by RouterOS 7.15
+/interface wireless security-profiles
+set [ find default=yes ] authentication-types=wpa2-psk mode=dynamic-keys wpa2-pre-shared-key=Sup3rS3cret supplicant-identity=MikroTik
+/interface wireguard
+add listen-port=13231 name=wg0 private-key="aGVsbG8gd29ybGQ="
+/ip ipsec identity
+add peer=office secret="very \"long\" secret \
+    continued" comment=office
+/ppp secret
+add name=vpn password=abc\
+    def service=l2tp
+/snmp community
+set [ find default=yes ] authentication-password=snmpAuth encryption-password="" name=public
+add addresses=10.0.0.0/8 name=monitoring
+/snmp
+set enabled=yes trap-community=monitoring
+/routing bgp connection
+add as=65000 name=upstream tcp-md5-key=bgpSecret
+/system ntp key
+add key=ntpSecret key-id=1
+/user
+add name=admin group=full
+`
+	expected := `# 2024-05-01 10:00:00 by RouterOS 7.15
+/interface wireless security-profiles
+set [ find default=yes ] authentication-types=wpa2-psk mode=dynamic-keys wpa2-pre-shared-key=******** supplicant-identity=MikroTik
+/interface wireguard
+add listen-port=13231 name=wg0 private-key="********"
+/ip ipsec identity
+add peer=office secret="********\
+    " comment=office
+/ppp secret
+add name=vpn password=********\
+    ******** service=l2tp
+/snmp community
+set [ find default=yes ] authentication-password=******** encryption-password="********" name=********
+add addresses=10.0.0.0/8 name=********
+/snmp
+set enabled=yes trap-community=********
+/routing bgp connection
+add as=65000 name=upstream tcp-md5-key=********
+/system ntp key
+add key=******** key-id=1
+/user
+add name=admin group=full
+`
+	assert.Equal(t, expected, RedactExport(export))
+
+	// the parsed redacted export has no secrets left
+	tree, err := ParseExport(RedactExport(export))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`********`}, tree.Lookup("/ip ipsec identity", "secret"))
+	assert.Equal(t, []string{"office"}, tree.Lookup("/ip ipsec identity", "comment"))
+	assert.Equal(t, []string{"****************"}, tree.Lookup("/ppp secret", "password"))
+	assert.Equal(t, []string{"l2tp"}, tree.Lookup("/ppp secret", "service"))
+
+	assert.Equal(t, "/ip service\r\nset telnet disabled=yes\r\n", RedactExport("/ip service\r\nset telnet disabled=yes\r\n"))
+}
+
+func TestRedactExportLine(t *testing.T) {
+	assert.Equal(t, "add name=vpn password=******** service=l2tp", RedactExportLine("add name=vpn password=secret service=l2tp"))
+	assert.Equal(t, "/ppp secret add name=vpn password=********", RedactExportLine("/ppp secret add name=vpn password=x"))
+	// the values of the other arguments are kept
+	assert.Equal(t, `add comment="password=x"`, RedactExportLine(`add comment="password=x"`))
+	assert.Equal(t, "set enabled=yes", RedactExportLine("set enabled=yes"))
+	assert.Equal(t, "add key=******** key-id=1", RedactExportLine("add key=ntpSecret key-id=1"))
+	assert.Equal(t, "/routing/bgp/connection add name=upstream tcp-md5-key=********", RedactExportLine("/routing/bgp/connection add name=upstream tcp-md5-key=x"))
+	// the SNMP community names are only masked along with the menu path
+	assert.Equal(t, "/snmp community add name=********", RedactExportLine("/snmp community add name=monitoring"))
+	assert.Equal(t, "/snmp/community set 0 name=********", RedactExportLine("/snmp/community set 0 name=monitoring"))
+	assert.Equal(t, "/interface ethernet set ether1 name=wan", RedactExportLine("/interface ethernet set ether1 name=wan"))
+}
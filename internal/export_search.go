@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mazay/mikromanager/db"
+)
+
+// ExportSearchMinLength is the shortest text the index can search for
+const ExportSearchMinLength = 3
+
+// ExportMatch is an export line matching the search.
+type ExportMatch struct {
+	Export  *db.Export
+	Line    int
+	Content string
+}
+
+// ExportSearch describes the search across the stored exports.
+type ExportSearch struct {
+	Query string
+	// Regex makes the query a regular expression rather than a plain text
+	Regex bool
+	// All searches all the retained exports rather than the latest export of every device
+	All bool
+	// Redact masks the secrets of the matching lines, the lines matching only because of their
+	// secrets are skipped
+	Redact bool
+	Limit  int
+}
+
+// searchedExports returns the exports of the search scope keyed by ID, either the latest export
+// of every device or all of them. The exports of the trashed devices are skipped.
+func searchedExports(exports []*db.Export, all bool) map[string]*db.Export {
+	var (
+		scope   = map[string]*db.Export{}
+		devices = map[string]bool{}
+	)
+
+	// the exports are ordered by the modification time, the latest first
+	for _, export := range exports {
+		if export.Device == nil || export.Device.Trashed() || export.Missing {
+			continue
+		}
+		if !all && devices[export.DeviceId] {
+			continue
+		}
+		devices[export.DeviceId] = true
+		scope[export.Id] = export
+	}
+
+	return scope
+}
+
+// searchMatches returns true if the line matches the regular expression if set, or contains
+// the text ignoring the case otherwise.
+func searchMatches(line string, text string, re *regexp.Regexp) bool {
+	if re != nil {
+		return re.MatchString(line)
+	}
+	return strings.Contains(strings.ToLower(line), strings.ToLower(text))
+}
+
+// SearchExports finds the lines of the indexed exports containing the query text or matching
+// the query regular expression. The plain text search uses the index, the regular expressions
+// are matched against all the indexed lines of the scope. It returns up to search.Limit
+// matches and an error if the query is invalid or the search fails.
+func SearchExports(database *db.DB, search *ExportSearch) ([]*ExportMatch, error) {
+	var (
+		export  = &db.Export{}
+		matches []*ExportMatch
+		lines   []*db.ExportLine
+		re      *regexp.Regexp
+		err     error
+	)
+
+	query := strings.TrimSpace(search.Query)
+	if search.Regex {
+		re, err = regexp.Compile(query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+	} else if utf8.RuneCountInString(query) < ExportSearchMinLength {
+		return nil, fmt.Errorf("the search text should be at least %d characters long", ExportSearchMinLength)
+	}
+	if query == "" {
+		return nil, errors.New("the search query is empty")
+	}
+
+	exports, err := export.GetAll(database)
+	if err != nil {
+		return nil, err
+	}
+	scope := searchedExports(exports, search.All)
+	var ids []string
+	for id := range scope {
+		ids = append(ids, id)
+	}
+
+	if re == nil {
+		lines, err = db.SearchExportLines(database, query, ids, search.Limit)
+	} else {
+		lines, err = db.GetExportLines(database, ids)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		if re != nil && !re.MatchString(line.Content) {
+			continue
+		}
+		if search.Redact {
+			line.Content = RedactExportLine(line.Content)
+			if !searchMatches(line.Content, query, re) {
+				continue
+			}
+		}
+		if search.Limit > 0 && len(matches) >= search.Limit {
+			break
+		}
+		matches = append(matches, &ExportMatch{Export: scope[line.ExportId], Line: line.LineNumber, Content: line.Content})
+	}
+
+	// the matches of a device are grouped together, the latest export first
+	slices.SortStableFunc(matches, func(a, b *ExportMatch) int {
+		if a.Export.DeviceId != b.Export.DeviceId {
+			return strings.Compare(a.Export.Device.Address, b.Export.Device.Address)
+		}
+		if a.Export.Id != b.Export.Id && a.Export.LastModified != nil && b.Export.LastModified != nil {
+			return b.Export.LastModified.Compare(*a.Export.LastModified)
+		}
+		return 0
+	})
+
+	return matches, nil
+}
+
+// IndexExports indexes the redacted lines of the exports missing from the index, e.g. the exports
+// stored before the index was introduced or imported by the reconciliation. It returns the number of the indexed exports and an error if
+// any of the exports can not be downloaded or indexed.
+func IndexExports(database *db.DB, s3 *S3) (int, error) {
+	var (
+		export = &db.Export{}
+		count  int
+		errs   []error
+	)
+
+	indexed, err := db.IndexedExportIds(database)
+	if err != nil {
+		return 0, err
+	}
+	exports, err := export.GetAll(database)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, e := range exports {
+		if indexed[e.Id] || e.Missing || e.Size == nil {
+			continue
+		}
+		body, err := s3.GetFile(e.S3Key, *e.Size)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.S3Key, err))
+			continue
+		}
+		err = indexExport(database, e, body)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.S3Key, err))
+			continue
+		}
+		count++
+	}
+
+	return count, errors.Join(errs...)
+}
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchExports(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		now     = time.Now()
+		devices []*db.Device
+	)
+	for _, address := range []string{"10.0.0.2", "10.0.0.1", "10.0.0.3"} {
+		device := &db.Device{Address: address}
+		err = device.Create(database)
+		if err != nil {
+			t.Fatal(err)
+		}
+		devices = append(devices, device)
+	}
+
+	exports := []struct {
+		device *db.Device
+		age    time.Duration
+		body   string
+	}{
+		{devices[0], time.Hour, "/ip address\nadd address=192.168.88.1/24 interface=bridge\n"},
+		{devices[0], 0, "/ip address\nadd address=192.168.89.1/24 interface=bridge\n"},
+		{devices[1], 0, "/ip firewall filter\nadd chain=input comment=\"Allow SSH\"\n/ip address\nadd address=192.168.88.2/24 interface=bridge\n"},
+		{devices[2], 0, "/ip address\nadd address=192.168.88.3/24 interface=bridge\n"},
+	}
+	for _, e := range exports {
+		modified := now.Add(-e.age)
+		export := &db.Export{DeviceId: e.device.Id, LastModified: &modified}
+		err = export.Save(database)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.IndexExport(database, export, []byte(e.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the exports of the trashed devices are not searched
+	err = devices[2].Trash(database, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := SearchExports(database, &ExportSearch{Query: "192.168.88", Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+	assert.Equal(t, "10.0.0.1", matches[0].Export.Device.Address)
+	assert.Equal(t, 4, matches[0].Line)
+	assert.Equal(t, "add address=192.168.88.2/24 interface=bridge", matches[0].Content)
+
+	// the older exports are searched as well
+	matches, err = SearchExports(database, &ExportSearch{Query: "192.168.88", All: true, Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, matches, 2)
+	assert.Equal(t, "10.0.0.2", matches[1].Export.Device.Address)
+
+	matches, err = SearchExports(database, &ExportSearch{Query: `^add address=192\.168\.8[89]\.1/`, Regex: true, All: true, Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, matches, 2)
+	// the latest export of the device goes first
+	assert.Equal(t, "add address=192.168.89.1/24 interface=bridge", matches[0].Content)
+
+	matches, err = SearchExports(database, &ExportSearch{Query: "interface=bridge", All: true, Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, matches, 2)
+
+	matches, err = SearchExports(database, &ExportSearch{Query: `comment="allow ssh"`, Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+
+	// the secrets can not be searched for without the permission
+	err = db.IndexExport(database, matches[0].Export, []byte("/ppp secret\nadd name=vpn password=hunter22\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, err = SearchExports(database, &ExportSearch{Query: "hunter22", Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+	matches, err = SearchExports(database, &ExportSearch{Query: "hunter22", Redact: true, Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, matches)
+	matches, err = SearchExports(database, &ExportSearch{Query: "name=vpn", Redact: true, Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+	assert.Equal(t, "add name=vpn password=********", matches[0].Content)
+
+	_, err = SearchExports(database, &ExportSearch{Query: "ip"})
+	assert.Error(t, err)
+	_, err = SearchExports(database, &ExportSearch{Query: "add (", Regex: true})
+	assert.Error(t, err)
+	_, err = SearchExports(database, &ExportSearch{Query: " ", Regex: true})
+	assert.Error(t, err)
+}
+
+func TestIndexExportRedacts(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	export := &db.Export{DeviceId: "device"}
+	err = export.Save(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = indexExport(database, export, []byte("/ppp secret\nadd name=vpn password=Sup3rS3cret service=l2tp\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines, err := db.GetExportLines(database, []string{export.Id})
+	assert.NoError(t, err)
+	assert.Len(t, lines, 2)
+	assert.Equal(t, "add name=vpn password=******** service=l2tp", lines[1].Content)
+}
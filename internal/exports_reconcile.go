@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"path"
+	"strings"
+
+	"github.com/mazay/mikromanager/db"
+)
+
+const (
+	// ReconcileModeReport only compares the DB export index with the S3 bucket, nothing is written
+	ReconcileModeReport ReconcileMode = iota
+	// ReconcileModeFlag also flags the DB rows whose objects vanished as missing
+	ReconcileModeFlag
+	// ReconcileModeFix imports the objects missing from the DB and deletes the vanished rows
+	ReconcileModeFix
+)
+
+// ReconcileMode defines what ReconcileExports writes to the database.
+type ReconcileMode int
+
+// ReconcileDevice holds the differences between the DB export index and the S3 bucket for a single device.
+type ReconcileDevice struct {
+	DeviceId string
+	Device   *db.Device
+	// NotIndexed are the S3 objects that have no matching DB row
+	NotIndexed []*Export
+	// Vanished are the DB rows whose S3 objects do not exist anymore
+	Vanished []*db.Export
+}
+
+// ReconcileReport is the outcome of comparing the DB export index with the S3 bucket contents.
+type ReconcileReport struct {
+	Fixed          bool
+	DevicesChecked int
+	Devices        []*ReconcileDevice
+	// OrphanPrefixes are the S3 export prefixes that do not belong to any known device
+	OrphanPrefixes []string
+	Errors         []string
+}
+
+// Clean returns true if no differences were found.
+func (r *ReconcileReport) Clean() bool {
+	return len(r.Devices) == 0 && len(r.OrphanPrefixes) == 0
+}
+
+// reconcileDeviceExports compares the DB rows with the S3 objects of a single device and
+// returns the differences, it returns nil if there are none.
+func reconcileDeviceExports(device *db.Device, rows []*db.Export, objects []*Export) *ReconcileDevice {
+	var (
+		result  = &ReconcileDevice{DeviceId: device.Id, Device: device}
+		indexed = map[string]bool{}
+		stored  = map[string]bool{}
+	)
+
+	for _, row := range rows {
+		indexed[row.S3Key] = true
+	}
+	for _, object := range objects {
+		stored[object.Key] = true
+		if !indexed[object.Key] {
+			result.NotIndexed = append(result.NotIndexed, object)
+		}
+	}
+	for _, row := range rows {
+		if !stored[row.S3Key] {
+			result.Vanished = append(result.Vanished, row)
+		}
+	}
+
+	if len(result.NotIndexed) == 0 && len(result.Vanished) == 0 {
+		return nil
+	}
+	return result
+}
+
+// findOrphanPrefixes returns the prefixes whose last path element does not match any of the device IDs.
+func findOrphanPrefixes(prefixes []string, deviceIds map[string]bool) []string {
+	var orphans []string
+	for _, prefix := range prefixes {
+		if !deviceIds[path.Base(strings.TrimSuffix(prefix, "/"))] {
+			orphans = append(orphans, prefix)
+		}
+	}
+	return orphans
+}
+
+// ReconcileExports lists the S3 exports of every device and compares them with the exports
+// stored in the database. The ReconcileModeReport mode writes nothing, the ReconcileModeFlag mode
+// flags the DB rows whose objects vanished as missing and the ReconcileModeFix mode imports the
+// objects missing from the DB and deletes the vanished rows. Prefixes of unknown devices are only
+// reported, they are never deleted.
+func ReconcileExports(database *db.DB, s3 *S3, mode ReconcileMode) (*ReconcileReport, error) {
+	var (
+		device    = &db.Device{}
+		export    = &db.Export{}
+		fix       = mode == ReconcileModeFix
+		report    = &ReconcileReport{Fixed: fix}
+		deviceIds = map[string]bool{}
+	)
+
+	devices, err := device.GetAllPlain(database)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range devices {
+		deviceIds[d.Id] = true
+
+		rows, err := export.GetByDeviceId(database, d.Id)
+		if err != nil {
+			return nil, err
+		}
+		objects, err := s3.GetExports(d.Id)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		report.DevicesChecked++
+
+		result := reconcileDeviceExports(d, rows, objects)
+		if result != nil {
+			report.Devices = append(report.Devices, result)
+		}
+		if mode == ReconcileModeReport {
+			continue
+		}
+
+		// rows whose objects are present again should not stay flagged
+		vanished := map[string]bool{}
+		if result != nil {
+			for _, row := range result.Vanished {
+				vanished[row.Id] = true
+			}
+		}
+		for _, row := range rows {
+			if row.Missing && !vanished[row.Id] {
+				if err = row.SetMissing(database, false); err != nil {
+					report.Errors = append(report.Errors, err.Error())
+				}
+			}
+		}
+
+		if result == nil {
+			continue
+		}
+
+		for _, row := range result.Vanished {
+			if fix {
+				err = row.Delete(database)
+			} else {
+				err = row.SetMissing(database, true)
+			}
+			if err != nil {
+				report.Errors = append(report.Errors, err.Error())
+			}
+		}
+
+		if fix {
+			for _, object := range result.NotIndexed {
+				row := &db.Export{
+					S3Key:        object.Key,
+					LastModified: object.LastModified,
+					ETag:         object.ETag,
+					Size:         object.Size,
+					DeviceId:     d.Id,
+				}
+				// the export worker might have stored the object in the meantime
+				if _, err = row.CreateUnlessExists(database); err != nil {
+					report.Errors = append(report.Errors, err.Error())
+				}
+			}
+		}
+	}
+
+	// exports of trashed devices are kept until the device is purged
+	trashed, err := device.GetAllTrashed(database)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range trashed {
+		deviceIds[d.Id] = true
+	}
+
+	prefixes, err := s3.GetExportsPrefixes()
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	} else {
+		report.OrphanPrefixes = findOrphanPrefixes(prefixes, deviceIds)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcileDeviceExports(t *testing.T) {
+	device := &db.Device{}
+	device.Id = "device-id"
+
+	indexed := &db.Export{S3Key: "exports/device-id/1.rsc"}
+	vanished := &db.Export{S3Key: "exports/device-id/2.rsc"}
+	stored := &Export{Key: "exports/device-id/1.rsc"}
+	notIndexed := &Export{Key: "exports/device-id/3.rsc"}
+
+	tests := []struct {
+		name           string
+		rows           []*db.Export
+		objects        []*Export
+		wantNil        bool
+		wantNotIndexed []*Export
+		wantVanished   []*db.Export
+	}{
+		{"In sync", []*db.Export{indexed}, []*Export{stored}, true, nil, nil},
+		{"Nothing stored", nil, nil, true, nil, nil},
+		{"Object not indexed", []*db.Export{indexed}, []*Export{stored, notIndexed}, false, []*Export{notIndexed}, nil},
+		{"Object vanished", []*db.Export{indexed, vanished}, []*Export{stored}, false, nil, []*db.Export{vanished}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := reconcileDeviceExports(device, tt.rows, tt.objects)
+			if tt.wantNil {
+				assert.Nil(t, got)
+				return
+			}
+			assert.Equal(t, "device-id", got.DeviceId)
+			assert.Equal(t, tt.wantNotIndexed, got.NotIndexed)
+			assert.Equal(t, tt.wantVanished, got.Vanished)
+		})
+	}
+}
+
+func TestFindOrphanPrefixes(t *testing.T) {
+	prefixes := []string{"bucket/exports/known/", "bucket/exports/unknown/"}
+	deviceIds := map[string]bool{"known": true}
+
+	assert.Equal(t, []string{"bucket/exports/unknown/"}, findOrphanPrefixes(prefixes, deviceIds))
+}
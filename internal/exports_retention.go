@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+)
+
+// RetentionPlan describes the outcome of applying an exports retention policy to the
+// exports of a single device, exports in the Remove list are the ones to be deleted. The plan
+// of the exports with no device attached has no device and only removes them.
+type RetentionPlan struct {
+	DeviceId string
+	Device   *db.Device
+	Keep     []*db.Export
+	Remove   []*db.Export
+}
+
+func exportInSlice(a *db.Export, list []*db.Export) bool {
+	for _, b := range list {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+func timeSliceBy(start time.Time, end time.Time, multiplier time.Duration) []time.Time {
+	var times []time.Time
+	for d := start; !d.After(end); d = d.Add(multiplier) {
+		times = append(times, d)
+	}
+	return times
+}
+
+// getLatestExport returns latest export object in the list
+func getLatestExport(slice []*db.Export) *db.Export {
+	var latest *db.Export
+	for _, export := range slice {
+		if latest == nil || export.LastModified.After(*latest.LastModified) {
+			latest = export
+		}
+	}
+	return latest
+}
+
+// exportsToKeep finds a list of export objects within the given time slots that we'd want to keep
+// typically latest backup for a timeWindow after each item in the timeSlice
+func exportsToKeep(exports []*db.Export, timeSlice []time.Time, timeWindow time.Duration) []*db.Export {
+	var exportList []*db.Export
+
+	for _, t := range timeSlice {
+		var tmpList []*db.Export
+		t2 := t.Add(timeWindow)
+		for _, export := range exports {
+			if export.LastModified.After(t) && export.LastModified.Before(t2) {
+				tmpList = append(tmpList, export)
+			}
+		}
+		earliestExport := getLatestExport(tmpList)
+		if earliestExport != nil {
+			exportList = append(exportList, earliestExport)
+		}
+	}
+	return exportList
+}
+
+// RotateHourlyExports return a list of hourly exports that should be kept
+func RotateHourlyExports(exports []*db.Export, number int64) []*db.Export {
+	now := time.Now()
+	end := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location())
+	start := end.Add(-time.Hour * time.Duration(number))
+	slice := timeSliceBy(start, end, time.Hour)
+
+	timeWindow := 59*time.Minute + 59*time.Second
+	return exportsToKeep(exports, slice, timeWindow)
+}
+
+// RotateDailyExports return a list of daily exports that should be kept
+func RotateDailyExports(exports []*db.Export, number int64) []*db.Export {
+	now := time.Now()
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	start := end.Add(-time.Hour * 24 * time.Duration(number))
+	slice := timeSliceBy(start, end, time.Hour*24)
+
+	timeWindow := 23*time.Hour + 59*time.Minute + 59*time.Second
+	return exportsToKeep(exports, slice, timeWindow)
+}
+
+// RotateWeeklyExports return a list of weekly exports that should be kept
+func RotateWeeklyExports(exports []*db.Export, number int64) []*db.Export {
+	now := time.Now()
+	weekDayDiff := 7 - now.Weekday()
+	end := time.Date(now.Year(), now.Month(), now.Day()+int(weekDayDiff), 0, 0, 0, 0, now.Location())
+	start := end.Add(-time.Hour * 168 * 30)
+	slice := timeSliceBy(start, end, time.Hour*168)
+
+	// 6 days 23 hours 59 minutes 59 seconds
+	timeWindow := 167*time.Hour + 59*time.Minute + 59*time.Second
+	return exportsToKeep(exports, slice, timeWindow)
+}
+
+// PlanRetention applies the hourly, daily and weekly rotation rules of the given policy
+// to the exports of a single device and returns the resulting plan. Nothing is deleted,
+// the caller decides what to do with the exports in the Remove list.
+func PlanRetention(exports []*db.Export, policy *db.ExportsRetentionPolicy) *RetentionPlan {
+	var keep []*db.Export
+
+	plan := &RetentionPlan{}
+	keep = append(keep, RotateHourlyExports(exports, policy.Hourly)...)
+	keep = append(keep, RotateDailyExports(exports, policy.Daily)...)
+	keep = append(keep, RotateWeeklyExports(exports, policy.Weekly)...)
+
+	for _, export := range exports {
+		if exportInSlice(export, keep) {
+			plan.Keep = append(plan.Keep, export)
+		} else {
+			plan.Remove = append(plan.Remove, export)
+		}
+	}
+
+	return plan
+}
+
+// PlanDevicesRetention builds a retention plan for every device in the database using
+// the given policy, followed by a plan removing the exports with no device attached if there
+// are any. It only reads the database and never deletes anything, which makes it suitable for
+// previewing the impact of a policy change.
+func PlanDevicesRetention(database *db.DB, policy *db.ExportsRetentionPolicy) ([]*RetentionPlan, error) {
+	var (
+		device = &db.Device{}
+		export = &db.Export{}
+		plans  []*RetentionPlan
+	)
+
+	devices, err := device.GetAllPlain(database)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range devices {
+		exports, err := export.GetByDeviceId(database, d.Id)
+		if err != nil {
+			return nil, err
+		}
+		plan := PlanRetention(exports, policy)
+		plan.DeviceId = d.Id
+		plan.Device = d
+		plans = append(plans, plan)
+	}
+
+	exports, err := export.GetAll(database)
+	if err != nil {
+		return nil, err
+	}
+	if orphans := GetNoDeviceExports(exports); len(orphans) > 0 {
+		plans = append(plans, &RetentionPlan{Remove: orphans})
+	}
+
+	return plans, nil
+}
+
+// GetNoDeviceExports return a list of exports with no devices attached, can be used to cleanup leftover exports
+func GetNoDeviceExports(exports []*db.Export) []*db.Export {
+	var exportsList []*db.Export
+
+	for _, export := range exports {
+		if export.DeviceId == "" {
+			exportsList = append(exportsList, export)
+		}
+	}
+
+	return exportsList
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestExport(lastModified time.Time) *db.Export {
+	return &db.Export{LastModified: &lastModified}
+}
+
+func TestPlanRetention(t *testing.T) {
+	now := time.Now()
+	hour := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location())
+
+	latest := newTestExport(hour.Add(-time.Hour + 30*time.Minute))
+	older := newTestExport(hour.Add(-time.Hour + 10*time.Minute))
+	exports := []*db.Export{latest, older}
+
+	tests := []struct {
+		name       string
+		exports    []*db.Export
+		policy     *db.ExportsRetentionPolicy
+		wantKeep   []*db.Export
+		wantRemove []*db.Export
+	}{
+		{"Keep latest export within the hour", exports, &db.ExportsRetentionPolicy{Hourly: 24}, []*db.Export{latest}, []*db.Export{older}},
+		{"Keep latest export within the day", exports, &db.ExportsRetentionPolicy{Daily: 14}, []*db.Export{latest}, []*db.Export{older}},
+		{"Nothing to keep or remove", nil, &db.ExportsRetentionPolicy{Hourly: 24, Daily: 14, Weekly: 26}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := PlanRetention(tt.exports, tt.policy)
+			assert.Equal(t, tt.wantKeep, plan.Keep)
+			assert.Equal(t, tt.wantRemove, plan.Remove)
+		})
+	}
+}
+
+func TestGetNoDeviceExports(t *testing.T) {
+	withDevice := &db.Export{DeviceId: "device-id"}
+	noDevice := &db.Export{}
+
+	assert.Equal(t, []*db.Export{noDevice}, GetNoDeviceExports([]*db.Export{withDevice, noDevice}))
+	assert.Nil(t, GetNoDeviceExports([]*db.Export{withDevice}))
+}
+
+func TestPlanDevicesRetentionOrphans(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device := &db.Device{Address: "10.0.0.1"}
+	err = device.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, export := range []*db.Export{
+		{S3Key: "exports/device/1.rsc", DeviceId: device.Id, LastModified: &now},
+		{S3Key: "exports/orphan/1.rsc", LastModified: &now},
+	} {
+		err = export.Save(database)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plans, err := PlanDevicesRetention(database, &db.ExportsRetentionPolicy{Hourly: 24, Daily: 14, Weekly: 26})
+	assert.NoError(t, err)
+	assert.Len(t, plans, 2)
+	assert.Equal(t, device.Id, plans[0].DeviceId)
+	assert.Len(t, plans[0].Keep, 1)
+	// the exports with no device are always removed
+	assert.Nil(t, plans[1].Device)
+	assert.Empty(t, plans[1].Keep)
+	assert.Len(t, plans[1].Remove, 1)
+	assert.Equal(t, "exports/orphan/1.rsc", plans[1].Remove[0].S3Key)
+}
@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mazay/mikromanager/db"
+)
+
+const (
+	InventoryAddress   = "address"
+	InventoryRoute     = "route"
+	InventoryLease     = "dhcp-lease"
+	InventoryArp       = "arp"
+	InventoryInterface = "interface"
+	InventoryWireless  = "wireless-client"
+)
+
+// InventoryMatch is an inventory entry of a device matching the search.
+type InventoryMatch struct {
+	Device     *db.Device
+	Source     string
+	Address    string
+	MacAddress string
+	Interface  string
+	// Detail holds the source specific details, e.g. the lease host name or the route gateway
+	Detail string
+}
+
+// ParseMacAddress converts the MAC address written with colons, dashes, dots or without any
+// separators to the upper case colon separated form RouterOS uses. It returns the converted
+// address and true, or the given value and false if it is not a MAC address.
+func ParseMacAddress(value string) (string, bool) {
+	digits := strings.Map(func(r rune) rune {
+		if r == ':' || r == '-' || r == '.' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(value))
+	if len(digits) != 12 {
+		return value, false
+	}
+	for _, c := range digits {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return value, false
+		}
+	}
+
+	digits = strings.ToUpper(digits)
+	var pairs []string
+	for i := 0; i < len(digits); i += 2 {
+		pairs = append(pairs, digits[i:i+2])
+	}
+	return strings.Join(pairs, ":"), true
+}
+
+// normalizeMacAddress returns the MAC address in the RouterOS form, the values which are not
+// MAC addresses are kept as is.
+func normalizeMacAddress(value string) string {
+	mac, _ := ParseMacAddress(value)
+	return mac
+}
+
+// inventoryMatcher returns the function matching the inventory values against the query, the
+// IP and MAC addresses must be equal, other queries match the values containing them ignoring
+// the case.
+func inventoryMatcher(query string) func(values ...string) bool {
+	if mac, ok := ParseMacAddress(query); ok {
+		return func(values ...string) bool { return slices.Contains(values, mac) }
+	}
+	if addr, err := netip.ParseAddr(query); err == nil {
+		return func(values ...string) bool {
+			for _, value := range values {
+				// the interface addresses are stored with the prefix length
+				value, _, _ = strings.Cut(value, "/")
+				if other, err := netip.ParseAddr(value); err == nil && other == addr {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	query = strings.ToLower(query)
+	return func(values ...string) bool {
+		for _, value := range values {
+			if value != "" && strings.Contains(strings.ToLower(value), query) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// routeContains returns true if the route destination contains the IP address, the default
+// routes are skipped as they contain any address.
+func routeContains(route *db.DeviceRoute, query string) bool {
+	addr, err := netip.ParseAddr(query)
+	if err != nil {
+		return false
+	}
+	prefix, err := netip.ParsePrefix(route.DstAddress)
+	if err != nil || prefix.Bits() == 0 {
+		return false
+	}
+	return prefix.Contains(addr)
+}
+
+// SearchInventory finds the addresses, routes, DHCP leases, ARP entries, interfaces and wireless
+// clients of the devices matching the query, e.g. to find the router owning an IP or a MAC
+// address. The IP addresses also match the routes of the networks they belong to. The entries of
+// the trashed devices are skipped. It returns the matches ordered by device address and an error
+// if the query is empty or any of the retrievals fail.
+func SearchInventory(database *db.DB, query string) ([]*InventoryMatch, error) {
+	var (
+		device   = &db.Device{}
+		address  = &db.DeviceAddress{}
+		route    = &db.DeviceRoute{}
+		lease    = &db.DeviceLease{}
+		arp      = &db.DeviceArpEntry{}
+		iface    = &db.DeviceInterface{}
+		client   = &db.DeviceWirelessClient{}
+		devices  = map[string]*db.Device{}
+		matches  []*InventoryMatch
+		addMatch = func(deviceId string, match *InventoryMatch) {
+			if d, ok := devices[deviceId]; ok {
+				match.Device = d
+				matches = append(matches, match)
+			}
+		}
+	)
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, errors.New("the search query is empty")
+	}
+	matcher := inventoryMatcher(query)
+
+	list, err := device.GetAllPlain(database)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range list {
+		devices[d.Id] = d
+	}
+
+	addresses, err := address.GetAll(database)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addresses {
+		if matcher(a.Address, a.Comment) {
+			addMatch(a.DeviceId, &InventoryMatch{Source: InventoryAddress, Address: a.Address, Interface: a.Interface, Detail: a.Comment})
+		}
+	}
+
+	routes, err := route.GetAll(database)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range routes {
+		if matcher(r.DstAddress, r.Gateway, r.Comment) || routeContains(r, query) {
+			detail := "via " + r.Gateway
+			if r.Connected {
+				detail = "connected " + r.Gateway
+			}
+			addMatch(r.DeviceId, &InventoryMatch{Source: InventoryRoute, Address: r.DstAddress, Detail: detail})
+		}
+	}
+
+	leases, err := lease.GetAll(database)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range leases {
+		if matcher(l.Address, l.MacAddress, l.HostName, l.Comment) {
+			addMatch(l.DeviceId, &InventoryMatch{Source: InventoryLease, Address: l.Address, MacAddress: l.MacAddress, Detail: strings.TrimSpace(l.HostName + " " + l.Status)})
+		}
+	}
+
+	entries, err := arp.GetAll(database)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range entries {
+		if matcher(a.Address, a.MacAddress, a.Comment) {
+			addMatch(a.DeviceId, &InventoryMatch{Source: InventoryArp, Address: a.Address, MacAddress: a.MacAddress, Interface: a.Interface, Detail: a.Comment})
+		}
+	}
+
+	interfaces, err := iface.GetAll(database)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range interfaces {
+		if matcher(i.MacAddress, i.Name, i.Comment) {
+			addMatch(i.DeviceId, &InventoryMatch{Source: InventoryInterface, MacAddress: i.MacAddress, Interface: i.Name, Detail: i.Comment})
+		}
+	}
+
+	clients, err := client.GetAll(database)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range clients {
+		if matcher(c.MacAddress, c.LastIp, c.Comment) {
+			addMatch(c.DeviceId, &InventoryMatch{Source: InventoryWireless, Address: c.LastIp, MacAddress: c.MacAddress, Interface: c.Interface, Detail: strings.TrimSpace(c.Ssid + " " + strconv.Itoa(c.Signal) + " dBm")})
+		}
+	}
+
+	// the sources of a device are kept in the order above
+	slices.SortStableFunc(matches, func(a, b *InventoryMatch) int {
+		return strings.Compare(a.Device.Address, b.Device.Address)
+	})
+
+	return matches, nil
+}
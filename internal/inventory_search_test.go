@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMacAddress(t *testing.T) {
+	for _, value := range []string{"AA:BB:CC:DD:EE:01", "aa-bb-cc-dd-ee-01", "aabb.ccdd.ee01", "aabbccddee01", " aa:bb:cc:dd:ee:01 "} {
+		mac, ok := ParseMacAddress(value)
+		assert.True(t, ok, value)
+		assert.Equal(t, "AA:BB:CC:DD:EE:01", mac, value)
+	}
+	for _, value := range []string{"", "10.0.0.1", "aabbccddee0g", "aabbccddee"} {
+		mac, ok := ParseMacAddress(value)
+		assert.False(t, ok, value)
+		assert.Equal(t, value, mac)
+	}
+}
+
+func TestSearchInventory(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	core := &db.Device{Address: "10.0.0.1"}
+	edge := &db.Device{Address: "10.0.1.1"}
+	trashed := &db.Device{Address: "10.0.2.1"}
+	for _, d := range []*db.Device{core, edge, trashed} {
+		err = d.Create(database)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = trashed.Trash(database, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, db.ReplaceDeviceAddresses(database, core.Id, []*db.DeviceAddress{{Address: "10.0.0.1", Interface: "bridge"}}))
+	assert.NoError(t, db.ReplaceDeviceAddresses(database, trashed.Id, []*db.DeviceAddress{{Address: "10.1.2.3"}}))
+	assert.NoError(t, db.ReplaceDeviceRoutes(database, edge.Id, []*db.DeviceRoute{
+		{DstAddress: "0.0.0.0/0", Gateway: "10.0.1.254"},
+		{DstAddress: "10.1.2.0/24", Gateway: "vlan12", Connected: true},
+	}))
+	assert.NoError(t, db.ReplaceDeviceLeases(database, edge.Id, []*db.DeviceLease{
+		{Address: "10.1.2.3", MacAddress: "AA:BB:CC:DD:EE:01", HostName: "Printer-2F", Status: "bound"},
+	}))
+	assert.NoError(t, db.ReplaceDeviceArpEntries(database, core.Id, []*db.DeviceArpEntry{
+		{Address: "10.1.2.3", MacAddress: "AA:BB:CC:DD:EE:01", Interface: "bridge"},
+	}))
+	assert.NoError(t, db.ReplaceDeviceInterfaces(database, core.Id, []*db.DeviceInterface{
+		{Name: "ether1", MacAddress: "AA:BB:CC:DD:EE:FF"},
+	}))
+	assert.NoError(t, db.ReplaceDeviceWirelessClients(database, edge.Id, []*db.DeviceWirelessClient{
+		{Interface: "wifi1", MacAddress: "AA:BB:CC:DD:EE:01", Ssid: "office", Signal: -60},
+	}))
+
+	// the IP address matches the lease, the ARP entry and the connected route but not the
+	// default route or the address of the trashed device
+	matches, err := SearchInventory(database, "10.1.2.3")
+	assert.NoError(t, err)
+	assert.Len(t, matches, 3)
+	assert.Equal(t, core.Id, matches[0].Device.Id)
+	assert.Equal(t, InventoryArp, matches[0].Source)
+	assert.Equal(t, InventoryRoute, matches[1].Source)
+	assert.Equal(t, "connected vlan12", matches[1].Detail)
+	assert.Equal(t, InventoryLease, matches[2].Source)
+	assert.Equal(t, "Printer-2F bound", matches[2].Detail)
+
+	// the MAC address matches in any notation
+	matches, err = SearchInventory(database, "aabb.ccdd.ee01")
+	assert.NoError(t, err)
+	assert.Len(t, matches, 3)
+	assert.Equal(t, InventoryWireless, matches[2].Source)
+	assert.Equal(t, "office -60 dBm", matches[2].Detail)
+	matches, err = SearchInventory(database, "aa-bb-cc-dd-ee-ff")
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+	assert.Equal(t, InventoryInterface, matches[0].Source)
+
+	// the IP addresses must be equal, other queries match the values containing them
+	matches, err = SearchInventory(database, "10.1.2.30")
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+	assert.Equal(t, InventoryRoute, matches[0].Source)
+	matches, err = SearchInventory(database, "printer")
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+
+	_, err = SearchInventory(database, " ")
+	assert.Error(t, err)
+}
@@ -0,0 +1,310 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+	"go.uber.org/zap"
+)
+
+const (
+	RotationRotated        = "rotated"
+	RotationFailed         = "failed"
+	RotationRolledBack     = "rolled-back"
+	RotationRollbackFailed = "rollback-failed"
+	RotationSkipped        = "skipped"
+
+	// passwordAlphabet avoids spaces and quotes which break the API commands and the CLI
+	passwordAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789-_.+"
+	// MinPasswordLength is the minimum length of the generated passwords
+	MinPasswordLength = 12
+	// rotationTimeout limits every device request of the rotation if the API timeout is not set,
+	// a device that stops responding halfway must not block the rotation
+	rotationTimeout = 30 * time.Second
+)
+
+// RotationResult is the outcome of the password rotation on a single device.
+type RotationResult struct {
+	Device *db.Device
+	Status string
+	Error  string
+}
+
+// RotationReport is the outcome of a password rotation, the stored password is only updated
+// if the new password was applied to all the devices.
+type RotationReport struct {
+	Credentials *db.Credentials
+	// Updated is set when the new password was stored
+	Updated bool
+	Results []*RotationResult
+	// NewPassword is only set if the rollback failed on some devices, those need to be fixed manually
+	NewPassword string
+}
+
+// Count returns the number of devices with the given rotation status.
+func (r *RotationReport) Count(status string) int {
+	var count int
+	for _, result := range r.Results {
+		if result.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// GeneratePassword returns a random password of the given length made of characters that are
+// safe to use with the RouterOS API and CLI.
+func GeneratePassword(length int) (string, error) {
+	if length < MinPasswordLength {
+		return "", fmt.Errorf("the password should be at least %d characters long", MinPasswordLength)
+	}
+
+	password := make([]byte, length)
+	max := big.NewInt(int64(len(passwordAlphabet)))
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		password[i] = passwordAlphabet[n.Int64()]
+	}
+	return string(password), nil
+}
+
+// ValidatePassword returns an error if the password can not be applied over the RouterOS API.
+func ValidatePassword(password string) error {
+	if password == "" {
+		return errors.New("the password is empty")
+	}
+	for _, r := range password {
+		if r == ' ' || r == '"' || r == '\'' || r < 0x20 {
+			return errors.New("the password should not contain spaces, quotes or control characters")
+		}
+	}
+	return nil
+}
+
+// RotationDevices splits the devices into the ones using the credentials, meaning those were
+// accepted the last time or the device was never contacted with its primary credentials being
+// the given ones, and the ones that have the credentials set as primary but accept another set.
+func RotationDevices(devices []*db.Device, creds *db.Credentials) ([]*db.Device, []*db.Device) {
+	var using, skipped []*db.Device
+
+	for _, d := range devices {
+		primary := d.CredentialsID == creds.Id || (d.CredentialsID == "" && creds.Alias == "Default")
+		switch {
+		case d.WorkingCredentialsID == creds.Id:
+			using = append(using, d)
+		case d.WorkingCredentialsID == "" && primary:
+			using = append(using, d)
+		case primary:
+			skipped = append(skipped, d)
+		}
+	}
+
+	return using, skipped
+}
+
+// getUserId returns the ID of the user on the device.
+func getUserId(ctx context.Context, api *Api, username string) (string, error) {
+	users, err := api.RunContext(ctx, "/user/print ?name="+username)
+	if err != nil {
+		return "", err
+	}
+	if len(users) == 0 {
+		return "", fmt.Errorf("user %s not found", username)
+	}
+	return users[0].Map[".id"], nil
+}
+
+// setUserPassword changes the password of the user with the given ID on the device.
+func setUserPassword(ctx context.Context, api *Api, id string, password string) error {
+	_, err := api.RunContext(ctx, fmt.Sprintf("/user/set =.id=%s =password=%s", id, password))
+	return err
+}
+
+// rotationApi returns the API client of the device for the rotation, its requests are always
+// limited in time.
+func rotationApi(device *db.Device, username string, password string, timeouts DeviceTimeouts) *Api {
+	timeout := timeouts.Api
+	if timeout <= 0 {
+		timeout = rotationTimeout
+	}
+	return &Api{Address: device.Address, Port: device.ApiPort, Username: username, Password: password, Async: true, Timeout: timeout}
+}
+
+// rotateDevicePassword sets the new password on the device and verifies the login with it,
+// the old password is restored if the verification fails or if the device did not confirm the
+// change, e.g. it stopped responding, as it might have been applied anyway. The restore is not
+// cancelled along with the context.
+func rotateDevicePassword(ctx context.Context, device *db.Device, username string, oldPassword string, newPassword string, timeouts DeviceTimeouts) *RotationResult {
+	result := &RotationResult{Device: device}
+	api := rotationApi(device, username, oldPassword, timeouts)
+
+	id, err := getUserId(ctx, api, username)
+	if err != nil {
+		result.Status = RotationFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	err = setUserPassword(ctx, api, id, newPassword)
+	if err != nil {
+		result.Status = RotationFailed
+		result.Error = err.Error()
+		if isDeviceError(err) {
+			return result
+		}
+		// the outcome is unknown, the device is switched back if it accepts the new password
+		api.Password = newPassword
+		_, loginErr := api.RunContext(context.WithoutCancel(ctx), "/system/identity/print")
+		if loginErr != nil {
+			if !isDeviceError(loginErr) {
+				result.Status = RotationRollbackFailed
+				result.Error = fmt.Sprintf("%s, the device did not confirm the change, it might use the new password", result.Error)
+			}
+			return result
+		}
+		result.Status = RotationRolledBack
+		if rollbackErr := setUserPassword(context.WithoutCancel(ctx), api, id, oldPassword); rollbackErr != nil {
+			result.Status = RotationRollbackFailed
+			result.Error = fmt.Sprintf("%s, rollback failed: %s", result.Error, rollbackErr.Error())
+		}
+		return result
+	}
+
+	api.Password = newPassword
+	_, err = api.RunContext(ctx, "/system/identity/print")
+	if err != nil {
+		result.Error = fmt.Sprintf("login with the new password failed: %s", err.Error())
+		result.Status = RotationRolledBack
+		if rollbackErr := setUserPassword(context.WithoutCancel(ctx), api, id, oldPassword); rollbackErr != nil {
+			result.Status = RotationRollbackFailed
+			result.Error = fmt.Sprintf("%s, rollback failed: %s", result.Error, rollbackErr.Error())
+		}
+		return result
+	}
+
+	result.Status = RotationRotated
+	return result
+}
+
+// rollbackDevicePassword restores the old password on a device that was already rotated.
+func rollbackDevicePassword(ctx context.Context, result *RotationResult, username string, oldPassword string, newPassword string, timeouts DeviceTimeouts) {
+	api := rotationApi(result.Device, username, newPassword, timeouts)
+	id, err := getUserId(ctx, api, username)
+	if err == nil {
+		err = setUserPassword(ctx, api, id, oldPassword)
+	}
+	if err != nil {
+		result.Status = RotationRollbackFailed
+		result.Error = fmt.Sprintf("rollback failed: %s", err.Error())
+		return
+	}
+	result.Status = RotationRolledBack
+	result.Error = "rolled back due to failures on other devices"
+}
+
+// rollbackRotation restores the old password on the devices rotated so far, the new password is
+// kept in the report if the rollback failed on any of them. The rollback is not cancelled along
+// with the context, every device request is still limited in time.
+func rollbackRotation(ctx context.Context, report *RotationReport, username string, oldPassword string, newPassword string, timeouts DeviceTimeouts, logger *zap.Logger) {
+	ctx = context.WithoutCancel(ctx)
+	for _, result := range report.Results {
+		if result.Status == RotationRotated {
+			logger.Info("rolling back password", zap.String("device", result.Device.Address))
+			rollbackDevicePassword(ctx, result, username, oldPassword, newPassword, timeouts)
+		}
+	}
+	if report.Count(RotationRollbackFailed) > 0 {
+		report.NewPassword = newPassword
+	}
+}
+
+// RotatePassword applies the new password to the RouterOS user of the credentials on every
+// device using them, one device at a time, verifying the login with the new password. The
+// stored password is only updated if all the devices were rotated, otherwise the devices
+// rotated so far are rolled back to the old password and the failures are reported, the same
+// happens if storing the new password fails. Devices that have the credentials as primary but
+// accept other ones are skipped. Every device request is limited by the API timeout, or by
+// rotationTimeout if it is not set, and the devices left once the context is cancelled fail and
+// trigger the rollback.
+func RotatePassword(ctx context.Context, database *db.DB, creds *db.Credentials, newPassword string, encryptionKey string, timeouts DeviceTimeouts, logger *zap.Logger) (*RotationReport, error) {
+	var (
+		device = &db.Device{}
+		report = &RotationReport{Credentials: creds}
+		failed bool
+	)
+
+	if creds.IsExternal() {
+		return nil, fmt.Errorf("the password of %s credentials is stored in an external secret, it has to be rotated there", creds.Alias)
+	}
+
+	err := ValidatePassword(newPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	oldPassword, err := db.DecryptString(creds.EncryptedPassword, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := db.EncryptString(newPassword, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := device.GetAllPlain(database)
+	if err != nil {
+		return nil, err
+	}
+	using, skipped := RotationDevices(devices, creds)
+
+	for _, d := range using {
+		logger.Info("rotating password", zap.String("device", d.Address), zap.String("credentials", creds.Alias))
+		result := rotateDevicePassword(ctx, d, creds.Username, oldPassword, newPassword, timeouts)
+		if result.Status != RotationRotated {
+			logger.Error("password rotation failed", zap.String("device", d.Address), zap.String("error", result.Error))
+			failed = true
+		}
+		report.Results = append(report.Results, result)
+		if failed {
+			break
+		}
+	}
+
+	if failed {
+		rollbackRotation(ctx, report, creds.Username, oldPassword, newPassword, timeouts, logger)
+		for _, d := range using[len(report.Results):] {
+			report.Results = append(report.Results, &RotationResult{
+				Device: d,
+				Status: RotationSkipped,
+				Error:  "not attempted due to an earlier failure",
+			})
+		}
+	} else {
+		err = creds.UpdatePassword(database, encrypted)
+		if err != nil {
+			// the devices must not be left with a password that is not stored anywhere
+			logger.Error("storing the new password failed", zap.String("credentials", creds.Alias), zap.String("error", err.Error()))
+			rollbackRotation(ctx, report, creds.Username, oldPassword, newPassword, timeouts, logger)
+			return report, err
+		}
+		report.Updated = true
+	}
+
+	for _, d := range skipped {
+		report.Results = append(report.Results, &RotationResult{
+			Device: d,
+			Status: RotationSkipped,
+			Error:  "the device accepts other credentials",
+		})
+	}
+
+	return report, nil
+}
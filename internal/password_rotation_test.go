@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestGeneratePassword(t *testing.T) {
+	password, err := GeneratePassword(24)
+	assert.NoError(t, err)
+	assert.Len(t, password, 24)
+	assert.NoError(t, ValidatePassword(password))
+	for _, r := range password {
+		assert.True(t, strings.ContainsRune(passwordAlphabet, r))
+	}
+
+	other, err := GeneratePassword(24)
+	assert.NoError(t, err)
+	assert.NotEqual(t, password, other)
+
+	_, err = GeneratePassword(MinPasswordLength - 1)
+	assert.Error(t, err)
+}
+
+func TestValidatePassword(t *testing.T) {
+	assert.NoError(t, ValidatePassword("s3cret-Pass.word"))
+	assert.Error(t, ValidatePassword(""))
+	assert.Error(t, ValidatePassword("with space"))
+	assert.Error(t, ValidatePassword(`with"quote`))
+}
+
+func TestRotationDevices(t *testing.T) {
+	defaults := &db.Credentials{Alias: "Default"}
+	defaults.Id = "default"
+	other := &db.Credentials{Alias: "other"}
+	other.Id = "other"
+
+	never := &db.Device{Address: "10.0.0.1"}
+	working := &db.Device{Address: "10.0.0.2", CredentialsID: "other", WorkingCredentialsID: "default"}
+	fallback := &db.Device{Address: "10.0.0.3", WorkingCredentialsID: "other"}
+	unrelated := &db.Device{Address: "10.0.0.4", CredentialsID: "other"}
+
+	using, skipped := RotationDevices([]*db.Device{never, working, fallback, unrelated}, defaults)
+	assert.Equal(t, []*db.Device{never, working}, using)
+	assert.Equal(t, []*db.Device{fallback}, skipped)
+}
+
+func TestRotatePasswordNoDevices(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds := testCredentialsChain(t, "admin")[0]
+	err = creds.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = RotatePassword(context.Background(), database, creds, "bad password", testEncryptionKey, DeviceTimeouts{}, zap.NewNop())
+	assert.Error(t, err)
+
+	// external passwords are rotated in their stores
+	external := &db.Credentials{Alias: "external", SecretSource: db.SecretSourceEnv, SecretRef: "ROUTER_PASSWORD"}
+	_, err = RotatePassword(context.Background(), database, external, "new-password", testEncryptionKey, DeviceTimeouts{}, zap.NewNop())
+	assert.Error(t, err)
+
+	report, err := RotatePassword(context.Background(), database, creds, "new-password", testEncryptionKey, DeviceTimeouts{}, zap.NewNop())
+	assert.NoError(t, err)
+	assert.True(t, report.Updated)
+	assert.Empty(t, report.Results)
+
+	fetched := &db.Credentials{}
+	fetched.Id = creds.Id
+	err = fetched.GetById(database)
+	assert.NoError(t, err)
+	password, err := db.DecryptString(fetched.EncryptedPassword, testEncryptionKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "new-password", password)
+}
+
+func TestRotatePasswordStoreFailure(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds := testCredentialsChain(t, "admin")[0]
+	err = creds.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, _ := testRouterOS(t)
+	addr := listener.Addr().(*net.TCPAddr)
+	device := &db.Device{Address: addr.IP.String(), ApiPort: strconv.Itoa(addr.Port), WorkingCredentialsID: creds.Id}
+	err = device.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the new password can't be stored once the devices were rotated
+	err = database.DB.Migrator().DropTable(&db.Credentials{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := RotatePassword(context.Background(), database, creds, "new-password", testEncryptionKey, DeviceTimeouts{}, zap.NewNop())
+	assert.Error(t, err)
+	assert.False(t, report.Updated)
+	assert.Len(t, report.Results, 1)
+	assert.Equal(t, RotationRolledBack, report.Results[0].Status)
+	assert.Empty(t, report.NewPassword)
+}
+
+func TestRotatePasswordUnresponsiveDevice(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds := testCredentialsChain(t, "admin")[0]
+	err = creds.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the device accepts the connection but never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	device := &db.Device{Address: addr.IP.String(), ApiPort: strconv.Itoa(addr.Port), WorkingCredentialsID: creds.Id}
+	err = device.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	report, err := RotatePassword(context.Background(), database, creds, "new-password", testEncryptionKey, DeviceTimeouts{Api: 200 * time.Millisecond}, zap.NewNop())
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.False(t, report.Updated)
+	assert.Len(t, report.Results, 1)
+	assert.Equal(t, RotationFailed, report.Results[0].Status)
+}
@@ -0,0 +1,320 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+	"go.uber.org/zap"
+)
+
+// upgradeStarter starts the device upgrades of the rollouts, implemented by the Upgrader.
+type upgradeStarter interface {
+	Start(device *db.Device, firmware bool) (*db.DeviceUpgrade, error)
+}
+
+// NeedsUpgrade returns true if a newer RouterOS version is available for the device or, if
+// firmware is set, its RouterBOARD firmware can be upgraded, as seen by the last poll.
+func NeedsUpgrade(device *db.Device, firmware bool) bool {
+	if device.LatestVersion != "" && device.LatestVersion != device.InstalledVersion {
+		return true
+	}
+	return firmware && device.UpgradeFirmware != "" && device.UpgradeFirmware != device.CurrentFirmware
+}
+
+// PlanRollout splits the devices that need an upgrade into batches, the first batch holds
+// canary devices and the rest up to batchSize devices each. It returns an error if the batch
+// size is not positive.
+func PlanRollout(devices []*db.Device, firmware bool, canary int, batchSize int) ([][]*db.Device, error) {
+	var (
+		batches [][]*db.Device
+		pending []*db.Device
+	)
+
+	if batchSize < 1 {
+		return nil, errors.New("the batch size should be at least 1")
+	}
+	if canary < 0 {
+		return nil, errors.New("the canary count can not be negative")
+	}
+
+	for _, device := range devices {
+		if !device.Trashed() && NeedsUpgrade(device, firmware) {
+			pending = append(pending, device)
+		}
+	}
+
+	if canary > 0 && len(pending) > 0 {
+		canary = min(canary, len(pending))
+		batches = append(batches, pending[:canary])
+		pending = pending[canary:]
+	}
+	for len(pending) > 0 {
+		size := min(batchSize, len(pending))
+		batches = append(batches, pending[:size])
+		pending = pending[size:]
+	}
+
+	return batches, nil
+}
+
+// NewRollout returns a rollout of the group with the devices assigned to the planned batches.
+// It returns an error if the plan is invalid or none of the devices need an upgrade.
+func NewRollout(group *db.DeviceGroup, firmware bool, canary int, batchSize int) (*db.Rollout, error) {
+	batches, err := PlanRollout(group.Devices, firmware, canary, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(batches) == 0 {
+		return nil, fmt.Errorf("none of the %s group devices need an upgrade", group.Name)
+	}
+
+	rollout := &db.Rollout{
+		GroupId:     group.Id,
+		Group:       group,
+		Status:      db.RolloutScheduled,
+		Firmware:    firmware,
+		CanaryCount: canary,
+		BatchSize:   batchSize,
+	}
+	for i, batch := range batches {
+		for _, device := range batch {
+			rollout.Devices = append(rollout.Devices, &db.RolloutDevice{
+				DeviceId: device.Id,
+				Device:   device,
+				Batch:    i,
+				Status:   db.RolloutDevicePending,
+			})
+		}
+	}
+
+	return rollout, nil
+}
+
+// parseWindowTime returns the minutes since midnight of the "15:04" formatted time.
+func parseWindowTime(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid maintenance window time %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ValidateWindow returns an error if only one of the maintenance window bounds is set or any
+// of them is not formatted as "15:04".
+func ValidateWindow(start string, end string) error {
+	if start == "" && end == "" {
+		return nil
+	}
+	if start == "" || end == "" {
+		return errors.New("both maintenance window bounds should be set")
+	}
+	_, err := parseWindowTime(start)
+	if err != nil {
+		return err
+	}
+	_, err = parseWindowTime(end)
+	return err
+}
+
+// InMaintenanceWindow returns true if the time is within the daily window, windows ending before
+// they start span midnight. Any time is within an unset window.
+func InMaintenanceWindow(start string, end string, now time.Time) (bool, error) {
+	if start == "" && end == "" {
+		return true, nil
+	}
+	err := ValidateWindow(start, end)
+	if err != nil {
+		return false, err
+	}
+
+	from, _ := parseWindowTime(start)
+	to, _ := parseWindowTime(end)
+	current := now.Hour()*60 + now.Minute()
+	if from <= to {
+		return current >= from && current < to, nil
+	}
+	return current >= from || current < to, nil
+}
+
+// ResumeRollout continues a halted rollout, the failed devices of the halted batch are retried.
+// It returns an error if the rollout is not halted.
+func ResumeRollout(database *db.DB, rollout *db.Rollout) error {
+	if rollout.Status != db.RolloutHalted {
+		return fmt.Errorf("only halted rollouts can be resumed, the rollout is %s", rollout.Status)
+	}
+
+	for _, d := range rollout.BatchDevices(rollout.Batch) {
+		if d.Status == db.UpgradeFailed {
+			d.Status = db.RolloutDevicePending
+			d.UpgradeId = ""
+			d.Upgrade = nil
+			d.Error = ""
+		}
+	}
+	rollout.Status = db.RolloutRunning
+	rollout.Error = ""
+	return rollout.Save(database)
+}
+
+// CancelRollout stops a rollout from starting any more upgrades, the upgrades in progress are
+// not interrupted. It returns an error if the rollout is already finished.
+func CancelRollout(database *db.DB, rollout *db.Rollout) error {
+	if rollout.Status == db.RolloutCompleted || rollout.Status == db.RolloutCancelled {
+		return fmt.Errorf("the rollout is already %s", rollout.Status)
+	}
+
+	now := time.Now()
+	rollout.Status = db.RolloutCancelled
+	rollout.FinishedAt = &now
+	return rollout.Save(database)
+}
+
+// startBatchDevices starts the upgrades of the pending devices of the batch, the devices that
+// became up to date or were trashed since the rollout was planned are skipped.
+func startBatchDevices(starter upgradeStarter, rollout *db.Rollout, devices []*db.RolloutDevice, logger *zap.Logger) {
+	for _, d := range devices {
+		if d.Status != db.RolloutDevicePending {
+			continue
+		}
+		if d.Device == nil || d.Device.Trashed() || !NeedsUpgrade(d.Device, rollout.Firmware) {
+			d.Status = db.RolloutDeviceSkipped
+			continue
+		}
+
+		logger.Info("rollout upgrade", zap.String("rollout", rollout.Id), zap.Int("batch", rollout.Batch), zap.String("device", d.Device.Address))
+		upgrade, err := starter.Start(d.Device, rollout.Firmware)
+		if err != nil {
+			d.Status = db.UpgradeFailed
+			d.Error = err.Error()
+			continue
+		}
+		d.UpgradeId = upgrade.Id
+		d.Upgrade = upgrade
+		d.Status = upgrade.Status
+	}
+}
+
+// advanceRollout moves the rollout forward: it starts the rollout once its start time has come,
+// follows the upgrades of the current batch, halts the rollout if any of them fails and starts
+// the next batch once the current one is finished, the pause is over and the time is within the
+// maintenance window. The rollout is completed after the last batch.
+func advanceRollout(database *db.DB, starter upgradeStarter, rollout *db.Rollout, now time.Time, logger *zap.Logger) error {
+	if rollout.Status == db.RolloutScheduled {
+		if now.Before(rollout.StartAt) {
+			return nil
+		}
+		logger.Info("starting rollout", zap.String("rollout", rollout.Id))
+		rollout.Status = db.RolloutRunning
+	}
+
+	for {
+		var (
+			pending  int
+			running  int
+			upgraded int
+			failed   []string
+			batch    = rollout.BatchDevices(rollout.Batch)
+		)
+
+		for _, d := range batch {
+			if d.Upgrade != nil {
+				d.Status = d.Upgrade.Status
+				d.Error = d.Upgrade.Error
+				upgraded++
+				// the pending upgrades are already started
+				if !d.Upgrade.Finished() {
+					running++
+					continue
+				}
+			}
+			switch d.Status {
+			case db.RolloutDevicePending:
+				pending++
+			case db.RolloutDeviceSkipped, db.UpgradeSucceeded:
+			case db.UpgradeFailed:
+				name := d.DeviceId
+				if d.Device != nil {
+					name = d.Device.Address
+				}
+				failed = append(failed, name)
+			default:
+				running++
+			}
+		}
+
+		if len(failed) > 0 {
+			logger.Warn("rollout halted", zap.String("rollout", rollout.Id), zap.Strings("failed", failed))
+			rollout.Status = db.RolloutHalted
+			rollout.Error = fmt.Sprintf("batch %d: upgrade failed on %s", rollout.Batch+1, strings.Join(failed, ", "))
+			break
+		}
+		if running > 0 {
+			break
+		}
+
+		if pending > 0 {
+			inWindow, err := InMaintenanceWindow(rollout.WindowStart, rollout.WindowEnd, now)
+			if err != nil {
+				return err
+			}
+			if !inWindow {
+				break
+			}
+			// no upgrades are started once the rollout was cancelled meanwhile
+			changed, err := rollout.Changed(database)
+			if err != nil {
+				return err
+			}
+			if changed {
+				return db.ErrRolloutChanged
+			}
+			startBatchDevices(starter, rollout, batch, logger)
+			continue
+		}
+
+		// the batch is finished
+		if rollout.Batch+1 >= rollout.Batches() {
+			logger.Info("rollout completed", zap.String("rollout", rollout.Id))
+			rollout.Status = db.RolloutCompleted
+			rollout.FinishedAt = &now
+			break
+		}
+		if rollout.BatchFinishedAt == nil {
+			rollout.BatchFinishedAt = &now
+		}
+		// there is nothing to watch after a batch of skipped devices
+		if upgraded > 0 && now.Before(rollout.BatchFinishedAt.Add(rollout.BatchPause)) {
+			break
+		}
+		rollout.Batch++
+		rollout.BatchFinishedAt = nil
+	}
+
+	return rollout.Save(database)
+}
+
+// AdvanceRollouts moves all the active rollouts forward. The errors of the individual rollouts
+// are logged and don't stop the others. It returns an error if the rollouts can not be fetched.
+func AdvanceRollouts(database *db.DB, upgrader *Upgrader, logger *zap.Logger) error {
+	var rollout = &db.Rollout{}
+
+	rollouts, err := rollout.GetActive(database)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rollouts {
+		err = advanceRollout(database, upgrader, r, time.Now(), logger)
+		if errors.Is(err, db.ErrRolloutChanged) {
+			logger.Info("rollout changed meanwhile, skipping", zap.String("rollout", r.Id))
+			continue
+		}
+		if err != nil {
+			logger.Error("rollout", zap.String("rollout", r.Id), zap.Error(err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeStarter records the started upgrades without talking to the devices.
+type fakeStarter struct {
+	database *db.DB
+	started  []string
+	err      error
+}
+
+func (f *fakeStarter) Start(device *db.Device, firmware bool) (*db.DeviceUpgrade, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.started = append(f.started, device.Address)
+	upgrade := &db.DeviceUpgrade{DeviceId: device.Id, Status: db.UpgradePending}
+	return upgrade, upgrade.Create(f.database)
+}
+
+// finishUpgrades sets the status of all the unfinished upgrades.
+func finishUpgrades(t *testing.T, database *db.DB, status string) {
+	err := database.DB.Model(&db.DeviceUpgrade{}).Where("status = ?", db.UpgradePending).Update("status", status).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testRollout(t *testing.T, count int, canary int, batchSize int) (*db.DB, *db.Rollout) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group := &db.DeviceGroup{Name: "core"}
+	for i := range count {
+		group.Devices = append(group.Devices, &db.Device{
+			Address:          fmt.Sprintf("10.0.0.%d", i+1),
+			InstalledVersion: "7.14",
+			LatestVersion:    "7.15",
+		})
+	}
+	err = group.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rollout, err := NewRollout(group, false, canary, batchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rollout.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return database, rollout
+}
+
+// reloadRollout fetches the rollout the way the scheduled job does.
+func reloadRollout(t *testing.T, database *db.DB, rollout *db.Rollout) *db.Rollout {
+	fetched := &db.Rollout{}
+	fetched.Id = rollout.Id
+	err := fetched.GetById(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fetched
+}
+
+func TestPlanRollout(t *testing.T) {
+	var devices []*db.Device
+	for i := range 6 {
+		devices = append(devices, &db.Device{Address: fmt.Sprintf("10.0.0.%d", i), InstalledVersion: "7.14", LatestVersion: "7.15"})
+	}
+	devices = append(devices, &db.Device{Address: "10.0.0.10", InstalledVersion: "7.15", LatestVersion: "7.15"})
+
+	batches, err := PlanRollout(devices, false, 1, 2)
+	assert.NoError(t, err)
+	assert.Len(t, batches, 4)
+	assert.Len(t, batches[0], 1)
+	assert.Len(t, batches[1], 2)
+	assert.Len(t, batches[3], 1)
+
+	batches, err = PlanRollout(devices, false, 0, 4)
+	assert.NoError(t, err)
+	assert.Len(t, batches, 2)
+
+	// the up to date device needs a firmware upgrade
+	devices[6].CurrentFirmware = "7.14"
+	devices[6].UpgradeFirmware = "7.15"
+	batches, err = PlanRollout(devices, true, 10, 1)
+	assert.NoError(t, err)
+	assert.Len(t, batches, 1)
+	assert.Len(t, batches[0], 7)
+
+	_, err = PlanRollout(devices, false, 1, 0)
+	assert.Error(t, err)
+	_, err = PlanRollout(devices, false, -1, 1)
+	assert.Error(t, err)
+
+	_, err = NewRollout(&db.DeviceGroup{Name: "empty"}, false, 1, 1)
+	assert.Error(t, err)
+}
+
+func TestInMaintenanceWindow(t *testing.T) {
+	at := func(clock string) time.Time {
+		parsed, err := time.Parse("15:04", clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Date(2024, 1, 1, parsed.Hour(), parsed.Minute(), 0, 0, time.Local)
+	}
+
+	for _, tc := range []struct {
+		start, end, now string
+		expected        bool
+	}{
+		{"", "", "12:00", true},
+		{"01:00", "05:00", "03:00", true},
+		{"01:00", "05:00", "05:00", false},
+		{"01:00", "05:00", "00:59", false},
+		// the window spans midnight
+		{"22:00", "04:00", "23:30", true},
+		{"22:00", "04:00", "02:00", true},
+		{"22:00", "04:00", "12:00", false},
+	} {
+		inWindow, err := InMaintenanceWindow(tc.start, tc.end, at(tc.now))
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, inWindow, "%s-%s at %s", tc.start, tc.end, tc.now)
+	}
+
+	assert.Error(t, ValidateWindow("01:00", ""))
+	assert.Error(t, ValidateWindow("25:00", "01:00"))
+	assert.NoError(t, ValidateWindow("", ""))
+}
+
+func TestAdvanceRollout(t *testing.T) {
+	database, rollout := testRollout(t, 5, 1, 2)
+	starter := &fakeStarter{database: database}
+	logger := zap.NewNop()
+	now := time.Now()
+
+	rollout.StartAt = now.Add(time.Hour)
+	rollout.BatchPause = 10 * time.Minute
+	err := rollout.Save(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// not started yet
+	err = advanceRollout(database, starter, reloadRollout(t, database, rollout), now, logger)
+	assert.NoError(t, err)
+	assert.Empty(t, starter.started)
+
+	// the canary batch starts
+	now = now.Add(time.Hour)
+	err = advanceRollout(database, starter, reloadRollout(t, database, rollout), now, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1"}, starter.started)
+	fetched := reloadRollout(t, database, rollout)
+	assert.Equal(t, db.RolloutRunning, fetched.Status)
+
+	// nothing changes while the upgrade runs
+	err = advanceRollout(database, starter, fetched, now, logger)
+	assert.NoError(t, err)
+	assert.Len(t, starter.started, 1)
+
+	// the next batch waits for the pause
+	finishUpgrades(t, database, db.UpgradeSucceeded)
+	err = advanceRollout(database, starter, reloadRollout(t, database, rollout), now, logger)
+	assert.NoError(t, err)
+	assert.Len(t, starter.started, 1)
+
+	now = now.Add(11 * time.Minute)
+	err = advanceRollout(database, starter, reloadRollout(t, database, rollout), now, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, starter.started)
+	assert.Equal(t, 1, reloadRollout(t, database, rollout).Batch)
+
+	// a failure halts the rollout
+	finishUpgrades(t, database, db.UpgradeFailed)
+	err = advanceRollout(database, starter, reloadRollout(t, database, rollout), now, logger)
+	assert.NoError(t, err)
+	fetched = reloadRollout(t, database, rollout)
+	assert.Equal(t, db.RolloutHalted, fetched.Status)
+	assert.Contains(t, fetched.Error, "10.0.0.2")
+
+	// resuming retries the failed devices
+	err = ResumeRollout(database, fetched)
+	assert.NoError(t, err)
+	err = advanceRollout(database, starter, reloadRollout(t, database, rollout), now, logger)
+	assert.NoError(t, err)
+	assert.Len(t, starter.started, 5)
+
+	// the last batch starts after the pause and completes the rollout
+	finishUpgrades(t, database, db.UpgradeSucceeded)
+	now = now.Add(time.Minute)
+	err = advanceRollout(database, starter, reloadRollout(t, database, rollout), now, logger)
+	assert.NoError(t, err)
+	now = now.Add(11 * time.Minute)
+	err = advanceRollout(database, starter, reloadRollout(t, database, rollout), now, logger)
+	assert.NoError(t, err)
+	assert.Len(t, starter.started, 7)
+	finishUpgrades(t, database, db.UpgradeSucceeded)
+	err = advanceRollout(database, starter, reloadRollout(t, database, rollout), now, logger)
+	assert.NoError(t, err)
+	fetched = reloadRollout(t, database, rollout)
+	assert.Equal(t, db.RolloutCompleted, fetched.Status)
+	assert.NotNil(t, fetched.FinishedAt)
+
+	err = ResumeRollout(database, fetched)
+	assert.Error(t, err)
+	err = CancelRollout(database, fetched)
+	assert.Error(t, err)
+}
+
+func TestAdvanceRolloutWindowAndSkips(t *testing.T) {
+	database, rollout := testRollout(t, 2, 0, 1)
+	starter := &fakeStarter{database: database}
+	logger := zap.NewNop()
+	noon := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+
+	rollout.WindowStart = "01:00"
+	rollout.WindowEnd = "05:00"
+	err := rollout.Save(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// outside of the maintenance window
+	err = advanceRollout(database, starter, reloadRollout(t, database, rollout), noon, logger)
+	assert.NoError(t, err)
+	assert.Empty(t, starter.started)
+	assert.Equal(t, db.RolloutRunning, reloadRollout(t, database, rollout).Status)
+
+	// the devices were upgraded in the meantime, the batches are skipped without a pause
+	err = database.DB.Model(&db.Device{}).Where("1 = 1").Update("installed_version", "7.15").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = advanceRollout(database, starter, reloadRollout(t, database, rollout), noon.Add(14*time.Hour), logger)
+	assert.NoError(t, err)
+	assert.Empty(t, starter.started)
+	fetched := reloadRollout(t, database, rollout)
+	assert.Equal(t, db.RolloutCompleted, fetched.Status)
+	for _, d := range fetched.Devices {
+		assert.Equal(t, db.RolloutDeviceSkipped, d.Status)
+	}
+}
+
+func TestAdvanceRolloutStartFailure(t *testing.T) {
+	database, rollout := testRollout(t, 2, 1, 1)
+	starter := &fakeStarter{database: database, err: errors.New("an upgrade of the device is already running")}
+
+	err := advanceRollout(database, starter, reloadRollout(t, database, rollout), time.Now(), zap.NewNop())
+	assert.NoError(t, err)
+	fetched := reloadRollout(t, database, rollout)
+	assert.Equal(t, db.RolloutHalted, fetched.Status)
+	assert.Equal(t, starter.err.Error(), fetched.Devices[0].Error)
+
+	err = CancelRollout(database, fetched)
+	assert.NoError(t, err)
+	assert.Equal(t, db.RolloutCancelled, reloadRollout(t, database, rollout).Status)
+}
+
+func TestAdvanceRolloutCancelledMeanwhile(t *testing.T) {
+	database, rollout := testRollout(t, 2, 0, 1)
+	starter := &fakeStarter{database: database}
+	logger := zap.NewNop()
+
+	// the rollout is cancelled after the job fetched it
+	advanced := reloadRollout(t, database, rollout)
+	err := CancelRollout(database, reloadRollout(t, database, rollout))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = advanceRollout(database, starter, advanced, time.Now(), logger)
+	assert.ErrorIs(t, err, db.ErrRolloutChanged)
+	assert.Empty(t, starter.started)
+	assert.Equal(t, db.RolloutCancelled, reloadRollout(t, database, rollout).Status)
+}
+
+func TestAdvanceRolloutSkipsTrashed(t *testing.T) {
+	database, rollout := testRollout(t, 2, 0, 2)
+	starter := &fakeStarter{database: database}
+
+	trashed := reloadRollout(t, database, rollout).Devices[0].Device
+	err := trashed.Trash(database, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = advanceRollout(database, starter, reloadRollout(t, database, rollout), time.Now(), zap.NewNop())
+	assert.NoError(t, err)
+	assert.Len(t, starter.started, 1)
+	assert.NotEqual(t, trashed.Address, starter.started[0])
+	for _, d := range reloadRollout(t, database, rollout).Devices {
+		if d.DeviceId == trashed.Id {
+			assert.Equal(t, db.RolloutDeviceSkipped, d.Status)
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package internal
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/go-routeros/routeros/v3"
 	"github.com/go-routeros/routeros/v3/proto"
@@ -16,7 +20,13 @@ type Api struct {
 	Password string
 	UseTLS   bool
 	Async    bool
-	Logger   *zap.Logger
+	// Timeout limits every request including the connection and the login, the requests are
+	// not limited if zero
+	Timeout time.Duration
+	// Pool keeps the connections for the following requests, every request opens a new
+	// connection if nil
+	Pool   *ApiPool
+	Logger *zap.Logger
 }
 
 func (api *Api) getEndpoint() string {
@@ -27,29 +37,108 @@ func (api *Api) getEndpoint() string {
 	}
 }
 
-func (api *Api) dial() (*routeros.Client, error) {
-	endpoint := api.getEndpoint()
+// dial connects and logs in to the device, the connection is closed if the context is done before
+// the login completes as the client does not cancel the login itself.
+func (api *Api) dial(ctx context.Context) (*routeros.Client, error) {
+	var (
+		conn     net.Conn
+		err      error
+		endpoint = api.getEndpoint()
+	)
+
 	if api.UseTLS {
-		return routeros.DialTLS(endpoint, api.Username, api.Password, nil)
+		conn, err = (&tls.Dialer{}).DialContext(ctx, "tcp", endpoint)
 	} else {
-		return routeros.Dial(endpoint, api.Username, api.Password)
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", endpoint)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to router os: %w", err)
 	}
-}
 
-func (api *Api) Run(command string) ([]*proto.Sentence, error) {
-	client, err := api.dial()
+	stop := context.AfterFunc(ctx, func() {
+		// We don't need to check the error here
+		//nolint:errcheck
+		conn.Close()
+	})
+	client, err := routeros.NewClient(conn)
+	if err == nil {
+		err = client.LoginContext(ctx, api.Username, api.Password)
+	}
+	if !stop() {
+		return nil, fmt.Errorf("could not login: %w", ctx.Err())
+	}
 	if err != nil {
-		return []*proto.Sentence{}, err
+		// We don't need to check the error here
+		//nolint:errcheck
+		conn.Close()
+		return nil, fmt.Errorf("could not login: %w", err)
 	}
-	// We don't need to check the error here
-	//nolint:errcheck
-	defer client.Close()
+	return client, nil
+}
 
+// IsUnknownCommand returns true if the device refused the command because its menu does not
+// exist, e.g. the wireless package is not installed.
+func IsUnknownCommand(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "no such command")
+}
+
+// connect opens a new logged in connection to the device.
+func (api *Api) connect(ctx context.Context) (*routeros.Client, error) {
+	client, err := api.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
 	if api.Async {
 		client.Async()
 	}
+	return client, nil
+}
+
+// Run sends the command to the device, the connection is taken from the pool if there is an idle
+// one and returned to it unless the request fails on the network level or times out, the device
+// errors leave the connection usable. A failing idle connection is replaced with a new one once,
+// e.g. when the device was rebooted since the last request.
+func (api *Api) Run(command string) ([]*proto.Sentence, error) {
+	return api.RunContext(context.Background(), command)
+}
+
+// RunContext is Run cancelled along with the context, the request timeout applies within the
+// context deadline.
+func (api *Api) RunContext(ctx context.Context, command string) ([]*proto.Sentence, error) {
+	ctx, cancel := WithTimeout(ctx, api.Timeout)
+	defer cancel()
+
+	var (
+		err    error
+		args   = strings.Split(command, " ")
+		client = api.Pool.get(api)
+		reused = client != nil
+	)
+	if !reused {
+		client, err = api.connect(ctx)
+		if err != nil {
+			return []*proto.Sentence{}, err
+		}
+	}
+
+	result, err := client.RunArgsContext(ctx, args)
+	if err != nil && reused && !isDeviceError(err) && ctx.Err() == nil {
+		// We don't need to check the error here
+		//nolint:errcheck
+		client.Close()
+		client, err = api.connect(ctx)
+		if err != nil {
+			return []*proto.Sentence{}, err
+		}
+		result, err = client.RunArgsContext(ctx, args)
+	}
 
-	result, err := client.RunArgs(strings.Split(command, " "))
+	if err == nil || isDeviceError(err) {
+		api.Pool.put(api, client)
+	} else {
+		//nolint:errcheck
+		client.Close()
+	}
 	if err != nil {
 		return []*proto.Sentence{}, err
 	}
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-routeros/routeros/v3"
+)
+
+// maxIdleConnections is the maximum number of idle connections kept per device and user
+const maxIdleConnections = 2
+
+type idleConnection struct {
+	client *routeros.Client
+	since  time.Time
+}
+
+// ApiPool keeps the logged in RouterOS API connections for reuse, so the consecutive requests
+// to a device, e.g. the collectors of a poll, skip the TCP handshake and the login. The
+// connections idle for longer than the idle timeout are closed, the connections are not kept at
+// all if the idle timeout is not positive. The zero value is not usable, see NewApiPool.
+type ApiPool struct {
+	IdleTimeout time.Duration
+
+	mu   sync.Mutex
+	idle map[string][]*idleConnection
+}
+
+// NewApiPool returns an empty pool closing the connections idle for longer than the timeout.
+func NewApiPool(idleTimeout time.Duration) *ApiPool {
+	return &ApiPool{IdleTimeout: idleTimeout, idle: map[string][]*idleConnection{}}
+}
+
+// poolKey identifies the connections which can be reused by the API client, the password is
+// hashed to not keep it in the keys.
+func poolKey(api *Api) string {
+	return fmt.Sprintf("%s|%t|%t|%s|%x", api.getEndpoint(), api.UseTLS, api.Async, api.Username, sha256.Sum256([]byte(api.Password)))
+}
+
+// get takes an idle connection of the API client out of the pool, the expired ones are closed.
+// It returns nil if there is no idle connection or the pool is nil.
+func (p *ApiPool) get(api *Api) *routeros.Client {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := poolKey(api)
+	for len(p.idle[key]) > 0 {
+		last := len(p.idle[key]) - 1
+		conn := p.idle[key][last]
+		p.idle[key] = p.idle[key][:last]
+		if time.Since(conn.since) < p.IdleTimeout {
+			return conn.client
+		}
+		//nolint:errcheck
+		conn.client.Close()
+	}
+	delete(p.idle, key)
+	return nil
+}
+
+// put returns the connection of the API client to the pool, the connection is closed instead if
+// the pool is nil, disabled or already keeps enough idle connections of the client.
+func (p *ApiPool) put(api *Api, client *routeros.Client) {
+	if p == nil || p.IdleTimeout <= 0 {
+		//nolint:errcheck
+		client.Close()
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := poolKey(api)
+	if len(p.idle[key]) >= maxIdleConnections {
+		//nolint:errcheck
+		client.Close()
+		return
+	}
+	p.idle[key] = append(p.idle[key], &idleConnection{client: client, since: time.Now()})
+}
+
+// Prune closes the connections idle for longer than the idle timeout. It returns the number of
+// the closed connections.
+func (p *ApiPool) Prune() int {
+	var closed int
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, conns := range p.idle {
+		var kept []*idleConnection
+		for _, conn := range conns {
+			if time.Since(conn.since) < p.IdleTimeout {
+				kept = append(kept, conn)
+				continue
+			}
+			//nolint:errcheck
+			conn.client.Close()
+			closed++
+		}
+		if len(kept) == 0 {
+			delete(p.idle, key)
+		} else {
+			p.idle[key] = kept
+		}
+	}
+
+	return closed
+}
+
+// Close closes all the idle connections.
+func (p *ApiPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, conns := range p.idle {
+		for _, conn := range conns {
+			//nolint:errcheck
+			conn.client.Close()
+		}
+		delete(p.idle, key)
+	}
+}
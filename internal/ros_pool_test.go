@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRouterOS serves the RouterOS API on a random local port accepting any login, every command
+// but "/fail" and "/hang" replies with a single sentence, "/hang" is never replied to. It returns
+// the listener and the number of the accepted connections.
+func testRouterOS(t *testing.T) (net.Listener, *atomic.Int32) {
+	var accepted = &atomic.Int32{}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() {
+				defer conn.Close()
+				r, w := bufio.NewReader(conn), proto.NewWriter(conn)
+				for {
+					words, err := readTestSentence(r)
+					if err != nil {
+						return
+					}
+					var tag string
+					for _, word := range words {
+						if strings.HasPrefix(word, ".tag=") {
+							tag = strings.TrimPrefix(word, ".tag=")
+						}
+					}
+					reply := func(words ...string) {
+						w.BeginSentence()
+						for _, word := range words {
+							w.WriteWord(word)
+						}
+						if tag != "" {
+							w.WriteWord(".tag=" + tag)
+						}
+						w.EndSentence() //nolint:errcheck
+					}
+					switch words[0] {
+					case "/login":
+					case "/fail":
+						reply("!trap", "=message=no such command")
+					case "/hang":
+						continue
+					default:
+						reply("!re", "=name=router")
+					}
+					reply("!done")
+				}
+			}()
+		}
+	}()
+
+	return listener, accepted
+}
+
+// readTestSentence reads the words of an API sentence, unlike the proto reader it accepts the
+// query words, e.g. "?name=admin".
+func readTestSentence(r *bufio.Reader) ([]string, error) {
+	var words []string
+	for {
+		length, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if length&0x80 != 0 {
+			return nil, errors.New("long words are not supported")
+		}
+		if length == 0 {
+			if len(words) == 0 {
+				return nil, errors.New("empty sentence")
+			}
+			return words, nil
+		}
+		word := make([]byte, length)
+		_, err = io.ReadFull(r, word)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, string(word))
+	}
+}
+
+func testApi(listener net.Listener, pool *ApiPool) *Api {
+	addr := listener.Addr().(*net.TCPAddr)
+	return &Api{Address: addr.IP.String(), Port: strconv.Itoa(addr.Port), Username: "admin", Async: true, Pool: pool, Timeout: 5 * time.Second}
+}
+
+func TestApiRunReusesConnections(t *testing.T) {
+	listener, accepted := testRouterOS(t)
+	pool := NewApiPool(time.Minute)
+	defer pool.Close()
+	api := testApi(listener, pool)
+
+	for range 3 {
+		reply, err := api.Run("/system/identity/print")
+		assert.NoError(t, err)
+		assert.Equal(t, "router", reply[0].Map["name"])
+	}
+	// the device errors leave the connection usable
+	_, err := api.Run("/fail")
+	assert.True(t, IsUnknownCommand(err))
+	_, err = api.Run("/system/identity/print")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), accepted.Load())
+
+	// other credentials get their own connections
+	other := testApi(listener, pool)
+	other.Username = "other"
+	_, err = other.Run("/system/identity/print")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), accepted.Load())
+}
+
+func TestApiRunWithoutPool(t *testing.T) {
+	listener, accepted := testRouterOS(t)
+	api := testApi(listener, nil)
+
+	for range 2 {
+		_, err := api.Run("/system/identity/print")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), accepted.Load())
+
+	disabled := testApi(listener, NewApiPool(-time.Second))
+	for range 2 {
+		_, err := disabled.Run("/system/identity/print")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(4), accepted.Load())
+}
+
+func TestApiPoolIdleTimeout(t *testing.T) {
+	listener, accepted := testRouterOS(t)
+	pool := NewApiPool(50 * time.Millisecond)
+	defer pool.Close()
+	api := testApi(listener, pool)
+
+	_, err := api.Run("/system/identity/print")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, pool.Prune())
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, 1, pool.Prune())
+	_, err = api.Run("/system/identity/print")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), accepted.Load())
+
+	// the expired connections are not reused even if not pruned yet
+	time.Sleep(60 * time.Millisecond)
+	_, err = api.Run("/system/identity/print")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), accepted.Load())
+}
+
+func TestApiRunReplacesBrokenConnection(t *testing.T) {
+	listener, accepted := testRouterOS(t)
+	pool := NewApiPool(time.Minute)
+	defer pool.Close()
+	api := testApi(listener, pool)
+
+	_, err := api.Run("/system/identity/print")
+	assert.NoError(t, err)
+
+	// the idle connection is closed behind the pool's back, e.g. by a device reboot
+	client := pool.get(api)
+	client.Close()
+	pool.put(api, client)
+
+	reply, err := api.Run("/system/identity/print")
+	assert.NoError(t, err)
+	assert.Equal(t, "router", reply[0].Map["name"])
+	assert.Equal(t, int32(2), accepted.Load())
+}
+
+func TestApiRunTimeout(t *testing.T) {
+	listener, _ := testRouterOS(t)
+	pool := NewApiPool(time.Minute)
+	defer pool.Close()
+	api := testApi(listener, pool)
+	api.Timeout = 50 * time.Millisecond
+
+	started := time.Now()
+	_, err := api.Run("/hang")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(started), time.Second)
+
+	// the cancelled requests stop regardless of the client timeout
+	api.Timeout = time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	started = time.Now()
+	_, err = api.RunContext(ctx, "/hang")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(started), time.Second)
+
+	// the timed out connections are not reused
+	_, err = api.Run("/system/identity/print")
+	assert.NoError(t, err)
+}
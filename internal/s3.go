@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/url"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -35,6 +36,12 @@ func s3BasePath(bucketPath string, deviceId string) string {
 	return path.Join(bucketPath, "exports", deviceId)
 }
 
+// s3ArchivePath returns the base path for a device's archived exports in the S3 bucket.
+// The returned path is <bucketPath>/archive/<deviceId>.
+func s3ArchivePath(bucketPath string, deviceId string) string {
+	return path.Join(bucketPath, "archive", deviceId)
+}
+
 // GetS3Session configures the AWS S3 client and returns an error if something fails.
 // If the region is not set, it will be determined from the environment. If the
 // endpoint is not set, AWS will use the default endpoint for the region. If the
@@ -109,6 +116,42 @@ func (b *S3) GetObjects(prefix string) ([]types.Object, error) {
 	return items, err
 }
 
+// GetPrefixes returns the list of "subdirectories" directly under the given prefix in the S3
+// bucket, each returned prefix ends with a slash. It returns an error if the listing fails.
+func (b *S3) GetPrefixes(prefix string) ([]string, error) {
+	var (
+		err      error
+		prefixes = []string{}
+	)
+
+	params := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(b.Bucket),
+		Prefix:    aws.String(strings.TrimSuffix(prefix, "/") + "/"),
+		Delimiter: aws.String("/"),
+	}
+
+	p := s3.NewListObjectsV2Paginator(b.client, params)
+
+	for p.HasMorePages() {
+		page, err := p.NextPage(context.TODO())
+		if err != nil {
+			return prefixes, err
+		}
+
+		for _, commonPrefix := range page.CommonPrefixes {
+			prefixes = append(prefixes, *commonPrefix.Prefix)
+		}
+	}
+
+	return prefixes, err
+}
+
+// GetExportsPrefixes returns the list of per-device export prefixes found in the S3 bucket.
+// It returns an error if the listing fails.
+func (b *S3) GetExportsPrefixes() ([]string, error) {
+	return b.GetPrefixes(s3BasePath(b.BucketPath, ""))
+}
+
 // GetExports returns a list of all exports for a given device ID in the S3
 // bucket. It returns an error if the listing fails.
 func (b *S3) GetExports(deviceId string) ([]*Export, error) {
@@ -286,3 +329,40 @@ func (b *S3) DeleteExports(exports []*Export) error {
 	// Success: All objects were targeted for deletion and no errors were returned by S3.
 	return nil
 }
+
+// CopyFile copies an object within the S3 bucket from the source key to the destination key
+// using the StorageClass specified in the S3 struct. It returns an error if the copy fails.
+func (b *S3) CopyFile(srcKey string, dstKey string) error {
+	source := &url.URL{Path: path.Join(b.Bucket, srcKey)}
+	input := &s3.CopyObjectInput{
+		Bucket:       aws.String(b.Bucket),
+		CopySource:   aws.String(source.EscapedPath()),
+		Key:          aws.String(dstKey),
+		StorageClass: types.StorageClass(b.StorageClass),
+	}
+
+	_, err := b.client.CopyObject(context.TODO(), input)
+
+	return err
+}
+
+// ArchiveExports moves all exports of the given device ID to the archive path of the S3
+// bucket, <bucketPath>/archive/<deviceId>, keeping the original file names. The original
+// objects are deleted only after all of them were copied. It returns the number of archived
+// exports and an error if any of the operations fail.
+func (b *S3) ArchiveExports(deviceId string) (int, error) {
+	exports, err := b.GetExports(deviceId)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, e := range exports {
+		dstKey := path.Join(s3ArchivePath(b.BucketPath, deviceId), path.Base(e.Key))
+		err = b.CopyFile(e.Key, dstKey)
+		if err != nil {
+			return 0, fmt.Errorf("failed to archive %s: %w", e.Key, err)
+		}
+	}
+
+	return len(exports), b.DeleteExports(exports)
+}
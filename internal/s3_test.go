@@ -26,6 +26,25 @@ func TestS3BasePath(t *testing.T) {
 	}
 }
 
+func TestS3ArchivePath(t *testing.T) {
+	tests := []struct {
+		name       string
+		bucketPath string
+		deviceId   string
+		want       string
+	}{
+		{"Empty bucketPath", "", "device-id", "archive/device-id"},
+		{"Both bucketPath and deviceId", "bucket", "device-id", "bucket/archive/device-id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s3ArchivePath(tt.bucketPath, tt.deviceId); got != tt.want {
+				t.Errorf("s3ArchivePath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestGetS3Session(t *testing.T) {
 	tests := []struct {
 		name            string
@@ -0,0 +1,239 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mazay/mikromanager/db"
+)
+
+const (
+	// defaultVaultField is the key read from the Vault secret if the reference doesn't name one
+	defaultVaultField = "password"
+	vaultTimeout      = 10 * time.Second
+)
+
+// SecretProvider resolves a reference to an external secret into its value, Allowed tells if
+// the reference may be read at all so the service's own secrets can't be exfiltrated.
+type SecretProvider interface {
+	Secret(ref string) (string, error)
+	Allowed(ref string) error
+}
+
+// EnvSecrets reads secrets from the environment variables named with the prefix, no variables
+// are read if the prefix is empty.
+type EnvSecrets struct {
+	Prefix string
+}
+
+// FileSecrets reads secrets from the files within the directory, e.g. a Kubernetes secret
+// mount, no files are read if the directory is empty.
+type FileSecrets struct {
+	Dir string
+}
+
+// VaultSecrets reads secrets from the HashiCorp Vault KV secrets engine over its HTTP API.
+type VaultSecrets struct {
+	Address   string
+	Token     string
+	Namespace string
+	Client    *http.Client
+}
+
+// Secrets resolves the passwords of the credentials, either decrypting the ones stored in the
+// database or reading them from the external provider the credentials reference.
+type Secrets struct {
+	EncryptionKey string
+	Providers     map[string]SecretProvider
+}
+
+// Allowed returns an error unless the variable named by ref starts with the prefix.
+func (e *EnvSecrets) Allowed(ref string) error {
+	if e.Prefix == "" {
+		return errors.New("environment secrets are disabled, the variable prefix is not configured")
+	}
+	if !strings.HasPrefix(ref, e.Prefix) {
+		return fmt.Errorf("environment variable %s does not start with %s", ref, e.Prefix)
+	}
+	return nil
+}
+
+// Secret returns the value of the environment variable named by ref. It returns an error if
+// the variable is not allowed or not set.
+func (e *EnvSecrets) Secret(ref string) (string, error) {
+	err := e.Allowed(ref)
+	if err != nil {
+		return "", err
+	}
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+	return value, nil
+}
+
+// resolve returns the path of the file at ref with the symlinks resolved. It returns an error if
+// the file is outside the directory or does not exist.
+func (f *FileSecrets) resolve(ref string) (string, error) {
+	if f.Dir == "" {
+		return "", errors.New("file secrets are disabled, the secrets directory is not configured")
+	}
+	if !filepath.IsAbs(ref) {
+		return "", fmt.Errorf("secret file %s is not an absolute path", ref)
+	}
+	dir, err := filepath.EvalSymlinks(f.Dir)
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.EvalSymlinks(ref)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("secret file %s is outside of %s", ref, f.Dir)
+	}
+	return path, nil
+}
+
+// Allowed returns an error unless the file at ref exists within the directory.
+func (f *FileSecrets) Allowed(ref string) error {
+	_, err := f.resolve(ref)
+	return err
+}
+
+// Secret returns the contents of the file at ref with the trailing newline removed. It returns
+// an error if the file is not allowed or can not be read.
+func (f *FileSecrets) Secret(ref string) (string, error) {
+	path, err := f.resolve(ref)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// Allowed always returns nil, the access to the Vault paths is limited with the token policies.
+func (v *VaultSecrets) Allowed(ref string) error {
+	return nil
+}
+
+// Secret reads the secret at the Vault API path given as "<path>#<field>", e.g.
+// "secret/data/routers#password", the field defaults to "password". Both KV version 1 and 2
+// responses are supported. It returns an error if the request fails or the field is missing.
+func (v *VaultSecrets) Secret(ref string) (string, error) {
+	var payload struct {
+		Data   map[string]any `json:"data"`
+		Errors []string       `json:"errors"`
+	}
+
+	if v.Address == "" {
+		return "", errors.New("vault address is not configured")
+	}
+
+	path, field, _ := strings.Cut(ref, "#")
+	if field == "" {
+		field = defaultVaultField
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(v.Address, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	client := v.Client
+	if client == nil {
+		client = &http.Client{Timeout: vaultTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	// We don't need to check the error here
+	//nolint:errcheck
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	err = json.Unmarshal(body, &payload)
+	if err != nil && resp.StatusCode == http.StatusOK {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s for %s: %s", resp.Status, path, strings.Join(payload.Errors, ", "))
+	}
+
+	data := payload.Data
+	// KV version 2 nests the secret data along with its metadata
+	if nested, ok := data["data"].(map[string]any); ok {
+		data = nested
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no %s field", path, field)
+	}
+	return value, nil
+}
+
+// NewSecrets returns the secrets resolver with the given providers, the environment and file
+// providers are added if set and the Vault provider if its address is set.
+func NewSecrets(encryptionKey string, env *EnvSecrets, files *FileSecrets, vault *VaultSecrets) *Secrets {
+	secrets := &Secrets{
+		EncryptionKey: encryptionKey,
+		Providers:     map[string]SecretProvider{},
+	}
+	if env != nil {
+		secrets.Providers[db.SecretSourceEnv] = env
+	}
+	if files != nil {
+		secrets.Providers[db.SecretSourceFile] = files
+	}
+	if vault != nil && vault.Address != "" {
+		secrets.Providers[db.SecretSourceVault] = vault
+	}
+	return secrets
+}
+
+// Password returns the password of the credentials, resolved at the time of the call so the
+// changes of the external secrets are picked up without a restart. It returns an error if the
+// password can not be decrypted or the external secret can not be read.
+func (s *Secrets) Password(creds *db.Credentials) (string, error) {
+	if !creds.IsExternal() {
+		return db.DecryptString(creds.EncryptedPassword, s.EncryptionKey)
+	}
+
+	err := s.CheckRef(creds.SecretSource, creds.SecretRef)
+	if err != nil {
+		return "", err
+	}
+	return s.Providers[creds.SecretSource].Secret(creds.SecretRef)
+}
+
+// CheckRef returns an error if the source is not configured or the reference is empty or not
+// allowed by the source.
+func (s *Secrets) CheckRef(source string, ref string) error {
+	provider, ok := s.Providers[source]
+	if !ok {
+		return fmt.Errorf("secret source %s is not configured", source)
+	}
+	if ref == "" {
+		return errors.New("secret reference is empty")
+	}
+	return provider.Allowed(ref)
+}
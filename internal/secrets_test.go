@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvSecrets(t *testing.T) {
+	t.Setenv("MIKROMANAGER_TEST_PASSWORD", "env-password")
+
+	t.Setenv("VAULT_TOKEN", "service-token")
+
+	provider := &EnvSecrets{Prefix: "MIKROMANAGER_TEST_"}
+	value, err := provider.Secret("MIKROMANAGER_TEST_PASSWORD")
+	assert.NoError(t, err)
+	assert.Equal(t, "env-password", value)
+
+	_, err = provider.Secret("MIKROMANAGER_TEST_UNSET")
+	assert.Error(t, err)
+
+	// the service's own variables can't be read
+	assert.Error(t, provider.Allowed("VAULT_TOKEN"))
+	_, err = provider.Secret("VAULT_TOKEN")
+	assert.Error(t, err)
+
+	// no variables are read without the prefix
+	_, err = (&EnvSecrets{}).Secret("MIKROMANAGER_TEST_PASSWORD")
+	assert.Error(t, err)
+}
+
+func TestFileSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	err := os.WriteFile(path, []byte("file-password\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &FileSecrets{Dir: filepath.Dir(path)}
+	value, err := provider.Secret(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "file-password", value)
+	assert.NoError(t, provider.Allowed(path))
+
+	_, err = provider.Secret(filepath.Join(provider.Dir, "missing"))
+	assert.Error(t, err)
+
+	// the files outside of the directory can't be read, including through the symlinks
+	outside := filepath.Join(t.TempDir(), "config.yml")
+	err = os.WriteFile(outside, []byte("encryptionKey: secret\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(outside, filepath.Join(provider.Dir, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{outside, filepath.Join(provider.Dir, "..", filepath.Base(filepath.Dir(outside)), "config.yml"), filepath.Join(provider.Dir, "link"), "password"} {
+		_, err = provider.Secret(ref)
+		assert.Error(t, err, ref)
+	}
+
+	// no files are read without the directory
+	_, err = (&FileSecrets{}).Secret(path)
+	assert.Error(t, err)
+}
+
+func TestVaultSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			//nolint:errcheck
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/routers":
+			//nolint:errcheck
+			w.Write([]byte(`{"data":{"data":{"password":"kv2-password","admin":"kv2-admin"},"metadata":{"version":1}}}`))
+		case "/v1/kv/routers":
+			//nolint:errcheck
+			w.Write([]byte(`{"data":{"password":"kv1-password"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			//nolint:errcheck
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	provider := &VaultSecrets{Address: server.URL, Token: "token"}
+
+	value, err := provider.Secret("secret/data/routers")
+	assert.NoError(t, err)
+	assert.Equal(t, "kv2-password", value)
+
+	value, err = provider.Secret("secret/data/routers#admin")
+	assert.NoError(t, err)
+	assert.Equal(t, "kv2-admin", value)
+
+	value, err = provider.Secret("/kv/routers")
+	assert.NoError(t, err)
+	assert.Equal(t, "kv1-password", value)
+
+	_, err = provider.Secret("secret/data/routers#missing")
+	assert.Error(t, err)
+
+	_, err = provider.Secret("secret/data/unknown")
+	assert.Error(t, err)
+
+	provider.Token = "wrong"
+	_, err = provider.Secret("secret/data/routers")
+	assert.ErrorContains(t, err, "permission denied")
+}
+
+func TestSecretsPassword(t *testing.T) {
+	t.Setenv("MIKROMANAGER_TEST_PASSWORD", "env-password")
+	secrets := NewSecrets(testEncryptionKey, &EnvSecrets{Prefix: "MIKROMANAGER_TEST_"}, nil, nil)
+
+	stored := testCredentialsChain(t, "admin")[0]
+	password, err := secrets.Password(stored)
+	assert.NoError(t, err)
+	assert.Equal(t, "admin-password", password)
+
+	external := &db.Credentials{SecretSource: db.SecretSourceEnv, SecretRef: "MIKROMANAGER_TEST_PASSWORD"}
+	password, err = secrets.Password(external)
+	assert.NoError(t, err)
+	assert.Equal(t, "env-password", password)
+
+	// Vault is not configured
+	_, err = secrets.Password(&db.Credentials{SecretSource: db.SecretSourceVault, SecretRef: "secret/data/routers"})
+	assert.Error(t, err)
+
+	// files are not configured
+	_, err = secrets.Password(&db.Credentials{SecretSource: db.SecretSourceFile, SecretRef: "/etc/passwd"})
+	assert.Error(t, err)
+
+	_, err = secrets.Password(&db.Credentials{SecretSource: db.SecretSourceEnv})
+	assert.Error(t, err)
+
+	assert.NoError(t, secrets.CheckRef(db.SecretSourceEnv, "MIKROMANAGER_TEST_PASSWORD"))
+	assert.Error(t, secrets.CheckRef(db.SecretSourceEnv, "AWS_SECRET_ACCESS_KEY"))
+}
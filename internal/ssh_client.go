@@ -2,7 +2,10 @@ package internal
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"net"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -12,7 +15,10 @@ type SshClient struct {
 	Port     string
 	User     string
 	Password string
-	cfg      *ssh.ClientConfig
+	// Timeout limits every command including the connection and the login, the commands are
+	// not limited if zero
+	Timeout time.Duration
+	cfg     *ssh.ClientConfig
 }
 
 func (cli *SshClient) init() {
@@ -35,25 +41,50 @@ func (cli *SshClient) init() {
 }
 
 func (cli *SshClient) Run(command string) ([]byte, error) {
-	var conn *ssh.Client
-	var err error
-	var result []byte
-	var session *ssh.Session
-	var buff bytes.Buffer
+	return cli.RunContext(context.Background(), command)
+}
+
+// RunContext runs the command on the device and returns its output, the connection is closed
+// once the context is done or the timeout is over, interrupting the command.
+func (cli *SshClient) RunContext(ctx context.Context, command string) ([]byte, error) {
+	var (
+		err     error
+		result  []byte
+		session *ssh.Session
+		buff    bytes.Buffer
+		dialer  net.Dialer
+	)
 
 	cli.init()
+	ctx, cancel := WithTimeout(ctx, cli.Timeout)
+	defer cancel()
 
-	conn, err = ssh.Dial("tcp", fmt.Sprintf("%s:%s", cli.Host, cli.Port), cli.cfg)
+	addr := fmt.Sprintf("%s:%s", cli.Host, cli.Port)
+	netConn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return result, err
 	}
+	// the handshake and the command are interrupted by closing the connection
+	stop := context.AfterFunc(ctx, func() {
+		//nolint:errcheck
+		netConn.Close()
+	})
+	defer stop()
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, addr, cli.cfg)
+	if err != nil {
+		//nolint:errcheck
+		netConn.Close()
+		return result, cli.contextError(ctx, err)
+	}
+	conn := ssh.NewClient(sshConn, chans, reqs)
 	// We don't need to check the error here
 	//nolint:errcheck
 	defer conn.Close()
 
 	session, err = conn.NewSession()
 	if err != nil {
-		return result, err
+		return result, cli.contextError(ctx, err)
 	}
 	// We don't need to check the error here
 	//nolint:errcheck
@@ -61,7 +92,16 @@ func (cli *SshClient) Run(command string) ([]byte, error) {
 
 	session.Stdout = &buff
 	if err := session.Run(command); err != nil {
-		return result, err
+		return result, cli.contextError(ctx, err)
 	}
 	return buff.Bytes(), err
 }
+
+// contextError returns the context error if the context is done, the connection errors caused
+// by closing it are meaningless otherwise.
+func (cli *SshClient) contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s: %w", cli.Host, ctx.Err())
+	}
+	return err
+}
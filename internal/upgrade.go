@@ -0,0 +1,367 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-routeros/routeros/v3"
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/mazay/mikromanager/db"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRebootTimeout = 10 * time.Minute
+	defaultUpgradePoll   = 15 * time.Second
+)
+
+var (
+	ErrUpgradeRunning = errors.New("an upgrade of the device is already running")
+	upgradesMutex     sync.Mutex
+	upgradesRunning   = map[string]bool{}
+)
+
+// Upgrader runs the RouterOS packages and RouterBOARD firmware upgrades of the devices, recording
+// the progress of every upgrade in the database.
+type Upgrader struct {
+	Db      *db.DB
+	S3      *S3
+	Secrets *Secrets
+	Logger  *zap.Logger
+	// RebootTimeout is the time the device has to come back after the upgrade reboot
+	RebootTimeout time.Duration
+	// PollInterval is the interval between the checks of the rebooting device
+	PollInterval time.Duration
+	// Timeouts limits every device request, the checks of the rebooting device included
+	Timeouts DeviceTimeouts
+
+	// run and export talk to the device, those are replaced in tests
+	run    func(device *db.Device, command string) ([]*proto.Sentence, error)
+	export func(device *db.Device) (*db.Export, error)
+}
+
+// NewUpgrader returns an upgrader talking to the devices with their credentials chains and
+// storing the pre-upgrade exports in the S3 bucket.
+func NewUpgrader(database *db.DB, s3 *S3, secrets *Secrets, rebootTimeout time.Duration, logger *zap.Logger) *Upgrader {
+	u := &Upgrader{
+		Db:            database,
+		S3:            s3,
+		Secrets:       secrets,
+		Logger:        logger,
+		RebootTimeout: rebootTimeout,
+		PollInterval:  defaultUpgradePoll,
+	}
+	if u.RebootTimeout == 0 {
+		u.RebootTimeout = defaultRebootTimeout
+	}
+	u.run = func(device *db.Device, command string) ([]*proto.Sentence, error) {
+		ctx, cancel := WithTimeout(context.Background(), u.Timeouts.Api)
+		defer cancel()
+		return runWithCredentials(ctx, device, u.Db, u.Secrets, nil, command)
+	}
+	u.export = u.backup
+	return u
+}
+
+// UpgradeRunning returns true if an upgrade of the device with the given ID is in progress.
+func UpgradeRunning(deviceId string) bool {
+	upgradesMutex.Lock()
+	defer upgradesMutex.Unlock()
+	return upgradesRunning[deviceId]
+}
+
+// parseUptime converts the RouterOS uptime, e.g. "1w2d3h4m5s", to a duration.
+func parseUptime(uptime string) (time.Duration, error) {
+	var (
+		total  time.Duration
+		digits string
+		units  = map[rune]time.Duration{
+			'w': 7 * 24 * time.Hour,
+			'd': 24 * time.Hour,
+			'h': time.Hour,
+			'm': time.Minute,
+			's': time.Second,
+		}
+	)
+
+	for _, r := range uptime {
+		if r >= '0' && r <= '9' {
+			digits += string(r)
+			continue
+		}
+		unit, ok := units[r]
+		if !ok || digits == "" {
+			return 0, fmt.Errorf("invalid uptime %q", uptime)
+		}
+		value, err := strconv.Atoi(digits)
+		if err != nil {
+			return 0, err
+		}
+		total += time.Duration(value) * unit
+		digits = ""
+	}
+	if digits != "" || uptime == "" {
+		return 0, fmt.Errorf("invalid uptime %q", uptime)
+	}
+
+	return total, nil
+}
+
+// isDeviceError returns true if the device refused the command, other errors are expected while
+// the device is going down for a reboot.
+func isDeviceError(err error) bool {
+	var deviceErr *routeros.DeviceError
+	return errors.As(err, &deviceErr) || IsAuthError(err)
+}
+
+// backup creates an export of the device over SSH and stores it.
+func (u *Upgrader) backup(device *db.Device) (*db.Export, error) {
+	ctx, cancel := WithTimeout(context.Background(), u.Timeouts.Ssh)
+	defer cancel()
+	body, err := sshWithCredentials(ctx, device, u.Db, u.Secrets, "/export show-sensitive")
+	if err != nil {
+		return nil, err
+	}
+	export, err := SaveExport(u.Db, u.S3, device.Id, body)
+	if errors.Is(err, ErrExportNotIndexed) {
+		// the export is stored, the upgrade goes on
+		u.Logger.Warn(err.Error(), zap.String("device", device.Id))
+		return export, nil
+	}
+	return export, err
+}
+
+// setStatus stores the new status of the upgrade.
+func (u *Upgrader) setStatus(upgrade *db.DeviceUpgrade, status string) error {
+	u.Logger.Info("device upgrade", zap.String("device", upgrade.DeviceId), zap.String("status", status))
+	upgrade.Status = status
+	return upgrade.Save(u.Db)
+}
+
+// readValue runs the print command and returns the value of the key from its first reply.
+func (u *Upgrader) readValue(device *db.Device, command string, key string) (string, error) {
+	reply, err := u.run(device, command)
+	if err != nil {
+		return "", err
+	}
+	if len(reply) == 0 {
+		return "", fmt.Errorf("got an empty reply to %s", command)
+	}
+	return reply[0].Map[key], nil
+}
+
+// waitForReboot waits until the device responds with an uptime shorter than the time passed
+// since the reboot was requested.
+func (u *Upgrader) waitForReboot(device *db.Device, requested time.Time) error {
+	deadline := requested.Add(u.RebootTimeout)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(u.PollInterval)
+
+		value, err := u.readValue(device, "/system/resource/print", "uptime")
+		if err != nil {
+			u.Logger.Debug("waiting for the device", zap.String("device", device.Address), zap.Error(err))
+			continue
+		}
+		uptime, err := parseUptime(value)
+		if err != nil {
+			return err
+		}
+		if uptime < time.Since(requested) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("the device did not come back within %s", u.RebootTimeout)
+}
+
+// upgradePackages installs the available RouterOS update and verifies the installed version
+// after the reboot, nothing is done if the device is up to date.
+func (u *Upgrader) upgradePackages(device *db.Device, upgrade *db.DeviceUpgrade) error {
+	_, err := u.run(device, "/system/package/update/check-for-updates ?once")
+	if err != nil {
+		return err
+	}
+	reply, err := u.run(device, "/system/package/update/getall")
+	if err != nil {
+		return err
+	}
+	if len(reply) == 0 {
+		return errors.New("got an empty package update data")
+	}
+	upgrade.FromVersion = reply[0].Map["installed-version"]
+	upgrade.ToVersion = reply[0].Map["latest-version"]
+	if upgrade.ToVersion == "" || upgrade.ToVersion == upgrade.FromVersion {
+		upgrade.ToVersion = upgrade.FromVersion
+		return nil
+	}
+
+	err = u.setStatus(upgrade, db.UpgradeInstalling)
+	if err != nil {
+		return err
+	}
+	requested := time.Now()
+	// the device reboots once the packages are downloaded, the connection may be dropped
+	_, err = u.run(device, "/system/package/update/install")
+	if err != nil && isDeviceError(err) {
+		return fmt.Errorf("install failed: %w", err)
+	}
+
+	err = u.setStatus(upgrade, db.UpgradeRebooting)
+	if err != nil {
+		return err
+	}
+	err = u.waitForReboot(device, requested)
+	if err != nil {
+		return err
+	}
+
+	err = u.setStatus(upgrade, db.UpgradeVerifying)
+	if err != nil {
+		return err
+	}
+	installed, err := u.readValue(device, "/system/package/update/getall", "installed-version")
+	if err != nil {
+		return err
+	}
+	if installed != upgrade.ToVersion {
+		return fmt.Errorf("installed version is %s, expected %s", installed, upgrade.ToVersion)
+	}
+
+	return nil
+}
+
+// upgradeFirmware upgrades the RouterBOARD firmware to the version shipped with the installed
+// packages and reboots the device to apply it, nothing is done if the firmware is up to date.
+func (u *Upgrader) upgradeFirmware(device *db.Device, upgrade *db.DeviceUpgrade) error {
+	err := u.setStatus(upgrade, db.UpgradeFirmware)
+	if err != nil {
+		return err
+	}
+
+	reply, err := u.run(device, "/system/routerboard/print")
+	if err != nil {
+		return err
+	}
+	if len(reply) == 0 {
+		return errors.New("got an empty routerboard data")
+	}
+	upgrade.FromFirmware = reply[0].Map["current-firmware"]
+	upgrade.ToFirmware = reply[0].Map["upgrade-firmware"]
+	if upgrade.ToFirmware == "" || upgrade.ToFirmware == upgrade.FromFirmware {
+		upgrade.ToFirmware = upgrade.FromFirmware
+		return nil
+	}
+
+	_, err = u.run(device, "/system/routerboard/upgrade")
+	if err != nil {
+		return fmt.Errorf("firmware upgrade failed: %w", err)
+	}
+	requested := time.Now()
+	_, err = u.run(device, "/system/reboot")
+	if err != nil && isDeviceError(err) {
+		return fmt.Errorf("reboot failed: %w", err)
+	}
+	err = u.waitForReboot(device, requested)
+	if err != nil {
+		return err
+	}
+
+	current, err := u.readValue(device, "/system/routerboard/print", "current-firmware")
+	if err != nil {
+		return err
+	}
+	if current != upgrade.ToFirmware {
+		return fmt.Errorf("current firmware is %s, expected %s", current, upgrade.ToFirmware)
+	}
+
+	return nil
+}
+
+// Run performs the upgrade: creates an export of the device, installs the RouterOS update, waits
+// for the reboot and verifies the installed version, then optionally upgrades the firmware. The
+// upgrade stops at the first failing step, the outcome is stored along with the error. It returns
+// the error of the failed step.
+func (u *Upgrader) Run(device *db.Device, upgrade *db.DeviceUpgrade) error {
+	err := u.setStatus(upgrade, db.UpgradeExporting)
+	if err == nil {
+		var export *db.Export
+		export, err = u.export(device)
+		if err != nil {
+			err = fmt.Errorf("pre-upgrade export failed: %w", err)
+		} else {
+			upgrade.ExportId = export.Id
+		}
+	}
+	if err == nil {
+		err = u.upgradePackages(device, upgrade)
+	}
+	if err == nil && upgrade.Firmware {
+		err = u.upgradeFirmware(device, upgrade)
+	}
+
+	now := time.Now()
+	upgrade.FinishedAt = &now
+	if err != nil {
+		u.Logger.Error("device upgrade failed", zap.String("device", device.Address), zap.Error(err))
+		upgrade.Status = db.UpgradeFailed
+		upgrade.Error = err.Error()
+	} else {
+		u.Logger.Info("device upgraded", zap.String("device", device.Address), zap.String("version", upgrade.ToVersion))
+		upgrade.Status = db.UpgradeSucceeded
+	}
+
+	saveErr := upgrade.Save(u.Db)
+	if saveErr != nil {
+		u.Logger.Error(saveErr.Error())
+	}
+	return err
+}
+
+// Start records a new upgrade of the device and runs it in the background, only one upgrade
+// per device can run at a time. It returns the recorded upgrade and an error if another upgrade
+// of the device is running or the upgrade can not be recorded.
+func (u *Upgrader) Start(device *db.Device, firmware bool) (*db.DeviceUpgrade, error) {
+	upgradesMutex.Lock()
+	if upgradesRunning[device.Id] {
+		upgradesMutex.Unlock()
+		return nil, ErrUpgradeRunning
+	}
+	upgradesRunning[device.Id] = true
+	upgradesMutex.Unlock()
+
+	done := func() {
+		upgradesMutex.Lock()
+		delete(upgradesRunning, device.Id)
+		upgradesMutex.Unlock()
+	}
+
+	upgrade := &db.DeviceUpgrade{
+		DeviceId:     device.Id,
+		Status:       db.UpgradePending,
+		Firmware:     firmware,
+		FromVersion:  device.InstalledVersion,
+		ToVersion:    device.LatestVersion,
+		FromFirmware: device.CurrentFirmware,
+		ToFirmware:   device.UpgradeFirmware,
+	}
+	err := upgrade.Create(u.Db)
+	if err != nil {
+		done()
+		return nil, err
+	}
+
+	// the caller gets a copy as the running upgrade keeps changing
+	started := *upgrade
+	go func() {
+		defer done()
+		//nolint:errcheck
+		u.Run(device, upgrade)
+	}()
+
+	return &started, nil
+}
@@ -0,0 +1,232 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-routeros/routeros/v3"
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeRouter simulates the replies of a device being upgraded.
+type fakeRouter struct {
+	installed       string
+	latest          string
+	currentFirmware string
+	upgradeFirmware string
+	bootedAt        time.Time
+	firmwarePending bool
+	installErr      error
+	commands        []string
+}
+
+func (f *fakeRouter) reboot() {
+	f.bootedAt = time.Now()
+	if f.firmwarePending {
+		f.currentFirmware = f.upgradeFirmware
+	}
+}
+
+func (f *fakeRouter) run(device *db.Device, command string) ([]*proto.Sentence, error) {
+	f.commands = append(f.commands, command)
+	reply := func(values map[string]string) ([]*proto.Sentence, error) {
+		return []*proto.Sentence{{Map: values}}, nil
+	}
+
+	switch command {
+	case "/system/package/update/getall":
+		return reply(map[string]string{"installed-version": f.installed, "latest-version": f.latest})
+	case "/system/package/update/install":
+		if f.installErr != nil {
+			return nil, f.installErr
+		}
+		f.installed = f.latest
+		f.reboot()
+		return nil, io.EOF
+	case "/system/resource/print":
+		return reply(map[string]string{"uptime": fmt.Sprintf("%ds", int(time.Since(f.bootedAt).Seconds()))})
+	case "/system/routerboard/print":
+		return reply(map[string]string{"current-firmware": f.currentFirmware, "upgrade-firmware": f.upgradeFirmware})
+	case "/system/routerboard/upgrade":
+		f.firmwarePending = true
+	case "/system/reboot":
+		f.reboot()
+		return nil, io.EOF
+	}
+	return nil, nil
+}
+
+func testUpgrader(t *testing.T, router *fakeRouter) (*Upgrader, *db.Device) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device := &db.Device{Address: "10.0.0.1", InstalledVersion: router.installed, LatestVersion: router.latest}
+	err = device.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := NewUpgrader(database, nil, nil, time.Second, zap.NewNop())
+	u.PollInterval = time.Millisecond
+	u.run = router.run
+	u.export = func(device *db.Device) (*db.Export, error) {
+		export := &db.Export{DeviceId: device.Id, S3Key: device.Id + "/1.rsc"}
+		return export, export.Save(database)
+	}
+	return u, device
+}
+
+func TestParseUptime(t *testing.T) {
+	uptime, err := parseUptime("1w2d3h4m5s")
+	assert.NoError(t, err)
+	assert.Equal(t, 9*24*time.Hour+3*time.Hour+4*time.Minute+5*time.Second, uptime)
+
+	uptime, err = parseUptime("42s")
+	assert.NoError(t, err)
+	assert.Equal(t, 42*time.Second, uptime)
+
+	for _, invalid := range []string{"", "5", "3x", "h"} {
+		_, err = parseUptime(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestUpgraderRun(t *testing.T) {
+	router := &fakeRouter{
+		installed:       "7.14",
+		latest:          "7.15",
+		currentFirmware: "7.14",
+		upgradeFirmware: "7.15",
+		bootedAt:        time.Now().Add(-time.Hour),
+	}
+	u, device := testUpgrader(t, router)
+
+	upgrade := &db.DeviceUpgrade{DeviceId: device.Id, Status: db.UpgradePending, Firmware: true}
+	err := upgrade.Create(u.Db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = u.Run(device, upgrade)
+	assert.NoError(t, err)
+
+	fetched := &db.DeviceUpgrade{}
+	fetched.Id = upgrade.Id
+	err = fetched.GetById(u.Db)
+	assert.NoError(t, err)
+	assert.Equal(t, db.UpgradeSucceeded, fetched.Status)
+	assert.Equal(t, "7.14", fetched.FromVersion)
+	assert.Equal(t, "7.15", fetched.ToVersion)
+	assert.Equal(t, "7.14", fetched.FromFirmware)
+	assert.Equal(t, "7.15", fetched.ToFirmware)
+	assert.NotEmpty(t, fetched.ExportId)
+	assert.NotNil(t, fetched.FinishedAt)
+	assert.Contains(t, router.commands, "/system/routerboard/upgrade")
+}
+
+func TestUpgraderRunUpToDate(t *testing.T) {
+	router := &fakeRouter{installed: "7.15", latest: "7.15", bootedAt: time.Now().Add(-time.Hour)}
+	u, device := testUpgrader(t, router)
+
+	upgrade := &db.DeviceUpgrade{DeviceId: device.Id}
+	err := upgrade.Create(u.Db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = u.Run(device, upgrade)
+	assert.NoError(t, err)
+	assert.Equal(t, db.UpgradeSucceeded, upgrade.Status)
+	assert.NotContains(t, router.commands, "/system/package/update/install")
+	assert.NotContains(t, router.commands, "/system/routerboard/print")
+}
+
+func TestUpgraderRunFailures(t *testing.T) {
+	// the device refuses the install
+	router := &fakeRouter{
+		installed:  "7.14",
+		latest:     "7.15",
+		bootedAt:   time.Now().Add(-time.Hour),
+		installErr: &routeros.DeviceError{Sentence: &proto.Sentence{Map: map[string]string{"message": "not enough space"}}},
+	}
+	u, device := testUpgrader(t, router)
+	upgrade := &db.DeviceUpgrade{DeviceId: device.Id}
+	err := upgrade.Create(u.Db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = u.Run(device, upgrade)
+	assert.ErrorContains(t, err, "not enough space")
+	assert.Equal(t, db.UpgradeFailed, upgrade.Status)
+	assert.Equal(t, err.Error(), upgrade.Error)
+
+	// the device never reboots
+	router = &fakeRouter{
+		installed:  "7.14",
+		latest:     "7.15",
+		bootedAt:   time.Now().Add(-time.Hour),
+		installErr: io.EOF,
+	}
+	u, device = testUpgrader(t, router)
+	upgrade = &db.DeviceUpgrade{DeviceId: device.Id}
+	err = upgrade.Create(u.Db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = u.Run(device, upgrade)
+	assert.ErrorContains(t, err, "did not come back")
+	assert.Equal(t, db.UpgradeFailed, upgrade.Status)
+
+	// the export fails, nothing is installed
+	router = &fakeRouter{installed: "7.14", latest: "7.15"}
+	u, device = testUpgrader(t, router)
+	u.export = func(device *db.Device) (*db.Export, error) {
+		return nil, errors.New("ssh: handshake failed")
+	}
+	upgrade = &db.DeviceUpgrade{DeviceId: device.Id}
+	err = upgrade.Create(u.Db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = u.Run(device, upgrade)
+	assert.ErrorContains(t, err, "pre-upgrade export failed")
+	assert.Empty(t, router.commands)
+}
+
+func TestUpgraderStart(t *testing.T) {
+	router := &fakeRouter{installed: "7.15", latest: "7.15", bootedAt: time.Now().Add(-time.Hour)}
+	u, device := testUpgrader(t, router)
+
+	// block the export until the second start is refused
+	release := make(chan struct{})
+	u.export = func(device *db.Device) (*db.Export, error) {
+		<-release
+		return &db.Export{}, nil
+	}
+
+	upgrade, err := u.Start(device, false)
+	assert.NoError(t, err)
+	assert.True(t, UpgradeRunning(device.Id))
+
+	_, err = u.Start(device, false)
+	assert.ErrorIs(t, err, ErrUpgradeRunning)
+
+	close(release)
+	assert.Eventually(t, func() bool { return !UpgradeRunning(device.Id) }, time.Second, time.Millisecond)
+
+	fetched := &db.DeviceUpgrade{}
+	fetched.Id = upgrade.Id
+	err = fetched.GetById(u.Db)
+	assert.NoError(t, err)
+	assert.Equal(t, db.UpgradeSucceeded, fetched.Status)
+}
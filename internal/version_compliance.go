@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mazay/mikromanager/db"
+)
+
+// UpdateChannels lists the RouterOS package update channels.
+var UpdateChannels = []string{"long-term", "stable", "testing", "development"}
+
+// versionRe matches RouterOS versions, e.g. "7.14.3", "7.15rc2" or "6.49beta54"
+var versionRe = regexp.MustCompile(`^(\d+(?:\.\d+)*)(?:(alpha|beta|rc)(\d*))?$`)
+
+// VersionGroup holds the devices running the same RouterOS version or firmware.
+type VersionGroup struct {
+	Version string
+	Devices []*db.Device
+}
+
+// NonCompliantDevice is a device running a RouterOS version below the minimum version of one
+// of its groups.
+type NonCompliantDevice struct {
+	Device  *db.Device
+	Group   *db.DeviceGroup
+	Minimum string
+}
+
+// VersionCompliance summarises the RouterOS versions and firmware running on the devices.
+type VersionCompliance struct {
+	Versions  []*VersionGroup
+	Firmwares []*VersionGroup
+	// Outdated holds the devices with a newer RouterOS version available on their channel
+	Outdated []*db.Device
+	// OutdatedFirmware holds the devices with a RouterBOARD firmware upgrade available
+	OutdatedFirmware []*db.Device
+	NonCompliant     []*NonCompliantDevice
+	// Unknown holds the devices that were never polled successfully
+	Unknown []*db.Device
+}
+
+// parseVersion splits the version into its numeric parts followed by the pre-release rank and
+// number, releases rank above the "rc", "beta" and "alpha" pre-releases of the same version.
+func parseVersion(version string) ([]int, error) {
+	var parts []int
+
+	match := versionRe.FindStringSubmatch(strings.TrimSpace(version))
+	if match == nil {
+		return nil, fmt.Errorf("invalid RouterOS version %q", version)
+	}
+	for _, part := range strings.Split(match[1], ".") {
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, value)
+	}
+	// "7.15" equals "7.15.0"
+	for len(parts) < 3 {
+		parts = append(parts, 0)
+	}
+
+	rank := map[string]int{"alpha": 0, "beta": 1, "rc": 2, "": 3}[match[2]]
+	number, _ := strconv.Atoi(match[3])
+	return append(parts, rank, number), nil
+}
+
+// CompareVersions compares two RouterOS versions, it returns -1 if a is lower than b, 0 if
+// those are equal and 1 if a is greater than b. It returns an error if any of the versions
+// can not be parsed.
+func CompareVersions(a string, b string) (int, error) {
+	partsA, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	partsB, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for len(partsA) < len(partsB) {
+		partsA = slices.Insert(partsA, len(partsA)-2, 0)
+	}
+	for len(partsB) < len(partsA) {
+		partsB = slices.Insert(partsB, len(partsB)-2, 0)
+	}
+	return slices.Compare(partsA, partsB), nil
+}
+
+// ValidateVersion returns an error if the value is neither empty nor a RouterOS version.
+func ValidateVersion(version string) error {
+	if version == "" {
+		return nil
+	}
+	_, err := parseVersion(version)
+	return err
+}
+
+// belowMinimum returns the group with the highest minimum version the device does not meet,
+// nil if the device complies with all its groups. Invalid minimum versions are ignored.
+func belowMinimum(device *db.Device) *db.DeviceGroup {
+	var strictest *db.DeviceGroup
+
+	for _, group := range device.Groups {
+		if group.MinimumVersion == "" {
+			continue
+		}
+		cmp, err := CompareVersions(device.InstalledVersion, group.MinimumVersion)
+		if err != nil || cmp >= 0 {
+			continue
+		}
+		if strictest == nil {
+			strictest = group
+			continue
+		}
+		cmp, _ = CompareVersions(group.MinimumVersion, strictest.MinimumVersion)
+		if cmp > 0 {
+			strictest = group
+		}
+	}
+
+	return strictest
+}
+
+// groupByVersion appends the device to the group of the version, creating it if needed.
+func groupByVersion(groups []*VersionGroup, version string, device *db.Device) []*VersionGroup {
+	for _, g := range groups {
+		if g.Version == version {
+			g.Devices = append(g.Devices, device)
+			return groups
+		}
+	}
+	return append(groups, &VersionGroup{Version: version, Devices: []*db.Device{device}})
+}
+
+// sortVersionGroups orders the groups by version, the latest first, the versions that can not
+// be parsed go last.
+func sortVersionGroups(groups []*VersionGroup) {
+	slices.SortStableFunc(groups, func(a, b *VersionGroup) int {
+		cmp, err := CompareVersions(b.Version, a.Version)
+		if err != nil {
+			return strings.Compare(b.Version, a.Version)
+		}
+		return cmp
+	})
+}
+
+// GetVersionCompliance groups the devices by their RouterOS version and firmware and lists the
+// devices with pending updates and the ones running a version below the minimum version of any
+// of their groups. The devices should have their groups loaded.
+func GetVersionCompliance(devices []*db.Device) *VersionCompliance {
+	var report = &VersionCompliance{}
+
+	for _, device := range devices {
+		if device.InstalledVersion == "" {
+			report.Unknown = append(report.Unknown, device)
+			continue
+		}
+
+		report.Versions = groupByVersion(report.Versions, device.InstalledVersion, device)
+		if device.CurrentFirmware != "" {
+			report.Firmwares = groupByVersion(report.Firmwares, device.CurrentFirmware, device)
+		}
+		if NeedsUpgrade(device, false) {
+			report.Outdated = append(report.Outdated, device)
+		}
+		if device.UpgradeFirmware != "" && device.UpgradeFirmware != device.CurrentFirmware {
+			report.OutdatedFirmware = append(report.OutdatedFirmware, device)
+		}
+		if group := belowMinimum(device); group != nil {
+			report.NonCompliant = append(report.NonCompliant, &NonCompliantDevice{
+				Device:  device,
+				Group:   group,
+				Minimum: group.MinimumVersion,
+			})
+		}
+	}
+
+	sortVersionGroups(report.Versions)
+	sortVersionGroups(report.Firmwares)
+	return report
+}
+
+// SetUpdateChannel switches the device to the RouterOS update channel and refreshes the update
+// information of the device, the changes are stored in the database. It returns an error if the
+// channel is unknown, the device can not be updated or the context is done.
+func SetUpdateChannel(ctx context.Context, database *db.DB, secrets *Secrets, device *db.Device, channel string) error {
+	if !slices.Contains(UpdateChannels, channel) {
+		return fmt.Errorf("unknown update channel %q", channel)
+	}
+
+	_, err := runWithCredentials(ctx, device, database, secrets, nil, "/system/package/update/set =channel="+channel)
+	if err != nil {
+		return err
+	}
+	_, err = runWithCredentials(ctx, device, database, secrets, nil, "/system/package/update/check-for-updates ?once")
+	if err != nil {
+		return err
+	}
+	reply, err := runWithCredentials(ctx, device, database, secrets, nil, "/system/package/update/getall")
+	if err != nil {
+		return err
+	}
+	if len(reply) == 0 {
+		return errors.New("got an empty package update data")
+	}
+
+	device.UpdateChannel = reply[0].Map["channel"]
+	device.InstalledVersion = reply[0].Map["installed-version"]
+	device.LatestVersion = reply[0].Map["latest-version"]
+	return device.SaveUpdateInfo(database)
+}
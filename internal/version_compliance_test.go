@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"7.15", "7.15.0", 0},
+		{"7.15.3", "7.15", 1},
+		{"7.9", "7.15", -1},
+		{"6.49.10", "7.1", -1},
+		{"7.16rc2", "7.16", -1},
+		{"7.16beta4", "7.16rc1", -1},
+		{"7.16rc10", "7.16rc2", 1},
+		{"7.16rc1", "7.15.3", 1},
+		{"7.1.1.1", "7.1.1", 1},
+	} {
+		cmp, err := CompareVersions(tc.a, tc.b)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, cmp, "%s vs %s", tc.a, tc.b)
+	}
+
+	_, err := CompareVersions("seven", "7.15")
+	assert.Error(t, err)
+	assert.Error(t, ValidateVersion("7.15 (stable)"))
+	assert.NoError(t, ValidateVersion(""))
+}
+
+func TestGetVersionCompliance(t *testing.T) {
+	core := &db.DeviceGroup{Name: "core", MinimumVersion: "7.15"}
+	edge := &db.DeviceGroup{Name: "edge", MinimumVersion: "7.12"}
+	lab := &db.DeviceGroup{Name: "lab"}
+
+	devices := []*db.Device{
+		{Address: "10.0.0.1", InstalledVersion: "7.15.3", LatestVersion: "7.15.3", CurrentFirmware: "7.15.3", UpgradeFirmware: "7.15.3", Groups: []*db.DeviceGroup{core}},
+		{Address: "10.0.0.2", InstalledVersion: "7.11", LatestVersion: "7.16", CurrentFirmware: "7.10", UpgradeFirmware: "7.11", Groups: []*db.DeviceGroup{edge, core}},
+		{Address: "10.0.0.3", InstalledVersion: "7.11", LatestVersion: "7.11", Groups: []*db.DeviceGroup{lab}},
+		{Address: "10.0.0.4"},
+	}
+
+	report := GetVersionCompliance(devices)
+	assert.Len(t, report.Versions, 2)
+	assert.Equal(t, "7.15.3", report.Versions[0].Version)
+	assert.Len(t, report.Versions[1].Devices, 2)
+	assert.Len(t, report.Firmwares, 2)
+	assert.Equal(t, "7.10", report.Firmwares[1].Version)
+	assert.Equal(t, []*db.Device{devices[1]}, report.Outdated)
+	assert.Equal(t, []*db.Device{devices[1]}, report.OutdatedFirmware)
+	assert.Equal(t, []*db.Device{devices[3]}, report.Unknown)
+
+	// the strictest group is reported
+	assert.Len(t, report.NonCompliant, 1)
+	assert.Equal(t, devices[1], report.NonCompliant[0].Device)
+	assert.Equal(t, core, report.NonCompliant[0].Group)
+	assert.Equal(t, "7.15", report.NonCompliant[0].Minimum)
+}
+
+func TestSetUpdateChannelUnknown(t *testing.T) {
+	err := SetUpdateChannel(context.Background(), nil, nil, &db.Device{Address: "10.0.0.1"}, "nightly")
+	assert.Error(t, err)
+}
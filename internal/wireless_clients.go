@@ -0,0 +1,205 @@
+package internal
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/mazay/mikromanager/db"
+)
+
+// WirelessMenus holds the menus of the registration tables listing the wireless clients, the
+// "/interface/wifi" menu of the newer RouterOS versions also lists the clients of the CAPsMAN
+// managed access points, the "/caps-man" one does the same for the legacy CAPsMAN
+var WirelessMenus = []string{"/interface/wifi", "/interface/wireless", "/caps-man"}
+
+// AccessPointSummary holds the wireless client counts of a single device.
+type AccessPointSummary struct {
+	Device  *db.Device
+	Clients int
+	// Peak is the highest client count of the summarized period
+	Peak  int
+	Ssids []string
+}
+
+// ClientCountBucket holds the highest client count sampled within the bucket period.
+type ClientCountBucket struct {
+	Start   time.Time
+	Clients int
+	Samples int
+}
+
+// parseSignal converts the signal strength to dBm, e.g. "-65" or "-65dBm@6Mbps", the missing or
+// malformed values are zero.
+func parseSignal(value string) int {
+	end := 0
+	for end < len(value) && (value[end] == '-' || (value[end] >= '0' && value[end] <= '9')) {
+		end++
+	}
+	signal, _ := strconv.Atoi(value[:end])
+	return signal
+}
+
+// firstValue returns the first non-empty value of the sentence keys, the registration tables of
+// the wireless menus name the same properties differently.
+func firstValue(s map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if s[key] != "" {
+			return s[key]
+		}
+	}
+	return ""
+}
+
+// ParseWirelessClients converts the registration table sentences of the menu to the device
+// wireless clients, the access points connected to the device as clients are skipped.
+func ParseWirelessClients(menu string, sentences []*proto.Sentence) []*db.DeviceWirelessClient {
+	var clients []*db.DeviceWirelessClient
+
+	for _, sentence := range sentences {
+		s := sentence.Map
+		if s["mac-address"] == "" || s["ap"] == "true" {
+			continue
+		}
+		clients = append(clients, &db.DeviceWirelessClient{
+			Menu:       menu,
+			Interface:  s["interface"],
+			MacAddress: normalizeMacAddress(s["mac-address"]),
+			Ssid:       s["ssid"],
+			Signal:     parseSignal(firstValue(s, "signal", "signal-strength", "rx-signal")),
+			TxRate:     s["tx-rate"],
+			RxRate:     s["rx-rate"],
+			Uptime:     s["uptime"],
+			LastIp:     s["last-ip"],
+			Comment:    s["comment"],
+		})
+	}
+
+	return clients
+}
+
+// UpdateWirelessClients stores the wireless clients of the device along with their count sampled
+// at the given time, the counts sampled before the retention period are removed. It returns an
+// error if any of the database operations fail.
+func UpdateWirelessClients(database *db.DB, device *db.Device, clients []*db.DeviceWirelessClient, sampledAt time.Time, retention time.Duration) error {
+	var count = &db.WirelessClientCount{DeviceId: device.Id, Clients: len(clients), SampledAt: sampledAt}
+
+	err := db.ReplaceDeviceWirelessClients(database, device.Id, clients)
+	if err != nil {
+		return err
+	}
+	err = count.Create(database)
+	if err != nil {
+		return err
+	}
+	if retention > 0 {
+		_, err = count.DeleteBefore(database, sampledAt.Add(-retention))
+	}
+	return err
+}
+
+// ClientCountHistory groups the client counts into the buckets of the given step between start
+// and end, each bucket holds the highest count sampled within it. The counts should be ordered
+// by the sampling time.
+func ClientCountHistory(counts []*db.WirelessClientCount, start time.Time, end time.Time, step time.Duration) []*ClientCountBucket {
+	var buckets []*ClientCountBucket
+
+	if step <= 0 {
+		return nil
+	}
+	for t := start; t.Before(end); t = t.Add(step) {
+		buckets = append(buckets, &ClientCountBucket{Start: t})
+	}
+	for _, count := range counts {
+		if count.SampledAt.Before(start) || !count.SampledAt.Before(end) {
+			continue
+		}
+		bucket := buckets[int(count.SampledAt.Sub(start)/step)]
+		bucket.Samples++
+		bucket.Clients = max(bucket.Clients, count.Clients)
+	}
+
+	return buckets
+}
+
+// SummarizeAccessPoints counts the current wireless clients of every device and finds the peak
+// counts among the sampled ones. The devices without clients or samples are skipped. It returns
+// the summaries ordered by the number of the clients, the busiest access point first.
+func SummarizeAccessPoints(devices []*db.Device, clients []*db.DeviceWirelessClient, counts []*db.WirelessClientCount) []*AccessPointSummary {
+	var (
+		summaries []*AccessPointSummary
+		byId      = map[string]*AccessPointSummary{}
+	)
+
+	for _, device := range devices {
+		byId[device.Id] = &AccessPointSummary{Device: device}
+	}
+	for _, client := range clients {
+		s, ok := byId[client.DeviceId]
+		if !ok {
+			continue
+		}
+		s.Clients++
+		if client.Ssid != "" && !slices.Contains(s.Ssids, client.Ssid) {
+			s.Ssids = append(s.Ssids, client.Ssid)
+		}
+	}
+	for _, count := range counts {
+		if s, ok := byId[count.DeviceId]; ok {
+			s.Peak = max(s.Peak, count.Clients)
+		}
+	}
+
+	for _, device := range devices {
+		s := byId[device.Id]
+		s.Peak = max(s.Peak, s.Clients)
+		if s.Peak == 0 {
+			continue
+		}
+		slices.Sort(s.Ssids)
+		summaries = append(summaries, s)
+	}
+	slices.SortStableFunc(summaries, func(a, b *AccessPointSummary) int {
+		if a.Clients != b.Clients {
+			return b.Clients - a.Clients
+		}
+		return strings.Compare(a.Device.Address, b.Device.Address)
+	})
+
+	return summaries
+}
+
+// SearchWirelessClients finds the wireless clients of the devices matching the query by MAC
+// address, last IP address, SSID, interface or comment, see SearchInventory for the matching
+// rules. The clients of the trashed devices are skipped. It returns an error if the query is
+// empty or the retrieval fails.
+func SearchWirelessClients(database *db.DB, query string) ([]*db.DeviceWirelessClient, error) {
+	var (
+		client  = &db.DeviceWirelessClient{}
+		matches []*db.DeviceWirelessClient
+	)
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, errors.New("the search query is empty")
+	}
+	matcher := inventoryMatcher(query)
+
+	clients, err := client.GetAll(database)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range clients {
+		if c.Device == nil || c.Device.Trashed() {
+			continue
+		}
+		if matcher(c.MacAddress, c.LastIp, c.Ssid, c.Interface, c.Comment) {
+			matches = append(matches, c)
+		}
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/mazay/mikromanager/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsUnknownCommand(t *testing.T) {
+	assert.True(t, IsUnknownCommand(errors.New("from RouterOS device: no such command prefix")))
+	assert.False(t, IsUnknownCommand(errors.New("i/o timeout")))
+	assert.False(t, IsUnknownCommand(nil))
+}
+
+func TestParseSignal(t *testing.T) {
+	assert.Equal(t, -65, parseSignal("-65"))
+	assert.Equal(t, -65, parseSignal("-65dBm@6Mbps"))
+	assert.Equal(t, 0, parseSignal(""))
+	assert.Equal(t, 0, parseSignal("n/a"))
+}
+
+func TestParseWirelessClients(t *testing.T) {
+	wireless := []*proto.Sentence{
+		{Map: map[string]string{"interface": "wlan1", "mac-address": "aa:bb:cc:dd:ee:01", "signal-strength": "-61dBm@HT20-7", "tx-rate": "65Mbps-20MHz/1S", "rx-rate": "72.2Mbps", "uptime": "1h2m3s", "last-ip": "10.0.0.10"}},
+		{Map: map[string]string{"interface": "wlan1", "mac-address": "AA:BB:CC:DD:EE:09", "ap": "true"}},
+		{Map: map[string]string{"interface": "wlan1"}},
+	}
+	clients := ParseWirelessClients("/interface/wireless", wireless)
+	assert.Len(t, clients, 1)
+	assert.Equal(t, "/interface/wireless", clients[0].Menu)
+	assert.Equal(t, "AA:BB:CC:DD:EE:01", clients[0].MacAddress)
+	assert.Equal(t, -61, clients[0].Signal)
+	assert.Equal(t, "65Mbps-20MHz/1S", clients[0].TxRate)
+	assert.Equal(t, "1h2m3s", clients[0].Uptime)
+	assert.Equal(t, "10.0.0.10", clients[0].LastIp)
+
+	wifi := []*proto.Sentence{
+		{Map: map[string]string{"interface": "wifi1", "mac-address": "AA:BB:CC:DD:EE:02", "ssid": "office", "signal": "-48", "uptime": "5m"}},
+	}
+	clients = ParseWirelessClients("/interface/wifi", wifi)
+	assert.Len(t, clients, 1)
+	assert.Equal(t, "office", clients[0].Ssid)
+	assert.Equal(t, -48, clients[0].Signal)
+
+	capsman := []*proto.Sentence{
+		{Map: map[string]string{"interface": "cap1", "mac-address": "AA:BB:CC:DD:EE:03", "ssid": "guest", "rx-signal": "-70"}},
+	}
+	clients = ParseWirelessClients("/caps-man", capsman)
+	assert.Equal(t, -70, clients[0].Signal)
+}
+
+func TestUpdateWirelessClients(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device := &db.Device{Address: "10.0.0.1"}
+	err = device.Create(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &db.DeviceWirelessClient{}
+	count := &db.WirelessClientCount{}
+	start := time.Now().Add(-3 * time.Hour)
+
+	err = UpdateWirelessClients(database, device, []*db.DeviceWirelessClient{{MacAddress: "AA:BB:CC:DD:EE:01"}, {MacAddress: "AA:BB:CC:DD:EE:02"}}, start, 2*time.Hour)
+	assert.NoError(t, err)
+	err = UpdateWirelessClients(database, device, []*db.DeviceWirelessClient{{MacAddress: "AA:BB:CC:DD:EE:01"}}, start.Add(time.Hour), 2*time.Hour)
+	assert.NoError(t, err)
+
+	clients, err := client.GetByDeviceId(database, device.Id)
+	assert.NoError(t, err)
+	assert.Len(t, clients, 1)
+	counts, err := count.GetByDeviceId(database, device.Id, start)
+	assert.NoError(t, err)
+	assert.Len(t, counts, 2)
+	assert.Equal(t, 2, counts[0].Clients)
+	assert.Equal(t, 1, counts[1].Clients)
+
+	// the samples older than the retention period are removed
+	err = UpdateWirelessClients(database, device, nil, start.Add(150*time.Minute), 2*time.Hour)
+	assert.NoError(t, err)
+	counts, err = count.GetByDeviceId(database, device.Id, start)
+	assert.NoError(t, err)
+	assert.Len(t, counts, 2)
+	assert.Equal(t, 1, counts[0].Clients)
+	assert.Equal(t, 0, counts[1].Clients)
+}
+
+func TestClientCountHistory(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	counts := []*db.WirelessClientCount{
+		{Clients: 9, SampledAt: start.Add(-time.Minute)},
+		{Clients: 3, SampledAt: start.Add(10 * time.Minute)},
+		{Clients: 5, SampledAt: start.Add(40 * time.Minute)},
+		{Clients: 2, SampledAt: start.Add(2*time.Hour + time.Minute)},
+		{Clients: 9, SampledAt: start.Add(3 * time.Hour)},
+	}
+
+	buckets := ClientCountHistory(counts, start, start.Add(3*time.Hour), time.Hour)
+	assert.Len(t, buckets, 3)
+	assert.Equal(t, start, buckets[0].Start)
+	assert.Equal(t, 5, buckets[0].Clients)
+	assert.Equal(t, 2, buckets[0].Samples)
+	assert.Equal(t, 0, buckets[1].Samples)
+	assert.Equal(t, 2, buckets[2].Clients)
+
+	assert.Nil(t, ClientCountHistory(counts, start, start.Add(time.Hour), 0))
+}
+
+func TestSummarizeAccessPoints(t *testing.T) {
+	devices := []*db.Device{{Address: "10.0.0.1"}, {Address: "10.0.0.2"}, {Address: "10.0.0.3"}, {Address: "10.0.0.4"}}
+	for i, d := range devices {
+		d.Id = string(rune('a' + i))
+	}
+	clients := []*db.DeviceWirelessClient{
+		{DeviceId: "b", Ssid: "office"},
+		{DeviceId: "b", Ssid: "guest"},
+		{DeviceId: "b", Ssid: "office"},
+		{DeviceId: "c", Ssid: "office"},
+		{DeviceId: "gone", Ssid: "office"},
+	}
+	counts := []*db.WirelessClientCount{
+		{DeviceId: "a", Clients: 4},
+		{DeviceId: "b", Clients: 1},
+		{DeviceId: "c", Clients: 7},
+	}
+
+	summaries := SummarizeAccessPoints(devices, clients, counts)
+	assert.Len(t, summaries, 3)
+	assert.Equal(t, "b", summaries[0].Device.Id)
+	assert.Equal(t, 3, summaries[0].Clients)
+	assert.Equal(t, 3, summaries[0].Peak)
+	assert.Equal(t, []string{"guest", "office"}, summaries[0].Ssids)
+	assert.Equal(t, "c", summaries[1].Device.Id)
+	assert.Equal(t, 7, summaries[1].Peak)
+	assert.Equal(t, "a", summaries[2].Device.Id)
+	assert.Equal(t, 0, summaries[2].Clients)
+}
+
+func TestSearchWirelessClients(t *testing.T) {
+	database := &db.DB{LogLevel: "silent"}
+	err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ap := &db.Device{Address: "10.0.0.1"}
+	trashed := &db.Device{Address: "10.0.0.2"}
+	for _, d := range []*db.Device{ap, trashed} {
+		err = d.Create(database)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = trashed.Trash(database, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, db.ReplaceDeviceWirelessClients(database, ap.Id, []*db.DeviceWirelessClient{
+		{MacAddress: "AA:BB:CC:DD:EE:01", Ssid: "Office", LastIp: "10.0.0.10"},
+		{MacAddress: "AA:BB:CC:DD:EE:02", Ssid: "guest"},
+	}))
+	assert.NoError(t, db.ReplaceDeviceWirelessClients(database, trashed.Id, []*db.DeviceWirelessClient{
+		{MacAddress: "AA:BB:CC:DD:EE:01", Ssid: "office"},
+	}))
+
+	matches, err := SearchWirelessClients(database, "aa-bb-cc-dd-ee-01")
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+	assert.Equal(t, ap.Id, matches[0].Device.Id)
+
+	matches, err = SearchWirelessClients(database, "office")
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+	matches, err = SearchWirelessClients(database, "10.0.0.10")
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+
+	_, err = SearchWirelessClients(database, "")
+	assert.Error(t, err)
+}
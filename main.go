@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"os"
 	"sync"
@@ -14,15 +16,26 @@ import (
 )
 
 type PollerCFG struct {
-	Client *internal.Api
-	Db     *database.DB
-	Device *database.Device
+	Client      *internal.Api
+	Db          *database.DB
+	Device      *database.Device
+	Credentials []*database.Credentials
+	Secrets     *internal.Secrets
+	Collectors  []internal.Collector
+	// Settings holds the collector settings of the device groups in the order of precedence
+	Settings []*database.CollectorSetting
+	// Jobs tracks the devices being polled, the device job is finished by the worker
+	Jobs *internal.DeviceJobs
 }
 
 type BackupCFG struct {
-	Client *internal.SshClient
-	Db     *database.DB
-	Device *database.Device
+	Client      *internal.SshClient
+	Db          *database.DB
+	Device      *database.Device
+	Credentials []*database.Credentials
+	Secrets     *internal.Secrets
+	// Jobs tracks the devices being exported, the device job is finished by the worker
+	Jobs *internal.DeviceJobs
 }
 
 var (
@@ -49,6 +62,11 @@ func main() {
 	logger = initLogger(config.LogLevel)
 	defer logger.Sync() //nolint:golint,errcheck
 
+	if flag.Arg(0) == "rekey" {
+		osExit(rekey(config, flag.Args()[1:]))
+		return
+	}
+
 	pollerCH := make(chan *PollerCFG)
 	exportCH := make(chan *BackupCFG)
 
@@ -99,6 +117,7 @@ func main() {
 		}
 		user.Username = "admin"
 		user.EncryptedPassword = encryptedPw
+		user.Role = database.UserRoleAdmin
 		err = user.Create(&db)
 		if err != nil {
 			logger.Error(err.Error())
@@ -106,14 +125,69 @@ func main() {
 		}
 	}
 
+	secrets := internal.NewSecrets(config.EncryptionKey, &internal.EnvSecrets{Prefix: config.SecretEnvPrefix}, &internal.FileSecrets{Dir: config.SecretFilesDir}, &internal.VaultSecrets{
+		Address:   config.VaultAddress,
+		Token:     config.VaultToken,
+		Namespace: config.VaultNamespace,
+	})
+
+	timeouts := internal.DeviceTimeouts{Api: config.ApiTimeout, Ssh: config.SshTimeout}
+
+	discovery := &internal.DiscoveryConfig{
+		Ranges:      config.DiscoveryRanges,
+		Credentials: config.DiscoveryCredentials,
+		Neighbors:   config.DiscoveryNeighbors,
+		Timeout:     config.DiscoveryTimeout,
+		Concurrency: config.DiscoveryConcurrency,
+		Timeouts:    timeouts,
+		Secrets:     secrets,
+		Logger:      logger,
+	}
+
+	// the upgrades interrupted by a restart can't be resumed
+	upgrade := &database.DeviceUpgrade{}
+	interrupted, err := upgrade.FailUnfinished(&db)
+	if err != nil {
+		logger.Error(err.Error())
+	} else if interrupted > 0 {
+		logger.Warn("marked interrupted device upgrades as failed", zap.Int64("count", interrupted))
+	}
+	upgrader := internal.NewUpgrader(&db, s3, secrets, config.UpgradeRebootTimeout, logger)
+	upgrader.Timeouts = timeouts
+	commands := internal.NewCommandRunner(&db, secrets, logger)
+	commands.Timeouts = timeouts
+
+	commandRun := &database.CommandRun{}
+	err = commandRun.FailUnfinished(&db)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+
+	apiPool := internal.NewApiPool(config.ApiIdleTimeout)
+	defer apiPool.Close()
+
+	collectors := internal.DefaultCollectors(&internal.CollectorOptions{
+		MgmtTag:           config.ManagementAddressTag,
+		WirelessClients:   config.WirelessClients,
+		WirelessRetention: config.WirelessClientsRetention,
+	})
+
 	// run HTTP server
 	server := http.HttpConfig{
-		Port:          "8000",
-		Db:            &db,
-		EncryptionKey: config.EncryptionKey,
-		Logger:        logger,
-		BackupPath:    config.BackupPath,
-		S3:            s3,
+		Port:           "8000",
+		Db:             &db,
+		EncryptionKey:  config.EncryptionKey,
+		Secrets:        secrets,
+		Logger:         logger,
+		BackupPath:     config.BackupPath,
+		S3:             s3,
+		TrashRetention: config.DeviceTrashRetention,
+		Discovery:      discovery,
+		Upgrader:       upgrader,
+		Commands:       commands,
+		Collectors:     collectors,
+		ApiPool:        apiPool,
+		Timeouts:       timeouts,
 	}
 	go server.HttpServer()
 
@@ -136,7 +210,7 @@ func main() {
 	logger.Info("devicePollerInterval", zap.Duration("interval", config.DevicePollerInterval))
 	pollerJob, pollerErr := scheduler.NewJob(
 		gocron.DurationJob(config.DevicePollerInterval),
-		gocron.NewTask(devicesPoller, config, &db, pollerCH),
+		gocron.NewTask(devicesPoller, config, &db, secrets, collectors, apiPool, internal.NewDeviceJobs(), pollerCH),
 	)
 	if pollerErr != nil {
 		logger.Error("poller", zap.Any("Job", pollerJob), zap.Any("error", pollerErr))
@@ -144,7 +218,7 @@ func main() {
 	logger.Info("deviceExportCronSchedule", zap.String("cron schedule", config.deviceExportCronSchedule))
 	exportJob, exportErr := scheduler.NewJob(
 		gocron.CronJob(config.deviceExportCronSchedule, false),
-		gocron.NewTask(backupScheduler, config, &db, exportCH),
+		gocron.NewTask(backupScheduler, config, &db, secrets, internal.NewDeviceJobs(), exportCH),
 	)
 	if exportErr != nil {
 		logger.Error("export", zap.Any("Job", exportJob), zap.Any("error", exportErr))
@@ -157,6 +231,52 @@ func main() {
 	if exportRetentionErr != nil {
 		logger.Error("export", zap.Any("Job", exportRetentionJob), zap.Any("error", exportRetentionErr))
 	}
+	logger.Info("exportsReconcileSchedule", zap.String("cron schedule", config.ExportsReconcileSchedule))
+	exportReconcileJob, exportReconcileErr := scheduler.NewJob(
+		gocron.CronJob(config.ExportsReconcileSchedule, false),
+		gocron.NewTask(reconcileExports, &db, config.ExportsReconcileAutoFix),
+	)
+	if exportReconcileErr != nil {
+		logger.Error("export", zap.Any("Job", exportReconcileJob), zap.Any("error", exportReconcileErr))
+	}
+	logger.Info("device trash purge job interval is 1 hour", zap.Duration("retention", config.DeviceTrashRetention))
+	trashPurgeJob, trashPurgeErr := scheduler.NewJob(
+		gocron.CronJob("30 * * * *", false),
+		gocron.NewTask(purgeTrash, &db, config.DeviceTrashRetention),
+	)
+	if trashPurgeErr != nil {
+		logger.Error("trash", zap.Any("Job", trashPurgeJob), zap.Any("error", trashPurgeErr))
+	}
+	if config.DiscoverySchedule != "" {
+		logger.Info("discoverySchedule", zap.String("cron schedule", config.DiscoverySchedule))
+		discoveryJob, discoveryErr := scheduler.NewJob(
+			gocron.CronJob(config.DiscoverySchedule, false),
+			gocron.NewTask(discoverDevices, &db, discovery),
+		)
+		if discoveryErr != nil {
+			logger.Error("discovery", zap.Any("Job", discoveryJob), zap.Any("error", discoveryErr))
+		}
+	}
+	logger.Info("upgrade rollouts job interval is 1 minute")
+	rolloutsJob, rolloutsErr := scheduler.NewJob(
+		gocron.DurationJob(time.Minute),
+		gocron.NewTask(advanceRollouts, &db, upgrader),
+		// a slow run must not start the same batch twice
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	if rolloutsErr != nil {
+		logger.Error("rollouts", zap.Any("Job", rolloutsJob), zap.Any("error", rolloutsErr))
+	}
+	if config.ApiIdleTimeout > 0 {
+		logger.Info("API connections prune job", zap.Duration("interval", config.ApiIdleTimeout))
+		apiPoolJob, apiPoolErr := scheduler.NewJob(
+			gocron.DurationJob(config.ApiIdleTimeout),
+			gocron.NewTask(pruneApiConnections, apiPool),
+		)
+		if apiPoolErr != nil {
+			logger.Error("api pool", zap.Any("Job", apiPoolJob), zap.Any("error", apiPoolErr))
+		}
+	}
 	logger.Info("session cleanup job interval runs at 00:00")
 	sessionCleanupJob, sessionCleanupErr := scheduler.NewJob(
 		gocron.CronJob("0 0 * * *", false),
@@ -170,91 +290,188 @@ func main() {
 	wg.Wait()
 }
 
-func devicesPoller(cfg *Config, db *database.DB, pollerCH chan<- *PollerCFG) error {
-	var d = &database.Device{}
+// rekey re-encrypts the stored secrets with a new encryption key, the new key is read from the
+// "-new-key" flag or the NEW_ENCRYPTION_KEY environment variable. The secrets are re-encrypted
+// with the current key if no new key is given, upgrading the legacy ciphertexts. It returns the
+// process exit code.
+func rekey(config *Config, args []string) int {
+	var newKey string
+
+	flags := flag.NewFlagSet("rekey", flag.ContinueOnError)
+	flags.StringVar(&newKey, "new-key", os.Getenv("NEW_ENCRYPTION_KEY"), "New encryption key, defaults to the NEW_ENCRYPTION_KEY environment variable")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if newKey == "" {
+		newKey = config.EncryptionKey
+	}
+
+	db := database.DB{LogLevel: config.DbLogLevel}
+	err = db.Open(config.DbPath)
+	if err != nil {
+		logger.Error("DB init issue", zap.String("error", err.Error()))
+		return 1
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			logger.Error("failed to close the database", zap.Error(err))
+		}
+	}()
+
+	count, err := database.Rekey(&db, config.EncryptionKey, newKey)
+	if err != nil {
+		logger.Error("rekey failed, nothing was changed", zap.Error(err))
+		return 1
+	}
+
+	logger.Info("secrets re-encrypted", zap.Int("count", count))
+	if newKey != config.EncryptionKey {
+		logger.Warn("set encryptionKey to the new key in the config file before starting the service")
+	}
+	return 0
+}
+
+func devicesPoller(cfg *Config, db *database.DB, secrets *internal.Secrets, collectors []internal.Collector, pool *internal.ApiPool, jobs *internal.DeviceJobs, pollerCH chan<- *PollerCFG) error {
+	var (
+		d       = &database.Device{}
+		g       = &database.DeviceGroup{}
+		setting = &database.CollectorSetting{}
+	)
 
 	logger.Info("starting device polling task")
-	// have to use the preload method here to not lose the device groups
 	devices, err := d.GetAllPlain(db)
 	if err != nil {
 		logger.Error(err.Error())
 		return err
 	}
+	// the groups are loaded separately to not save them along with the polled devices
+	groups, err := g.GetAllPreload(db)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+	allSettings, err := setting.GetAll(db)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+	settings := internal.DeviceCollectorSettings(groups, allSettings)
+
 	for _, device := range devices {
-		creds, err := device.GetCredentials(db)
+		// a hung device must not pile up the polls
+		started, since := jobs.Start(device.Id)
+		if !started {
+			logger.Warn("skipping device, the previous poll is still running", zap.String("device", device.Address), zap.Time("since", since))
+			continue
+		}
+		chain, err := device.GetCredentialsChain(db)
 		if err != nil {
+			jobs.Finish(device.Id)
 			logger.Error(err.Error())
 			return err
 		}
-		logger.Debug("authentication", zap.String("credentials", creds.Alias), zap.String("device", device.Address))
-		decryptedPw, encryptionErr := database.DecryptString(creds.EncryptedPassword, cfg.EncryptionKey)
-		if encryptionErr != nil {
-			logger.Error(encryptionErr.Error())
-			return err
-		}
 		client := &internal.Api{
-			Address:  device.Address,
-			Port:     device.ApiPort,
-			Username: creds.Username,
-			Password: decryptedPw,
-			Async:    true,
-			UseTLS:   false,
-			Logger:   logger,
+			Address: device.Address,
+			Port:    device.ApiPort,
+			Async:   true,
+			UseTLS:  false,
+			Timeout: cfg.ApiTimeout,
+			Pool:    pool,
+			Logger:  logger,
+		}
+		pollerCH <- &PollerCFG{
+			Client:      client,
+			Db:          db,
+			Device:      device,
+			Credentials: chain,
+			Secrets:     secrets,
+			Collectors:  collectors,
+			Settings:    settings[device.Id],
+			Jobs:        jobs,
 		}
-		pollerCH <- &PollerCFG{Client: client, Db: db, Device: device}
 	}
 	return nil
 }
 
 func apiWorker(pollerCH <-chan *PollerCFG) {
 	for cfg := range pollerCH {
-		var fetchErr error
-		var minorErr error
-		var dbErr error
-
-		logger.Info("polling device", zap.String("address", cfg.Client.Address))
-		fetchErr = fetchResources(cfg)
-		if fetchErr != nil {
-			logger.Error(fetchErr.Error())
-		}
+		pollDevice(context.Background(), cfg)
+		cfg.Jobs.Finish(cfg.Device.Id)
+	}
+}
 
-		fetchErr = fetchRbDetails(cfg)
-		if fetchErr != nil {
-			logger.Error(fetchErr.Error())
-		}
+// pollDevice runs the collectors due on the device and stores the outcome, the device requests
+// stop once the context is done.
+func pollDevice(ctx context.Context, cfg *PollerCFG) {
+	var status = &database.CollectorStatus{}
 
-		fetchErr = fetchIdentity(cfg)
-		if fetchErr != nil {
-			logger.Error(fetchErr.Error())
-		}
+	statuses, err := status.GetByDeviceId(cfg.Db, cfg.Device.Id)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	planned := internal.PlanCollectors(cfg.Collectors, cfg.Settings, statuses, time.Now())
+	if len(planned) == 0 {
+		logger.Debug("no collectors due", zap.String("address", cfg.Client.Address))
+		return
+	}
 
-		minorErr = cfg.Client.CheckForUpdates(cfg.Device)
-		if minorErr != nil {
-			logger.Error(minorErr.Error())
-		}
+	logger.Info("polling device", zap.String("address", cfg.Client.Address))
+	target := &internal.CollectorTarget{Client: cfg.Client, Db: cfg.Db, Device: cfg.Device, Logger: logger}
+	results := make([]*database.CollectorStatus, 0, len(planned))
+	authenticated := false
+
+	// the first collector finds the credentials accepted by the device, the rest reuse them
+	creds, authErr := internal.TryCredentials(cfg.Credentials, cfg.Device.WorkingCredentialsID, cfg.Secrets, func(creds *database.Credentials, password string) error {
+		logger.Debug("authentication", zap.String("credentials", creds.Alias), zap.String("device", cfg.Device.Address))
+		cfg.Client.Username = creds.Username
+		cfg.Client.Password = password
+		result, err := internal.RunCollector(ctx, target, planned[0])
+		results = append(results[:0], result)
+		authenticated = err == nil || !internal.IsAuthError(err)
+		return err
+	})
+	if authErr != nil {
+		logger.Error(authErr.Error(), zap.String("collector", planned[0].Collector.Name()))
+	} else {
+		rememberCredentials(cfg.Db, cfg.Device, cfg.Credentials, creds)
+	}
 
-		// do not consider fetchManagementIp errors as a failure, just log them
-		minorErr = fetchManagementIp(cfg)
-		if minorErr != nil {
-			logger.Error(minorErr.Error())
+	// a failing collector does not stop the others unless the device refused all the credentials
+	if authenticated {
+		for _, p := range planned[1:] {
+			result, err := internal.RunCollector(ctx, target, p)
+			if err != nil {
+				logger.Error(err.Error(), zap.String("collector", p.Collector.Name()))
+			}
+			results = append(results, result)
 		}
+	}
 
-		if fetchErr != nil {
-			cfg.Device.PollingSucceeded = 0
-		} else {
-			cfg.Device.PollingSucceeded = 1
-			cfg.Device.PolledAt = time.Now()
+	succeeded := false
+	for _, result := range results {
+		succeeded = succeeded || result.Succeeded
+		err = result.Save(cfg.Db)
+		if err != nil {
+			logger.Error(err.Error())
 		}
+	}
 
-		dbErr = cfg.Device.Save(cfg.Db)
+	if succeeded {
+		cfg.Device.PollingSucceeded = 1
+		cfg.Device.PolledAt = time.Now()
+	} else {
+		cfg.Device.PollingSucceeded = 0
+	}
 
-		if dbErr != nil {
-			logger.Error(dbErr.Error())
-		}
+	err = cfg.Device.SavePolled(cfg.Db)
+	if err != nil {
+		logger.Error(err.Error())
 	}
 }
 
-func backupScheduler(cfg *Config, db *database.DB, exportCH chan<- *BackupCFG) {
+func backupScheduler(cfg *Config, db *database.DB, secrets *internal.Secrets, jobs *internal.DeviceJobs, exportCH chan<- *BackupCFG) {
 	var d = &database.Device{}
 
 	logger.Info("starting backup task")
@@ -264,69 +481,86 @@ func backupScheduler(cfg *Config, db *database.DB, exportCH chan<- *BackupCFG) {
 		return
 	}
 	for _, device := range devices {
-		creds, err := device.GetCredentials(db)
+		started, since := jobs.Start(device.Id)
+		if !started {
+			logger.Warn("skipping device, the previous export is still running", zap.String("device", device.Address), zap.Time("since", since))
+			continue
+		}
+		chain, err := device.GetCredentialsChain(db)
 		if err != nil {
+			jobs.Finish(device.Id)
 			logger.Error(err.Error())
 			return
 		}
-		logger.Debug("authentication", zap.String("credentials", creds.Alias), zap.String("device", device.Address))
-		decryptedPw, encryptionErr := database.DecryptString(creds.EncryptedPassword, cfg.EncryptionKey)
-		if encryptionErr != nil {
-			logger.Error(encryptionErr.Error())
-			return
-		}
 		client := &internal.SshClient{
-			Host:     device.Address,
-			Port:     device.SshPort,
-			User:     creds.Username,
-			Password: decryptedPw,
+			Host:    device.Address,
+			Port:    device.SshPort,
+			Timeout: cfg.SshTimeout,
+		}
+		exportCH <- &BackupCFG{
+			Client:      client,
+			Db:          db,
+			Device:      device,
+			Credentials: chain,
+			Secrets:     secrets,
+			Jobs:        jobs,
 		}
-		exportCH <- &BackupCFG{Client: client, Db: db, Device: device}
 	}
 }
 
 func exportWorker(exportCH <-chan *BackupCFG) {
 	for cfg := range exportCH {
-		logger.Debug("creating backup", zap.String("address", cfg.Client.Host))
+		exportDevice(context.Background(), cfg)
+		cfg.Jobs.Finish(cfg.Device.Id)
+	}
+}
 
-		export, sshErr := cfg.Client.Run("/export show-sensitive")
-		if sshErr == nil {
-			output, err := s3.UploadExport(cfg.Device.Id, []byte(export))
-			if err != nil {
-				logger.Error(err.Error())
-			}
+// exportDevice stores the device export and checks it against the compliance policies, the SSH
+// session stops once the context is done.
+func exportDevice(ctx context.Context, cfg *BackupCFG) {
+	logger.Debug("creating backup", zap.String("address", cfg.Client.Host))
+
+	var export []byte
+	creds, sshErr := internal.TryCredentials(cfg.Credentials, cfg.Device.WorkingCredentialsID, cfg.Secrets, func(creds *database.Credentials, password string) error {
+		logger.Debug("authentication", zap.String("credentials", creds.Alias), zap.String("device", cfg.Device.Address))
+		cfg.Client.User = creds.Username
+		cfg.Client.Password = password
+		output, err := cfg.Client.RunContext(ctx, "/export show-sensitive")
+		export = output
+		return err
+	})
+	if sshErr != nil {
+		logger.Error(sshErr.Error())
+		return
+	}
+	rememberCredentials(cfg.Db, cfg.Device, cfg.Credentials, creds)
 
-			attrs, err := s3.GetExportAttributes(*output.Key)
-			if err != nil {
-				logger.Error(err.Error())
-			}
+	saved, err := internal.SaveExport(cfg.Db, s3, cfg.Device.Id, export)
+	if errors.Is(err, internal.ErrExportNotIndexed) {
+		// the export is stored, it is still checked for compliance
+		logger.Warn(err.Error(), zap.String("device", cfg.Device.Address))
+	} else if err != nil {
+		logger.Error(err.Error())
+		return
+	}
 
-			export := &database.Export{
-				S3Key:        *output.Key,
-				LastModified: attrs.LastModified,
-				ETag:         *output.ETag,
-				Size:         attrs.Size,
-				DeviceId:     cfg.Device.Id,
-			}
-			err = export.Save(cfg.Db)
-			if err != nil {
-				logger.Error(err.Error())
-			}
+	logger.Info("created a new backup", zap.String("device", cfg.Device.Address), zap.String("s3 key", saved.S3Key))
 
-			logger.Info("created a new backup", zap.String("device", cfg.Device.Address), zap.String("s3 key", *output.Key))
-		} else {
-			logger.Error(sshErr.Error())
+	results, err := internal.CheckExportCompliance(cfg.Db, saved, export)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	for _, result := range results {
+		if !result.Passed {
+			logger.Warn("compliance policy violated", zap.String("device", cfg.Device.Address),
+				zap.String("policy", result.PolicyId), zap.Strings("violations", result.ViolationList()))
 		}
 	}
 }
 
 func rotateExports(db *database.DB) {
-	var (
-		err         error
-		export      *database.Export
-		exportsList []*database.Export
-		device      *database.Device
-	)
+	var err error
 
 	logger.Info("starting exports retention task")
 	err = policy.GetDefault(db)
@@ -334,58 +568,118 @@ func rotateExports(db *database.DB) {
 		logger.Error(err.Error())
 		return
 	}
-	devices, err := device.GetAllPreload(db)
+	plans, err := internal.PlanDevicesRetention(db, policy)
 	if err != nil {
 		logger.Error(err.Error())
 		return
 	}
-	for _, device := range devices {
-		exports, err := export.GetByDeviceId(db, device.Id)
-		if err != nil {
-			logger.Error(err.Error())
-			return
-		}
-		exportsList = append(exportsList, rotateHourlyExports(exports, policy.Hourly)...)
-		exportsList = append(exportsList, rotateDailyExports(exports, policy.Daily)...)
-		exportsList = append(exportsList, rotateWeeklyExports(exports, policy.Weekly)...)
-
-		for _, export := range exports {
-			if !exportInSlice(export, exportsList) {
-				logger.Debug("deleting export", zap.String("filename", export.S3Key))
-
-				err := s3.DeleteFile(export.S3Key)
-				if err != nil {
-					logger.Error(err.Error())
-				}
-
-				err = export.Delete(db)
-				if err != nil {
-					logger.Error(err.Error())
-				}
+	for _, plan := range plans {
+		for _, export := range plan.Remove {
+			logger.Debug("deleting export", zap.String("filename", export.S3Key))
+
+			err := s3.DeleteFile(export.S3Key)
+			if err != nil {
+				logger.Error(err.Error())
+			}
+
+			err = export.Delete(db)
+			if err != nil {
+				logger.Error(err.Error())
 			}
 		}
 	}
+}
 
-	// cleanup orphaned exports
-	allExports, err := export.GetAll(db)
+// rememberCredentials stores the credentials accepted by the device and warns if those are
+// fallback ones.
+func rememberCredentials(db *database.DB, device *database.Device, chain []*database.Credentials, creds *database.Credentials) {
+	event, err := internal.RememberCredentials(db, device, chain, creds)
+	if err != nil {
+		logger.Error(err.Error())
+	} else if event != nil {
+		logger.Warn(event.Message, zap.String("device", device.Id), zap.String("event", event.Type))
+	}
+}
+
+func reconcileExports(db *database.DB, fix bool) {
+	logger.Info("starting exports reconciliation task", zap.Bool("fix", fix))
+	mode := internal.ReconcileModeFlag
+	if fix {
+		mode = internal.ReconcileModeFix
+	}
+	report, err := internal.ReconcileExports(db, s3, mode)
 	if err != nil {
 		logger.Error(err.Error())
 		return
 	}
-	orphanExports := getNoDeviceExports(allExports)
-	for _, export := range orphanExports {
-		err := s3.DeleteFile(export.S3Key)
-		if err != nil {
-			logger.Error(err.Error())
-		}
 
-		err = export.Delete(db)
+	for _, device := range report.Devices {
+		logger.Warn(
+			"exports index drift",
+			zap.String("device", device.DeviceId),
+			zap.Int("not indexed", len(device.NotIndexed)),
+			zap.Int("vanished", len(device.Vanished)),
+		)
+	}
+	for _, prefix := range report.OrphanPrefixes {
+		logger.Warn("orphan exports prefix", zap.String("prefix", prefix))
+	}
+	for _, reportErr := range report.Errors {
+		logger.Error(reportErr)
+	}
+
+	// the imported exports and the ones whose indexing failed are indexed now
+	indexed, err := internal.IndexExports(db, s3)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+	if indexed > 0 {
+		logger.Info("indexed exports", zap.Int("count", indexed))
+	}
+}
+
+func purgeTrash(db *database.DB, retention time.Duration) {
+	var device *database.Device
+
+	logger.Info("starting device trash purge task")
+	trashed, err := device.GetAllTrashed(db)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+
+	for _, d := range internal.ExpiredTrash(trashed, retention, time.Now()) {
+		logger.Info("purging device", zap.String("device", d.Id), zap.Bool("archive exports", d.ArchiveExports))
+		err = internal.PurgeDevice(db, s3, d)
 		if err != nil {
 			logger.Error(err.Error())
 		}
 	}
 }
 
+func discoverDevices(db *database.DB, cfg *internal.DiscoveryConfig) {
+	logger.Info("starting network discovery task", zap.Strings("ranges", cfg.Ranges), zap.Bool("neighbors", cfg.Neighbors))
+	err := internal.Discover(db, cfg)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+func advanceRollouts(db *database.DB, upgrader *internal.Upgrader) {
+	logger.Debug("advancing upgrade rollouts")
+	err := internal.AdvanceRollouts(db, upgrader, logger)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+func pruneApiConnections(pool *internal.ApiPool) {
+	closed := pool.Prune()
+	if closed > 0 {
+		logger.Debug("closed idle API connections", zap.Int("count", closed))
+	}
+}
+
 func cleanupSessions(db *database.DB) {
 	var err error
 	var session *database.Session